@@ -0,0 +1,101 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package applog
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/czcorpus/cnc-gokit/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+func logRequest(t *testing.T, redactQueries bool, target string) string {
+	gin.SetMode(gin.TestMode)
+	var buff bytes.Buffer
+	origLogger := log.Logger
+	log.Logger = zerolog.New(&buff)
+	defer func() { log.Logger = origLogger }()
+
+	w := httptest.NewRecorder()
+	_, engine := gin.CreateTestContext(w)
+	engine.Use(AccessLogMiddleware(redactQueries))
+	engine.GET("/", func(ctx *gin.Context) {
+		logging.AddLogEvent(ctx, "args", map[string]any{"query": ctx.Query("query"), "maximumRecords": 10})
+		ctx.Status(http.StatusOK)
+	})
+	engine.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+	return buff.String()
+}
+
+func TestAccessLogKeepsQuery(t *testing.T) {
+	record := logRequest(t, false, "/?operation=searchRetrieve&query=secret")
+	assert.Contains(t, record, `"query":"secret"`)
+	assert.Contains(t, record, "query=secret")
+}
+
+func TestAccessLogRedactsQuery(t *testing.T) {
+	record := logRequest(t, true, "/?operation=searchRetrieve&query=secret")
+	assert.NotContains(t, record, "secret")
+	assert.Contains(t, record, `"query":"[redacted]"`)
+	assert.Contains(t, record, `"maximumRecords":10`)
+	assert.Contains(t, record, "operation=searchRetrieve")
+}
+
+func TestRedactPathWithoutQuery(t *testing.T) {
+	assert.Equal(t, "/", redactPath("/", ""))
+	assert.Equal(t, "/?operation=explain", redactPath("/", "operation=explain"))
+}
+
+func TestSetupValidatesValues(t *testing.T) {
+	origLogger := log.Logger
+	origLevel := zerolog.GlobalLevel()
+	defer func() {
+		log.Logger = origLogger
+		zerolog.SetGlobalLevel(origLevel)
+	}()
+	assert.Error(t, Setup("", "verbose", FormatJSON))
+	assert.Error(t, Setup("", "info", "xml"))
+	assert.NoError(t, Setup("", "", ""))
+	assert.Equal(t, zerolog.InfoLevel, zerolog.GlobalLevel())
+}
+
+func TestSetupJSONFile(t *testing.T) {
+	origLogger := log.Logger
+	origLevel := zerolog.GlobalLevel()
+	defer func() {
+		log.Logger = origLogger
+		zerolog.SetGlobalLevel(origLevel)
+	}()
+	path := filepath.Join(t.TempDir(), "app.log")
+	assert.NoError(t, Setup(path, "warning", ""))
+	log.Info().Msg("info record")
+	log.Warn().Msg("warning record")
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "info record")
+	assert.Contains(t, string(data), `"message":"warning record"`)
+}
@@ -0,0 +1,117 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package applog
+
+import (
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/czcorpus/cnc-gokit/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// RedactedValue replaces query content in logs
+	// when redaction is enabled
+	RedactedValue = "[redacted]"
+
+	// queryArgName is the name of the SRU argument containing
+	// the query and also the key under which handlers store it
+	// in the `args` log event
+	queryArgName = "query"
+
+	// logEventPrefix must match the prefix used by logging.AddLogEvent
+	logEventPrefix = "logEvent_"
+)
+
+// redactPath replaces the query argument value in a URL path
+// (including its raw query part).
+func redactPath(path string, rawQuery string) string {
+	if rawQuery == "" {
+		return path
+	}
+	args, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return path
+	}
+	if args.Has(queryArgName) {
+		args.Set(queryArgName, RedactedValue)
+	}
+	return path + "?" + args.Encode()
+}
+
+// redactEvent returns a log event value with query content
+// replaced by RedactedValue. The original value is not modified.
+func redactEvent(v any) any {
+	args, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+	if _, ok := args[queryArgName]; !ok {
+		return v
+	}
+	ans := make(map[string]any, len(args))
+	for k, item := range args {
+		ans[k] = item
+	}
+	ans[queryArgName] = RedactedValue
+	return ans
+}
+
+// AccessLogMiddleware logs each processed request. With redactQueries
+// disabled, it is the standard logging.GinMiddleware. Otherwise the
+// logged records are the same except for query content (both in the
+// URL and in the logged arguments) which is replaced by RedactedValue.
+func AccessLogMiddleware(redactQueries bool) gin.HandlerFunc {
+	if !redactQueries {
+		return logging.GinMiddleware()
+	}
+	return func(ctx *gin.Context) {
+		start := time.Now()
+		path := redactPath(ctx.Request.URL.Path, ctx.Request.URL.RawQuery)
+
+		ctx.Next()
+
+		var logEvent *zerolog.Event
+		if ctx.Writer.Status() >= 500 {
+			logEvent = log.Error()
+
+		} else {
+			logEvent = log.Info()
+		}
+		logEvent = logEvent.
+			Float64("latency", time.Since(start).Seconds()).
+			Str("clientIP", ctx.ClientIP()).
+			Str("method", ctx.Request.Method).
+			Int("status", ctx.Writer.Status()).
+			Str("errorMessage", ctx.Errors.ByType(gin.ErrorTypePrivate).String()).
+			Int("bodySize", ctx.Writer.Size()).
+			Str("path", path)
+
+		for k, v := range ctx.Keys {
+			if strings.HasPrefix(k, logEventPrefix) {
+				logEvent = logEvent.Any(k[len(logEventPrefix):], redactEvent(v))
+			}
+		}
+		logEvent.Send()
+	}
+}
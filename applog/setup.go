@@ -0,0 +1,107 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package applog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/czcorpus/cnc-gokit/logging"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Format specifies how log records are written
+type Format string
+
+const (
+	// FormatConsole produces human readable colored records
+	FormatConsole Format = "console"
+
+	// FormatJSON produces one JSON object per record, suitable
+	// for log collecting tools
+	FormatJSON Format = "json"
+
+	DfltLevel logging.LogLevel = "info"
+)
+
+var levelMapping = map[logging.LogLevel]zerolog.Level{
+	"debug":   zerolog.DebugLevel,
+	"info":    zerolog.InfoLevel,
+	"warning": zerolog.WarnLevel,
+	"warn":    zerolog.WarnLevel,
+	"error":   zerolog.ErrorLevel,
+}
+
+func (f Format) Validate() error {
+	if f != FormatConsole && f != FormatJSON {
+		return fmt.Errorf("invalid log format `%s` (supported: %s, %s)", f, FormatConsole, FormatJSON)
+	}
+	return nil
+}
+
+// DefaultFormat returns a format used in case none is configured.
+// To keep the original behavior, a log file is written in JSON while
+// the standard error output gets the console format.
+func DefaultFormat(path string) Format {
+	if path != "" {
+		return FormatJSON
+	}
+	return FormatConsole
+}
+
+// Setup configures the global logger. An empty level means `info`
+// and an empty format means the default one (see DefaultFormat).
+// The level also applies to debug records containing query arguments,
+// i.e. these are written only in the `debug` mode.
+func Setup(path string, level logging.LogLevel, format Format) error {
+	if level == "" {
+		level = DfltLevel
+	}
+	lev, ok := levelMapping[level]
+	if !ok {
+		return fmt.Errorf("invalid log level `%s`", level)
+	}
+	if format == "" {
+		format = DefaultFormat(path)
+	}
+	if err := format.Validate(); err != nil {
+		return err
+	}
+	var out io.Writer = os.Stderr
+	if path != "" {
+		logf, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file %s: %w", path, err)
+		}
+		out = logf
+	}
+	zerolog.SetGlobalLevel(lev)
+	if format == FormatConsole {
+		out = zerolog.ConsoleWriter{
+			Out:        out,
+			NoColor:    path != "",
+			TimeFormat: time.RFC3339,
+		}
+	}
+	log.Logger = zerolog.New(out).With().Timestamp().Logger()
+	return nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package auth provides pluggable checks deciding whether a client
+// can access resources with restricted availability.
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/gin-gonic/gin"
+)
+
+// Authenticator decides whether a request can access
+// a resource with restricted availability.
+type Authenticator interface {
+	IsAuthorized(ctx *gin.Context, resource *corpus.CorpusSetup) bool
+}
+
+// Conf configures access to restricted resources. In case
+// no method is configured, restricted resources are not accessible.
+type Conf struct {
+
+	// BearerTokens is a list of accepted tokens passed via
+	// the `Authorization: Bearer <token>` header
+	BearerTokens []string `json:"bearerTokens"`
+
+	// TrustedHeader is a name of a header set by a trusted
+	// proxy (e.g. Shibboleth SP passing `eppn`) for authenticated
+	// users. Any non-empty value means the user is authenticated.
+	TrustedHeader string `json:"trustedHeader"`
+}
+
+func (conf *Conf) Validate() error {
+	if conf == nil {
+		return nil
+	}
+	for _, token := range conf.BearerTokens {
+		if strings.TrimSpace(token) == "" {
+			return fmt.Errorf("auth.bearerTokens must not contain empty tokens")
+		}
+	}
+	return nil
+}
+
+// --------
+
+type denyAll struct{}
+
+func (da denyAll) IsAuthorized(ctx *gin.Context, resource *corpus.CorpusSetup) bool {
+	return false
+}
+
+// --------
+
+type bearerToken struct {
+	tokens []string
+}
+
+func (bt *bearerToken) IsAuthorized(ctx *gin.Context, resource *corpus.CorpusSetup) bool {
+	token, ok := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return false
+	}
+	for _, t := range bt.tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// --------
+
+type trustedHeader struct {
+	name string
+}
+
+func (th *trustedHeader) IsAuthorized(ctx *gin.Context, resource *corpus.CorpusSetup) bool {
+	return ctx.GetHeader(th.name) != ""
+}
+
+// --------
+
+// anyOf authorizes a request if at least one of the
+// authenticators authorizes it
+type anyOf []Authenticator
+
+func (ao anyOf) IsAuthorized(ctx *gin.Context, resource *corpus.CorpusSetup) bool {
+	for _, a := range ao {
+		if a.IsAuthorized(ctx, resource) {
+			return true
+		}
+	}
+	return false
+}
+
+// NewAuthenticator creates an authenticator based on
+// the configuration. In case nothing is configured, an
+// authenticator denying all the requests is returned.
+func NewAuthenticator(conf *Conf) Authenticator {
+	if conf == nil {
+		return denyAll{}
+	}
+	ans := make(anyOf, 0, 2)
+	if len(conf.BearerTokens) > 0 {
+		ans = append(ans, &bearerToken{tokens: conf.BearerTokens})
+	}
+	if conf.TrustedHeader != "" {
+		ans = append(ans, &trustedHeader{name: conf.TrustedHeader})
+	}
+	if len(ans) == 0 {
+		return denyAll{}
+	}
+	return ans
+}
@@ -0,0 +1,47 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestContext(headers map[string]string) *gin.Context {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/", nil)
+	for k, v := range headers {
+		ctx.Request.Header.Set(k, v)
+	}
+	return ctx
+}
+
+func TestAuthenticator(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	assert.False(t, NewAuthenticator(nil).IsAuthorized(newTestContext(nil), nil))
+
+	a := NewAuthenticator(&Conf{BearerTokens: []string{"secret"}, TrustedHeader: "eppn"})
+	assert.False(t, a.IsAuthorized(newTestContext(nil), nil))
+	assert.False(t, a.IsAuthorized(newTestContext(map[string]string{"Authorization": "Bearer foo"}), nil))
+	assert.True(t, a.IsAuthorized(newTestContext(map[string]string{"Authorization": "Bearer secret"}), nil))
+	assert.True(t, a.IsAuthorized(newTestContext(map[string]string{"eppn": "user@example.org"}), nil))
+}
@@ -0,0 +1,57 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package backlink
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	// RefVarPosition is a reference template variable
+	// containing the KWIC token position
+	RefVarPosition = "pos"
+
+	// RefVarSentence is a reference template variable containing
+	// a value identifying the sentence of the KWIC
+	RefVarSentence = "sentence"
+)
+
+var refTemplateVarPatt = regexp.MustCompile(`\{([A-Za-z0-9_.]+)\}`)
+
+// RefTemplateVars returns names of all the variables (in the `{name}`
+// form) used in a reference template (in the order of occurrence).
+func RefTemplateVars(tmpl string) []string {
+	matches := refTemplateVarPatt.FindAllStringSubmatch(tmpl, -1)
+	ans := make([]string, len(matches))
+	for i, m := range matches {
+		ans[i] = m[1]
+	}
+	return ans
+}
+
+// GenerateFromTemplate replaces variables in a reference template
+// by escaped values. Missing values are replaced by empty strings.
+func GenerateFromTemplate(tmpl string, vars map[string]string) string {
+	return refTemplateVarPatt.ReplaceAllStringFunc(tmpl, func(m string) string {
+		// note: QueryEscape encodes spaces as `+` which is not valid in paths
+		return strings.ReplaceAll(url.QueryEscape(vars[m[1:len(m)-1]]), "+", "%20")
+	})
+}
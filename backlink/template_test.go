@@ -0,0 +1,41 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package backlink
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefTemplateVars(t *testing.T) {
+	assert.Equal(t, []string{"doc.id", "sentence", "pos"}, RefTemplateVars("x/{doc.id}/{sentence}#{pos}"))
+	assert.Empty(t, RefTemplateVars("https://example.org/"))
+}
+
+func TestGenerateFromTemplate(t *testing.T) {
+	assert.Equal(
+		t,
+		"https://example.org/a%2Fb%20c?s=&p=10",
+		GenerateFromTemplate(
+			"https://example.org/{doc.id}?s={sentence}&p={pos}",
+			map[string]string{"doc.id": "a/b c", "pos": "10"},
+		),
+	)
+}
@@ -0,0 +1,270 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package client provides a client for consuming the MQuery-SRU
+// (or any other FCS/SRU) endpoint.
+package client
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Version12 Version = "1.2"
+	Version20 Version = "2.0"
+
+	dfltTimeout = 60 * time.Second
+)
+
+// Version is an SRU protocol version
+type Version string
+
+func (v Version) Validate() error {
+	if v == Version12 || v == Version20 {
+		return nil
+	}
+	return fmt.Errorf("unsupported SRU version %s", v)
+}
+
+// ScanOptions are optional arguments of the `scan` operation.
+// Zero values mean that the endpoint's defaults apply.
+type ScanOptions struct {
+	MaximumTerms     int
+	ResponsePosition int
+}
+
+// SearchRetrieveOptions are optional arguments of the `searchRetrieve`
+// operation. Zero values mean that the endpoint's defaults apply.
+type SearchRetrieveOptions struct {
+
+	// Context specifies PIDs of resources to search in
+	// (the `x-fcs-context` argument)
+	Context []string
+
+	// DataViews specifies requested data views (the `x-fcs-dataviews`
+	// argument), e.g. `adv` or `adv:lemma,pos`
+	DataViews []string
+
+	// StartRecord is a position (starting from 1) of the first
+	// returned record. To obtain a next page of results, use
+	// SearchRetrieveResponse.NextRecordPosition.
+	StartRecord int
+
+	MaximumRecords int
+
+	// HitCountOnly asks just for the number of hits without any records
+	// (i.e. `maximumRecords=0`). MaximumRecords is ignored in such case.
+	HitCountOnly bool
+
+	// QueryType specifies a query language (e.g. `fcs`). It is supported
+	// only by SRU 2.0; in SRU 1.2, queries are always in CQL.
+	QueryType string
+
+	// RecordSchema specifies a schema of returned records
+	// (e.g. `http://clarin.eu/fcs/resource`)
+	RecordSchema string
+
+	// ResourceStats enables (non-standard) per-resource statistics
+	// (see SearchRetrieveResponse.Resources)
+	ResourceStats bool
+
+	// RewritesAllowed allows the endpoint to rewrite the query
+	// (the `x-fcs-rewrites-allowed` argument). It is supported
+	// only by SRU 2.0.
+	RewritesAllowed bool
+}
+
+// Client is a client of an SRU endpoint. All the records
+// are requested with XML packing so they can be parsed
+// directly into the response types.
+type Client struct {
+	endpoint   *url.URL
+	version    Version
+	httpClient *http.Client
+}
+
+// Explain describes the endpoint including the FCS endpoint
+// description (list of resources, supported data views etc.).
+func (c *Client) Explain() (*ExplainResponse, error) {
+	args := c.baseArgs("explain")
+	args.Set("x-fcs-endpoint-description", "true")
+	var ans ExplainResponse
+	if err := c.fetch(args, &ans); err != nil {
+		return nil, err
+	}
+	if ans.Explain == nil && len(ans.Diagnostics) > 0 {
+		return nil, &DiagnosticsError{StatusCode: http.StatusOK, Diagnostics: ans.Diagnostics}
+	}
+	return &ans, nil
+}
+
+// Scan browses the index specified by the scan clause
+// (e.g. `fcs.resource = root`)
+func (c *Client) Scan(clause string, opts ScanOptions) (*ScanResponse, error) {
+	var ans ScanResponse
+	if err := c.fetch(c.scanArgs(clause, opts), &ans); err != nil {
+		return nil, err
+	}
+	if len(ans.Terms) == 0 && len(ans.Diagnostics) > 0 {
+		return nil, &DiagnosticsError{StatusCode: http.StatusOK, Diagnostics: ans.Diagnostics}
+	}
+	return &ans, nil
+}
+
+// SearchRetrieve searches for the query in the endpoint's resources.
+// In case the endpoint returns diagnostics without any records,
+// a DiagnosticsError is returned.
+func (c *Client) SearchRetrieve(query string, opts SearchRetrieveOptions) (*SearchRetrieveResponse, error) {
+	args, err := c.searchRetrieveArgs(query, opts)
+	if err != nil {
+		return nil, err
+	}
+	var ans SearchRetrieveResponse
+	if err := c.fetch(args, &ans); err != nil {
+		return nil, err
+	}
+	if len(ans.Records) == 0 && len(ans.Diagnostics) > 0 {
+		return nil, &DiagnosticsError{StatusCode: http.StatusOK, Diagnostics: ans.Diagnostics}
+	}
+	return &ans, nil
+}
+
+func (c *Client) baseArgs(operation string) url.Values {
+	args := c.endpoint.Query()
+	args.Set("operation", operation)
+	args.Set("version", string(c.version))
+	if c.version == Version12 {
+		args.Set("recordPacking", "xml")
+
+	} else {
+		args.Set("recordXMLEscaping", "xml")
+	}
+	return args
+}
+
+func (c *Client) scanArgs(clause string, opts ScanOptions) url.Values {
+	args := c.baseArgs("scan")
+	args.Set("scanClause", clause)
+	if opts.MaximumTerms > 0 {
+		args.Set("maximumTerms", strconv.Itoa(opts.MaximumTerms))
+	}
+	if opts.ResponsePosition > 0 {
+		args.Set("responsePosition", strconv.Itoa(opts.ResponsePosition))
+	}
+	return args
+}
+
+func (c *Client) searchRetrieveArgs(query string, opts SearchRetrieveOptions) (url.Values, error) {
+	args := c.baseArgs("searchRetrieve")
+	args.Set("query", query)
+	if len(opts.Context) > 0 {
+		args.Set("x-fcs-context", strings.Join(opts.Context, ","))
+	}
+	if len(opts.DataViews) > 0 {
+		args.Set("x-fcs-dataviews", strings.Join(opts.DataViews, ","))
+	}
+	if opts.StartRecord > 0 {
+		args.Set("startRecord", strconv.Itoa(opts.StartRecord))
+	}
+	if opts.HitCountOnly {
+		args.Set("maximumRecords", "0")
+
+	} else if opts.MaximumRecords > 0 {
+		args.Set("maximumRecords", strconv.Itoa(opts.MaximumRecords))
+	}
+	if opts.RecordSchema != "" {
+		args.Set("recordSchema", opts.RecordSchema)
+	}
+	if opts.ResourceStats {
+		args.Set("x-cnc-resource-stats", "true")
+	}
+	if opts.QueryType != "" {
+		if c.version == Version12 {
+			return args, fmt.Errorf("queryType is not supported in SRU %s", c.version)
+		}
+		args.Set("queryType", opts.QueryType)
+	}
+	if opts.RewritesAllowed {
+		if c.version == Version12 {
+			return args, fmt.Errorf("x-fcs-rewrites-allowed is not supported in SRU %s", c.version)
+		}
+		args.Set("x-fcs-rewrites-allowed", "true")
+	}
+	return args, nil
+}
+
+// fetch performs a request with the provided arguments and decodes
+// the response into `ans`. Diagnostics sent along with an error HTTP
+// status are returned as a DiagnosticsError.
+func (c *Client) fetch(args url.Values, ans any) error {
+	reqURL := *c.endpoint
+	reqURL.RawQuery = args.Encode()
+	resp, err := c.httpClient.Get(reqURL.String())
+	if err != nil {
+		return fmt.Errorf("failed to perform SRU request: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read SRU response: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		var diags struct {
+			Diagnostics []Diagnostic `xml:"diagnostics>diagnostic"`
+		}
+		if xml.Unmarshal(body, &diags) == nil && len(diags.Diagnostics) > 0 {
+			return &DiagnosticsError{StatusCode: resp.StatusCode, Diagnostics: diags.Diagnostics}
+		}
+		return fmt.Errorf("SRU request failed with status %d", resp.StatusCode)
+	}
+	if err := xml.Unmarshal(body, ans); err != nil {
+		return fmt.Errorf("failed to decode SRU response: %w", err)
+	}
+	return nil
+}
+
+// NewClient creates a new client for the SRU endpoint available
+// at the provided URL. In case httpClient is nil, a default client
+// with a reasonable timeout is used.
+func NewClient(endpoint string, version Version, httpClient *http.Client) (*Client, error) {
+	if err := version.Validate(); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SRU endpoint URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid SRU endpoint URL %s: unsupported scheme", endpoint)
+	}
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: dfltTimeout}
+	}
+	return &Client{
+		endpoint:   u,
+		version:    version,
+		httpClient: httpClient,
+	}, nil
+}
@@ -0,0 +1,222 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer creates a server responding with the recorded
+// response `file` and storing arguments of the last request
+func newTestServer(t *testing.T, status int, file string, args *url.Values) *httptest.Server {
+	data, err := os.ReadFile(filepath.Join("testdata", file))
+	assert.NoError(t, err)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*args = r.URL.Query()
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(status)
+		w.Write(data)
+	}))
+}
+
+func TestNewClientValidation(t *testing.T) {
+	_, err := NewClient("https://fcs.example.org/", "3.0", nil)
+	assert.Error(t, err)
+	_, err = NewClient("fcs.example.org", Version20, nil)
+	assert.Error(t, err)
+	_, err = NewClient("https://fcs.example.org/", Version12, nil)
+	assert.NoError(t, err)
+}
+
+func TestExplain(t *testing.T) {
+	var args url.Values
+	srv := newTestServer(t, http.StatusOK, "explain-2.0.xml", &args)
+	defer srv.Close()
+	c, err := NewClient(srv.URL, Version20, nil)
+	assert.NoError(t, err)
+
+	ans, err := c.Explain()
+	assert.NoError(t, err)
+	assert.Equal(t, "explain", args.Get("operation"))
+	assert.Equal(t, "2.0", args.Get("version"))
+	assert.Equal(t, "xml", args.Get("recordXMLEscaping"))
+	assert.Equal(t, "true", args.Get("x-fcs-endpoint-description"))
+
+	assert.Equal(t, "2.0", ans.Version)
+	assert.Equal(t, "fcs.example.org", ans.Explain.Host)
+	assert.Equal(t, []LocalizedString{{Lang: "en", Value: "Test endpoint"}}, ans.Explain.Titles)
+	v, ok := ans.Explain.Setting("maximumTerms")
+	assert.True(t, ok)
+	assert.Equal(t, "100", v)
+	v, ok = ans.Explain.Default("numberOfRecords")
+	assert.True(t, ok)
+	assert.Equal(t, "50", v)
+
+	assert.Len(t, ans.EndpointDescription.Capabilities, 2)
+	assert.Len(t, ans.EndpointDescription.SupportedDataViews, 2)
+	assert.Len(t, ans.EndpointDescription.Resources, 1)
+	res := ans.EndpointDescription.Resources[0]
+	assert.Equal(t, "http://hdl.handle.net/11234/1-0001", res.PID)
+	assert.Equal(t, []LocalizedString{{Lang: "en", Value: "SYN2020"}}, res.Titles)
+	assert.Equal(t, []string{"ces"}, res.Languages)
+	assert.Equal(t, []string{"hits", "adv"}, res.AvailableDataViews.Values())
+}
+
+func TestScanFailure(t *testing.T) {
+	var args url.Values
+	srv := newTestServer(t, http.StatusOK, "scan-1.2.xml", &args)
+	defer srv.Close()
+	c, err := NewClient(srv.URL, Version12, nil)
+	assert.NoError(t, err)
+
+	_, err = c.Scan("fcs.resource = root", ScanOptions{MaximumTerms: 200})
+	assert.Equal(t, "scan", args.Get("operation"))
+	assert.Equal(t, "1.2", args.Get("version"))
+	assert.Equal(t, "xml", args.Get("recordPacking"))
+	assert.Equal(t, "fcs.resource = root", args.Get("scanClause"))
+	assert.Equal(t, "200", args.Get("maximumTerms"))
+	assert.Empty(t, args.Get("responsePosition"))
+
+	var diagErr *DiagnosticsError
+	assert.True(t, errors.As(err, &diagErr))
+	assert.Len(t, diagErr.Diagnostics, 2)
+	assert.Equal(t, 6, diagErr.Diagnostics[0].Code())
+	assert.Equal(t, 16, diagErr.Diagnostics[1].Code())
+}
+
+func TestSearchRetrieve(t *testing.T) {
+	var args url.Values
+	srv := newTestServer(t, http.StatusOK, "searchRetrieve-2.0.xml", &args)
+	defer srv.Close()
+	c, err := NewClient(srv.URL, Version20, nil)
+	assert.NoError(t, err)
+
+	ans, err := c.SearchRetrieve("Havel", SearchRetrieveOptions{
+		Context:         []string{"http://hdl.handle.net/11234/1-0001", "foo"},
+		DataViews:       []string{"adv"},
+		StartRecord:     1,
+		MaximumRecords:  2,
+		QueryType:       "fcs",
+		ResourceStats:   true,
+		RewritesAllowed: true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "searchRetrieve", args.Get("operation"))
+	assert.Equal(t, "Havel", args.Get("query"))
+	assert.Equal(t, "http://hdl.handle.net/11234/1-0001,foo", args.Get("x-fcs-context"))
+	assert.Equal(t, "adv", args.Get("x-fcs-dataviews"))
+	assert.Equal(t, "1", args.Get("startRecord"))
+	assert.Equal(t, "2", args.Get("maximumRecords"))
+	assert.Equal(t, "fcs", args.Get("queryType"))
+	assert.Equal(t, "true", args.Get("x-cnc-resource-stats"))
+	assert.Equal(t, "true", args.Get("x-fcs-rewrites-allowed"))
+
+	assert.Equal(t, 152, ans.NumberOfRecords)
+	assert.True(t, ans.HasNext())
+	assert.Equal(t, 3, ans.NextRecordPosition)
+	assert.Len(t, ans.Diagnostics, 1)
+	assert.Equal(t, "maximumRecords", ans.Diagnostics[0].Details)
+	assert.Equal(t, []ResourceStats{{
+		PID:             "http://hdl.handle.net/11234/1-0001",
+		NumberOfRecords: 152,
+		ReturnedRecords: 2,
+		Truncated:       true,
+		CorpusSize:      121826797,
+		HitsPerMillion:  1.25,
+	}}, ans.Resources)
+
+	assert.Len(t, ans.Records, 2)
+	rec := ans.Records[1]
+	assert.Equal(t, 2, rec.Position)
+	assert.Equal(t, "http://hdl.handle.net/11234/1-0001", rec.Resource.PID)
+	assert.Equal(t, "https://kontext.example.org/view?q=Havel", rec.Resource.Fragment.Ref)
+	hits := rec.Resource.Fragment.HitsView()
+	assert.Equal(t, []string{"Havel"}, hits.Hits)
+	assert.Equal(t, "prezident Olga Havel řekl", hits.Text())
+	adv := rec.Resource.Fragment.AdvancedView()
+	assert.Len(t, adv.Segments, 2)
+	assert.Len(t, adv.Layers, 2)
+	assert.Equal(t, Span{Ref: "s2", Highlight: "h1", Value: "Havel"}, adv.Layers[0].Spans[1])
+}
+
+func TestSearchRetrieveV12(t *testing.T) {
+	var args url.Values
+	srv := newTestServer(t, http.StatusOK, "searchRetrieve-1.2.xml", &args)
+	defer srv.Close()
+	c, err := NewClient(srv.URL, Version12, nil)
+	assert.NoError(t, err)
+
+	_, err = c.SearchRetrieve("Havel", SearchRetrieveOptions{QueryType: "fcs"})
+	assert.Error(t, err)
+	_, err = c.SearchRetrieve("Havel", SearchRetrieveOptions{RewritesAllowed: true})
+	assert.Error(t, err)
+
+	ans, err := c.SearchRetrieve("Havel", SearchRetrieveOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "xml", args.Get("recordPacking"))
+	assert.Empty(t, args.Get("x-fcs-context"))
+	assert.Empty(t, args.Get("startRecord"))
+	assert.Equal(t, 1, ans.NumberOfRecords)
+	assert.False(t, ans.HasNext())
+	assert.Len(t, ans.Records, 1)
+	assert.Equal(t, "prezident Václav Havel řekl", ans.Records[0].Resource.Fragment.HitsView().Text())
+	assert.Nil(t, ans.Records[0].Resource.Fragment.AdvancedView())
+
+	_, err = c.SearchRetrieve("Havel", SearchRetrieveOptions{MaximumRecords: 10, HitCountOnly: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "0", args.Get("maximumRecords"))
+}
+
+func TestSearchRetrieveDiagnostics(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusBadRequest} {
+		var args url.Values
+		srv := newTestServer(t, status, "searchRetrieve-2.0-error.xml", &args)
+		c, err := NewClient(srv.URL, Version20, nil)
+		assert.NoError(t, err)
+
+		_, err = c.SearchRetrieve("Havel AND", SearchRetrieveOptions{})
+		var diagErr *DiagnosticsError
+		assert.True(t, errors.As(err, &diagErr))
+		assert.Equal(t, status, diagErr.StatusCode)
+		assert.Equal(t, 10, diagErr.Diagnostics[0].Code())
+		assert.Contains(t, err.Error(), "Invalid query syntax")
+		srv.Close()
+	}
+}
+
+func TestErrorStatusWithoutDiagnostics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	c, err := NewClient(srv.URL, Version20, nil)
+	assert.NoError(t, err)
+	_, err = c.Explain()
+	assert.Error(t, err)
+	var diagErr *DiagnosticsError
+	assert.False(t, errors.As(err, &diagErr))
+}
@@ -0,0 +1,71 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Diagnostic is a single SRU diagnostic as returned by the endpoint
+type Diagnostic struct {
+	URI     string `xml:"uri"`
+	Details string `xml:"details"`
+	Message string `xml:"message"`
+}
+
+// Code returns a numeric code of the diagnostic (the last
+// part of its URI, e.g. 10 for `info:srw/diagnostic/1/10`).
+// In case the code cannot be determined, 0 is returned.
+func (d Diagnostic) Code() int {
+	idx := strings.LastIndex(d.URI, "/")
+	if idx < 0 {
+		return 0
+	}
+	code, err := strconv.Atoi(d.URI[idx+1:])
+	if err != nil {
+		return 0
+	}
+	return code
+}
+
+func (d Diagnostic) String() string {
+	if d.Details != "" {
+		return fmt.Sprintf("%s (%s): %s", d.URI, d.Details, d.Message)
+	}
+	return fmt.Sprintf("%s: %s", d.URI, d.Message)
+}
+
+// DiagnosticsError is returned in case the endpoint was unable to
+// produce the requested data and described the problem using
+// diagnostics. Please note that SRU endpoints typically respond with
+// HTTP status 200 even in such case.
+type DiagnosticsError struct {
+	StatusCode  int
+	Diagnostics []Diagnostic
+}
+
+func (err *DiagnosticsError) Error() string {
+	items := make([]string, len(err.Diagnostics))
+	for i, d := range err.Diagnostics {
+		items[i] = d.String()
+	}
+	return fmt.Sprintf("SRU request failed: %s", strings.Join(items, "; "))
+}
@@ -0,0 +1,291 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package client
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// Please note that the types below match elements by their local
+// names only so they can be used for responses of both supported
+// SRU versions (which differ in namespaces).
+
+// --------------------- explain ---------------------
+
+// ExplainResponse is a parsed response of the `explain` operation
+type ExplainResponse struct {
+	Version             string               `xml:"version"`
+	Explain             *Explain             `xml:"record>recordData>explain"`
+	EndpointDescription *EndpointDescription `xml:"extraResponseData>EndpointDescription"`
+	Diagnostics         []Diagnostic         `xml:"diagnostics>diagnostic"`
+}
+
+// Explain contains the ZeeRex description of the endpoint
+type Explain struct {
+	Host         string            `xml:"serverInfo>host"`
+	Port         string            `xml:"serverInfo>port"`
+	Database     string            `xml:"serverInfo>database"`
+	Titles       []LocalizedString `xml:"databaseInfo>title"`
+	Descriptions []LocalizedString `xml:"databaseInfo>description"`
+	Defaults     []ConfigValue     `xml:"configInfo>default"`
+	Settings     []ConfigValue     `xml:"configInfo>setting"`
+}
+
+// Setting returns a value of the configInfo setting `typ`
+// (e.g. `maximumRecords`)
+func (e *Explain) Setting(typ string) (string, bool) {
+	for _, v := range e.Settings {
+		if v.Type == typ {
+			return v.Value, true
+		}
+	}
+	return "", false
+}
+
+// Default returns a value of the configInfo default `typ`
+// (e.g. `numberOfRecords`)
+func (e *Explain) Default(typ string) (string, bool) {
+	for _, v := range e.Defaults {
+		if v.Type == typ {
+			return v.Value, true
+		}
+	}
+	return "", false
+}
+
+type ConfigValue struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// LocalizedString is a text along with its language
+// (both `lang` and `xml:lang` attributes are recognized)
+type LocalizedString struct {
+	Lang  string `xml:"lang,attr"`
+	Value string `xml:",chardata"`
+}
+
+// EndpointDescription is the FCS endpoint description
+// (provided only if requested)
+type EndpointDescription struct {
+	Version            string              `xml:"version,attr"`
+	Capabilities       []string            `xml:"Capabilities>Capability"`
+	SupportedDataViews []SupportedDataView `xml:"SupportedDataViews>SupportedDataView"`
+	SupportedLayers    []SupportedLayer    `xml:"SupportedLayers>SupportedLayer"`
+	Resources          []ResourceInfo      `xml:"Resources>Resource"`
+}
+
+type SupportedDataView struct {
+	ID             string `xml:"id,attr"`
+	DeliveryPolicy string `xml:"delivery-policy,attr"`
+	MIMEType       string `xml:",chardata"`
+}
+
+type SupportedLayer struct {
+	ID        string `xml:"id,attr"`
+	Qualifier string `xml:"qualifier,attr"`
+	ResultID  string `xml:"result-id,attr"`
+	Type      string `xml:",chardata"`
+}
+
+// ResourceInfo describes a single searchable resource
+type ResourceInfo struct {
+	PID          string            `xml:"pid,attr"`
+	Titles       []LocalizedString `xml:"Title"`
+	Descriptions []LocalizedString `xml:"Description"`
+	LandingPage  string            `xml:"LandingPageURI"`
+	Languages    []string          `xml:"Languages>Language"`
+
+	// AvailableDataViews contains space separated IDs of data views
+	AvailableDataViews ValueRefs `xml:"AvailableDataViews"`
+
+	// AvailableLayers contains space separated IDs of layers
+	AvailableLayers ValueRefs `xml:"AvailableLayers"`
+
+	AvailabilityRestriction string `xml:"AvailabilityRestriction"`
+}
+
+type ValueRefs struct {
+	Ref string `xml:"ref,attr"`
+}
+
+// Values returns individual IDs stored in the `ref` attribute
+func (v ValueRefs) Values() []string {
+	return strings.Fields(v.Ref)
+}
+
+// --------------------- scan ---------------------
+
+// ScanResponse is a parsed response of the `scan` operation
+type ScanResponse struct {
+	Version     string       `xml:"version"`
+	Terms       []Term       `xml:"terms>term"`
+	Diagnostics []Diagnostic `xml:"diagnostics>diagnostic"`
+}
+
+type Term struct {
+	Value           string `xml:"value"`
+	NumberOfRecords int    `xml:"numberOfRecords"`
+	DisplayTerm     string `xml:"displayTerm"`
+}
+
+// --------------------- searchRetrieve ---------------------
+
+// SearchRetrieveResponse is a parsed response of the `searchRetrieve`
+// operation. Non-fatal diagnostics (e.g. a lowered `maximumRecords`)
+// are available in Diagnostics.
+type SearchRetrieveResponse struct {
+	Version            string       `xml:"version"`
+	NumberOfRecords    int          `xml:"numberOfRecords"`
+	ResultSetID        string       `xml:"resultSetId"`
+	Records            []Record     `xml:"records>record"`
+	NextRecordPosition int          `xml:"nextRecordPosition"`
+	Diagnostics        []Diagnostic `xml:"diagnostics>diagnostic"`
+
+	// Resources contains (non-standard) per-resource statistics
+	Resources []ResourceStats `xml:"extraResponseData>Resources>Resource"`
+}
+
+// HasNext tells whether there are more records
+// available (starting at NextRecordPosition)
+func (sr *SearchRetrieveResponse) HasNext() bool {
+	return sr.NextRecordPosition > 0
+}
+
+// ResourceStats describes results of a single resource
+type ResourceStats struct {
+	PID             string  `xml:"pid,attr"`
+	NumberOfRecords int     `xml:"numberOfRecords,attr"`
+	ReturnedRecords int     `xml:"returnedRecords,attr"`
+	Truncated       bool    `xml:"truncated,attr"`
+	CorpusSize      int64   `xml:"corpusSize,attr"`
+	HitsPerMillion  float64 `xml:"ipm,attr"`
+}
+
+// Record is a single search result. Based on the requested
+// record schema, either Resource or DC is set.
+type Record struct {
+	Schema   string    `xml:"recordSchema"`
+	Position int       `xml:"recordPosition"`
+	Resource *Resource `xml:"recordData>Resource"`
+	DC       *DCRecord `xml:"recordData>dc"`
+}
+
+// DCRecord is a Dublin Core summary of a record
+type DCRecord struct {
+	Titles      []string `xml:"title"`
+	Description string   `xml:"description"`
+	Identifier  string   `xml:"identifier"`
+	Source      string   `xml:"source"`
+	Languages   []string `xml:"language"`
+}
+
+// Resource is a search result within a resource (identified by its PID)
+type Resource struct {
+	PID      string   `xml:"pid,attr"`
+	Fragment Fragment `xml:"ResourceFragment"`
+}
+
+type Fragment struct {
+	Ref       string     `xml:"ref,attr"`
+	DataViews []DataView `xml:"DataView"`
+}
+
+// HitsView returns the basic (hits) data view of the fragment
+// or nil if not present
+func (f *Fragment) HitsView() *HitsResult {
+	for _, dv := range f.DataViews {
+		if dv.Hits != nil {
+			return dv.Hits
+		}
+	}
+	return nil
+}
+
+// AdvancedView returns the advanced data view of the fragment
+// or nil if not present
+func (f *Fragment) AdvancedView() *AdvancedResult {
+	for _, dv := range f.DataViews {
+		if dv.Advanced != nil {
+			return dv.Advanced
+		}
+	}
+	return nil
+}
+
+// DataView is a single data view of a fragment. Based on
+// the view type, either Hits or Advanced is set.
+type DataView struct {
+	Type     string          `xml:"type,attr"`
+	Hits     *HitsResult     `xml:"Result"`
+	Advanced *AdvancedResult `xml:"Advanced"`
+}
+
+// HitsResult is the basic (hits) data view
+type HitsResult struct {
+
+	// Raw contains the original content including
+	// the `Hit` elements
+	Raw string `xml:",innerxml"`
+
+	// Hits contains matching words
+	Hits []string `xml:"Hit"`
+}
+
+// Text returns the text of the result without any markup
+func (hr *HitsResult) Text() string {
+	var ans strings.Builder
+	dec := xml.NewDecoder(strings.NewReader("<r>" + hr.Raw + "</r>"))
+	dec.Strict = false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		if v, ok := tok.(xml.CharData); ok {
+			ans.Write(v)
+		}
+	}
+	return ans.String()
+}
+
+// AdvancedResult is the advanced data view
+type AdvancedResult struct {
+	Unit     string    `xml:"unit,attr"`
+	Segments []Segment `xml:"Segments>Segment"`
+	Layers   []Layer   `xml:"Layers>Layer"`
+}
+
+type Segment struct {
+	ID    string `xml:"id,attr"`
+	Start int    `xml:"start,attr"`
+	End   int    `xml:"end,attr"`
+}
+
+type Layer struct {
+	ID    string `xml:"id,attr"`
+	Spans []Span `xml:"Span"`
+}
+
+type Span struct {
+	Ref       string `xml:"ref,attr"`
+	Highlight string `xml:"highlight,attr"`
+	Value     string `xml:",chardata"`
+}
@@ -34,17 +34,21 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/czcorpus/cnc-gokit/logging"
 	"github.com/czcorpus/cnc-gokit/uniresp"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog/log"
 
+	"github.com/czcorpus/mquery-sru/applog"
+	"github.com/czcorpus/mquery-sru/auth"
 	"github.com/czcorpus/mquery-sru/cnf"
+	"github.com/czcorpus/mquery-sru/compression"
 	"github.com/czcorpus/mquery-sru/general"
 	"github.com/czcorpus/mquery-sru/handler"
 	"github.com/czcorpus/mquery-sru/handler/form"
 	"github.com/czcorpus/mquery-sru/monitoring"
+	"github.com/czcorpus/mquery-sru/ratelimit"
 	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/czcorpus/mquery-sru/tracing"
 	"github.com/czcorpus/mquery-sru/worker"
 )
 
@@ -67,6 +71,12 @@ func getEnv(name string) string {
 func init() {
 }
 
+func setupLogging(path string, conf *cnf.Conf) {
+	if err := applog.Setup(path, conf.LogLevel, conf.LogFormat); err != nil {
+		log.Fatal().Err(err).Msg("failed to set up logging")
+	}
+}
+
 func runApiServer(
 	conf *cnf.Conf,
 	syscallChan chan os.Signal,
@@ -88,16 +98,32 @@ func runApiServer(
 		}
 	}
 	engine.Use(gin.Recovery())
-	engine.Use(logging.GinMiddleware())
+	engine.Use(applog.AccessLogMiddleware(conf.LogRedactQueries))
+	engine.Use(tracing.Middleware())
+	if conf.Compression.IsEnabled() {
+		engine.Use(compression.Middleware(conf.Compression.MinSizeBytes))
+	}
 	engine.NoMethod(uniresp.NoMethodHandler)
 	engine.NoRoute(uniresp.NotFoundHandler)
 
-	FCSActions := handler.NewFCSHandler(conf.ServerInfo, conf.CorporaSetup, radapter)
-	engine.GET("/", FCSActions.FCSHandler)
-	engine.HEAD("/", FCSActions.FCSHandler)
+	FCSActions := handler.NewFCSHandler(
+		conf.ServerInfo,
+		conf.CorporaSetup,
+		radapter,
+		auth.NewAuthenticator(conf.Auth),
+		conf.Redis.SearchAnswerTimeout(),
+	)
+	fcsMiddlewares := make([]gin.HandlerFunc, 0, 2)
+	if conf.RateLimit.IsEnabled() {
+		fcsMiddlewares = append(
+			fcsMiddlewares, FCSActions.RateLimit(ratelimit.NewLimiter(conf.RateLimit)))
+	}
+	fcsMiddlewares = append(fcsMiddlewares, FCSActions.RequestTimeout(conf.RequestTimeout()))
+	engine.GET("/", append(fcsMiddlewares, FCSActions.FCSHandler)...)
+	engine.HEAD("/", append(fcsMiddlewares, FCSActions.FCSHandler)...)
 
 	viewHandler := handler.NewViewHandler(FCSActions, conf.AssetsURLPath)
-	engine.GET("/ui/view", viewHandler.Handle)
+	engine.GET("/ui/view", append(fcsMiddlewares, viewHandler.Handle)...)
 
 	engine.StaticFS(
 		"/ui/assets",
@@ -105,14 +131,20 @@ func runApiServer(
 	)
 
 	uIActions := form.NewFormHandler(
-		conf.ServerInfo, conf.CorporaSetup, conf.SourcesRootDir)
+		conf.ServerInfo, conf.CorporaSetup, conf.FormTemplatesDir)
 	engine.GET("/ui/form", uIActions.Handle)
 
 	logger := monitoring.NewWorkerJobLogger(conf.TimezoneLocation())
 	logger.GoRunTimelineWriter()
 
-	monitoringActions := monitoring.NewActions(logger, conf.TimezoneLocation())
+	monitoringActions := monitoring.NewActions(logger, conf.TimezoneLocation(), radapter)
 	engine.GET("/monitoring/workers-load", monitoringActions.WorkersLoad)
+	engine.GET("/monitoring/outstanding-queries", monitoringActions.OutstandingQueries)
+
+	healthActions := monitoring.NewHealthActions(
+		radapter, time.Duration(conf.Redis.WorkersGracePeriodSecs)*time.Second)
+	engine.GET("/healthz", healthActions.Healthz)
+	engine.GET("/readyz", healthActions.Readyz)
 
 	srv := &http.Server{
 		Handler:      engine,
@@ -144,7 +176,8 @@ func runWorker(conf *cnf.Conf, workerID string, radapter *rdb.Adapter, exitEvent
 	log.Info().Msg("Starting MQuery-SRU worker")
 	ch := radapter.Subscribe()
 	logger := monitoring.NewWorkerJobLogger(conf.TimezoneLocation())
-	w := worker.NewWorker(workerID, radapter, ch, exitEvent, logger)
+	w := worker.NewWorker(
+		workerID, radapter, ch, exitEvent, logger, conf.Redis.BlockingDequeueTimeout())
 	w.Listen()
 }
 
@@ -168,6 +201,7 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Usage:\n\t%s [options] server [config.json]\n\t", filepath.Base(os.Args[0]))
 		fmt.Fprintf(os.Stderr, "Usage:\n\t%s [options] worker [config.json]\n\t", filepath.Base(os.Args[0]))
 		fmt.Fprintf(os.Stderr, "Usage:\n\t%s translate [basic/advanced]\n\t", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "Usage:\n\t%s validate-config [config.json]\n\t", filepath.Base(os.Args[0]))
 		fmt.Fprintf(os.Stderr, "%s [options] version\n", filepath.Base(os.Args[0]))
 		flag.PrintDefaults()
 	}
@@ -196,16 +230,19 @@ func main() {
 		if conf.LogFile != "" {
 			wPath = filepath.Join(filepath.Dir(conf.LogFile), "worker.log")
 		}
-		logging.SetupLogging(wPath, conf.LogLevel)
+		setupLogging(wPath, conf)
 		log.Logger = log.Logger.With().Str("worker", getWorkerID()).Logger()
 
+	} else if action == "validate-config" {
+		os.Exit(validateConfig(conf))
+
 	} else if action == "test" {
 		cnf.ValidateAndDefaults(conf)
 		log.Info().Msg("config OK")
 		return
 
 	} else {
-		logging.SetupLogging(conf.LogFile, conf.LogLevel)
+		setupLogging(conf.LogFile, conf)
 	}
 	log.Info().Msg("MQuery-SRU initialization...")
 	cnf.ValidateAndDefaults(conf)
@@ -223,6 +260,9 @@ func main() {
 	}()
 
 	radapter := rdb.NewAdapter(conf.Redis)
+	log.Info().
+		Any("keys", conf.Redis.UsedKeys()).
+		Msg("using Redis keys and channels")
 
 	switch action {
 	case "server":
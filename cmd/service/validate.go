@@ -0,0 +1,53 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+
+	"github.com/czcorpus/mquery-sru/cnf"
+)
+
+// validateConfig performs a thorough check of the corpora
+// configuration (including the Manatee registry files) and
+// prints a per-resource report. It returns an exit code
+// for the process.
+func validateConfig(conf *cnf.Conf) int {
+	if conf.CorporaSetup == nil {
+		fmt.Println("missing configuration section `corpora`")
+		return 1
+	}
+	exitCode := 0
+	if err := conf.CorporaSetup.ValidateAndDefaults("corpora"); err != nil {
+		fmt.Printf("corpora: %s\n", err)
+		exitCode = 1
+	}
+	for _, report := range conf.CorporaSetup.CheckResources() {
+		if report.OK() {
+			fmt.Printf("%s: OK\n", report.ID)
+			continue
+		}
+		exitCode = 1
+		fmt.Printf("%s:\n", report.ID)
+		for _, problem := range report.Problems {
+			fmt.Printf("  - %s\n", problem)
+		}
+	}
+	return exitCode
+}
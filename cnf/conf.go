@@ -20,20 +20,28 @@ package cnf
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/bytedance/sonic"
+	"github.com/czcorpus/mquery-sru/applog"
+	"github.com/czcorpus/mquery-sru/auth"
+	"github.com/czcorpus/mquery-sru/compression"
 	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/ratelimit"
 	"github.com/czcorpus/mquery-sru/rdb"
 
+	"github.com/czcorpus/cnc-gokit/collections"
 	"github.com/czcorpus/cnc-gokit/logging"
 	"github.com/rs/zerolog/log"
 )
 
 const (
 	dfltServerWriteTimeoutSecs = 30
+	dfltRequestTimeoutMargin   = 5
 	dfltLanguage               = "en"
 	dfltMaxNumConcurrentJobs   = 4
 	dfltVertMaxNumErrors       = 100
@@ -41,6 +49,55 @@ const (
 	dfltTimeZone       = "Europe/Prague"
 	dfltSourcesRootDir = "."
 	dfltAssetsURLPath  = "/"
+
+	dfltOperation     = "explain"
+	dfltRecordPacking = "xml"
+
+	dfltStringRecordFieldSeparator = "\t"
+	dfltVersion                    = "2.0"
+	dfltStreamingMinRecords        = 200
+)
+
+var (
+	// SupportedVersions lists SRU versions handled by the server
+	SupportedVersions = []string{"1.2", "2.0"}
+
+	// supportedOperations lists operations which can be configured
+	// as the default one (i.e. the ones supported by all the handled
+	// SRU versions)
+	supportedOperations = []string{"explain", "scan", "searchRetrieve"}
+
+	// availableRecordPackings lists record packings (`recordXMLEscaping`
+	// in SRU 2.0) implemented by the server. By default, all of them
+	// are supported.
+	availableRecordPackings = []string{"xml", "string"}
+
+	// availableUnknownParamsPolicies lists policies for handling
+	// unknown request parameters (see ServerInfo.UnknownParamsPolicy)
+	availableUnknownParamsPolicies = []string{UnknownParamsPolicyStrict, UnknownParamsPolicyLenient}
+
+	// availableStringRecordFormats lists formats of records
+	// packed as strings (see ServerInfo.StringRecordFormat)
+	availableStringRecordFormats = []string{StringRecordFormatXML, StringRecordFormatTSV}
+)
+
+const (
+	// StringRecordFormatXML packs records as escaped XML fragments
+	// (as defined by the SRU specification)
+	StringRecordFormatXML = "xml"
+
+	// StringRecordFormatTSV packs records as plain text lines
+	// with tab (or other configured separator) separated fields
+	StringRecordFormatTSV = "tsv"
+)
+
+const (
+	// UnknownParamsPolicyStrict rejects requests with unknown
+	// parameters (as required by SRU/FCS)
+	UnknownParamsPolicyStrict = "strict"
+
+	// UnknownParamsPolicyLenient ignores unknown parameters
+	UnknownParamsPolicyLenient = "lenient"
 )
 
 type ServerInfo struct {
@@ -74,8 +131,82 @@ type ServerInfo struct {
 	// for different labels, descriptions etc.
 	PrimaryLanguage string `json:"primaryLanguage"`
 
+	// DefaultLanguage specifies a language used in case a single-language
+	// string is required (e.g. a resource title in a Dublin Core record)
+	// and it also goes first in multi-language lists in explain responses.
+	// In case a value is not available in the language, the first configured
+	// language (in alphabetical order) is used. Default is "en".
+	DefaultLanguage string `json:"defaultLanguage"`
+
 	// ExternalURLPath specifies an external path to the API on host
 	ExternalURLPath string `json:"externalUrlPath"`
+
+	// DefaultVersion specifies SRU version used in case a request
+	// does not specify it. Explain responses advertise it along
+	// with all the supported versions.
+	DefaultVersion string `json:"defaultVersion"`
+
+	// DefaultOperation specifies an operation performed in case
+	// a request neither specifies it nor it can be derived from
+	// other arguments (`query`, `scanClause`).
+	DefaultOperation string `json:"defaultOperation"`
+
+	// DefaultRecordPacking specifies record packing used in case
+	// a client does not specify it (`recordPacking` in SRU 1.2,
+	// `recordXMLEscaping` in SRU 2.0).
+	DefaultRecordPacking string `json:"defaultRecordPacking"`
+
+	// SupportedRecordPackings lists record packings clients can request
+	// (e.g. a deployment can disable the `string` packing which does
+	// not preserve record structure). Explain advertises exactly these.
+	SupportedRecordPackings []string `json:"supportedRecordPackings"`
+
+	// StringRecordFormat specifies the format of records packed
+	// as strings (`recordPacking=string` in SRU 1.2,
+	// `recordXMLEscaping=string` in SRU 2.0). By default (`xml`),
+	// records are sent as escaped XML. The `tsv` format produces plain
+	// text lines without any markup (see StringRecordFieldSeparator).
+	StringRecordFormat string `json:"stringRecordFormat"`
+
+	// StringRecordFieldSeparator separates fields of records
+	// in the `tsv` string record format. Default is a tab.
+	StringRecordFieldSeparator string `json:"stringRecordFieldSeparator"`
+
+	// UnknownParamsPolicy specifies how unknown request parameters
+	// are handled. The `strict` policy (default) rejects them with
+	// the "Unsupported parameter" diagnostic, the `lenient` one ignores
+	// them (e.g. tracking parameters added by clients).
+	UnknownParamsPolicy string `json:"unknownParamsPolicy"`
+
+	// IgnoredParamPrefixes lists prefixes (e.g. `utm_`) of unknown
+	// parameters which are ignored even with the `strict` policy
+	IgnoredParamPrefixes []string `json:"ignoredParamPrefixes"`
+
+	// LogIgnoredParams enables logging of ignored unknown parameters
+	LogIgnoredParams bool `json:"logIgnoredParams"`
+
+	// StreamingMinRecords specifies the number of requested records
+	// from which a searchRetrieve response is streamed to the client
+	// (i.e. records are written as they are created) instead of being
+	// rendered to memory first. Default is 200.
+	StreamingMinRecords int `json:"streamingMinRecords"`
+}
+
+// IgnoresParam tells whether an unknown request parameter
+// should be ignored (see UnknownParamsPolicy, IgnoredParamPrefixes)
+func (s *ServerInfo) IgnoresParam(name string) bool {
+	if s == nil {
+		return false
+	}
+	if s.UnknownParamsPolicy == UnknownParamsPolicyLenient {
+		return true
+	}
+	for _, prefix := range s.IgnoredParamPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *ServerInfo) Validate() error {
@@ -115,6 +246,113 @@ func (s *ServerInfo) Validate() error {
 		}
 	}
 
+	if s.DefaultLanguage == "" {
+		s.DefaultLanguage = dfltLanguage
+		log.Warn().
+			Str("value", s.DefaultLanguage).
+			Msg("serverInfo.defaultLanguage not set, using default")
+	}
+
+	if s.DefaultVersion == "" {
+		s.DefaultVersion = dfltVersion
+		log.Warn().
+			Str("value", s.DefaultVersion).
+			Msg("serverInfo.defaultVersion not set, using default")
+
+	} else if !collections.SliceContains(SupportedVersions, s.DefaultVersion) {
+		return fmt.Errorf(
+			"invalid `serverInfo.defaultVersion` %s (supported: %s)",
+			s.DefaultVersion, strings.Join(SupportedVersions, ", "))
+	}
+
+	if s.DefaultOperation == "" {
+		s.DefaultOperation = dfltOperation
+		log.Warn().
+			Str("value", s.DefaultOperation).
+			Msg("serverInfo.defaultOperation not set, using default")
+
+	} else if !collections.SliceContains(supportedOperations, s.DefaultOperation) {
+		return fmt.Errorf(
+			"invalid `serverInfo.defaultOperation` %s (supported: %s)",
+			s.DefaultOperation, strings.Join(supportedOperations, ", "))
+	}
+
+	if len(s.SupportedRecordPackings) == 0 {
+		s.SupportedRecordPackings = availableRecordPackings
+		log.Warn().
+			Strs("value", s.SupportedRecordPackings).
+			Msg("serverInfo.supportedRecordPackings not set, using default")
+
+	} else {
+		for _, packing := range s.SupportedRecordPackings {
+			if !collections.SliceContains(availableRecordPackings, packing) {
+				return fmt.Errorf(
+					"invalid `serverInfo.supportedRecordPackings` item %s (available: %s)",
+					packing, strings.Join(availableRecordPackings, ", "))
+			}
+		}
+	}
+
+	if s.DefaultRecordPacking == "" {
+		s.DefaultRecordPacking = dfltRecordPacking
+		if !collections.SliceContains(s.SupportedRecordPackings, dfltRecordPacking) {
+			s.DefaultRecordPacking = s.SupportedRecordPackings[0]
+		}
+		log.Warn().
+			Str("value", s.DefaultRecordPacking).
+			Msg("serverInfo.defaultRecordPacking not set, using default")
+
+	} else if !collections.SliceContains(s.SupportedRecordPackings, s.DefaultRecordPacking) {
+		return fmt.Errorf(
+			"invalid `serverInfo.defaultRecordPacking` %s (supported: %s)",
+			s.DefaultRecordPacking, strings.Join(s.SupportedRecordPackings, ", "))
+	}
+
+	if s.StringRecordFormat == "" {
+		s.StringRecordFormat = StringRecordFormatXML
+
+	} else if !collections.SliceContains(availableStringRecordFormats, s.StringRecordFormat) {
+		return fmt.Errorf(
+			"invalid `serverInfo.stringRecordFormat` %s (available: %s)",
+			s.StringRecordFormat, strings.Join(availableStringRecordFormats, ", "))
+	}
+	if s.StringRecordFormat == StringRecordFormatTSV {
+		if s.StringRecordFieldSeparator == "" {
+			s.StringRecordFieldSeparator = dfltStringRecordFieldSeparator
+			log.Warn().
+				Str("value", s.StringRecordFieldSeparator).
+				Msg("serverInfo.stringRecordFieldSeparator not set, using default")
+
+		} else if strings.ContainsAny(s.StringRecordFieldSeparator, " \r\n") {
+			// note: record fields (e.g. contexts) contain spaces
+			return errors.New("invalid `serverInfo.stringRecordFieldSeparator` (spaces and line breaks are not allowed)")
+		}
+	}
+
+	if s.UnknownParamsPolicy == "" {
+		s.UnknownParamsPolicy = UnknownParamsPolicyStrict
+
+	} else if !collections.SliceContains(availableUnknownParamsPolicies, s.UnknownParamsPolicy) {
+		return fmt.Errorf(
+			"invalid `serverInfo.unknownParamsPolicy` %s (available: %s)",
+			s.UnknownParamsPolicy, strings.Join(availableUnknownParamsPolicies, ", "))
+	}
+	for _, prefix := range s.IgnoredParamPrefixes {
+		if prefix == "" {
+			return errors.New("invalid `serverInfo.ignoredParamPrefixes` (empty prefix is not allowed)")
+		}
+	}
+
+	if s.StreamingMinRecords < 0 {
+		return errors.New("invalid `serverInfo.streamingMinRecords` (must not be negative)")
+
+	} else if s.StreamingMinRecords == 0 {
+		s.StreamingMinRecords = dfltStreamingMinRecords
+		log.Warn().
+			Int("value", s.StreamingMinRecords).
+			Msg("serverInfo.streamingMinRecords not set, using default")
+	}
+
 	return nil
 }
 
@@ -127,16 +365,36 @@ type Conf struct {
 	CorsAllowedOrigins     []string `json:"corsAllowedOrigins"`
 	TrustedProxies         []string `json:"trustedProxies"`
 
+	// RequestTimeoutSecs is a time limit for processing of a single
+	// FCS request. Once exceeded, the request is answered with HTTP 503
+	// and an SRU diagnostic. It must be longer than the Redis query
+	// timeout so worker timeouts are reported as such.
+	RequestTimeoutSecs int `json:"requestTimeoutSecs"`
+
 	// SourcesRootDir is mainly used to locate html/xml templates and other
 	// assets so we can refer them in a relative way inside the code
-	SourcesRootDir string               `json:"sourcesRootDir"`
-	AssetsURLPath  string               `json:"assetsURLPath"`
-	ServerInfo     *ServerInfo          `json:"serverInfo"`
-	CorporaSetup   *corpus.CorporaSetup `json:"corpora"`
-	Redis          *rdb.Conf            `json:"redis"`
-	LogFile        string               `json:"logFile"`
-	LogLevel       logging.LogLevel     `json:"logLevel"`
-	TimeZone       string               `json:"timeZone"`
+	SourcesRootDir string `json:"sourcesRootDir"`
+	AssetsURLPath  string `json:"assetsURLPath"`
+
+	// FormTemplatesDir is an optional directory with custom templates
+	// of the testing form. If empty, embedded templates are used.
+	FormTemplatesDir string `json:"formTemplatesDir"`
+
+	ServerInfo   *ServerInfo          `json:"serverInfo"`
+	CorporaSetup *corpus.CorporaSetup `json:"corpora"`
+	Redis        *rdb.Conf            `json:"redis"`
+	RateLimit    *ratelimit.Conf      `json:"rateLimit"`
+	Compression  *compression.Conf    `json:"compression"`
+	Auth         *auth.Conf           `json:"auth"`
+	LogFile      string               `json:"logFile"`
+	LogLevel     logging.LogLevel     `json:"logLevel"`
+	LogFormat    applog.Format        `json:"logFormat"`
+
+	// LogRedactQueries replaces query content in request logs
+	// so it is not stored in production logs. Queries are still
+	// written by debug records (i.e. only with `logLevel: debug`).
+	LogRedactQueries bool   `json:"logRedactQueries"`
+	TimeZone         string `json:"timeZone"`
 
 	srcPath string
 }
@@ -153,6 +411,12 @@ func (conf *Conf) TimezoneLocation() *time.Location {
 	return loc
 }
 
+// RequestTimeout returns the time limit for processing
+// of a single FCS request (see RequestTimeoutSecs)
+func (conf *Conf) RequestTimeout() time.Duration {
+	return time.Duration(conf.RequestTimeoutSecs) * time.Second
+}
+
 // GetSourcePath returns an absolute path of a file
 // the config was loaded from.
 func (conf *Conf) GetSourcePath() string {
@@ -181,6 +445,14 @@ func LoadConfig(path string) *Conf {
 	if err != nil {
 		log.Fatal().Err(err).Msg("Cannot load config")
 	}
+	overrides, err := ApplyEnvOverrides(&conf, os.LookupEnv)
+	if err != nil {
+		log.Fatal().Err(err).Msg("Cannot load config")
+	}
+	if len(overrides) > 0 {
+		// note: we do not log values as they may contain secrets
+		log.Info().Strs("variables", overrides).Msg("config values overridden by environment variables")
+	}
 	return &conf
 }
 
@@ -209,6 +481,57 @@ func ValidateAndDefaults(conf *Conf) {
 		log.Fatal().Err(err).Msg("invalid configuration")
 		return
 	}
+	answerTimeoutSecs := conf.Redis.QueryAnswerTimeoutSecs
+	if conf.Redis.SearchAnswerTimeoutSecs > answerTimeoutSecs {
+		answerTimeoutSecs = conf.Redis.SearchAnswerTimeoutSecs
+	}
+	if conf.RequestTimeoutSecs == 0 {
+		conf.RequestTimeoutSecs = answerTimeoutSecs + dfltRequestTimeoutMargin
+		log.Warn().
+			Int("value", conf.RequestTimeoutSecs).
+			Msg("requestTimeoutSecs not specified, using default (longest redis answer timeout + margin)")
+
+	} else if conf.RequestTimeoutSecs <= answerTimeoutSecs {
+		log.Fatal().Msgf(
+			"invalid configuration: requestTimeoutSecs (%d) must be longer than redis answer timeouts (%d)",
+			conf.RequestTimeoutSecs, answerTimeoutSecs)
+		return
+	}
+	if conf.ServerWriteTimeoutSecs <= conf.RequestTimeoutSecs {
+		log.Warn().
+			Int("serverWriteTimeoutSecs", conf.ServerWriteTimeoutSecs).
+			Int("requestTimeoutSecs", conf.RequestTimeoutSecs).
+			Msg("serverWriteTimeoutSecs should be longer than requestTimeoutSecs, otherwise timeouts cannot be reported to clients")
+	}
+	if err := conf.Auth.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("invalid configuration")
+		return
+	}
+	if err := conf.RateLimit.ValidateAndDefaults(); err != nil {
+		log.Fatal().Err(err).Msg("invalid configuration")
+		return
+	}
+	if err := conf.Compression.ValidateAndDefaults(); err != nil {
+		log.Fatal().Err(err).Msg("invalid configuration")
+		return
+	}
+	if conf.LogLevel == "" {
+		conf.LogLevel = applog.DfltLevel
+		log.Warn().
+			Str("logLevel", string(applog.DfltLevel)).
+			Msg("log level not specified, using default")
+
+	} else if !conf.LogLevel.IsValid() {
+		log.Fatal().Msgf("invalid configuration: invalid log level `%s`", conf.LogLevel)
+		return
+	}
+	if conf.LogFormat == "" {
+		conf.LogFormat = applog.DefaultFormat(conf.LogFile)
+
+	} else if err := conf.LogFormat.Validate(); err != nil {
+		log.Fatal().Err(err).Msg("invalid configuration")
+		return
+	}
 	if conf.TimeZone == "" {
 		log.Warn().
 			Str("timeZone", dfltTimeZone).
@@ -0,0 +1,78 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package cnf
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newValidServerInfo() *ServerInfo {
+	return &ServerInfo{
+		ServerHost:    "localhost",
+		ServerPort:    "8080",
+		Database:      "test",
+		DatabaseTitle: map[string]string{"en": "Test"},
+	}
+}
+
+func TestUnknownParamsPolicyValidation(t *testing.T) {
+	info := newValidServerInfo()
+	assert.NoError(t, info.Validate())
+	assert.Equal(t, UnknownParamsPolicyStrict, info.UnknownParamsPolicy)
+
+	info = newValidServerInfo()
+	info.UnknownParamsPolicy = "relaxed"
+	assert.Error(t, info.Validate())
+
+	info = newValidServerInfo()
+	info.IgnoredParamPrefixes = []string{"utm_", ""}
+	assert.Error(t, info.Validate())
+}
+
+func TestStreamingMinRecordsValidation(t *testing.T) {
+	info := newValidServerInfo()
+	assert.NoError(t, info.Validate())
+	assert.Equal(t, dfltStreamingMinRecords, info.StreamingMinRecords)
+
+	info = newValidServerInfo()
+	info.StreamingMinRecords = 10
+	assert.NoError(t, info.Validate())
+	assert.Equal(t, 10, info.StreamingMinRecords)
+
+	info = newValidServerInfo()
+	info.StreamingMinRecords = -1
+	assert.Error(t, info.Validate())
+}
+
+func TestIgnoresParam(t *testing.T) {
+	var info *ServerInfo
+	assert.False(t, info.IgnoresParam("utm_source"))
+
+	info = &ServerInfo{
+		UnknownParamsPolicy:  UnknownParamsPolicyStrict,
+		IgnoredParamPrefixes: []string{"utm_"},
+	}
+	assert.True(t, info.IgnoresParam("utm_source"))
+	assert.False(t, info.IgnoresParam("x-foo"))
+
+	info.UnknownParamsPolicy = UnknownParamsPolicyLenient
+	assert.True(t, info.IgnoresParam("x-foo"))
+}
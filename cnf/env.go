@@ -0,0 +1,172 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package cnf
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// EnvVarPrefix is a prefix of environment variables
+// overriding configuration values (see ApplyEnvOverrides)
+const EnvVarPrefix = "MQUERY"
+
+// EnvVarName creates a name of an environment variable overriding
+// a configuration value specified by its path of JSON keys
+// (e.g. `redis`, `host` => `MQUERY_REDIS_HOST`,
+// `redis`, `queryAnswerTimeoutSecs` => `MQUERY_REDIS_QUERY_ANSWER_TIMEOUT_SECS`).
+func EnvVarName(path ...string) string {
+	var ans strings.Builder
+	ans.WriteString(EnvVarPrefix)
+	for _, key := range path {
+		ans.WriteString("_")
+		runes := []rune(key)
+		for i, r := range runes {
+			if i > 0 && unicode.IsUpper(r) &&
+				(!unicode.IsUpper(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				ans.WriteString("_")
+			}
+			ans.WriteRune(unicode.ToUpper(r))
+		}
+	}
+	return ans.String()
+}
+
+// ApplyEnvOverrides replaces configuration values loaded from a config
+// file with values of respective environment variables (see EnvVarName).
+// Only scalar values (strings, numbers, booleans) and lists of strings
+// (comma separated) can be overridden. Sections missing in the config
+// file are created in case an environment variable refers to them.
+// The lookup function is typically os.LookupEnv. The function returns
+// names of applied variables.
+//
+// The precedence of values is: environment variable > config file > default.
+// As defaults are applied by ValidateAndDefaults, it must be called
+// after this function so also the overridden values are validated.
+func ApplyEnvOverrides(conf *Conf, lookup func(string) (string, bool)) ([]string, error) {
+	applied := make([]string, 0, 5)
+	if err := applyEnvOverrides(reflect.ValueOf(conf).Elem(), nil, lookup, &applied); err != nil {
+		return applied, err
+	}
+	return applied, nil
+}
+
+func applyEnvOverrides(
+	v reflect.Value,
+	path []string,
+	lookup func(string) (string, bool),
+	applied *[]string,
+) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		fieldPath := append(append([]string{}, path...), key)
+		fv := v.Field(i)
+
+		if fv.Kind() == reflect.Pointer && fv.Type().Elem().Kind() == reflect.Struct {
+			// we create a missing section and keep it only
+			// in case some of its values is overridden
+			sect := fv
+			if fv.IsNil() {
+				sect = reflect.New(fv.Type().Elem())
+			}
+			numApplied := len(*applied)
+			if err := applyEnvOverrides(sect.Elem(), fieldPath, lookup, applied); err != nil {
+				return err
+			}
+			if fv.IsNil() && len(*applied) > numApplied {
+				fv.Set(sect)
+			}
+			continue
+		}
+		if fv.Kind() == reflect.Struct {
+			if err := applyEnvOverrides(fv, fieldPath, lookup, applied); err != nil {
+				return err
+			}
+			continue
+		}
+
+		name := EnvVarName(fieldPath...)
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := setEnvValue(fv, value); err != nil {
+			return fmt.Errorf("invalid value of environment variable %s: %w", name, err)
+		}
+		*applied = append(*applied, name)
+	}
+	return nil
+}
+
+func setEnvValue(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		x, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(x)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		x, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(x)
+	case reflect.Float32, reflect.Float64:
+		x, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(x)
+	case reflect.Bool:
+		x, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(x)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		items := reflect.MakeSlice(v.Type(), 0, 5)
+		if value != "" {
+			for _, item := range strings.Split(value, ",") {
+				items = reflect.Append(
+					items, reflect.ValueOf(strings.TrimSpace(item)).Convert(v.Type().Elem()))
+			}
+		}
+		v.Set(items)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package cnf
+
+import (
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/stretchr/testify/assert"
+)
+
+func lookupIn(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+}
+
+func TestEnvVarName(t *testing.T) {
+	assert.Equal(t, "MQUERY_REDIS_HOST", EnvVarName("redis", "host"))
+	assert.Equal(
+		t,
+		"MQUERY_REDIS_QUERY_ANSWER_TIMEOUT_SECS",
+		EnvVarName("redis", "queryAnswerTimeoutSecs"),
+	)
+	assert.Equal(t, "MQUERY_ASSETS_URL_PATH", EnvVarName("assetsURLPath"))
+	assert.Equal(t, "MQUERY_REDIS_TLS_CA_CERT_FILE", EnvVarName("redis", "tls", "caCertFile"))
+	assert.Equal(t, "MQUERY_LISTEN_PORT", EnvVarName("listenPort"))
+}
+
+func TestApplyEnvOverrides(t *testing.T) {
+	conf := &Conf{
+		ListenPort: 8080,
+		LogLevel:   "info",
+		Redis:      &rdb.Conf{Host: "localhost", Port: 6379},
+	}
+	applied, err := ApplyEnvOverrides(conf, lookupIn(map[string]string{
+		"MQUERY_REDIS_HOST":                      "redis.example.com",
+		"MQUERY_REDIS_QUERY_ANSWER_TIMEOUT_SECS": "60",
+		"MQUERY_LOG_LEVEL":                       "debug",
+		"MQUERY_CORS_ALLOWED_ORIGINS":            "https://a.example.com, https://b.example.com",
+		"MQUERY_CORPORA_ALLOW_DEBUG_QUERY":       "true",
+		"UNRELATED":                              "foo",
+	}))
+	assert.NoError(t, err)
+	assert.ElementsMatch(
+		t,
+		[]string{
+			"MQUERY_REDIS_HOST",
+			"MQUERY_REDIS_QUERY_ANSWER_TIMEOUT_SECS",
+			"MQUERY_LOG_LEVEL",
+			"MQUERY_CORS_ALLOWED_ORIGINS",
+			"MQUERY_CORPORA_ALLOW_DEBUG_QUERY",
+		},
+		applied,
+	)
+	// env > file
+	assert.Equal(t, "redis.example.com", conf.Redis.Host)
+	assert.Equal(t, 60, conf.Redis.QueryAnswerTimeoutSecs)
+	assert.Equal(t, "debug", string(conf.LogLevel))
+	// file values are kept in case there is no variable
+	assert.Equal(t, 6379, conf.Redis.Port)
+	assert.Equal(t, 8080, conf.ListenPort)
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"}, conf.CorsAllowedOrigins)
+	// a missing section is created
+	if assert.NotNil(t, conf.CorporaSetup) {
+		assert.True(t, conf.CorporaSetup.AllowDebugQuery)
+	}
+	// sections not referred by any variable stay missing
+	assert.Nil(t, conf.Auth)
+	assert.Nil(t, conf.Redis.TLS)
+}
+
+func TestApplyEnvOverridesBeforeDefaults(t *testing.T) {
+	conf := &Conf{Redis: &rdb.Conf{Host: "localhost", DB: 1}}
+	_, err := ApplyEnvOverrides(conf, lookupIn(map[string]string{"MQUERY_REDIS_PORT": "6380"}))
+	assert.NoError(t, err)
+	assert.NoError(t, conf.Redis.Validate())
+	// env > default
+	assert.Equal(t, 6380, conf.Redis.Port)
+	// default applies in case neither file nor env specify the value
+	assert.Equal(t, "mquerysru", conf.Redis.ChannelQuery)
+
+	// overridden values are validated
+	conf = &Conf{Redis: &rdb.Conf{Host: "localhost", DB: 1}}
+	_, err = ApplyEnvOverrides(conf, lookupIn(map[string]string{"MQUERY_REDIS_PORT": "70000"}))
+	assert.NoError(t, err)
+	assert.Error(t, conf.Redis.Validate())
+}
+
+func TestApplyEnvOverridesInvalidValue(t *testing.T) {
+	conf := &Conf{}
+	_, err := ApplyEnvOverrides(conf, lookupIn(map[string]string{"MQUERY_LISTEN_PORT": "http"}))
+	assert.ErrorContains(t, err, "MQUERY_LISTEN_PORT")
+
+	_, err = ApplyEnvOverrides(conf, lookupIn(map[string]string{"MQUERY_SERVER_INFO_DATABASE_TITLE": "x"}))
+	assert.ErrorContains(t, err, "unsupported type")
+}
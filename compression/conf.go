@@ -0,0 +1,61 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package compression
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dfltMinSizeBytes = 1024
+)
+
+// Conf configures compression of HTTP responses. Responses are
+// compressed (using gzip or deflate, as accepted by a client) only
+// if they are at least `MinSizeBytes` long.
+type Conf struct {
+	Enabled bool `json:"enabled"`
+
+	// MinSizeBytes specifies the minimum size of a response body
+	// to be compressed. Smaller responses are sent as they are.
+	MinSizeBytes int `json:"minSizeBytes"`
+}
+
+// IsEnabled tells whether responses should be compressed
+func (conf *Conf) IsEnabled() bool {
+	return conf != nil && conf.Enabled
+}
+
+func (conf *Conf) ValidateAndDefaults() error {
+	if conf == nil {
+		return nil
+	}
+	if conf.MinSizeBytes < 0 {
+		return fmt.Errorf("compression.minSizeBytes must be a non-negative number")
+	}
+	if conf.Enabled && conf.MinSizeBytes == 0 {
+		conf.MinSizeBytes = dfltMinSizeBytes
+		log.Warn().
+			Int("value", conf.MinSizeBytes).
+			Msg("compression.minSizeBytes not specified, using default")
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package compression
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	EncodingGzip    = "gzip"
+	EncodingDeflate = "deflate"
+)
+
+// compressedFlusher is a compressing writer which supports
+// flushing of pending data (both gzip.Writer and zlib.Writer do)
+type compressedFlusher interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// acceptedEncoding selects the best supported content coding
+// based on the `Accept-Encoding` header value. Gzip is preferred
+// over deflate if both are equally acceptable. The `*` value applies
+// only to codings not listed explicitly (so e.g. `gzip;q=0, *` still
+// rejects gzip). An empty string means no supported encoding is accepted.
+func acceptedEncoding(header string) string {
+	qValues := make(map[string]float64)
+	for _, item := range strings.Split(header, ",") {
+		params := strings.Split(item, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			if v, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				var err error
+				q, err = strconv.ParseFloat(v, 64)
+				if err != nil {
+					q = 0
+				}
+			}
+		}
+		qValues[coding] = q
+	}
+	var ans string
+	var ansQ float64
+	for _, coding := range []string{EncodingGzip, EncodingDeflate} {
+		q, ok := qValues[coding]
+		if !ok {
+			q = qValues["*"]
+		}
+		if q > ansQ {
+			ans, ansQ = coding, q
+		}
+	}
+	return ans
+}
+
+// compressWriter buffers the beginning of a response body until
+// it is clear whether the response is large enough to be compressed.
+// Once decided, all the data are either compressed or passed
+// to the original writer as they are.
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding string
+	minSize  int
+	buf      []byte
+	decided  bool
+	enc      compressedFlusher
+}
+
+// canCompress tells whether the response is worth compressing
+// and whether it is allowed at all (e.g. a handler might have
+// encoded the data on its own)
+func (w *compressWriter) canCompress() bool {
+	status := w.ResponseWriter.Status()
+	return len(w.buf) >= w.minSize &&
+		w.Header().Get("Content-Encoding") == "" &&
+		status >= http.StatusOK &&
+		status != http.StatusNoContent &&
+		status != http.StatusNotModified
+}
+
+// start decides whether to compress the response, sets
+// the respective headers and writes the buffered data.
+func (w *compressWriter) start() error {
+	w.decided = true
+	if w.canCompress() {
+		header := w.Header()
+		// content type must be set explicitly as the standard
+		// sniffing would see compressed data
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", http.DetectContentType(w.buf))
+		}
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+		// the compressed entity is not byte-equal to the original one
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+		if w.encoding == EncodingGzip {
+			w.enc = gzip.NewWriter(w.ResponseWriter)
+
+		} else {
+			// note: HTTP "deflate" means the zlib format (RFC 1950),
+			// not a raw deflate stream
+			w.enc = zlib.NewWriter(w.ResponseWriter)
+		}
+	}
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	_, err := w.write(buf)
+	return err
+}
+
+func (w *compressWriter) write(p []byte) (int, error) {
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		return w.write(p)
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= w.minSize {
+		if err := w.start(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush sends all the pending data to the client. In case the writer
+// has not decided about compression yet, the decision is made based
+// on the data written so far.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if err := w.start(); err != nil {
+			log.Error().Err(err).Msg("failed to write response")
+			return
+		}
+	}
+	if w.enc != nil {
+		if err := w.enc.Flush(); err != nil {
+			log.Error().Err(err).Msg("failed to flush compressed response")
+			return
+		}
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Close writes all the remaining data (including possible
+// compression trailer)
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+	if w.enc != nil {
+		return w.enc.Close()
+	}
+	return nil
+}
+
+// Middleware returns a middleware compressing responses
+// of at least `minSize` bytes using an encoding accepted
+// by a client (gzip or deflate).
+func Middleware(minSize int) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Writer.Header().Add("Vary", "Accept-Encoding")
+		encoding := acceptedEncoding(ctx.GetHeader("Accept-Encoding"))
+		if encoding == "" {
+			ctx.Next()
+			return
+		}
+		origWriter := ctx.Writer
+		cw := &compressWriter{
+			ResponseWriter: origWriter,
+			encoding:       encoding,
+			minSize:        minSize,
+		}
+		ctx.Writer = cw
+		defer func() {
+			if err := cw.Close(); err != nil {
+				log.Error().Err(err).Msg("failed to finish compressed response")
+			}
+			ctx.Writer = origWriter
+		}()
+		ctx.Next()
+	}
+}
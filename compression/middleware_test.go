@@ -0,0 +1,135 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package compression
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const testPI = `<?xml-stylesheet type="text/xsl" href="/ui/assets/test.xslt"?>`
+
+func newTestEngine(body string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(Middleware(100))
+	engine.GET("/", func(ctx *gin.Context) {
+		ctx.Writer.Header().Set("Content-Type", "application/xml")
+		ctx.Writer.WriteHeader(http.StatusAccepted)
+		ctx.Writer.Write([]byte(body))
+	})
+	engine.GET("/stream", func(ctx *gin.Context) {
+		for i := 0; i < 3; i++ {
+			ctx.Writer.Write([]byte(body))
+			ctx.Writer.Flush()
+		}
+	})
+	return engine
+}
+
+func doRequest(engine *gin.Engine, path, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	rec := httptest.NewRecorder()
+	engine.ServeHTTP(rec, req)
+	return rec
+}
+
+func testBody() string {
+	return xml.Header + testPI + "<root>" + strings.Repeat("<item>foo</item>", 50) + "</root>"
+}
+
+func TestAcceptedEncoding(t *testing.T) {
+	assert.Equal(t, "", acceptedEncoding(""))
+	assert.Equal(t, "", acceptedEncoding("br, identity"))
+	assert.Equal(t, "gzip", acceptedEncoding("gzip, deflate, br"))
+	assert.Equal(t, "gzip", acceptedEncoding("deflate, gzip"))
+	assert.Equal(t, "deflate", acceptedEncoding("gzip;q=0.5, deflate"))
+	assert.Equal(t, "deflate", acceptedEncoding("GZIP;q=0, deflate"))
+	assert.Equal(t, "gzip", acceptedEncoding("*"))
+	assert.Equal(t, "", acceptedEncoding("gzip;q=0"))
+	assert.Equal(t, "deflate", acceptedEncoding("gzip;q=0, *"))
+	assert.Equal(t, "", acceptedEncoding("gzip;q=0, deflate;q=0, *"))
+	assert.Equal(t, "deflate", acceptedEncoding("*;q=0.5, deflate"))
+}
+
+func TestGzipCompression(t *testing.T) {
+	body := testBody()
+	rec := doRequest(newTestEngine(body), "/", "gzip, deflate")
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "application/xml", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+	assert.Less(t, rec.Body.Len(), len(body))
+	zr, err := gzip.NewReader(rec.Body)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(zr)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(data))
+}
+
+func TestDeflateCompression(t *testing.T) {
+	body := testBody()
+	rec := doRequest(newTestEngine(body), "/", "deflate")
+	assert.Equal(t, "deflate", rec.Header().Get("Content-Encoding"))
+	reader, err := zlib.NewReader(rec.Body)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(data))
+}
+
+func TestSmallResponseNotCompressed(t *testing.T) {
+	rec := doRequest(newTestEngine("<root/>"), "/", "gzip")
+	assert.Equal(t, http.StatusAccepted, rec.Code)
+	assert.Equal(t, "", rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "application/xml", rec.Header().Get("Content-Type"))
+	assert.Equal(t, "<root/>", rec.Body.String())
+}
+
+func TestNoAcceptEncoding(t *testing.T) {
+	body := testBody()
+	rec := doRequest(newTestEngine(body), "/", "")
+	assert.Equal(t, "", rec.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", rec.Header().Get("Vary"))
+	assert.Equal(t, body, rec.Body.String())
+}
+
+func TestFlushedResponse(t *testing.T) {
+	body := testBody()
+	rec := doRequest(newTestEngine(body), "/stream", "gzip")
+	assert.Equal(t, "gzip", rec.Header().Get("Content-Encoding"))
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/xml"))
+	zr, err := gzip.NewReader(rec.Body)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(zr)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat(body, 3), string(data))
+}
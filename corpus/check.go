@@ -0,0 +1,197 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package corpus
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/czcorpus/cnc-gokit/collections"
+)
+
+// ResourceReport contains all the problems found
+// in a configuration of a single resource
+type ResourceReport struct {
+	ID       string
+	Problems []string
+}
+
+func (r *ResourceReport) addProblem(msg string, args ...any) {
+	r.Problems = append(r.Problems, fmt.Sprintf(msg, args...))
+}
+
+func (r *ResourceReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// registryInfo contains names of positional attributes and structures
+// defined in a Manatee registry file
+type registryInfo struct {
+	posAttrs   *collections.Set[string]
+	structures *collections.Set[string]
+}
+
+// parseRegistry reads a Manatee registry file and extracts names
+// of positional attributes and structures. Attributes of structures
+// (i.e. the ones defined within a STRUCTURE block) are ignored.
+func parseRegistry(path string) (registryInfo, error) {
+	ans := registryInfo{
+		posAttrs:   collections.NewSet[string](),
+		structures: collections.NewSet[string](),
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return ans, err
+	}
+	defer f.Close()
+	var depth int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		items := strings.Fields(line)
+		if len(items) >= 2 {
+			name := strings.Trim(items[1], `"{`)
+			if items[0] == "ATTRIBUTE" && depth == 0 {
+				ans.posAttrs.Add(name)
+
+			} else if items[0] == "STRUCTURE" && depth == 0 {
+				ans.structures.Add(name)
+			}
+		}
+		depth += strings.Count(line, "{") - strings.Count(line, "}")
+	}
+	return ans, scanner.Err()
+}
+
+// CheckResources performs a thorough check of all the configured
+// resources including their registry files. Contrary to Validate,
+// all the problems are collected and reported (i.e. the check does
+// not stop on the first error).
+func (cs *CorporaSetup) CheckResources() []ResourceReport {
+	ans := make([]ResourceReport, 0, len(cs.Resources))
+	for _, res := range cs.Resources {
+		report := ResourceReport{ID: res.ID}
+		if err := res.Validate(fmt.Sprintf("corpora.resources[%s]", res.ID)); err != nil {
+			report.addProblem("%s", err)
+		}
+		var numBasicSearchAttrs int
+		for _, attr := range res.PosAttrs {
+			if attr.IsBasicSearchAttr {
+				numBasicSearchAttrs++
+			}
+		}
+		if numBasicSearchAttrs == 0 {
+			report.addProblem("no basic search attribute (isBasicSearchAttr) defined among posAttrs")
+		}
+		regPaths := res.RegistryPaths
+		if len(regPaths) == 0 {
+			regPaths = []string{cs.GetRegistryPath(res.ID)}
+		}
+		for _, regPath := range regPaths {
+			reg, err := parseRegistry(regPath)
+			if err != nil {
+				report.addProblem("registry file %s not readable: %s", regPath, err)
+				continue
+			}
+			report.Problems = append(report.Problems, res.registryProblems(reg)...)
+		}
+		ans = append(ans, report)
+	}
+	return ans
+}
+
+// registryProblems lists all the positional attributes and structures
+// referenced by the resource configuration which are not defined
+// in the provided registry
+func (cs *CorpusSetup) registryProblems(reg registryInfo) []string {
+	var report ResourceReport
+	for _, attr := range cs.PosAttrs {
+		if !reg.posAttrs.Contains(attr.Name) {
+			report.addProblem("positional attribute %s not found in registry", attr.Name)
+		}
+	}
+	if cs.DiacriticsFoldedAttr != "" && !reg.posAttrs.Contains(cs.DiacriticsFoldedAttr) {
+		report.addProblem(
+			"positional attribute %s (diacriticsFoldedAttr) not found in registry",
+			cs.DiacriticsFoldedAttr)
+	}
+	mappedStructs := [][2]string{
+		{"sentenceStruct", cs.StructureMapping.SentenceStruct},
+		{"utteranceStruct", cs.StructureMapping.UtteranceStruct},
+		{"paragraphStruct", cs.StructureMapping.ParagraphStruct},
+		{"turnStruct", cs.StructureMapping.TurnStruct},
+		{"textStruct", cs.StructureMapping.TextStruct},
+		{"sessionStruct", cs.StructureMapping.SessionStruct},
+		{"viewContextStruct", cs.ViewContextStruct},
+		{"segmentStruct", cs.SegmentStruct},
+	}
+	for _, item := range mappedStructs {
+		if item[1] != "" && !reg.structures.Contains(item[1]) {
+			report.addProblem("structure %s (%s) not found in registry", item[1], item[0])
+		}
+	}
+	for _, attr := range cs.RefStructAttrs {
+		if structName, _, ok := SplitStructAttr(attr); ok && !reg.structures.Contains(structName) {
+			report.addProblem("structure %s (refStructAttrs) not found in registry", structName)
+		}
+	}
+	if structName, _, ok := SplitStructAttr(cs.SentenceRefAttr); ok && !reg.structures.Contains(structName) {
+		report.addProblem("structure %s (sentenceRefAttr) not found in registry", structName)
+	}
+	for _, attr := range cs.MetadataAttrs {
+		if structName, _, ok := SplitStructAttr(attr); ok && !reg.structures.Contains(structName) {
+			report.addProblem("structure %s (metadataAttrs) not found in registry", structName)
+		}
+	}
+	return report.Problems
+}
+
+// validateRegistryReferences makes sure that positional attributes
+// and structures referenced by resources are defined in their registry
+// files so misconfigured resources are detected on startup rather than
+// when searched. Resources which are currently unavailable (i.e. there
+// is no readable registry file) are skipped as they are reported
+// by logResourcesAvailability.
+func (cs *CorporaSetup) validateRegistryReferences(confContext string) error {
+	for _, res := range cs.Resources {
+		shards, err := cs.ResolveShards(res.ID)
+		if err != nil {
+			continue
+		}
+		for _, shard := range shards {
+			reg, err := parseRegistry(shard.RegistryPath)
+			if err != nil {
+				return fmt.Errorf(
+					"failed to read registry %s of `%s.resources[%s]`: %w",
+					shard.RegistryPath, confContext, res.ID, err)
+			}
+			if problems := res.registryProblems(reg); len(problems) > 0 {
+				return fmt.Errorf(
+					"invalid `%s.resources[%s]`: %s (registry %s)",
+					confContext, res.ID, problems[0], shard.RegistryPath)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package corpus
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testRegistry = `NAME "Test corpus"
+PATH /var/lib/manatee/data/test
+ATTRIBUTE word
+ATTRIBUTE lemma {
+	LABEL "lemma"
+}
+STRUCTURE doc {
+	ATTRIBUTE title
+}
+STRUCTURE s
+`
+
+func TestCheckResources(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "test"), []byte(testRegistry), 0644))
+	setup := &CorporaSetup{
+		RegistryDir: dir,
+		Resources: SrchResources{
+			{
+				ID:          "test",
+				FullName:    map[string]string{"en": "Test"},
+				Description: map[string]string{"en": "Test"},
+				Languages:   []string{"ces"},
+				PosAttrs: []PosAttr{
+					{Name: "word", Layer: LayerTypeText, IsLayerDefault: true, IsBasicSearchAttr: true},
+					{Name: "title", Layer: LayerTypeLemma, IsLayerDefault: true},
+				},
+				StructureMapping: StructureMapping{SentenceStruct: "s", TextStruct: "text"},
+			},
+			{
+				ID: "missing",
+			},
+		},
+	}
+	reports := setup.CheckResources()
+	assert.Len(t, reports, 2)
+	assert.Equal(t, []string{
+		"positional attribute title not found in registry",
+		"structure text (textStruct) not found in registry",
+	}, reports[0].Problems)
+	assert.False(t, reports[1].OK())
+}
+
+func TestValidateRegistryReferences(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "test"), []byte(testRegistry), 0644))
+	newSetup := func() *CorporaSetup {
+		return &CorporaSetup{
+			RegistryDir: dir,
+			Resources: SrchResources{
+				{
+					ID: "test",
+					PosAttrs: []PosAttr{
+						{Name: "word", Layer: LayerTypeText, IsLayerDefault: true, IsBasicSearchAttr: true},
+						{Name: "lemma", Layer: LayerTypeLemma, IsLayerDefault: true},
+					},
+					StructureMapping:  StructureMapping{SentenceStruct: "s", TextStruct: "doc"},
+					ViewContextStruct: "s",
+					RefStructAttrs:    []string{"doc.title"},
+				},
+				{
+					// no registry => skipped
+					ID:       "unavailable",
+					PosAttrs: []PosAttr{{Name: "foo"}},
+				},
+			},
+		}
+	}
+	assert.NoError(t, newSetup().validateRegistryReferences("corpora"))
+
+	setup := newSetup()
+	setup.Resources[0].DiacriticsFoldedAttr = "word_folded"
+	assert.EqualError(
+		t,
+		setup.validateRegistryReferences("corpora"),
+		"invalid `corpora.resources[test]`: positional attribute word_folded (diacriticsFoldedAttr) "+
+			"not found in registry (registry "+filepath.Join(dir, "test")+")",
+	)
+
+	setup = newSetup()
+	setup.Resources[0].StructureMapping.ParagraphStruct = "p"
+	assert.ErrorContains(
+		t,
+		setup.validateRegistryReferences("corpora"),
+		"structure p (paragraphStruct) not found in registry",
+	)
+}
@@ -20,6 +20,7 @@ package conc
 
 import (
 	"html"
+	"net/url"
 	"regexp"
 	"strings"
 	"unicode/utf8"
@@ -31,6 +32,14 @@ import (
 
 const (
 	invalidParent = 1000000
+
+	// structAttrNone is a value Manatee provides for structural
+	// attributes in case a position is not within the structure
+	structAttrNone = "===NONE==="
+
+	// ContextEllipsis is a word of a token replacing the left
+	// and right context tokens removed by KWICLine.TruncateContext
+	ContextEllipsis = "…"
 )
 
 var (
@@ -39,15 +48,288 @@ var (
 
 type TokenSlice []*Token
 
+// JoinWords creates a plain text representation of the tokens
+// (formatted by `fmtToken`) with spaces between them. Tokens with
+// the `NoSpaceBefore` flag are attached to their predecessors.
+func (ts TokenSlice) JoinWords(fmtToken func(token *Token) string) string {
+	return ts.joinWords(func(token *Token, i int) string { return fmtToken(token) })
+}
+
+// joinWords is the same as JoinWords but `fmtToken` also
+// gets an index of the token
+func (ts TokenSlice) joinWords(fmtToken func(token *Token, i int) string) string {
+	var ans strings.Builder
+	for i, token := range ts {
+		if token.Word == "" {
+			continue
+		}
+		if ans.Len() > 0 && !token.NoSpaceBefore {
+			ans.WriteString(" ")
+		}
+		ans.WriteString(fmtToken(token, i))
+	}
+	return ans.String()
+}
+
+// KWICLine is a concordance line split into the left context,
+// the hit (KWIC) and the right context. In case of discontinuous
+// matches (e.g. `[word="A"] []* [word="B"]`), the KWIC contains
+// multiple hits (continuous sequences of strong tokens) separated
+// by non-strong tokens.
+type KWICLine struct {
+	Left  TokenSlice
+	KWIC  TokenSlice
+	Right TokenSlice
+}
+
+// Tokens returns all the tokens of the line in their original order
+func (kl KWICLine) Tokens() TokenSlice {
+	ans := make(TokenSlice, 0, len(kl.Left)+len(kl.KWIC)+len(kl.Right))
+	ans = append(ans, kl.Left...)
+	ans = append(ans, kl.KWIC...)
+	return append(ans, kl.Right...)
+}
+
+// IsKWIC tells whether the i-th token of the line (see Tokens)
+// is a part of a hit (i.e. non-strong tokens between hits
+// within the KWIC are not considered)
+func (kl KWICLine) IsKWIC(i int) bool {
+	return i >= len(kl.Left) && i < len(kl.Left)+len(kl.KWIC) && kl.KWIC[i-len(kl.Left)].Strong
+}
+
+// Hits returns all the hits (continuous sequences of strong
+// tokens) of the line in their original order
+func (kl KWICLine) Hits() []TokenSlice {
+	ans := make([]TokenSlice, 0, 1)
+	start := -1
+	for i, token := range kl.KWIC {
+		if token.Strong && start < 0 {
+			start = i
+
+		} else if !token.Strong && start >= 0 {
+			ans = append(ans, kl.KWIC[start:i])
+			start = -1
+		}
+	}
+	if start >= 0 {
+		ans = append(ans, kl.KWIC[start:])
+	}
+	return ans
+}
+
+// PackHits creates a plain text representation of the line
+// (see TokenSlice.PackText) with each hit surrounded by
+// `hitStart` and `hitEnd`.
+func (kl KWICLine) PackHits(hitStart, hitEnd string) string {
+	return kl.Tokens().PackText(
+		TextPackingOptions{KWICLeftDelimiter: hitStart, KWICRightDelimiter: hitEnd})
+}
+
+// JoinWords creates a plain text representation of the line
+// (see TokenSlice.JoinWords). The `fmtToken` function also
+// gets information whether the token is a part of the hit.
+func (kl KWICLine) JoinWords(fmtToken func(token *Token, isKWIC bool) string) string {
+	return kl.Tokens().joinWords(func(token *Token, i int) string {
+		return fmtToken(token, kl.IsKWIC(i))
+	})
+}
+
+// TruncateContext returns a copy of the line with the left and right
+// context limited to `maxTokens` tokens nearest to the hit. Removed
+// tokens are replaced by a single ContextEllipsis token on each truncated
+// side. Zero `maxTokens` means no limitation.
+func (kl KWICLine) TruncateContext(maxTokens int) KWICLine {
+	if maxTokens <= 0 {
+		return kl
+	}
+	if len(kl.Left) > maxTokens {
+		left := make(TokenSlice, 0, maxTokens+1)
+		left = append(left, &Token{Word: ContextEllipsis})
+		kl.Left = append(left, kl.Left[len(kl.Left)-maxTokens:]...)
+	}
+	if len(kl.Right) > maxTokens {
+		right := make(TokenSlice, 0, maxTokens+1)
+		right = append(right, kl.Right[:maxTokens]...)
+		kl.Right = append(right, &Token{Word: ContextEllipsis})
+	}
+	return kl
+}
+
+// NewKWICLine splits tokens of a concordance line into the left
+// context, the hit and the right context. The hit spans from the first
+// to the last strong token (i.e. it can contain multiple separated hits,
+// see KWICLine.Hits). In case there are no strong tokens, all
+// the tokens are considered to be the left context.
+func NewKWICLine(tokens TokenSlice) KWICLine {
+	first, last := -1, -1
+	for i, token := range tokens {
+		if token.Strong {
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+	if first < 0 {
+		return KWICLine{Left: tokens}
+	}
+	return KWICLine{
+		Left:  tokens[:first],
+		KWIC:  tokens[first : last+1],
+		Right: tokens[last+1:],
+	}
+}
+
+// TextPackingOptions specify how a concordance line is packed
+// into a single string (see TokenSlice.PackText)
+type TextPackingOptions struct {
+
+	// KWICLeftDelimiter is inserted before each hit
+	KWICLeftDelimiter string
+
+	// KWICRightDelimiter is inserted after each hit
+	KWICRightDelimiter string
+
+	// SegmentMarker replaces the space before tokens starting
+	// a new segment (see Token.SegmentStart)
+	SegmentMarker string
+}
+
+// PackText creates a plain text representation of the tokens
+// (like JoinWords) with each hit (i.e. a continuous sequence of strong
+// tokens) surrounded by the configured delimiters and with segment markers inserted
+// at segment boundaries.
+func (ts TokenSlice) PackText(opts TextPackingOptions) string {
+	var ans strings.Builder
+	var inKWIC, segmentStart bool
+	for _, token := range ts {
+		// empty tokens are not rendered but they still
+		// end hits and start segments (see KWICLine.Hits)
+		if inKWIC && !token.Strong {
+			ans.WriteString(opts.KWICRightDelimiter)
+			inKWIC = false
+		}
+		segmentStart = segmentStart || token.SegmentStart
+		if token.Word == "" {
+			continue
+		}
+		if ans.Len() > 0 {
+			if segmentStart && opts.SegmentMarker != "" {
+				ans.WriteString(opts.SegmentMarker)
+
+			} else if !token.NoSpaceBefore {
+				ans.WriteString(" ")
+			}
+		}
+		if !inKWIC && token.Strong {
+			ans.WriteString(opts.KWICLeftDelimiter)
+			inKWIC = true
+		}
+		ans.WriteString(token.Word)
+		segmentStart = false
+	}
+	if inKWIC {
+		ans.WriteString(opts.KWICRightDelimiter)
+	}
+	return ans.String()
+}
+
+// TextSpan is a range of characters [Start, End) within a text
+type TextSpan struct {
+	Start int
+	End   int
+}
+
+// TextWithHitOffsets creates a plain (i.e. not HTML-escaped) text
+// representation of the tokens (see JoinWords) along with character
+// offsets of hits (i.e. continuous sequences of strong tokens) within
+// the text. Offsets are counted in Unicode characters starting from zero.
+func (ts TokenSlice) TextWithHitOffsets() (string, []TextSpan) {
+	var ans strings.Builder
+	spans := make([]TextSpan, 0, 1)
+	var pos int
+	var inHit bool
+	for _, token := range ts {
+		// empty tokens are not rendered but they still end hits
+		if inHit && !token.Strong {
+			spans[len(spans)-1].End = pos
+			inHit = false
+		}
+		if token.Word == "" {
+			continue
+		}
+		if ans.Len() > 0 && !token.NoSpaceBefore {
+			ans.WriteString(" ")
+			pos++
+		}
+		if !inHit && token.Strong {
+			spans = append(spans, TextSpan{Start: pos})
+			inHit = true
+		}
+		word := html.UnescapeString(token.Word)
+		ans.WriteString(word)
+		pos += utf8.RuneCountInString(word)
+	}
+	if inHit {
+		spans[len(spans)-1].End = pos
+	}
+	return ans.String(), spans
+}
+
 type Token struct {
 	Word   string            `json:"word"`
 	Strong bool              `json:"strong"`
 	Attrs  map[string]string `json:"attrs"`
+
+	// NoSpaceBefore specifies that the token should be attached
+	// to the previous one when rendering text (e.g. a comma)
+	NoSpaceBefore bool `json:"noSpaceBefore"`
+
+	// SegmentStart specifies that the token starts a new segment
+	// (an occurrence of the configured segment structure, e.g. a sentence)
+	SegmentStart bool `json:"segmentStart,omitempty"`
+}
+
+// isClosingPunct tests for tokens which are typically written
+// without a space before them. Note that words are already
+// HTML-escaped here.
+func isClosingPunct(word string) bool {
+	switch word {
+	case ",", ".", ";", ":", "!", "?", ")", "]", "}", "…", "%", "...":
+		return true
+	}
+	return false
+}
+
+// isOpeningPunct tests for tokens which are typically written
+// without a space after them.
+func isOpeningPunct(word string) bool {
+	switch word {
+	case "(", "[", "{":
+		return true
+	}
+	return false
 }
 
 type ConcordanceLine struct {
 	Text TokenSlice `json:"text"`
 	Ref  string     `json:"ref"`
+
+	// StructAttrs contains values of requested structural
+	// attributes (e.g. `doc.id`) of the KWIC position
+	StructAttrs map[string]string `json:"structAttrs,omitempty"`
+}
+
+// StructAttr returns a value of a retrieved structural attribute
+// (see StructAttrs). For attributes which have not been retrieved
+// and for lines outside the respective structure, an empty string
+// is returned.
+func (cl ConcordanceLine) StructAttr(name string) string {
+	v := cl.StructAttrs[name]
+	if v == structAttrNone {
+		return ""
+	}
+	return v
 }
 
 type ConcExamples struct {
@@ -55,7 +337,8 @@ type ConcExamples struct {
 }
 
 type LineParser struct {
-	attrs []string
+	attrs       []string
+	structAttrs []string
 }
 
 func (lp *LineParser) parseTokenQuadruple(s []string) *Token {
@@ -114,24 +397,81 @@ func (lp *LineParser) normalizeTokens(tokens []string) []string {
 	return ans
 }
 
-// parseRawLine
+// parseRefs parses line references as produced by mango (i.e. a KWIC
+// position followed by comma-separated structural attribute values
+// with commas, whitespace and '%' percent-encoded).
+func (lp *LineParser) parseRefs(rawRefs string) (string, map[string]string) {
+	if len(lp.structAttrs) == 0 {
+		return rawRefs, nil
+	}
+	items := strings.Split(rawRefs, ",")
+	if len(items)-1 != len(lp.structAttrs) {
+		log.Warn().
+			Str("value", rawRefs).
+			Int("expectedNumAttrs", len(lp.structAttrs)).
+			Msg("cannot parse line references")
+		return items[0], nil
+	}
+	structAttrs := make(map[string]string)
+	for i, attr := range lp.structAttrs {
+		v, err := url.PathUnescape(html.UnescapeString(items[i+1]))
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Str("value", items[i+1]).
+				Msg("cannot decode structural attribute value")
+			v = items[i+1]
+		}
+		structAttrs[attr] = v
+	}
+	return items[0], structAttrs
+}
+
+// removeSegmentMarkers removes segment markers (see `mango.SegmentMarker`)
+// from the items and returns indices of tokens (i.e. item quadruples)
+// which start a new segment.
+func (lp *LineParser) removeSegmentMarkers(items []string) ([]string, map[int]bool) {
+	ans := make([]string, 0, len(items))
+	segStarts := make(map[int]bool)
+	for _, item := range items {
+		if item == mango.SegmentMarker {
+			segStarts[len(ans)/4] = true
+			continue
+		}
+		ans = append(ans, item)
+	}
+	return ans, segStarts
+}
+
 func (lp *LineParser) parseRawLine(line string) ConcordanceLine {
 	rtokens := splitPatt.Split(html.EscapeString(line), -1)
-	items := lp.normalizeTokens(rtokens[1:])
+	items, segStarts := lp.removeSegmentMarkers(lp.normalizeTokens(rtokens[1:]))
 	if len(items)%4 != 0 {
 		log.Error().
 			Str("origLine", line).
 			Msg("unparseable Manatee KWIC line")
+		ref, structAttrs := lp.parseRefs(rtokens[0])
 		return ConcordanceLine{
-			Text: []*Token{{Word: "---- ERROR (unparseable) ----"}},
-			Ref:  rtokens[0],
+			Text:        []*Token{{Word: "---- ERROR (unparseable) ----"}},
+			Ref:         ref,
+			StructAttrs: structAttrs,
 		}
 	}
 	tokens := make(TokenSlice, 0, len(items)/4)
+	var prevWord string // empty words are not rendered (see JoinWords)
 	for i := 0; i < len(items); i += 4 {
-		tokens = append(tokens, lp.parseTokenQuadruple(items[i:i+4]))
+		token := lp.parseTokenQuadruple(items[i : i+4])
+		if prevWord != "" {
+			token.NoSpaceBefore = isClosingPunct(token.Word) || isOpeningPunct(prevWord)
+		}
+		token.SegmentStart = segStarts[i/4]
+		if token.Word != "" {
+			prevWord = token.Word
+		}
+		tokens = append(tokens, token)
 	}
-	return ConcordanceLine{Text: tokens, Ref: rtokens[0]}
+	ref, structAttrs := lp.parseRefs(rtokens[0])
+	return ConcordanceLine{Text: tokens, Ref: ref, StructAttrs: structAttrs}
 }
 
 // Parse converts Manatee-encoded concordance lines into MQuery format.
@@ -144,8 +484,9 @@ func (lp *LineParser) Parse(data mango.GoConcExamples) []ConcordanceLine {
 	return pLines
 }
 
-func NewLineParser(attrs []string) *LineParser {
+func NewLineParser(attrs []string, structAttrs []string) *LineParser {
 	return &LineParser{
-		attrs: attrs,
+		attrs:       attrs,
+		structAttrs: structAttrs,
 	}
 }
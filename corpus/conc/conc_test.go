@@ -0,0 +1,326 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package conc
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLineWithStructAttrs(t *testing.T) {
+	parser := NewLineParser([]string{"word", "lemma"}, []string{"doc.id", "doc.title"})
+	lines := parser.Parse(mango.GoConcExamples{
+		Lines: []string{"#123,d1,A%20Big%20%25%20Title the {} /the strc dog {} /dog strc"},
+	})
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, "#123", lines[0].Ref)
+		assert.Equal(t, map[string]string{"doc.id": "d1", "doc.title": "A Big % Title"}, lines[0].StructAttrs)
+		assert.Len(t, lines[0].Text, 2)
+	}
+}
+
+func TestParseLineWithCommaInStructAttr(t *testing.T) {
+	parser := NewLineParser([]string{"word", "lemma"}, []string{"doc.id", "doc.title"})
+	lines := parser.Parse(mango.GoConcExamples{
+		Lines: []string{"#123,d1,Dogs%2C%20Cats the {} /the strc"},
+	})
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, "#123", lines[0].Ref)
+		assert.Equal(t, map[string]string{"doc.id": "d1", "doc.title": "Dogs, Cats"}, lines[0].StructAttrs)
+	}
+}
+
+func TestParseLineWithoutStructAttrs(t *testing.T) {
+	parser := NewLineParser([]string{"word", "lemma"}, nil)
+	lines := parser.Parse(mango.GoConcExamples{
+		Lines: []string{"#123 the {} /the strc"},
+	})
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, "#123", lines[0].Ref)
+		assert.Nil(t, lines[0].StructAttrs)
+	}
+}
+
+func TestParseLineWithMismatchingStructAttrs(t *testing.T) {
+	parser := NewLineParser([]string{"word", "lemma"}, []string{"doc.id", "doc.title"})
+	lines := parser.Parse(mango.GoConcExamples{
+		Lines: []string{"#123,d1,x,y the {} /the strc"},
+	})
+	if assert.Len(t, lines, 1) {
+		assert.Equal(t, "#123", lines[0].Ref)
+		assert.Nil(t, lines[0].StructAttrs)
+	}
+}
+
+func TestParseLineWithSegmentMarkers(t *testing.T) {
+	parser := NewLineParser([]string{"word", "lemma"}, nil)
+	lines := parser.Parse(mango.GoConcExamples{
+		Lines: []string{
+			"#123 \x1f the {} /the strc end {} /end strc . {} /. strc \x1f new {col0 coll} /new strc",
+		},
+	})
+	if assert.Len(t, lines, 1) && assert.Len(t, lines[0].Text, 4) {
+		assert.Equal(t, "the", lines[0].Text[0].Word)
+		assert.True(t, lines[0].Text[0].SegmentStart)
+		assert.False(t, lines[0].Text[1].SegmentStart)
+		assert.False(t, lines[0].Text[2].SegmentStart)
+		assert.Equal(t, "new", lines[0].Text[3].Word)
+		assert.True(t, lines[0].Text[3].SegmentStart)
+	}
+}
+
+func TestParseLineAttachesPunctuation(t *testing.T) {
+	parser := NewLineParser([]string{"word", "lemma"}, nil)
+	lines := parser.Parse(mango.GoConcExamples{
+		Lines: []string{
+			"#123 he {} /he strc said {} /say strc , {} /, strc quietly {col0 coll} /quietly strc",
+		},
+	})
+	if assert.Len(t, lines, 1) {
+		assert.Equal(
+			t,
+			"he said, quietly",
+			lines[0].Text.JoinWords(func(token *Token) string { return token.Word }),
+		)
+	}
+}
+
+func TestEmptyWordsAreRenderedConsistently(t *testing.T) {
+	line := NewKWICLine(TokenSlice{
+		{Word: "a"},
+		{Word: "big", Strong: true},
+		{Word: ""},
+		{Word: "dog", Strong: true},
+		{Word: "", SegmentStart: true},
+		{Word: "barks"},
+	})
+	// the empty token separates hits in all the representations
+	assert.Len(t, line.Hits(), 2)
+	assert.Equal(
+		t,
+		"a [big] [dog] barks",
+		line.JoinWords(func(token *Token, isKWIC bool) string {
+			if isKWIC {
+				return "[" + token.Word + "]"
+			}
+			return token.Word
+		}),
+	)
+	assert.Equal(t, "a [big] [dog] barks", line.PackHits("[", "]"))
+	text, spans := line.Tokens().TextWithHitOffsets()
+	assert.Equal(t, "a big dog barks", text)
+	assert.Equal(t, []TextSpan{{Start: 2, End: 5}, {Start: 6, End: 9}}, spans)
+	// a segment started by an empty token starts with the next one
+	assert.Equal(
+		t,
+		"a big dog|barks",
+		line.Tokens().PackText(TextPackingOptions{SegmentMarker: "|"}),
+	)
+}
+
+func TestPackText(t *testing.T) {
+	text := TokenSlice{
+		{Word: "the"},
+		{Word: "end", Strong: true},
+		{Word: ".", NoSpaceBefore: true},
+		{Word: "a", SegmentStart: true, Strong: true},
+		{Word: "new", Strong: true},
+	}
+	assert.Equal(t, "the end. a new", text.PackText(TextPackingOptions{}))
+	assert.Equal(
+		t,
+		"the [end]. [a new]",
+		text.PackText(TextPackingOptions{KWICLeftDelimiter: "[", KWICRightDelimiter: "]"}),
+	)
+	assert.Equal(
+		t,
+		"the <end>.\n<a new>",
+		text.PackText(TextPackingOptions{
+			KWICLeftDelimiter:  "<",
+			KWICRightDelimiter: ">",
+			SegmentMarker:      "\n",
+		}),
+	)
+}
+
+func TestNewKWICLine(t *testing.T) {
+	text := TokenSlice{
+		{Word: "the"},
+		{Word: "big", Strong: true},
+		{Word: "dog", Strong: true},
+		{Word: "barks"},
+		{Word: "."},
+	}
+	line := NewKWICLine(text)
+	assert.Equal(t, text[:1], line.Left)
+	assert.Equal(t, text[1:3], line.KWIC)
+	assert.Equal(t, text[3:], line.Right)
+	assert.Equal(t, text, line.Tokens())
+	assert.False(t, line.IsKWIC(0))
+	assert.True(t, line.IsKWIC(1))
+	assert.True(t, line.IsKWIC(2))
+	assert.False(t, line.IsKWIC(3))
+}
+
+func TestNewKWICLineWithoutHit(t *testing.T) {
+	text := TokenSlice{{Word: "the"}, {Word: "dog"}}
+	line := NewKWICLine(text)
+	assert.Equal(t, text, line.Left)
+	assert.Empty(t, line.KWIC)
+	assert.Empty(t, line.Right)
+	assert.Empty(t, line.Hits())
+	assert.False(t, line.IsKWIC(0))
+}
+
+func TestNewKWICLineSeparatedHits(t *testing.T) {
+	text := TokenSlice{
+		{Word: "a"},
+		{Word: "big", Strong: true},
+		{Word: "and"},
+		{Word: "lazy"},
+		{Word: "old", Strong: true},
+		{Word: "dog", Strong: true},
+		{Word: "barks"},
+	}
+	line := NewKWICLine(text)
+	assert.Equal(t, text[:1], line.Left)
+	assert.Equal(t, text[1:6], line.KWIC)
+	assert.Equal(t, text[6:], line.Right)
+	assert.Equal(t, []TokenSlice{text[1:2], text[4:6]}, line.Hits())
+	assert.False(t, line.IsKWIC(0))
+	assert.True(t, line.IsKWIC(1))
+	assert.False(t, line.IsKWIC(2))
+	assert.False(t, line.IsKWIC(3))
+	assert.True(t, line.IsKWIC(4))
+	assert.True(t, line.IsKWIC(5))
+	assert.False(t, line.IsKWIC(6))
+	assert.Equal(t, "a [big] and lazy [old dog] barks", line.PackHits("[", "]"))
+	assert.Equal(
+		t,
+		"a <big> and lazy <old dog> barks",
+		text.PackText(TextPackingOptions{KWICLeftDelimiter: "<", KWICRightDelimiter: ">"}),
+	)
+}
+
+// longLine creates a line with `contextLen` tokens on both
+// sides of the hit (`l0 ... lN HIT r0 ... rN`)
+func longLine(contextLen int) TokenSlice {
+	ans := make(TokenSlice, 0, 2*contextLen+1)
+	for i := contextLen - 1; i >= 0; i-- {
+		ans = append(ans, &Token{Word: "l" + strconv.Itoa(i)})
+	}
+	ans = append(ans, &Token{Word: "HIT", Strong: true})
+	for i := 0; i < contextLen; i++ {
+		ans = append(ans, &Token{Word: "r" + strconv.Itoa(i)})
+	}
+	return ans
+}
+
+func TestTruncateContextLongLine(t *testing.T) {
+	text := longLine(5000)
+	line := NewKWICLine(text).TruncateContext(3)
+	assert.Len(t, line.Left, 4)
+	assert.Len(t, line.KWIC, 1)
+	assert.Len(t, line.Right, 4)
+	assert.Equal(t, "… l2 l1 l0 [HIT] r0 r1 r2 …", line.PackHits("[", "]"))
+	assert.Equal(
+		t,
+		"… l2 l1 l0 <HIT> r0 r1 r2 …",
+		line.Tokens().PackText(TextPackingOptions{KWICLeftDelimiter: "<", KWICRightDelimiter: ">"}),
+	)
+	assert.False(t, line.IsKWIC(0))
+	assert.True(t, line.IsKWIC(4))
+	// the original line is not modified
+	assert.Len(t, text, 10001)
+	assert.Equal(t, "l4999", text[0].Word)
+}
+
+func TestTruncateContextShortLine(t *testing.T) {
+	text := longLine(3)
+	line := NewKWICLine(text)
+	assert.Equal(t, line, line.TruncateContext(3))
+	assert.Equal(t, line, line.TruncateContext(0))
+	assert.Equal(t, "… l0 [HIT] r0 …", line.TruncateContext(1).PackHits("[", "]"))
+}
+
+func TestTruncateContextSeparatedHits(t *testing.T) {
+	// tokens between hits are never truncated
+	line := NewKWICLine(TokenSlice{
+		{Word: "a"},
+		{Word: "b"},
+		{Word: "big", Strong: true},
+		{Word: "and"},
+		{Word: "lazy"},
+		{Word: "dog", Strong: true},
+		{Word: "barks"},
+		{Word: "loudly"},
+	}).TruncateContext(1)
+	assert.Equal(t, "… b [big] and lazy [dog] barks …", line.PackHits("[", "]"))
+}
+
+func TestKWICLineJoinWords(t *testing.T) {
+	line := NewKWICLine(TokenSlice{
+		{Word: "the", Strong: true},
+		{Word: ""},
+		{Word: "dog", Strong: true},
+		{Word: ",", NoSpaceBefore: true},
+		{Word: "barks"},
+	})
+	assert.Equal(
+		t,
+		"[the] [dog], barks",
+		line.JoinWords(func(token *Token, isKWIC bool) string {
+			if isKWIC {
+				return "[" + token.Word + "]"
+			}
+			return token.Word
+		}),
+	)
+}
+
+func TestTextWithHitOffsets(t *testing.T) {
+	text, spans := TokenSlice{
+		{Word: "žlutý", Strong: true},
+		{Word: "kůň"},
+		{Word: "&amp;"},
+		{Word: "pes", Strong: true},
+		{Word: "", Strong: true},
+		{Word: "psí", Strong: true},
+		{Word: ".", NoSpaceBefore: true},
+	}.TextWithHitOffsets()
+	assert.Equal(t, "žlutý kůň & pes psí.", text)
+	assert.Equal(t, []TextSpan{{Start: 0, End: 5}, {Start: 12, End: 19}}, spans)
+}
+
+func TestTextWithHitOffsetsNoHit(t *testing.T) {
+	text, spans := TokenSlice{{Word: "the"}, {Word: "dog"}}.TextWithHitOffsets()
+	assert.Equal(t, "the dog", text)
+	assert.Empty(t, spans)
+}
+
+func TestConcordanceLineStructAttr(t *testing.T) {
+	line := ConcordanceLine{StructAttrs: map[string]string{"doc.id": "d1", "s.id": "===NONE==="}}
+	assert.Equal(t, "d1", line.StructAttr("doc.id"))
+	assert.Equal(t, "", line.StructAttr("s.id"))
+	assert.Equal(t, "", line.StructAttr("p.id"))
+	assert.Equal(t, "", ConcordanceLine{}.StructAttr("doc.id"))
+}
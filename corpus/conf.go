@@ -21,17 +21,28 @@ package corpus
 import (
 	"errors"
 	"fmt"
+	"math"
+	"net/url"
+	"os"
 	"path/filepath"
 	"sort"
 	"strings"
 
 	"github.com/czcorpus/cnc-gokit/collections"
 	"github.com/czcorpus/cnc-gokit/fs"
+	"github.com/czcorpus/mquery-sru/backlink"
+	"github.com/czcorpus/mquery-sru/corpus/conc"
+	"github.com/czcorpus/mquery-sru/general"
 	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/query"
 	"github.com/rs/zerolog/log"
 )
 
 const (
+	// AllResourcesPattern is a special PID pattern
+	// matching all the configured resources
+	AllResourcesPattern = "all"
+
 	LayerTypeText     LayerType = "text"
 	LayerTypeLemma    LayerType = "lemma"
 	LayerTypePOS      LayerType = "pos"
@@ -43,17 +54,27 @@ const (
 
 	dfltMaxRecords = 50
 	dfltMaxContext = 50
+	dfltMaxTerms   = 100
+
+	dfltMaxQueryLength = 2048
+	dfltMaxQueryTerms  = 100
+	dfltMaxQueryDepth  = 16
+
+	dfltResultSetWindow = 500
 
 	dfltViewContextStruct = "s"
+	dfltSegmentMarker     = "\n"
 
-	// ExplainOpNumberOfRecords is a value we currently don't understand
-	// well...
-	// TODO what is this value for in the "explain" operation?
-	ExplainOpNumberOfRecords = 25
+	dfltMultiValueSeparator = "|"
+
+	// shardIDSeparator separates a resource ID and a shard index
+	// within shard IDs (see ShardID)
+	shardIDSeparator = "#"
 )
 
 var (
-	ErrResourceNotFound = errors.New("resource not found")
+	ErrResourceNotFound    = errors.New("resource not found")
+	ErrResourceUnavailable = errors.New("resource temporarily unavailable")
 )
 
 // LayerType is a layer above positional attributes
@@ -76,6 +97,25 @@ func (name LayerType) Validate() error {
 	return fmt.Errorf("invalid layer name `%s`", name)
 }
 
+// AvailabilityRestriction specifies who can access
+// a resource (see FCS endpoint description)
+type AvailabilityRestriction string
+
+const (
+	AvailabilityRestrictionNone               AvailabilityRestriction = ""
+	AvailabilityRestrictionAuthOnly           AvailabilityRestriction = "authOnly"
+	AvailabilityRestrictionPersonalIdentifier AvailabilityRestriction = "personalIdentifier"
+)
+
+func (ar AvailabilityRestriction) Validate() error {
+	if ar == AvailabilityRestrictionNone ||
+		ar == AvailabilityRestrictionAuthOnly ||
+		ar == AvailabilityRestrictionPersonalIdentifier {
+		return nil
+	}
+	return fmt.Errorf("invalid availability restriction `%s`", ar)
+}
+
 func (name LayerType) GetResultID() string {
 	switch name {
 	case LayerTypeText:
@@ -113,6 +153,10 @@ type PosAttr struct {
 	// (e.g. the `word` attribute is typically set as
 	// the default for the `text` layer)
 	IsLayerDefault bool `json:"isLayerDefault"`
+
+	// IsMultiValue defines whether the attribute contains multiple
+	// values (e.g. `N|NP`) separated by the resource's MultiValueSeparator
+	IsMultiValue bool `json:"isMultiValue"`
 }
 
 // StructureMapping provides mapping between custom
@@ -127,6 +171,27 @@ type StructureMapping struct {
 	SessionStruct   string `json:"sessionStruct"`
 }
 
+// Struct returns a corpus structure a `within` context (e.g. `sentence`,
+// `s`, `p`) is mapped to. For unknown contexts and for contexts not mapped
+// in the resource, an empty string is returned.
+func (sm StructureMapping) Struct(context string) string {
+	switch context {
+	case "sentence", "s":
+		return sm.SentenceStruct
+	case "utterance", "u":
+		return sm.UtteranceStruct
+	case "paragraph", "p":
+		return sm.ParagraphStruct
+	case "turn", "t":
+		return sm.TurnStruct
+	case "text":
+		return sm.TextStruct
+	case "session":
+		return sm.SessionStruct
+	}
+	return ""
+}
+
 // CorpusSetup is a complete corpus configuration
 // (it is part of MQuery-SRU configuration)
 type CorpusSetup struct {
@@ -138,6 +203,7 @@ type CorpusSetup struct {
 	Description map[string]string `json:"description"` // section optional, "en" required
 
 	// languages used in resource - ISO 639-3 three letter language codes
+	// (ISO 639-1 codes are also accepted, see NormalizedLanguages)
 	Languages []string `json:"languages"`
 
 	URI              string           `json:"uri"`
@@ -149,7 +215,144 @@ type CorpusSetup struct {
 	// a structure representing a sentence or a speach.
 	ViewContextStruct string `json:"viewContextStruct"`
 
+	// RefStructAttrs are structural attributes (in the `struct.attr`
+	// form, e.g. `doc.id`) whose values are retrieved for each hit
+	// to allow building meaningful references (document ID, page etc.)
+	RefStructAttrs []string `json:"refStructAttrs"`
+
+	// SentenceRefAttr is a structural attribute (e.g. `s.id`) identifying
+	// the sentence of a hit (e.g. its number within the document). It is
+	// retrieved along with RefStructAttrs and it is available as the
+	// `sentence` variable in RefTemplate.
+	SentenceRefAttr string `json:"sentenceRefAttr"`
+
+	// RefTemplate is a template of record references (the `ref` attribute
+	// of returned resources). Variables in the `{name}` form are replaced
+	// by the KWIC position (`{pos}`), the sentence reference (`{sentence}`,
+	// see SentenceRefAttr) and values of RefStructAttrs (e.g. `{doc.id}`).
+	// Values of hits outside a respective structure are empty. If set,
+	// it replaces KonText backlinks.
+	RefTemplate string `json:"refTemplate"`
+
+	// MetadataAttrs are document-level structural attributes (e.g.
+	// `doc.author`, `doc.title`) whose values are retrieved for each hit
+	// and provided via the `metadata` data view (SRU 2.0 only)
+	MetadataAttrs []string `json:"metadataAttrs"`
+
+	// KWICLeftDelimiter and KWICRightDelimiter are inserted around
+	// the hit in plain text representations of concordance lines
+	// (e.g. the Dublin Core description). The tokenized hits
+	// data view is not affected.
+	KWICLeftDelimiter  string `json:"kwicLeftDelimiter"`
+	KWICRightDelimiter string `json:"kwicRightDelimiter"`
+
+	// SegmentStruct is a structure (e.g. `s`) whose boundaries
+	// are marked by SegmentMarker in plain text representations
+	// of concordance lines. An empty value means no marking.
+	SegmentStruct string `json:"segmentStruct"`
+
+	// SegmentMarker is a string inserted between segments
+	// (see SegmentStruct)
+	SegmentMarker string `json:"segmentMarker"`
+
+	// MultiValueSeparator separates values of multi-value positional
+	// attributes (see PosAttr.IsMultiValue)
+	MultiValueSeparator string `json:"multiValueSeparator"`
+
+	// DiacriticsFoldedAttr is a positional attribute containing
+	// lowercased word forms with diacritics removed (e.g. `word_folded`).
+	// If set, clients can search the resource diacritics-insensitively.
+	DiacriticsFoldedAttr string `json:"diacriticsFoldedAttr"`
+
+	// QueryNormalization is a Unicode normalization form (`NFC`, `NFD`,
+	// `NFKC`, `NFKD` or `none`) query terms are transformed to before
+	// they are searched. It should match the form of the corpus data.
+	QueryNormalization query.NormForm `json:"queryNormalization"`
+
 	KontextBacklinkRootURL string `json:"kontextBacklinkRootURL"`
+
+	// FallbackRegistryPath is a full path to an alternative registry
+	// file (e.g. a mirror of the corpus) used in case the regular
+	// registry file in `corpora.registryDir` is missing or unreadable.
+	FallbackRegistryPath string `json:"fallbackRegistryPath"`
+
+	// RegistryPaths are full paths to registry files of corpora
+	// (e.g. per-year shards) the resource consists of. If set,
+	// the corpora are searched together and their results are
+	// merged into results of the resource (the registry file
+	// in `corpora.registryDir` is not used).
+	RegistryPaths []string `json:"registryPaths"`
+
+	// MaximumRecords overrides the global `corpora.maximumRecords`
+	// for this resource. Zero means the global value applies.
+	MaximumRecords int `json:"maximumRecords"`
+
+	// DefaultRecords overrides the global `corpora.defaultRecords`
+	// for this resource. Zero means the global value applies.
+	DefaultRecords int `json:"defaultRecords"`
+
+	// AllowRawCQL enables searching the resource using native
+	// (backend) CQL queries. For security reasons, this is
+	// disabled by default.
+	AllowRawCQL bool `json:"allowRawCQL"`
+
+	// AvailabilityRestriction specifies whether the resource
+	// is available only to authenticated users
+	AvailabilityRestriction AvailabilityRestriction `json:"availabilityRestriction"`
+
+	// Size is the number of tokens in the resource used to calculate
+	// relative frequencies of hits. If not set, the size reported
+	// by workers (i.e. obtained from the corpus data) is used.
+	Size int64 `json:"size"`
+
+	// Enabled allows taking the resource temporarily offline
+	// without removing its configuration. If omitted, the resource
+	// is enabled (see IsEnabled).
+	Enabled *bool `json:"enabled"`
+}
+
+// IsEnabled tells whether the resource can be searched
+// and listed (see CorpusSetup.Enabled)
+func (cs *CorpusSetup) IsEnabled() bool {
+	return cs.Enabled == nil || *cs.Enabled
+}
+
+// CorpusSize returns the configured size of the resource
+// (see CorpusSetup.Size) or, if not configured, the provided
+// size reported by a worker.
+func (cs *CorpusSetup) CorpusSize(reportedSize int64) int64 {
+	if cs.Size > 0 {
+		return cs.Size
+	}
+	return reportedSize
+}
+
+// HitsPerMillion returns the relative frequency of concSize hits
+// in the resource (i.p.m. rounded to two decimal places). For the
+// resource size, see CorpusSize. In case the size is unknown,
+// false is returned.
+func (cs *CorpusSetup) HitsPerMillion(concSize int, reportedSize int64) (float64, bool) {
+	size := cs.CorpusSize(reportedSize)
+	if size <= 0 {
+		return 0, false
+	}
+	return math.Round(float64(concSize)/float64(size)*1e8) / 100, true
+}
+
+// IsRestricted tells whether the resource is
+// available only to authenticated users
+func (cs *CorpusSetup) IsRestricted() bool {
+	return cs.AvailabilityRestriction != AvailabilityRestrictionNone
+}
+
+// TextPacking provides options for creating plain text
+// representations of concordance lines
+func (cs *CorpusSetup) TextPacking() conc.TextPackingOptions {
+	return conc.TextPackingOptions{
+		KWICLeftDelimiter:  cs.KWICLeftDelimiter,
+		KWICRightDelimiter: cs.KWICRightDelimiter,
+		SegmentMarker:      cs.SegmentMarker,
+	}
 }
 
 // GetBasicSearchAttrs provides all the basic search attrs
@@ -183,6 +386,130 @@ func (cs *CorpusSetup) GetDefinedLayers() *collections.Set[LayerType] {
 	return ans
 }
 
+// SplitAttrValue splits a value of the attribute into individual
+// values in case the attribute is a multi-value one. Otherwise,
+// the value is returned as the only item.
+func (cs *CorpusSetup) SplitAttrValue(attr PosAttr, v string) []string {
+	if !attr.IsMultiValue || cs.MultiValueSeparator == "" {
+		return []string{v}
+	}
+	ans := make([]string, 0, 2)
+	for _, item := range strings.Split(v, cs.MultiValueSeparator) {
+		if item != "" {
+			ans = append(ans, item)
+		}
+	}
+	if len(ans) == 0 {
+		return []string{v}
+	}
+	return ans
+}
+
+// GetRefStructAttrs returns all the structural attributes to be
+// retrieved with each hit (i.e. RefStructAttrs, SentenceRefAttr
+// and MetadataAttrs)
+func (cs *CorpusSetup) GetRefStructAttrs() []string {
+	if cs.SentenceRefAttr == "" && len(cs.MetadataAttrs) == 0 {
+		return cs.RefStructAttrs
+	}
+	ans := make([]string, 0, len(cs.RefStructAttrs)+len(cs.MetadataAttrs)+1)
+	ans = append(ans, cs.RefStructAttrs...)
+	if cs.SentenceRefAttr != "" {
+		ans = append(ans, cs.SentenceRefAttr)
+	}
+	ans = append(ans, cs.MetadataAttrs...)
+	// remove duplicates while keeping the order
+	for i := len(ans) - 1; i > 0; i-- {
+		if collections.SliceContains(ans[:i], ans[i]) {
+			ans = append(ans[:i], ans[i+1:]...)
+		}
+	}
+	return ans
+}
+
+// HasPosAttr tests whether the corpus has a positional
+// attribute of the provided name
+func (cs *CorpusSetup) HasPosAttr(name string) bool {
+	for _, item := range cs.PosAttrs {
+		if item.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HasStruct tests whether the provided structure is known
+// from the resource configuration (i.e. it is mapped, used as
+// a view context or segment structure or it has configured
+// reference or metadata attributes)
+func (cs *CorpusSetup) HasStruct(name string) bool {
+	sm := cs.StructureMapping
+	known := []string{
+		cs.ViewContextStruct, cs.SegmentStruct, sm.SentenceStruct, sm.UtteranceStruct,
+		sm.ParagraphStruct, sm.TurnStruct, sm.TextStruct, sm.SessionStruct,
+	}
+	for _, attr := range cs.GetRefStructAttrs() {
+		structName, _, _ := strings.Cut(attr, ".")
+		known = append(known, structName)
+	}
+	return name != "" && collections.SliceContains(known, name)
+}
+
+// GetSortedPosAttrs returns a sorted copy of the resource's positional
+// attributes (see sortPosAttrs). In case the resource does not define
+// a default attribute of the text layer, the first basic search attribute
+// goes first.
+func (cs *CorpusSetup) GetSortedPosAttrs() []PosAttr {
+	ans := make([]PosAttr, len(cs.PosAttrs))
+	copy(ans, cs.PosAttrs)
+	sortPosAttrs(ans)
+	if len(ans) > 0 && (ans[0].Layer != DefaultLayerType || !ans[0].IsLayerDefault) {
+		for i, attr := range ans {
+			if attr.IsBasicSearchAttr {
+				ans = append(append([]PosAttr{attr}, ans[:i]...), ans[i+1:]...)
+				break
+			}
+		}
+	}
+	return ans
+}
+
+// GetSortedPosAttrNames is the same as GetSortedPosAttrs
+// but it returns just a list of attribute names.
+func (cs *CorpusSetup) GetSortedPosAttrNames() []string {
+	return collections.SliceMap(
+		cs.GetSortedPosAttrs(),
+		func(v PosAttr, i int) string { return v.Name },
+	)
+}
+
+// GetPosAttrsWithBasicSearchAttr returns a copy of corpus positional
+// attributes where only `name` is set as a basic search attribute.
+// In case `name` is empty, the original attributes are returned.
+func (cs *CorpusSetup) GetPosAttrsWithBasicSearchAttr(name string) []PosAttr {
+	if name == "" {
+		return cs.PosAttrs
+	}
+	ans := make([]PosAttr, len(cs.PosAttrs))
+	for i, item := range cs.PosAttrs {
+		ans[i] = item
+		ans[i].IsBasicSearchAttr = item.Name == name
+	}
+	return ans
+}
+
+// GetPosAttrsForFoldedSearch returns a copy of corpus positional
+// attributes where only the diacritics-folded attribute is set
+// as a basic search attribute. The folded attribute does not have
+// to be among the configured positional attributes.
+func (cs *CorpusSetup) GetPosAttrsForFoldedSearch() []PosAttr {
+	ans := cs.GetPosAttrsWithBasicSearchAttr(cs.DiacriticsFoldedAttr)
+	if !cs.HasPosAttr(cs.DiacriticsFoldedAttr) {
+		ans = append(ans, PosAttr{Name: cs.DiacriticsFoldedAttr, IsBasicSearchAttr: true})
+	}
+	return ans
+}
+
 // GetDefinedLayersAsRefString provides all the layers
 // defined for the corpus formatted as a single string
 // (this is required in SRU XML)
@@ -197,6 +524,18 @@ func (cs *CorpusSetup) GetDefinedLayersAsRefString() string {
 // Validate validates corpus setup. This should be run
 // as part of server startup (i.e. before any requests start)
 func (ls *CorpusSetup) Validate(confContext string) error {
+	if ls.PID == "" {
+		ls.PID = ls.ID
+		log.Warn().
+			Str("value", ls.PID).
+			Str("corpus", ls.ID).
+			Msg("pid not defined, using corpus ID")
+
+	} else if !isURI(ls.PID) {
+		return fmt.Errorf(
+			"invalid `%s.pid` value %s (must be a URI, e.g. a handle.net or DOI URL)", confContext, ls.PID)
+	}
+
 	if ls.FullName == nil {
 		return fmt.Errorf("missing configuration section `%s.fullName`", confContext)
 	}
@@ -213,19 +552,57 @@ func (ls *CorpusSetup) Validate(confContext string) error {
 		return fmt.Errorf("missing required configuration for `%s.description.en`", confContext)
 	}
 
-	if ls.Languages == nil {
+	if len(ls.Languages) == 0 {
 		return fmt.Errorf("missing required configuration section `%s.languages`", confContext)
 	}
+	for _, lang := range ls.Languages {
+		if _, err := NormalizeLanguageCode(lang); err != nil {
+			return fmt.Errorf("invalid `%s.languages`: %w", confContext, err)
+		}
+	}
+
+	if ls.Size < 0 {
+		return fmt.Errorf("invalid `%s.size` (must be a non-negative number)", confContext)
+	}
+
+	if strings.Contains(ls.ID, shardIDSeparator) {
+		return fmt.Errorf(
+			"invalid `%s.id` value %s (must not contain `%s`)", confContext, ls.ID, shardIDSeparator)
+	}
+	if len(ls.RegistryPaths) > 0 && ls.FallbackRegistryPath != "" {
+		return fmt.Errorf(
+			"`%s.registryPaths` cannot be combined with `%s.fallbackRegistryPath`", confContext, confContext)
+	}
+	for _, path := range ls.RegistryPaths {
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf(
+				"invalid `%s.registryPaths` item %s (must be an absolute path)", confContext, path)
+		}
+	}
 
 	if ls == nil {
 		return fmt.Errorf("missing configuration section `%s.layers`", confContext)
 	}
+	if err := ls.AvailabilityRestriction.Validate(); err != nil {
+		return fmt.Errorf("invalid `%s.availabilityRestriction`: %w", confContext, err)
+	}
 	layerDefaults := make(map[LayerType]int)
-	var basicSrchAttrs int
-	for _, attr := range ls.PosAttrs {
+	var basicSrchAttrs, multiValueAttrs int
+	for i, attr := range ls.PosAttrs {
 		if err := attr.Layer.Validate(); err != nil {
 			return err
 		}
+		// IDs are used as XML IDs of layers in the endpoint description
+		if attr.ID == "" {
+			ls.PosAttrs[i].ID = attr.Name
+			log.Warn().
+				Str("value", attr.Name).
+				Str("corpus", ls.ID).
+				Msg("posAttrs item id not defined, using attribute name")
+
+		} else if !general.IsValidStructName(attr.ID) || attr.ID == "hits" || attr.ID == "adv" {
+			return fmt.Errorf("invalid `%s.posAttrs` item id %s", confContext, attr.ID)
+		}
 		_, ok := layerDefaults[attr.Layer]
 		if !ok { // we must make sure items with 0 are also set, so we can validate all the attrs
 			layerDefaults[attr.Layer] = 0
@@ -236,6 +613,9 @@ func (ls *CorpusSetup) Validate(confContext string) error {
 		if attr.IsBasicSearchAttr {
 			basicSrchAttrs++
 		}
+		if attr.IsMultiValue {
+			multiValueAttrs++
+		}
 	}
 	for layer, num := range layerDefaults {
 		if num != 1 {
@@ -250,6 +630,88 @@ func (ls *CorpusSetup) Validate(confContext string) error {
 		return fmt.Errorf("no positional attributes are set to be used in basic search query")
 	}
 
+	if multiValueAttrs > 0 && ls.MultiValueSeparator == "" {
+		ls.MultiValueSeparator = dfltMultiValueSeparator
+		log.Warn().
+			Str("value", ls.MultiValueSeparator).
+			Str("corpus", ls.ID).
+			Msg("multiValueSeparator not defined, using default")
+
+	} else if multiValueAttrs == 0 && ls.MultiValueSeparator != "" {
+		log.Warn().
+			Str("corpus", ls.ID).
+			Msg("multiValueSeparator has no effect without isMultiValue posAttrs")
+	}
+
+	for _, attr := range ls.RefStructAttrs {
+		if _, _, ok := SplitStructAttr(attr); !ok {
+			return fmt.Errorf(
+				"invalid `%s.refStructAttrs` item %s (must be in the form struct.attr)", confContext, attr)
+		}
+	}
+
+	if ls.SentenceRefAttr != "" {
+		if _, _, ok := SplitStructAttr(ls.SentenceRefAttr); !ok {
+			return fmt.Errorf(
+				"invalid `%s.sentenceRefAttr` value %s (must be in the form struct.attr)",
+				confContext, ls.SentenceRefAttr)
+		}
+	}
+
+	for _, attr := range ls.MetadataAttrs {
+		if _, _, ok := SplitStructAttr(attr); !ok {
+			return fmt.Errorf(
+				"invalid `%s.metadataAttrs` item %s (must be in the form struct.attr)", confContext, attr)
+		}
+	}
+
+	for _, v := range backlink.RefTemplateVars(ls.RefTemplate) {
+		switch {
+		case v == backlink.RefVarPosition:
+		case v == backlink.RefVarSentence && ls.SentenceRefAttr != "":
+		case collections.SliceContains(ls.RefStructAttrs, v):
+		default:
+			return fmt.Errorf(
+				"invalid `%s.refTemplate` variable %s (must be %s, %s or an item of refStructAttrs)",
+				confContext, v, backlink.RefVarPosition, backlink.RefVarSentence)
+		}
+	}
+
+	if ls.DiacriticsFoldedAttr != "" && !general.IsValidStructName(ls.DiacriticsFoldedAttr) {
+		return fmt.Errorf(
+			"invalid `%s.diacriticsFoldedAttr` value %s", confContext, ls.DiacriticsFoldedAttr)
+	}
+
+	if ls.QueryNormalization == "" {
+		ls.QueryNormalization = query.NormFormNFC
+		log.Warn().
+			Str("value", string(ls.QueryNormalization)).
+			Str("corpus", ls.ID).
+			Msg("queryNormalization not defined, using default")
+
+	} else if err := ls.QueryNormalization.Validate(); err != nil {
+		return fmt.Errorf("invalid `%s.queryNormalization`: %w", confContext, err)
+	}
+
+	if ls.SegmentStruct != "" {
+		if !general.IsValidStructName(ls.SegmentStruct) {
+			return fmt.Errorf(
+				"invalid `%s.segmentStruct` value %s", confContext, ls.SegmentStruct)
+		}
+		if ls.SegmentMarker == "" {
+			ls.SegmentMarker = dfltSegmentMarker
+			log.Warn().
+				Str("value", ls.SegmentMarker).
+				Str("corpus", ls.ID).
+				Msg("segmentMarker not defined, using default")
+		}
+
+	} else if ls.SegmentMarker != "" {
+		log.Warn().
+			Str("corpus", ls.ID).
+			Msg("segmentMarker has no effect without segmentStruct")
+	}
+
 	if ls.ViewContextStruct == "" {
 		ls.ViewContextStruct = dfltViewContextStruct
 		log.Warn().
@@ -261,6 +723,40 @@ func (ls *CorpusSetup) Validate(confContext string) error {
 	return nil
 }
 
+// isURI tests whether v is an absolute URI (e.g. `http://hdl.handle.net/11234/1-123`
+// or `hdl:11234/1-123`) which is what FCS expects as a resource PID.
+func isURI(v string) bool {
+	u, err := url.Parse(v)
+	if err != nil || u.Scheme == "" {
+		return false
+	}
+	return u.Host != "" || u.Opaque != ""
+}
+
+// SplitStructAttr splits a structural attribute name (e.g. `doc.id`)
+// into the structure and attribute parts. The last value tells
+// whether the name is valid.
+func SplitStructAttr(v string) (string, string, bool) {
+	structName, attrName, ok := strings.Cut(v, ".")
+	if !ok || !general.IsValidStructName(structName) || !general.IsValidStructName(attrName) {
+		return "", "", false
+	}
+	return structName, attrName, true
+}
+
+// NormalizedLanguages returns resource languages as ISO 639-3 codes
+// (as required by FCS). ISO 639-1 codes are converted, invalid codes
+// (which should not pass the config validation) are omitted.
+func (ls *CorpusSetup) NormalizedLanguages() []string {
+	ans := make([]string, 0, len(ls.Languages))
+	for _, lang := range ls.Languages {
+		if v, err := NormalizeLanguageCode(lang); err == nil {
+			ans = append(ans, v)
+		}
+	}
+	return ans
+}
+
 // -----
 
 // SrchResources is a configuration of all the enabled
@@ -284,7 +780,23 @@ func (sr SrchResources) GetCorpora() []string {
 	return collections.SliceMap(sr, func(v *CorpusSetup, i int) string { return v.ID })
 }
 
+// GetLanguages returns a sorted list of all the languages
+// (as ISO 639-3 codes) used within configured resources
+func (sr SrchResources) GetLanguages() []string {
+	ans := collections.NewSet[string]()
+	for _, res := range sr {
+		for _, lang := range res.NormalizedLanguages() {
+			ans.Add(lang)
+		}
+	}
+	return ans.ToOrderedSlice()
+}
+
+// GetResource returns a resource with the provided ID.
+// Shard IDs (see ShardID) are also accepted in which case
+// the resource the shard belongs to is returned.
 func (sr SrchResources) GetResource(ID string) (*CorpusSetup, error) {
+	ID = ShardResourceID(ID)
 	resIndex := collections.SliceFindIndex(sr, func(v *CorpusSetup) bool { return v.ID == ID })
 	if resIndex == -1 {
 		return nil, ErrResourceNotFound
@@ -320,16 +832,23 @@ func (sr SrchResources) GetCommonPosAttrs(corpusNames ...string) ([]PosAttr, err
 		ans[i] = v
 		i++
 	}
-	sort.SliceStable(ans, func(i, j int) bool {
-		if ans[i].Layer == DefaultLayerType && ans[i].IsLayerDefault {
+	sortPosAttrs(ans)
+	return ans, nil
+}
+
+// sortPosAttrs sorts positional attributes by their names except
+// for the default attribute of the default (text) layer which always
+// goes first (workers use the first attribute as a token's word)
+func sortPosAttrs(attrs []PosAttr) {
+	sort.SliceStable(attrs, func(i, j int) bool {
+		if attrs[i].Layer == DefaultLayerType && attrs[i].IsLayerDefault {
 			return true
 		}
-		if ans[j].Layer == DefaultLayerType && ans[j].IsLayerDefault {
+		if attrs[j].Layer == DefaultLayerType && attrs[j].IsLayerDefault {
 			return false
 		}
-		return strings.Compare(ans[i].Name, ans[j].Name) < 0
+		return strings.Compare(attrs[i].Name, attrs[j].Name) < 0
 	})
-	return ans, nil
 }
 
 // GetCommonPosAttrs2 returns positional attributes common
@@ -354,15 +873,24 @@ func (sr SrchResources) GetCommonPosAttrs2() []PosAttr {
 		ans[i] = v
 		i++
 	}
-	sort.SliceStable(ans, func(i, j int) bool {
-		if ans[i].Layer == DefaultLayerType && ans[i].IsLayerDefault {
-			return true
-		}
-		if ans[j].Layer == DefaultLayerType && ans[j].IsLayerDefault {
-			return false
+	sortPosAttrs(ans)
+	return ans
+}
+
+// GetAllPosAttrs returns positional attributes of all the
+// resources (identified by their IDs, see `PosAttr.ID`).
+func (sr SrchResources) GetAllPosAttrs() []PosAttr {
+	collect := make(map[string]PosAttr)
+	for _, res := range sr {
+		for _, pa := range res.PosAttrs {
+			collect[pa.ID] = pa
 		}
-		return strings.Compare(ans[i].Name, ans[j].Name) < 0
-	})
+	}
+	ans := make([]PosAttr, 0, len(collect))
+	for _, v := range collect {
+		ans = append(ans, v)
+	}
+	sortPosAttrs(ans)
 	return ans
 }
 
@@ -388,9 +916,48 @@ func (sr SrchResources) Validate(confContext string) error {
 			return err
 		}
 	}
+	// layer IDs are shared by all the resources (see GetAllPosAttrs)
+	posAttrs := make(map[string]PosAttr)
+	for _, corp := range sr {
+		for _, pa := range corp.PosAttrs {
+			if prev, ok := posAttrs[pa.ID]; ok && (prev.Name != pa.Name || prev.Layer != pa.Layer) {
+				return fmt.Errorf(
+					"`%s[%s].posAttrs` item id %s used for different attributes or layers",
+					confContext, corp.ID, pa.ID)
+			}
+			posAttrs[pa.ID] = pa
+		}
+	}
 	return nil
 }
 
+// IsPIDPattern tests whether a value should be treated as a pattern
+// matching possibly multiple resource PIDs (i.e. the special value
+// `all` or a glob pattern like `cs_*`)
+func IsPIDPattern(v string) bool {
+	return v == AllResourcesPattern || strings.ContainsAny(v, "*?[")
+}
+
+// FindByPIDPattern returns IDs of all the resources with PIDs
+// matching the provided pattern (see IsPIDPattern).
+func (sr SrchResources) FindByPIDPattern(pattern string) ([]string, error) {
+	ans := make([]string, 0, len(sr))
+	for _, res := range sr {
+		if pattern == AllResourcesPattern {
+			ans = append(ans, res.ID)
+			continue
+		}
+		match, err := filepath.Match(pattern, res.PID)
+		if err != nil {
+			return []string{}, fmt.Errorf("invalid PID pattern %s: %w", pattern, err)
+		}
+		if match {
+			ans = append(ans, res.ID)
+		}
+	}
+	return ans, nil
+}
+
 // GetResourceByPID
 // in case a resource with PID does not exist, ErrResourceNotFound is returned
 func (sr SrchResources) GetResourceByPID(PID string) (*CorpusSetup, error) {
@@ -418,17 +985,283 @@ type CorporaSetup struct {
 	// also limited by its internals to `MaxRecordsInternalLimit`
 	MaximumRecords int `json:"maximumRecords"`
 
+	// MaximumBackendLines specifies max. number of concordance lines
+	// requested from a worker for a single resource. Both MaximumRecords
+	// and ResultSetWindow must fit into the limit so a requested page
+	// is never silently truncated. In case of MQuery, this is limited
+	// by its internals to `MaxRecordsInternalLimit`
+	MaximumBackendLines int `json:"maximumBackendLines"`
+
+	// DefaultRecords specifies number of records returned
+	// in a "searchRetrieve" search in case the client does not
+	// specify the `maximumRecords` argument.
+	DefaultRecords int `json:"defaultRecords"`
+
+	// DisableHitCountOnly rejects `maximumRecords=0` requests which
+	// otherwise return just the number of hits without any records
+	// (no concordance lines are fetched for such requests)
+	DisableHitCountOnly bool `json:"disableHitCountOnly"`
+
 	// MaximumContext specifies max. number of tokens left/right from hit
 	MaximumContext int `json:"maximumContext"`
 
+	// MaximumRenderedContext specifies max. number of context tokens
+	// left/right from hit rendered in records. Longer contexts are
+	// truncated (see conc.KWICLine.TruncateContext). Zero means
+	// no limitation (i.e. only MaximumContext applies).
+	MaximumRenderedContext int `json:"maximumRenderedContext"`
+
+	// MaximumTerms specifies max. number of terms returned
+	// in a "scan" operation. It is also used in case the client
+	// does not specify the `maximumTerms` argument.
+	MaximumTerms int `json:"maximumTerms"`
+
+	// MaximumQueryLength specifies max. length (in bytes) of a raw query
+	MaximumQueryLength int `json:"maximumQueryLength"`
+
+	// MaximumQueryTerms specifies max. number of terms a query can contain
+	MaximumQueryTerms int `json:"maximumQueryTerms"`
+
+	// MaximumQueryDepth specifies max. nesting level of a query
+	// (parentheses, brackets)
+	MaximumQueryDepth int `json:"maximumQueryDepth"`
+
+	// MaximumResultSetTTL specifies max. time (in seconds) a result set
+	// can be cached for (as requested by clients via `resultSetTTL`).
+	// Zero value disables the result set cache.
+	MaximumResultSetTTL int `json:"maximumResultSetTTL"`
+
+	// ResultSetWindow specifies number of concordance lines (per resource)
+	// stored in a cached result set. Pages beyond the window are always
+	// obtained from workers.
+	ResultSetWindow int `json:"resultSetWindow"`
+
+	// MaximumResources specifies max. number of resources a single
+	// "searchRetrieve" can search in. Zero means no limit.
+	MaximumResources int `json:"maximumResources"`
+
+	// MaximumResourcesExemptDefault allows searching all the configured
+	// resources in case the client does not specify any (via `x-fcs-context`)
+	// even if their number exceeds MaximumResources
+	MaximumResourcesExemptDefault bool `json:"maximumResourcesExemptDefault"`
+
+	// AllowDebugQuery allows clients to obtain backend (Manatee CQL)
+	// queries generated for individual searched resources. As this
+	// reveals backend internals, it is disabled by default.
+	AllowDebugQuery bool `json:"allowDebugQuery"`
+
+	// StrictSearch makes searches fail on the first resource which
+	// cannot be searched (e.g. it is temporarily unavailable) instead
+	// of returning results of the remaining resources. Clients can
+	// override this per request (see `x-cnc-strict`).
+	StrictSearch bool `json:"strictSearch"`
+
 	// Resources is a description of configured corpora/resources
 	Resources SrchResources `json:"resources"`
+
+	// disabledResources contains configured resources which are
+	// disabled (see CorpusSetup.Enabled). They are removed from
+	// Resources during validation so the rest of the application
+	// does not see them at all.
+	disabledResources SrchResources
 }
 
 func (cs *CorporaSetup) GetRegistryPath(corpusID string) string {
 	return filepath.Join(cs.RegistryDir, corpusID)
 }
 
+// ResolveRegistryPath returns a path of a registry file which can
+// be currently used to search in the corpus. In case the regular
+// registry file is missing or unreadable, the resource's fallback
+// registry (if configured) is used. If no usable registry file is
+// available, ErrResourceUnavailable is returned. For unknown corpora,
+// ErrResourceNotFound is returned.
+func (cs *CorporaSetup) ResolveRegistryPath(corpusID string) (string, error) {
+	res, err := cs.Resources.GetResource(corpusID)
+	if err != nil {
+		return "", err
+	}
+	regPath := cs.GetRegistryPath(corpusID)
+	if isReadableFile(regPath) {
+		return regPath, nil
+	}
+	if res.FallbackRegistryPath != "" && isReadableFile(res.FallbackRegistryPath) {
+		return res.FallbackRegistryPath, nil
+	}
+	return "", ErrResourceUnavailable
+}
+
+// CorpusShard is a physical corpus searched as (a part of) a resource.
+// For resources without multiple registry paths (see CorpusSetup.RegistryPaths),
+// there is a single shard identified by the resource ID.
+type CorpusShard struct {
+	ID           string
+	RegistryPath string
+}
+
+// ShardID creates an ID of idx-th shard of a resource
+func ShardID(corpusID string, idx int) string {
+	return fmt.Sprintf("%s%s%d", corpusID, shardIDSeparator, idx)
+}
+
+// ShardResourceID returns an ID of the resource a shard (see ShardID)
+// belongs to. Resource IDs are returned unchanged.
+func ShardResourceID(ID string) string {
+	if i := strings.LastIndex(ID, shardIDSeparator); i > -1 {
+		return ID[:i]
+	}
+	return ID
+}
+
+// ResolveShards returns corpora which must be searched to search
+// the resource. For resources with multiple registry paths, all
+// the registry files must be readable as partial results would be
+// misleading. Otherwise, ErrResourceUnavailable is returned. For
+// other resources, the registry path is resolved by ResolveRegistryPath.
+func (cs *CorporaSetup) ResolveShards(corpusID string) ([]CorpusShard, error) {
+	res, err := cs.Resources.GetResource(corpusID)
+	if err != nil {
+		return nil, err
+	}
+	if len(res.RegistryPaths) == 0 {
+		regPath, err := cs.ResolveRegistryPath(corpusID)
+		if err != nil {
+			return nil, err
+		}
+		return []CorpusShard{{ID: res.ID, RegistryPath: regPath}}, nil
+	}
+	ans := make([]CorpusShard, 0, len(res.RegistryPaths))
+	for i, regPath := range res.RegistryPaths {
+		if !isReadableFile(regPath) {
+			return nil, ErrResourceUnavailable
+		}
+		ans = append(ans, CorpusShard{ID: ShardID(res.ID, i), RegistryPath: regPath})
+	}
+	return ans, nil
+}
+
+// isReadableFile tests whether the path points to a regular
+// file which can be opened for reading
+func isReadableFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	return err == nil && info.Mode().IsRegular()
+}
+
+// separateDisabledResources moves disabled resources
+// from Resources to disabledResources
+func (cs *CorporaSetup) separateDisabledResources(confContext string) {
+	enabled := make(SrchResources, 0, len(cs.Resources))
+	for _, res := range cs.Resources {
+		if res.IsEnabled() {
+			enabled = append(enabled, res)
+			continue
+		}
+		log.Warn().
+			Str("resource", res.ID).
+			Msgf("%s.resources: resource disabled", confContext)
+		cs.disabledResources = append(cs.disabledResources, res)
+	}
+	cs.Resources = enabled
+}
+
+// IsDisabledResource tells whether the PID belongs to a configured
+// resource which is disabled (see CorpusSetup.Enabled)
+func (cs *CorporaSetup) IsDisabledResource(PID string) bool {
+	_, err := cs.disabledResources.GetResourceByPID(PID)
+	return err == nil
+}
+
+// logResourcesAvailability writes a warning for each configured
+// resource which cannot be currently searched or which is
+// searched using its fallback registry. This does not prevent
+// the service from starting as the resources may become available
+// later.
+func (cs *CorporaSetup) logResourcesAvailability(confContext string) {
+	for _, res := range cs.Resources {
+		shards, err := cs.ResolveShards(res.ID)
+		if err != nil {
+			log.Warn().
+				Str("resource", res.ID).
+				Str("registryPath", cs.GetRegistryPath(res.ID)).
+				Str("fallbackRegistryPath", res.FallbackRegistryPath).
+				Msgf("%s.resources: resource configured but currently unavailable", confContext)
+
+		} else if len(res.RegistryPaths) == 0 && shards[0].RegistryPath != cs.GetRegistryPath(res.ID) {
+			log.Warn().
+				Str("resource", res.ID).
+				Str("fallbackRegistryPath", shards[0].RegistryPath).
+				Msgf("%s.resources: registry file not available, using fallback", confContext)
+		}
+	}
+}
+
+// GetMaximumRecords returns the max. number of records a client
+// can obtain when searching in the provided resources. Per-resource
+// overrides are respected and the strictest one applies.
+func (cs *CorporaSetup) GetMaximumRecords(corpusIDs ...string) int {
+	ans := cs.MaximumRecords
+	for i, corpusID := range corpusIDs {
+		v := cs.MaximumRecords
+		if res, err := cs.Resources.GetResource(corpusID); err == nil && res.MaximumRecords > 0 {
+			v = res.MaximumRecords
+		}
+		if i == 0 || v < ans {
+			ans = v
+		}
+	}
+	return ans
+}
+
+// GetDefaultRecords returns the number of records returned
+// when searching in the provided resources without specifying
+// `maximumRecords`. The value never exceeds GetMaximumRecords.
+func (cs *CorporaSetup) GetDefaultRecords(corpusIDs ...string) int {
+	ans := cs.DefaultRecords
+	for i, corpusID := range corpusIDs {
+		v := cs.DefaultRecords
+		if res, err := cs.Resources.GetResource(corpusID); err == nil && res.DefaultRecords > 0 {
+			v = res.DefaultRecords
+		}
+		if i == 0 || v < ans {
+			ans = v
+		}
+	}
+	if maxRec := cs.GetMaximumRecords(corpusIDs...); ans > maxRec {
+		return maxRec
+	}
+	return ans
+}
+
+// BackendLines returns the number of concordance lines to be requested
+// from a worker to cover a line range [from, to) of a resource. The value
+// is bounded by MaximumBackendLines (if set).
+func (cs *CorporaSetup) BackendLines(from, to int) int {
+	ans := to - from
+	if cs.MaximumBackendLines > 0 && ans > cs.MaximumBackendLines {
+		return cs.MaximumBackendLines
+	}
+	if ans < 0 {
+		return 0
+	}
+	return ans
+}
+
+// ExceedsMaximumResources tells whether searching numResources
+// resources is over the configured limit. The isDefault argument
+// specifies that the resources have not been selected by the client
+// (i.e. all the configured resources are to be searched).
+func (cs *CorporaSetup) ExceedsMaximumResources(numResources int, isDefault bool) bool {
+	if cs.MaximumResources == 0 || isDefault && cs.MaximumResourcesExemptDefault {
+		return false
+	}
+	return numResources > cs.MaximumResources
+}
+
 func (cs *CorporaSetup) ValidateAndDefaults(confContext string) error {
 	if cs == nil {
 		return fmt.Errorf("missing configuration section `%s`", confContext)
@@ -443,15 +1276,53 @@ func (cs *CorporaSetup) ValidateAndDefaults(confContext string) error {
 	if !isDir {
 		return fmt.Errorf("`%s.registryDir` is not a directory", confContext)
 	}
+	if cs.MaximumBackendLines < 0 || cs.MaximumBackendLines > mango.MaxRecordsInternalLimit {
+		return fmt.Errorf(
+			"`%s.maximumBackendLines` must be between 0 and %d", confContext, mango.MaxRecordsInternalLimit)
+
+	} else if cs.MaximumBackendLines == 0 {
+		cs.MaximumBackendLines = mango.MaxRecordsInternalLimit
+		log.Warn().
+			Int("value", cs.MaximumBackendLines).
+			Msgf("%s.maximumBackendLines not set, using default", confContext)
+	}
+
 	if cs.MaximumRecords == 0 {
 		cs.MaximumRecords = dfltMaxRecords
 		log.Warn().
 			Int("value", dfltMaxRecords).
 			Msgf("%s.maximumRecords not set, using default", confContext)
+	}
+	if cs.MaximumRecords > cs.MaximumBackendLines {
+		return fmt.Errorf(
+			"`%s.maximumRecords` must be at most %d (maximumBackendLines)",
+			confContext, cs.MaximumBackendLines)
+	}
 
-	} else if cs.MaximumRecords > mango.MaxRecordsInternalLimit {
+	if cs.DefaultRecords < 0 {
+		return fmt.Errorf("`%s.defaultRecords` invalid value; has to be positive", confContext)
+
+	} else if cs.DefaultRecords == 0 {
+		cs.DefaultRecords = cs.MaximumRecords
+		log.Warn().
+			Int("value", cs.DefaultRecords).
+			Msgf("%s.defaultRecords not set, using %s.maximumRecords", confContext, confContext)
+
+	} else if cs.DefaultRecords > cs.MaximumRecords {
 		return fmt.Errorf(
-			"`%s.maximumRecords must be at most %d", confContext, mango.MaxRecordsInternalLimit)
+			"`%s.defaultRecords` must be at most %d (maximumRecords)", confContext, cs.MaximumRecords)
+	}
+
+	for _, res := range cs.Resources {
+		if res.MaximumRecords < 0 || res.MaximumRecords > cs.MaximumBackendLines {
+			return fmt.Errorf(
+				"`%s.resources[%s].maximumRecords` must be between 0 and %d (maximumBackendLines)",
+				confContext, res.ID, cs.MaximumBackendLines)
+		}
+		if res.DefaultRecords < 0 {
+			return fmt.Errorf(
+				"`%s.resources[%s].defaultRecords` invalid value; has to be positive", confContext, res.ID)
+		}
 	}
 
 	if cs.MaximumContext < 0 {
@@ -464,5 +1335,98 @@ func (cs *CorporaSetup) ValidateAndDefaults(confContext string) error {
 			Msgf("%s.maximumContext not set, using default", confContext)
 	}
 
-	return cs.Resources.Validate("resources")
+	if cs.MaximumRenderedContext < 0 {
+		return fmt.Errorf("`%s.maximumRenderedContext` invalid value; has to be positive", confContext)
+	}
+
+	if cs.MaximumTerms < 0 {
+		return fmt.Errorf("`%s.maximumTerms` invalid value; has to be positive", confContext)
+
+	} else if cs.MaximumTerms == 0 {
+		cs.MaximumTerms = dfltMaxTerms
+		log.Warn().
+			Int("value", dfltMaxTerms).
+			Msgf("%s.maximumTerms not set, using default", confContext)
+	}
+
+	if cs.MaximumQueryLength < 0 {
+		return fmt.Errorf("`%s.maximumQueryLength` invalid value; has to be positive", confContext)
+
+	} else if cs.MaximumQueryLength == 0 {
+		cs.MaximumQueryLength = dfltMaxQueryLength
+		log.Warn().
+			Int("value", dfltMaxQueryLength).
+			Msgf("%s.maximumQueryLength not set, using default", confContext)
+	}
+
+	if cs.MaximumQueryTerms < 0 {
+		return fmt.Errorf("`%s.maximumQueryTerms` invalid value; has to be positive", confContext)
+
+	} else if cs.MaximumQueryTerms == 0 {
+		cs.MaximumQueryTerms = dfltMaxQueryTerms
+		log.Warn().
+			Int("value", dfltMaxQueryTerms).
+			Msgf("%s.maximumQueryTerms not set, using default", confContext)
+	}
+
+	if cs.MaximumQueryDepth < 0 {
+		return fmt.Errorf("`%s.maximumQueryDepth` invalid value; has to be positive", confContext)
+
+	} else if cs.MaximumQueryDepth == 0 {
+		cs.MaximumQueryDepth = dfltMaxQueryDepth
+		log.Warn().
+			Int("value", dfltMaxQueryDepth).
+			Msgf("%s.maximumQueryDepth not set, using default", confContext)
+	}
+
+	if cs.MaximumResultSetTTL < 0 {
+		return fmt.Errorf("`%s.maximumResultSetTTL` invalid value; has to be positive", confContext)
+	}
+
+	if cs.ResultSetWindow < 0 || cs.ResultSetWindow > cs.MaximumBackendLines {
+		return fmt.Errorf(
+			"`%s.resultSetWindow` must be between 0 and %d (maximumBackendLines)",
+			confContext, cs.MaximumBackendLines)
+
+	} else if cs.ResultSetWindow == 0 && cs.MaximumResultSetTTL > 0 {
+		cs.ResultSetWindow = dfltResultSetWindow
+		if cs.ResultSetWindow > cs.MaximumBackendLines {
+			cs.ResultSetWindow = cs.MaximumBackendLines
+		}
+		log.Warn().
+			Int("value", cs.ResultSetWindow).
+			Msgf("%s.resultSetWindow not set, using default", confContext)
+	}
+
+	if cs.MaximumResources < 0 {
+		return fmt.Errorf("`%s.maximumResources` invalid value; has to be positive", confContext)
+	}
+
+	if err := cs.Resources.Validate("resources"); err != nil {
+		return err
+	}
+	cs.separateDisabledResources(confContext)
+	cs.logResourcesAvailability(confContext)
+	if err := cs.validateRegistryReferences(confContext); err != nil {
+		return err
+	}
+
+	if cs.ExceedsMaximumResources(len(cs.Resources), true) {
+		log.Warn().
+			Int("maximumResources", cs.MaximumResources).
+			Int("numResources", len(cs.Resources)).
+			Msgf(
+				"more resources configured than %s.maximumResources, searches without x-fcs-context will be rejected",
+				confContext)
+	}
+	return nil
+}
+
+// QueryLimits returns configured query complexity limits
+func (cs *CorporaSetup) QueryLimits() query.Limits {
+	return query.Limits{
+		MaxLength: cs.MaximumQueryLength,
+		MaxTerms:  cs.MaximumQueryTerms,
+		MaxDepth:  cs.MaximumQueryDepth,
+	}
 }
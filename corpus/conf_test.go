@@ -0,0 +1,321 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package corpus
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindByPIDPattern(t *testing.T) {
+	resources := SrchResources{
+		{ID: "syn2020", PID: "cs_syn2020"},
+		{ID: "syn2015", PID: "cs_syn2015"},
+		{ID: "intercorp_en", PID: "en_intercorp"},
+	}
+	assert.True(t, IsPIDPattern("all"))
+	assert.True(t, IsPIDPattern("cs_*"))
+	assert.False(t, IsPIDPattern("cs_syn2020"))
+
+	ans, err := resources.FindByPIDPattern("all")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"syn2020", "syn2015", "intercorp_en"}, ans)
+
+	ans, err = resources.FindByPIDPattern("cs_*")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"syn2020", "syn2015"}, ans)
+
+	ans, err = resources.FindByPIDPattern("de_*")
+	assert.NoError(t, err)
+	assert.Empty(t, ans)
+
+	_, err = resources.FindByPIDPattern("cs_[")
+	assert.Error(t, err)
+}
+
+func TestPosAttrsOfDisjointResources(t *testing.T) {
+	resources := SrchResources{
+		{
+			ID: "corp1",
+			PosAttrs: []PosAttr{
+				{Name: "tag", Layer: LayerTypePOS},
+				{Name: "word", Layer: LayerTypeText, IsLayerDefault: true},
+				{Name: "lemma", Layer: LayerTypeLemma},
+			},
+		},
+		{
+			ID: "corp2",
+			PosAttrs: []PosAttr{
+				{Name: "pos", Layer: LayerTypePOS},
+				{Name: "form", Layer: LayerTypeText, IsBasicSearchAttr: true},
+				{Name: "base", Layer: LayerTypeLemma},
+			},
+		},
+	}
+	common, err := resources.GetCommonPosAttrs("corp1", "corp2")
+	assert.NoError(t, err)
+	assert.Empty(t, common)
+
+	corp1, err := resources.GetResource("corp1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"word", "lemma", "tag"}, corp1.GetSortedPosAttrNames())
+
+	// no text layer default => the basic search attr goes first
+	corp2, err := resources.GetResource("corp2")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"form", "base", "pos"}, corp2.GetSortedPosAttrNames())
+	// the original attributes must stay untouched
+	assert.Equal(t, "pos", corp2.PosAttrs[0].Name)
+}
+
+func TestIsURI(t *testing.T) {
+	assert.True(t, isURI("http://hdl.handle.net/11234/1-1234"))
+	assert.True(t, isURI("https://doi.org/10.1234/abcd"))
+	assert.True(t, isURI("hdl:11234/1-1234"))
+	assert.False(t, isURI("syn2020"))
+	assert.False(t, isURI("cs_syn2020"))
+	assert.False(t, isURI(""))
+	assert.False(t, isURI("http://"))
+}
+
+func TestSplitStructAttr(t *testing.T) {
+	structName, attrName, ok := SplitStructAttr("doc.id")
+	assert.True(t, ok)
+	assert.Equal(t, "doc", structName)
+	assert.Equal(t, "id", attrName)
+	for _, v := range []string{"doc", "doc.", ".id", "doc.id.x", "doc id.x"} {
+		_, _, ok := SplitStructAttr(v)
+		assert.False(t, ok, v)
+	}
+}
+
+func TestResolveRegistryPath(t *testing.T) {
+	regDir := t.TempDir()
+	mirrorDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(regDir, "syn2020"), []byte("ATTRIBUTE word\n"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(mirrorDir, "syn2015"), []byte("ATTRIBUTE word\n"), 0644))
+	assert.NoError(t, os.Mkdir(filepath.Join(regDir, "intercorp_en"), 0755))
+	cs := CorporaSetup{
+		RegistryDir: regDir,
+		Resources: SrchResources{
+			{ID: "syn2020", FallbackRegistryPath: filepath.Join(mirrorDir, "syn2020")},
+			{ID: "syn2015", FallbackRegistryPath: filepath.Join(mirrorDir, "syn2015")},
+			{ID: "intercorp_en"},
+		},
+	}
+
+	path, err := cs.ResolveRegistryPath("syn2020")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(regDir, "syn2020"), path)
+
+	path, err = cs.ResolveRegistryPath("syn2015")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(mirrorDir, "syn2015"), path)
+
+	_, err = cs.ResolveRegistryPath("intercorp_en")
+	assert.ErrorIs(t, err, ErrResourceUnavailable)
+
+	_, err = cs.ResolveRegistryPath("unknown")
+	assert.ErrorIs(t, err, ErrResourceNotFound)
+}
+
+func TestResolveShards(t *testing.T) {
+	regDir := t.TempDir()
+	shardsDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(regDir, "syn2020"), []byte("ATTRIBUTE word\n"), 0644))
+	for _, name := range []string{"news2019", "news2020"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(shardsDir, name), []byte("ATTRIBUTE word\n"), 0644))
+	}
+	cs := CorporaSetup{
+		RegistryDir: regDir,
+		Resources: SrchResources{
+			{ID: "syn2020"},
+			{
+				ID: "news",
+				RegistryPaths: []string{
+					filepath.Join(shardsDir, "news2019"),
+					filepath.Join(shardsDir, "news2020"),
+				},
+			},
+			{
+				ID: "oral",
+				RegistryPaths: []string{
+					filepath.Join(shardsDir, "news2019"),
+					filepath.Join(shardsDir, "oral2020"),
+				},
+			},
+		},
+	}
+
+	shards, err := cs.ResolveShards("syn2020")
+	assert.NoError(t, err)
+	assert.Equal(t, []CorpusShard{{ID: "syn2020", RegistryPath: filepath.Join(regDir, "syn2020")}}, shards)
+
+	shards, err = cs.ResolveShards("news")
+	assert.NoError(t, err)
+	assert.Equal(
+		t,
+		[]CorpusShard{
+			{ID: "news#0", RegistryPath: filepath.Join(shardsDir, "news2019")},
+			{ID: "news#1", RegistryPath: filepath.Join(shardsDir, "news2020")},
+		},
+		shards,
+	)
+	for _, shard := range shards {
+		res, err := cs.Resources.GetResource(shard.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "news", res.ID)
+		assert.Equal(t, "news", ShardResourceID(shard.ID))
+	}
+
+	// a single missing shard makes the whole resource unavailable
+	_, err = cs.ResolveShards("oral")
+	assert.ErrorIs(t, err, ErrResourceUnavailable)
+
+	_, err = cs.ResolveShards("unknown")
+	assert.ErrorIs(t, err, ErrResourceNotFound)
+}
+
+func TestGetAllPosAttrs(t *testing.T) {
+	resources := SrchResources{
+		{
+			ID: "c1",
+			PosAttrs: []PosAttr{
+				{ID: "word", Name: "word", Layer: LayerTypeText, IsLayerDefault: true},
+				{ID: "lemma", Name: "lemma", Layer: LayerTypeLemma},
+			},
+		},
+		{
+			ID: "c2",
+			PosAttrs: []PosAttr{
+				{ID: "word", Name: "word", Layer: LayerTypeText, IsLayerDefault: true},
+				{ID: "phon", Name: "phon", Layer: LayerTypePhonetic},
+			},
+		},
+	}
+	ids := make([]string, 0, 3)
+	for _, pa := range resources.GetAllPosAttrs() {
+		ids = append(ids, pa.ID)
+	}
+	assert.Equal(t, []string{"word", "lemma", "phon"}, ids)
+}
+
+func TestExceedsMaximumResources(t *testing.T) {
+	conf := &CorporaSetup{}
+	assert.False(t, conf.ExceedsMaximumResources(100, false))
+	assert.False(t, conf.ExceedsMaximumResources(100, true))
+	conf.MaximumResources = 2
+	assert.False(t, conf.ExceedsMaximumResources(2, false))
+	assert.True(t, conf.ExceedsMaximumResources(3, false))
+	assert.True(t, conf.ExceedsMaximumResources(3, true))
+	conf.MaximumResourcesExemptDefault = true
+	assert.True(t, conf.ExceedsMaximumResources(3, false))
+	assert.False(t, conf.ExceedsMaximumResources(3, true))
+}
+
+func TestBackendLines(t *testing.T) {
+	conf := &CorporaSetup{MaximumBackendLines: 100}
+	assert.Equal(t, 50, conf.BackendLines(0, 50))
+	assert.Equal(t, 50, conf.BackendLines(30, 80))
+	assert.Equal(t, 100, conf.BackendLines(0, 500))
+	assert.Equal(t, 0, conf.BackendLines(10, 10))
+	conf.MaximumBackendLines = 0
+	assert.Equal(t, 500, conf.BackendLines(0, 500))
+}
+
+func TestValidateMaximumBackendLines(t *testing.T) {
+	dir := t.TempDir()
+	conf := &CorporaSetup{RegistryDir: dir}
+	assert.NoError(t, conf.ValidateAndDefaults("corpora"))
+	assert.Equal(t, 1000, conf.MaximumBackendLines)
+
+	conf = &CorporaSetup{RegistryDir: dir, MaximumBackendLines: 100, MaximumResultSetTTL: 60}
+	assert.NoError(t, conf.ValidateAndDefaults("corpora"))
+	assert.Equal(t, 100, conf.ResultSetWindow)
+
+	conf = &CorporaSetup{RegistryDir: dir, MaximumBackendLines: 20, MaximumRecords: 50}
+	assert.EqualError(
+		t,
+		conf.ValidateAndDefaults("corpora"),
+		"`corpora.maximumRecords` must be at most 20 (maximumBackendLines)",
+	)
+
+	conf = &CorporaSetup{RegistryDir: dir, MaximumBackendLines: 100, ResultSetWindow: 200}
+	assert.Error(t, conf.ValidateAndDefaults("corpora"))
+
+	conf = &CorporaSetup{RegistryDir: dir, MaximumBackendLines: 5000}
+	assert.Error(t, conf.ValidateAndDefaults("corpora"))
+}
+
+func TestHitsPerMillion(t *testing.T) {
+	res := &CorpusSetup{ID: "syn2020"}
+	_, ok := res.HitsPerMillion(10, 0)
+	assert.False(t, ok)
+	ipm, ok := res.HitsPerMillion(1267, 100000000)
+	assert.True(t, ok)
+	assert.Equal(t, 12.67, ipm)
+
+	res.Size = 1000000
+	assert.Equal(t, int64(1000000), res.CorpusSize(100000000))
+	ipm, ok = res.HitsPerMillion(25, 0)
+	assert.True(t, ok)
+	assert.Equal(t, 25.0, ipm)
+}
+
+func TestSplitAttrValue(t *testing.T) {
+	res := &CorpusSetup{MultiValueSeparator: "|"}
+	multi := PosAttr{Name: "tag", IsMultiValue: true}
+	single := PosAttr{Name: "word"}
+	assert.Equal(t, []string{"N", "NP"}, res.SplitAttrValue(multi, "N|NP"))
+	assert.Equal(t, []string{"N"}, res.SplitAttrValue(multi, "N"))
+	assert.Equal(t, []string{"N", "NP"}, res.SplitAttrValue(multi, "N||NP|"))
+	assert.Equal(t, []string{"|"}, res.SplitAttrValue(multi, "|"))
+	assert.Equal(t, []string{"a|b"}, res.SplitAttrValue(single, "a|b"))
+}
+
+func TestGetRefStructAttrs(t *testing.T) {
+	res := &CorpusSetup{RefStructAttrs: []string{"doc.id"}}
+	assert.Equal(t, []string{"doc.id"}, res.GetRefStructAttrs())
+	res.SentenceRefAttr = "s.id"
+	assert.Equal(t, []string{"doc.id", "s.id"}, res.GetRefStructAttrs())
+	assert.Equal(t, []string{"doc.id"}, res.RefStructAttrs)
+	res.SentenceRefAttr = "doc.id"
+	assert.Equal(t, []string{"doc.id"}, res.GetRefStructAttrs())
+	res.SentenceRefAttr = "s.id"
+	res.MetadataAttrs = []string{"doc.author", "doc.id", "doc.title"}
+	assert.Equal(t, []string{"doc.id", "s.id", "doc.author", "doc.title"}, res.GetRefStructAttrs())
+	assert.Equal(t, []string{"doc.id"}, res.RefStructAttrs)
+}
+
+func TestHasStruct(t *testing.T) {
+	res := &CorpusSetup{
+		StructureMapping:  StructureMapping{SentenceStruct: "s", ParagraphStruct: "p"},
+		ViewContextStruct: "sp",
+		RefStructAttrs:    []string{"doc.id"},
+	}
+	assert.True(t, res.HasStruct("s"))
+	assert.True(t, res.HasStruct("p"))
+	assert.True(t, res.HasStruct("sp"))
+	assert.True(t, res.HasStruct("doc"))
+	assert.False(t, res.HasStruct("text"))
+	assert.False(t, res.HasStruct(""))
+}
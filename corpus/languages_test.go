@@ -0,0 +1,45 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package corpus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeLanguageCode(t *testing.T) {
+	for code, expected := range map[string]string{
+		"cs":  "ces",
+		"en":  "eng",
+		"ces": "ces",
+		"hsb": "hsb", // no ISO 639-1 counterpart
+	} {
+		v, err := NormalizeLanguageCode(code)
+		assert.NoError(t, err, code)
+		assert.Equal(t, expected, v, code)
+	}
+}
+
+func TestNormalizeLanguageCodeRejectsInvalid(t *testing.T) {
+	for _, code := range []string{"xyz", "zzz", "xx", "CES", "czech", ""} {
+		_, err := NormalizeLanguageCode(code)
+		assert.Error(t, err, code)
+	}
+}
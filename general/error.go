@@ -48,6 +48,8 @@ func (dc DiagnosticCode) AsMessage() string {
 		return "Unsupported context set"
 	case DCUnsupportedIndex:
 		return "Unsupported index"
+	case DCUnsupportedRelation:
+		return "Unsupported relation"
 	case DCDatabaseDoesNotExist:
 		return "Database does not exist"
 	case DCQuerySyntaxError:
@@ -56,6 +58,8 @@ func (dc DiagnosticCode) AsMessage() string {
 		return "Cannot process query; reason unknown"
 	case DCQueryFeatureUnsupported:
 		return "Query feature unsupported"
+	case DCResultSetDoesNotExist:
+		return "Result set does not exist"
 	case DCTooManyMatchingRecords:
 		return "Result set not created: too many matching records"
 	case DCFirstRecordPosOutOfRange:
@@ -64,6 +68,8 @@ func (dc DiagnosticCode) AsMessage() string {
 		return "Unknown schema for retrieval"
 	case DCUnsupportedRecordPacking:
 		return "Unsupported record packing"
+	case DCResponsePositionOutOfRange:
+		return "Response position out of range"
 	}
 	return "??"
 }
@@ -77,9 +83,35 @@ const (
 	DTGeneralQuerySyntaxError               DiagnosticType = 10 // fatal, return only this one
 	DTQueryTooComplex                       DiagnosticType = 11 // fatal, return only this one
 	DTQueryWasRewritten                     DiagnosticType = 12 // non-fatal, only advanced query with `x-fcs-rewrites-allowed`
-	DTGeneralProcessingHint                 DiagnosticType = 14 // non-fatal, only advanced query
+	DTGeneralProcessingHint                 DiagnosticType = 14 // non-fatal
 )
 
+// non-standard (MQuery-SRU specific) diagnostic types for situations
+// not covered by FCS (see DiagnosticType.URI)
+const (
+	// DTResourceRequiresAuthentication reports a resource left out
+	// of a search because the client is not authorized to access it
+	DTResourceRequiresAuthentication DiagnosticType = 101 // non-fatal
+
+	// DTResourceTemporarilyUnavailable reports a resource left out
+	// of a search because it cannot be searched at the moment
+	// (e.g. due to a missing registry file)
+	DTResourceTemporarilyUnavailable DiagnosticType = 102 // non-fatal
+)
+
+// dtFirstNonStandard is the lowest value of non-standard diagnostic types
+const dtFirstNonStandard DiagnosticType = 100
+
+// URI returns an identifier of the diagnostic type as defined
+// by the CLARIN FCS specification. Non-standard diagnostic types
+// are identified within the MQuery-SRU namespace.
+func (dt DiagnosticType) URI() string {
+	if dt >= dtFirstNonStandard {
+		return fmt.Sprintf("https://github.com/czcorpus/mquery-sru/diagnostic/%d", dt)
+	}
+	return fmt.Sprintf("http://clarin.eu/fcs/diagnostic/%d", dt)
+}
+
 // https://www.loc.gov/standards/sru/diagnostics/diagnosticsList.html
 // used with diagnostic type 1
 const (
@@ -97,14 +129,19 @@ const (
 	DCQuerySyntaxError        DiagnosticCode = 10
 	DCUnsupportedContextSet   DiagnosticCode = 15
 	DCUnsupportedIndex        DiagnosticCode = 16
+	DCUnsupportedRelation     DiagnosticCode = 19
 	DCQueryCannotProcess      DiagnosticCode = 47
 	DCQueryFeatureUnsupported DiagnosticCode = 48
+	// Result set related diagnostics
+	DCResultSetDoesNotExist DiagnosticCode = 51
 	// Diagnostics Relating to Records
 	DCTooManyMatchingRecords    DiagnosticCode = 60
 	DCFirstRecordPosOutOfRange  DiagnosticCode = 61
 	DCUnknownSchemaForRetrieval DiagnosticCode = 66
 	// Records related diagnostics
 	DCUnsupportedRecordPacking DiagnosticCode = 71
+	// Scan related diagnostics
+	DCResponsePositionOutOfRange DiagnosticCode = 120
 )
 
 type FCSError struct {
@@ -18,6 +18,8 @@
 
 package general
 
+import "fmt"
+
 const (
 
 	// ConformantStatusBadRequest
@@ -39,8 +41,32 @@ const (
 	ConformandGeneralServerError = 200
 
 	RecordSchema = "http://clarin.eu/fcs/resource"
+
+	// RecordSchemaDC is a Dublin Core schema providing
+	// a simple summary of each record
+	RecordSchemaDC = "info:srw/schema/1/dc-v1.1"
 )
 
+// recordSchemaNames maps short schema names (as advertised
+// in explain) to schema identifiers
+var recordSchemaNames = map[string]string{
+	"fcs": RecordSchema,
+	"dc":  RecordSchemaDC,
+}
+
+// NormalizeRecordSchema validates a `recordSchema` value (either
+// a schema identifier or its short name) and returns the respective
+// schema identifier.
+func NormalizeRecordSchema(v string) (string, error) {
+	if v == RecordSchema || v == RecordSchemaDC {
+		return v, nil
+	}
+	if ident, ok := recordSchemaNames[v]; ok {
+		return ident, nil
+	}
+	return "", fmt.Errorf("unknown record schema: %s", v)
+}
+
 type FCSGeneralRequest struct {
 	Version string
 	Errors  []FCSError
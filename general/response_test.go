@@ -0,0 +1,40 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package general
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeRecordSchema(t *testing.T) {
+	for _, v := range []string{"fcs", RecordSchema} {
+		ident, err := NormalizeRecordSchema(v)
+		assert.NoError(t, err)
+		assert.Equal(t, RecordSchema, ident)
+	}
+	for _, v := range []string{"dc", RecordSchemaDC} {
+		ident, err := NormalizeRecordSchema(v)
+		assert.NoError(t, err)
+		assert.Equal(t, RecordSchemaDC, ident)
+	}
+	_, err := NormalizeRecordSchema("info:srw/schema/1/mods-v3.3")
+	assert.Error(t, err)
+}
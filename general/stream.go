@@ -0,0 +1,73 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package general
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+)
+
+// streamFlushBytes specifies how often (in written bytes)
+// a streamed response is flushed to the client
+const streamFlushBytes = 64 * 1024
+
+// flushingWriter is a writer which flushes the underlying
+// writer (if it supports flushing) after each `flushEvery` bytes.
+type flushingWriter struct {
+	w          io.Writer
+	flushEvery int
+	sinceFlush int
+}
+
+func (fw *flushingWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	fw.sinceFlush += n
+	if fw.sinceFlush >= fw.flushEvery {
+		fw.Flush()
+	}
+	return n, err
+}
+
+func (fw *flushingWriter) Flush() {
+	if flusher, ok := fw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	fw.sinceFlush = 0
+}
+
+// StreamXML encodes data as an indented XML document (including the XML
+// declaration and an optional stylesheet instruction) directly to the writer.
+// Unlike xml.MarshalIndent, the document is never kept in memory as a whole
+// and the writer is flushed periodically so the client can start consuming
+// large responses early. The produced document is the same as the one
+// created by xml.MarshalIndent(data, "", "  ").
+func StreamXML(w io.Writer, xslt string, data any) error {
+	fw := &flushingWriter{w: w, flushEvery: streamFlushBytes}
+	if _, err := io.WriteString(fw, xml.Header+GetXSLTHeader(xslt)); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(fw)
+	enc.Indent("", "  ")
+	if err := enc.Encode(data); err != nil {
+		return err
+	}
+	fw.Flush()
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package general
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testDoc struct {
+	XMLName xml.Name `xml:"doc"`
+	Items   []string `xml:"items>item"`
+}
+
+func TestStreamXMLMatchesMarshalIndent(t *testing.T) {
+	doc := testDoc{}
+	for i := 0; i < 10000; i++ {
+		doc.Items = append(doc.Items, strings.Repeat("x", i%50))
+	}
+	expected, err := xml.MarshalIndent(doc, "", "  ")
+	assert.NoError(t, err)
+	var buf bytes.Buffer
+	assert.NoError(t, StreamXML(&buf, "style.xsl", doc))
+	assert.Equal(t, xml.Header+GetXSLTHeader("style.xsl")+string(expected), buf.String())
+}
+
+func TestStreamXMLFlushes(t *testing.T) {
+	doc := testDoc{}
+	for i := 0; i < 20000; i++ {
+		doc.Items = append(doc.Items, "item")
+	}
+	rec := httptest.NewRecorder()
+	assert.NoError(t, StreamXML(rec, "", doc))
+	assert.True(t, rec.Flushed)
+}
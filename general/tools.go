@@ -18,7 +18,21 @@
 
 package general
 
-import "fmt"
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var structNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+var resultSetQueryRegexp = regexp.MustCompile(`^\s*cql\.resultSetId\s*==?\s*"([^"]+)"\s*$`)
 
 func MapItems[K string, V any, T any](data map[K]V, mapFn func(k K, v V) T) []T {
 	ans := make([]T, len(data))
@@ -30,6 +44,59 @@ func MapItems[K string, V any, T any](data map[K]V, mapFn func(k K, v V) T) []T
 	return ans
 }
 
+// OrderedLanguages returns languages of a multi-language value
+// so that the one selected by SelectLanguage goes first and the
+// rest follows in alphabetical order.
+func OrderedLanguages[V any](data map[string]V, preferred string) []string {
+	ans := make([]string, 0, len(data))
+	for k := range data {
+		ans = append(ans, k)
+	}
+	sort.Strings(ans)
+	selected := SelectLanguage(data, preferred)
+	sort.SliceStable(ans, func(i, j int) bool {
+		return ans[i] == selected && ans[j] != selected
+	})
+	return ans
+}
+
+// MapLocalizedItems works like MapItems but the items are produced
+// in a deterministic order given by OrderedLanguages.
+func MapLocalizedItems[V any, T any](data map[string]V, preferred string, mapFn func(k string, v V) T) []T {
+	ans := make([]T, 0, len(data))
+	for _, lang := range OrderedLanguages(data, preferred) {
+		ans = append(ans, mapFn(lang, data[lang]))
+	}
+	return ans
+}
+
+// SelectLanguage picks a language from a multi-language value
+// in case a single-language string is required. The preferred
+// language is used if present, otherwise the first configured
+// language is used (in alphabetical order as the order of
+// keys in a JSON object is not preserved). For empty data,
+// an empty string is returned.
+func SelectLanguage[V any](data map[string]V, preferred string) string {
+	if _, ok := data[preferred]; ok {
+		return preferred
+	}
+	var ans string
+	for k := range data {
+		if ans == "" || k < ans {
+			ans = k
+		}
+	}
+	return ans
+}
+
+// LocalizedValue returns a value of a multi-language configuration
+// in the language selected by SelectLanguage. The second return
+// value is false for empty data.
+func LocalizedValue(data map[string]string, preferred string) (string, bool) {
+	v, ok := data[SelectLanguage(data, preferred)]
+	return v, ok
+}
+
 func ReturnIf[T any](cond bool, ifTrue T, ifFalse T) T {
 	if cond {
 		return ifTrue
@@ -43,3 +110,86 @@ func GetXSLTHeader(xslt string) string {
 	}
 	return ""
 }
+
+// ValidateStylesheetURL tests whether the provided value is
+// a relative or absolute (http/https) URL which can be safely
+// used within the `xml-stylesheet` processing instruction.
+func ValidateStylesheetURL(v string) (string, error) {
+	if strings.ContainsAny(v, "\"<>\\ \t\r\n") {
+		return "", errors.New("stylesheet URL contains invalid characters")
+	}
+	u, err := url.Parse(v)
+	if err != nil {
+		return "", fmt.Errorf("invalid stylesheet URL: %w", err)
+	}
+	if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported stylesheet URL scheme: %s", u.Scheme)
+	}
+	if u.Scheme != "" && u.Host == "" {
+		return "", errors.New("invalid stylesheet URL: missing host")
+	}
+	return v, nil
+}
+
+// IsValidStructName tests whether the provided value can be
+// used as a corpus structure name (e.g. `s`, `doc`, `sp`).
+func IsValidStructName(v string) bool {
+	return structNameRegexp.MatchString(v)
+}
+
+// EncodeResultSetID creates an opaque identifier of a result set
+// defined by the provided search arguments. The arguments are
+// contained within the identifier so the search can be repeated
+// in case the cached result set is not available anymore.
+func EncodeResultSetID(args map[string]string) string {
+	data, err := json.Marshal(args)
+	if err != nil {
+		// a map of strings is always serializable
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeResultSetID returns search arguments of a result set
+// identifier created by EncodeResultSetID.
+func DecodeResultSetID(id string) (map[string]string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid result set identifier: %w", err)
+	}
+	var ans map[string]string
+	if err := json.Unmarshal(data, &ans); err != nil {
+		return nil, fmt.Errorf("invalid result set identifier: %w", err)
+	}
+	return ans, nil
+}
+
+// ResultSetIDFromQuery extracts a result set identifier from a query
+// referring to a previously returned result set (`cql.resultSetId="..."`).
+func ResultSetIDFromQuery(q string) (string, bool) {
+	srch := resultSetQueryRegexp.FindStringSubmatch(q)
+	if srch == nil {
+		return "", false
+	}
+	return srch[1], true
+}
+
+// ETag creates a strong entity tag (including quotes)
+// for a response defined by the provided parameters.
+func ETag(params ...string) string {
+	return fmt.Sprintf(
+		"\"%x\"", sha1.Sum([]byte(strings.Join(params, "\x00"))))
+}
+
+// ETagMatches tests whether an `If-None-Match` header value
+// matches the provided entity tag. Weak comparison is used
+// as required for `If-None-Match` by RFC 9110.
+func ETagMatches(ifNoneMatch, etag string) bool {
+	for _, v := range strings.Split(ifNoneMatch, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == "*" || v == etag {
+			return true
+		}
+	}
+	return false
+}
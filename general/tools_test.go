@@ -0,0 +1,78 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package general
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectLanguage(t *testing.T) {
+	titles := map[string]string{"en": "Corpus", "cs": "Korpus", "de": "Korpus"}
+	assert.Equal(t, "de", SelectLanguage(titles, "de"))
+	assert.Equal(t, "cs", SelectLanguage(titles, "fr"))
+	assert.Equal(t, "cs", SelectLanguage(titles, ""))
+	assert.Equal(t, "", SelectLanguage(map[string]string{}, "en"))
+}
+
+func TestLocalizedValue(t *testing.T) {
+	titles := map[string]string{"en": "Corpus", "cs": "Korpus"}
+	v, ok := LocalizedValue(titles, "en")
+	assert.True(t, ok)
+	assert.Equal(t, "Corpus", v)
+	v, ok = LocalizedValue(titles, "fr")
+	assert.True(t, ok)
+	assert.Equal(t, "Korpus", v)
+	_, ok = LocalizedValue(nil, "en")
+	assert.False(t, ok)
+}
+
+func TestMapLocalizedItems(t *testing.T) {
+	titles := map[string]string{"en": "Corpus", "cs": "Korpus", "de": "Korpus", "sk": "Korpus"}
+	langs := MapLocalizedItems(titles, "en", func(k, v string) string { return k })
+	assert.Equal(t, []string{"en", "cs", "de", "sk"}, langs)
+	langs = MapLocalizedItems(titles, "fr", func(k, v string) string { return k })
+	assert.Equal(t, []string{"cs", "de", "en", "sk"}, langs)
+}
+
+func TestResultSetIDRoundTrip(t *testing.T) {
+	args := map[string]string{"query": `"dog"`, "x-fcs-context": "pid:1,pid:2"}
+	id := EncodeResultSetID(args)
+	assert.Equal(t, id, EncodeResultSetID(map[string]string{"x-fcs-context": "pid:1,pid:2", "query": `"dog"`}))
+	decoded, err := DecodeResultSetID(id)
+	assert.NoError(t, err)
+	assert.Equal(t, args, decoded)
+
+	_, err = DecodeResultSetID("foo")
+	assert.Error(t, err)
+}
+
+func TestResultSetIDFromQuery(t *testing.T) {
+	id, ok := ResultSetIDFromQuery(`cql.resultSetId = "abc_1"`)
+	assert.True(t, ok)
+	assert.Equal(t, "abc_1", id)
+	id, ok = ResultSetIDFromQuery(`cql.resultSetId=="abc"`)
+	assert.True(t, ok)
+	assert.Equal(t, "abc", id)
+	_, ok = ResultSetIDFromQuery(`cql.resultSetId="abc" AND dog`)
+	assert.False(t, ok)
+	_, ok = ResultSetIDFromQuery(`dog`)
+	assert.False(t, ok)
+}
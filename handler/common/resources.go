@@ -0,0 +1,133 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/czcorpus/mquery-sru/auth"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+)
+
+// SearchedResources describes resources which can be searched
+// within a searchRetrieve request
+type SearchedResources struct {
+
+	// Corpora contains IDs of resources which can be searched
+	Corpora []string
+
+	// ShardIDs maps resource ID to IDs of its shards. Resources with
+	// multiple registry paths are searched in multiple corpora (shards)
+	// whose results are merged so each resource is still a single unit
+	// of the round robin selection.
+	ShardIDs map[string][]string
+
+	// RegistryPaths maps shard ID to registry path
+	RegistryPaths map[string]string
+
+	// Dropped contains non-fatal diagnostics describing
+	// resources left out of the search
+	Dropped []general.FCSError
+}
+
+// FilterResources drops restricted resources the client is not authorized
+// to access and resources which are currently unavailable (e.g. due to
+// a missing registry file) and resolves shards of the remaining resources.
+// Dropping a resource is not fatal as the remaining resources can still
+// be searched. Only in case of a strict search, the first dropped resource
+// is reported as a fatal error along with the respective HTTP status.
+// Unknown resources are skipped silently.
+func FilterResources(
+	ctx *gin.Context,
+	corporaConf *corpus.CorporaSetup,
+	authenticator auth.Authenticator,
+	corpora []string,
+	strict bool,
+) (SearchedResources, *general.FCSError, int) {
+	ans := SearchedResources{
+		Corpora:       make([]string, 0, len(corpora)),
+		ShardIDs:      make(map[string][]string),
+		RegistryPaths: make(map[string]string),
+	}
+	for _, corpusID := range corpora {
+		res, err := corporaConf.Resources.GetResource(corpusID)
+		if err == nil && res.IsRestricted() && !authenticator.IsAuthorized(ctx, res) {
+			msg := fmt.Sprintf("Resource %s requires authentication", res.PID)
+			if strict {
+				return ans, &general.FCSError{
+					Code:    general.DCAuthenticationError,
+					Ident:   res.PID,
+					Message: msg,
+				}, general.ConformandGeneralServerError
+			}
+			// a diagnostic code would make the diagnostic fatal
+			// so we report just the non-fatal diagnostic type
+			ans.Dropped = append(ans.Dropped, general.FCSError{
+				Type:    general.DTResourceRequiresAuthentication,
+				Ident:   res.PID,
+				Message: msg,
+			})
+			continue
+		}
+		shards, err := corporaConf.ResolveShards(corpusID)
+		if err == corpus.ErrResourceUnavailable {
+			log.Warn().
+				Str("resource", corpusID).
+				Msg("configured resource currently unavailable, skipping")
+			msg := fmt.Sprintf("Resource %s is temporarily unavailable", res.PID)
+			if strict {
+				return ans, &general.FCSError{
+					Code:    general.DCSystemTemporarilyUnavailable,
+					Ident:   res.PID,
+					Message: msg,
+				}, http.StatusServiceUnavailable
+			}
+			ans.Dropped = append(ans.Dropped, general.FCSError{
+				Type:    general.DTResourceTemporarilyUnavailable,
+				Ident:   res.PID,
+				Message: msg,
+			})
+			continue
+
+		} else if err != nil {
+			log.Warn().
+				Err(err).
+				Str("resource", corpusID).
+				Msg("unknown resource, skipping")
+			continue
+
+		} else if len(res.RegistryPaths) == 0 && shards[0].RegistryPath != corporaConf.GetRegistryPath(corpusID) {
+			log.Debug().
+				Str("resource", corpusID).
+				Str("registryPath", shards[0].RegistryPath).
+				Msg("using fallback registry")
+		}
+		ans.ShardIDs[corpusID] = make([]string, len(shards))
+		for i, shard := range shards {
+			ans.RegistryPaths[shard.ID] = shard.RegistryPath
+			ans.ShardIDs[corpusID][i] = shard.ID
+		}
+		ans.Corpora = append(ans.Corpora, corpusID)
+	}
+	return ans, nil, http.StatusOK
+}
@@ -0,0 +1,107 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/auth"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func createFilterTestConf(t *testing.T) *corpus.CorporaSetup {
+	regDir := t.TempDir()
+	// note: registry of the `oral` resource is missing (i.e. it is unavailable)
+	for _, name := range []string{"syn2020", "syn2015", "news2019", "news2020"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(regDir, name), []byte{}, 0644))
+	}
+	return &corpus.CorporaSetup{
+		RegistryDir: regDir,
+		Resources: corpus.SrchResources{
+			{ID: "syn2020", PID: "pid:syn2020"},
+			{ID: "oral", PID: "pid:oral"},
+			{
+				ID:                      "syn2015",
+				PID:                     "pid:syn2015",
+				AvailabilityRestriction: corpus.AvailabilityRestrictionAuthOnly,
+			},
+			{
+				ID:  "news",
+				PID: "pid:news",
+				RegistryPaths: []string{
+					filepath.Join(regDir, "news2019"),
+					filepath.Join(regDir, "news2020"),
+				},
+			},
+		},
+	}
+}
+
+func TestFilterResources(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/", nil)
+	conf := createFilterTestConf(t)
+	ans, fcsErr, status := FilterResources(
+		ctx, conf, auth.NewAuthenticator(nil),
+		[]string{"syn2020", "oral", "syn2015", "news", "unknown"}, false)
+	assert.Nil(t, fcsErr)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{"syn2020", "news"}, ans.Corpora)
+	assert.Equal(t, []string{"syn2020"}, ans.ShardIDs["syn2020"])
+	assert.Equal(t, []string{"news#0", "news#1"}, ans.ShardIDs["news"])
+	assert.Equal(t, filepath.Join(conf.RegistryDir, "news2020"), ans.RegistryPaths["news#1"])
+	if assert.Len(t, ans.Dropped, 2) {
+		assert.Equal(t, general.DTResourceTemporarilyUnavailable, ans.Dropped[0].Type)
+		assert.Equal(t, "pid:oral", ans.Dropped[0].Ident)
+		assert.False(t, ans.Dropped[0].IsFatal())
+		assert.Equal(t, general.DTResourceRequiresAuthentication, ans.Dropped[1].Type)
+		assert.Equal(t, "pid:syn2015", ans.Dropped[1].Ident)
+		assert.False(t, ans.Dropped[1].IsFatal())
+	}
+}
+
+func TestFilterResourcesStrict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/", nil)
+	conf := createFilterTestConf(t)
+
+	_, fcsErr, status := FilterResources(
+		ctx, conf, auth.NewAuthenticator(nil), []string{"syn2020", "oral"}, true)
+	if assert.NotNil(t, fcsErr) {
+		assert.Equal(t, general.DCSystemTemporarilyUnavailable, fcsErr.Code)
+		assert.Equal(t, "pid:oral", fcsErr.Ident)
+	}
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+
+	_, fcsErr, status = FilterResources(
+		ctx, conf, auth.NewAuthenticator(nil), []string{"syn2015"}, true)
+	if assert.NotNil(t, fcsErr) {
+		assert.Equal(t, general.DCAuthenticationError, fcsErr.Code)
+	}
+	assert.Equal(t, general.ConformandGeneralServerError, status)
+}
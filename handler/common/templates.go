@@ -23,6 +23,7 @@ import (
 	"text/template"
 
 	"github.com/czcorpus/cnc-gokit/strutil"
+	"github.com/czcorpus/mquery-sru/general"
 )
 
 func GetTemplateFunctions() template.FuncMap {
@@ -44,5 +45,12 @@ func GetTemplateFunctions() template.FuncMap {
 			}
 			return v
 		},
+		"localizedMsgFrom": func(msg map[string]string, lang string) string {
+			v, ok := general.LocalizedValue(msg, lang)
+			if !ok {
+				return "??"
+			}
+			return v
+		},
 	}
 }
@@ -1,6 +1,8 @@
 package form
 
 import (
+	"bytes"
+	"embed"
 	"net/http"
 	"path/filepath"
 
@@ -11,39 +13,111 @@ import (
 	"text/template"
 
 	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
 )
 
+// defaultTemplates are used in case no custom
+// templates directory is configured
+//
+//go:embed templates/*
+var defaultTemplates embed.FS
+
 type FormHandler struct {
 	serverInfo *cnf.ServerInfo
 	conf       *corpus.CorporaSetup
 	tmpl       *template.Template
 }
 
-func (a *FormHandler) Handle(ctx *gin.Context) {
+func (a *FormHandler) render() ([]byte, error) {
 	tplData := map[string]any{
 		"Corpora":    a.conf.Resources.GetCorpora(),
 		"ServerInfo": a.serverInfo,
 	}
-	if err := a.tmpl.ExecuteTemplate(ctx.Writer, "form.html", tplData); err != nil {
-		ctx.AbortWithError(http.StatusInternalServerError, err)
+	var buf bytes.Buffer
+	if err := a.tmpl.ExecuteTemplate(&buf, "form.html", tplData); err != nil {
+		return []byte{}, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (a *FormHandler) Handle(ctx *gin.Context) {
+	data, err := a.render()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to render the form template")
+		ctx.Error(err)
+		ctx.String(http.StatusInternalServerError, "Failed to render the form")
 		return
 	}
-	ctx.Writer.WriteHeader(http.StatusOK)
+	ctx.Data(http.StatusOK, "text/html; charset=utf-8", data)
 }
 
+// hasTemplates tells whether a directory exists and contains
+// at least one file
+func hasTemplates(dir string) bool {
+	if dir == "" {
+		return false
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*"))
+	return err == nil && len(files) > 0
+}
+
+// loadTemplates parses templates from a directory or, in case
+// the directory is empty, the embedded default ones. Please note
+// that parsing also fails in case a template refers to a function
+// missing in common.GetTemplateFunctions.
+func loadTemplates(templatesDir string) (*template.Template, error) {
+	tmpl := template.New("").Funcs(common.GetTemplateFunctions())
+	if templatesDir != "" {
+		return tmpl.ParseGlob(filepath.Join(templatesDir, "*"))
+	}
+	return tmpl.ParseFS(defaultTemplates, "templates/*")
+}
+
+// NewFormHandler creates a new form handler. If templatesDir
+// is empty, missing or empty, embedded default templates are used.
+// The same applies in case the custom templates cannot be parsed
+// or rendered (e.g. they use an unknown function).
 func NewFormHandler(
 	serverInfo *cnf.ServerInfo,
 	conf *corpus.CorporaSetup,
-	projectRootDir string,
+	templatesDir string,
 ) *FormHandler {
-	path := filepath.Join(projectRootDir, "handler", "form", "templates")
-	tmpl := template.Must(
-		template.New("").
-			Funcs(common.GetTemplateFunctions()).
-			ParseGlob(path + "/*"))
-	return &FormHandler{
+	ans := &FormHandler{
 		serverInfo: serverInfo,
 		conf:       conf,
-		tmpl:       tmpl,
 	}
+	// Parsing reveals only syntax errors and unknown functions so we also
+	// render the template once to find out about possible references
+	// to missing fields etc. (the data does not change in runtime so this
+	// is sufficient)
+	if hasTemplates(templatesDir) {
+		tmpl, err := loadTemplates(templatesDir)
+		if err == nil {
+			ans.tmpl = tmpl
+			_, err = ans.render()
+		}
+		if err != nil {
+			log.Error().
+				Err(err).
+				Str("dir", templatesDir).
+				Msg("invalid form templates, using embedded templates")
+			ans.tmpl = nil
+		}
+
+	} else if templatesDir != "" {
+		log.Warn().
+			Str("dir", templatesDir).
+			Msg("form templates directory missing or empty, using embedded templates")
+	}
+	if ans.tmpl == nil {
+		tmpl, err := loadTemplates("")
+		if err != nil {
+			log.Fatal().Err(err).Msg("failed to parse the form template")
+		}
+		ans.tmpl = tmpl
+		if _, err := ans.render(); err != nil {
+			log.Fatal().Err(err).Msg("failed to render the form template")
+		}
+	}
+	return ans
 }
@@ -0,0 +1,104 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package form
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"text/template"
+
+	"github.com/czcorpus/mquery-sru/cnf"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormTemplateRenders(t *testing.T) {
+	handler := NewFormHandler(
+		&cnf.ServerInfo{
+			DatabaseTitle:   map[string]string{"en": "Test database"},
+			ExternalURLPath: "/fcs",
+		},
+		&corpus.CorporaSetup{
+			Resources: corpus.SrchResources{
+				{ID: "corpus1"},
+				{ID: "corpus2"},
+			},
+		},
+		"",
+	)
+	data, err := handler.render()
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "Test database")
+	assert.Contains(t, string(data), `value="corpus2"`)
+}
+
+func TestFormCustomTemplatesDir(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(
+		filepath.Join(dir, "form.html"),
+		[]byte("custom {{ enMsgFrom .ServerInfo.DatabaseTitle }}"),
+		0644,
+	))
+	serverInfo := &cnf.ServerInfo{DatabaseTitle: map[string]string{"en": "Test database"}}
+	handler := NewFormHandler(serverInfo, &corpus.CorporaSetup{}, dir)
+	data, err := handler.render()
+	assert.NoError(t, err)
+	assert.Equal(t, "custom Test database", string(data))
+
+	handler = NewFormHandler(serverInfo, &corpus.CorporaSetup{}, filepath.Join(dir, "missing"))
+	data, err = handler.render()
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "<!DOCTYPE html>")
+}
+
+func TestFormTemplateWithUnknownFunc(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(
+		filepath.Join(dir, "form.html"),
+		[]byte("custom {{ unknownFunc .ServerInfo.DatabaseTitle }}"),
+		0644,
+	))
+	_, err := loadTemplates(dir)
+	assert.ErrorContains(t, err, `function "unknownFunc" not defined`)
+
+	serverInfo := &cnf.ServerInfo{DatabaseTitle: map[string]string{"en": "Test database"}}
+	handler := NewFormHandler(serverInfo, &corpus.CorporaSetup{}, dir)
+	data, err := handler.render()
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "<!DOCTYPE html>")
+}
+
+func TestFormRenderFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := &FormHandler{
+		serverInfo: &cnf.ServerInfo{},
+		conf:       &corpus.CorporaSetup{},
+		tmpl:       template.Must(template.New("form.html").Parse(`{{ template "missing" }}`)),
+	}
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest("GET", "/ui/form", nil)
+	handler.Handle(ctx)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "Failed to render the form", w.Body.String())
+}
@@ -19,12 +19,19 @@
 package handler
 
 import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
 	"github.com/czcorpus/cnc-gokit/logging"
+	"github.com/czcorpus/mquery-sru/auth"
 	"github.com/czcorpus/mquery-sru/cnf"
 	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/czcorpus/mquery-sru/general"
 	v12 "github.com/czcorpus/mquery-sru/handler/v12"
 	v20 "github.com/czcorpus/mquery-sru/handler/v20"
+	"github.com/czcorpus/mquery-sru/ratelimit"
 	"github.com/czcorpus/mquery-sru/rdb"
 
 	"github.com/gin-gonic/gin"
@@ -35,7 +42,13 @@ const (
 	Version12 = "1.2"
 	Version20 = "2.0"
 
+	// DefaultVersion is used in case a request does not specify
+	// the version and no default one is configured
 	DefaultVersion = Version20
+
+	// HighestVersion is reported to clients requesting
+	// an unsupported version
+	HighestVersion = Version20
 )
 
 type FCSSubHandler interface {
@@ -44,13 +57,41 @@ type FCSSubHandler interface {
 		fcsGeneralRequest general.FCSGeneralRequest,
 		xslt map[string]string,
 	)
+	HandleError(ctx *gin.Context, code int, fcsErrors []general.FCSError)
 }
 
 type FCSHandler struct {
 	conf     *corpus.CorporaSetup
-	radapter *rdb.Adapter
+	radapter rdb.QueryPublisher
 
 	versions map[string]FCSSubHandler
+
+	// defaultVersion is used in case a request does not specify one
+	defaultVersion string
+}
+
+// getSubHandler returns a subhandler for the requested SRU version and
+// the version it actually handles. In case the version is not supported,
+// a subhandler of the same major version (if any) is used so a client
+// always gets a response of a version it understands (i.e. SRU 1.x clients
+// never get a 2.0 document and vice versa). Otherwise, the default version
+// is used.
+func (a *FCSHandler) getSubHandler(version string) (FCSSubHandler, string, bool) {
+	if version == "" {
+		version = a.defaultVersion
+	}
+	if handler, ok := a.versions[version]; ok {
+		return handler, version, true
+	}
+	major, _, _ := strings.Cut(version, ".")
+	for _, v := range []string{Version12, Version20} {
+		if strings.HasPrefix(v, major+".") {
+			if handler, ok := a.versions[v]; ok {
+				return handler, v, false
+			}
+		}
+	}
+	return a.versions[a.defaultVersion], a.defaultVersion, false
 }
 
 func (a *FCSHandler) FCSHandler(ctx *gin.Context) {
@@ -61,38 +102,83 @@ func (a *FCSHandler) FCSHandler(ctx *gin.Context) {
 }
 
 func (a *FCSHandler) handleWithXSLT(ctx *gin.Context, xslt map[string]string) {
+	reqVersion := ctx.Query("version")
+	handler, version, ok := a.getSubHandler(reqVersion)
 	req := general.FCSGeneralRequest{
-		Version: ctx.DefaultQuery("version", DefaultVersion),
+		Version: version,
 		Fatal:   false,
 		Errors:  make([]general.FCSError, 0, 10),
 	}
-	handler, ok := a.versions[req.Version]
 	if !ok {
-		handler = a.versions[DefaultVersion]
-		req.Version = DefaultVersion
 		req.AddError(general.FCSError{
 			Code:    general.DCUnsupportedVersion,
-			Ident:   DefaultVersion,
-			Message: "Unsupported version " + req.Version,
+			Ident:   HighestVersion,
+			Message: "Unsupported version " + reqVersion,
 		})
 	}
 	logging.AddLogEvent(ctx, "version", req.Version)
 	handler.Handle(ctx, req, xslt)
 }
 
+// RateLimit returns a middleware rejecting requests exceeding
+// limits of the provided limiter. Rejected requests get HTTP 429
+// along with a proper SRU diagnostic.
+func (a *FCSHandler) RateLimit(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if limiter.Allow(ctx.ClientIP()) {
+			ctx.Next()
+			return
+		}
+		logging.AddLogEvent(ctx, "rateLimited", true)
+		handler, _, _ := a.getSubHandler(ctx.Query("version"))
+		handler.HandleError(
+			ctx,
+			http.StatusTooManyRequests,
+			[]general.FCSError{
+				{
+					Code:    general.DCGeneralSystemError,
+					Ident:   "rate limit",
+					Message: "Too many requests, please try again later",
+				},
+			},
+		)
+		ctx.Abort()
+	}
+}
+
+// RequestTimeout returns a middleware limiting the time for processing
+// a request. Handlers waiting for results of workers give up once
+// the limit is exceeded and respond with HTTP 503 along with a proper
+// SRU diagnostic.
+func (a *FCSHandler) RequestTimeout(timeout time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		reqCtx, cancel := context.WithTimeout(ctx.Request.Context(), timeout)
+		defer cancel()
+		ctx.Request = ctx.Request.WithContext(reqCtx)
+		ctx.Next()
+	}
+}
+
 func NewFCSHandler(
 	serverInfo *cnf.ServerInfo,
 	corporaConf *corpus.CorporaSetup,
-	radapter *rdb.Adapter,
+	radapter rdb.QueryPublisher,
+	authenticator auth.Authenticator,
+	searchAnswerTimeout time.Duration,
 ) *FCSHandler {
+	dfltVersion := DefaultVersion
+	if serverInfo.DefaultVersion != "" {
+		dfltVersion = serverInfo.DefaultVersion
+	}
 	return &FCSHandler{
-		conf:     corporaConf,
-		radapter: radapter,
+		conf:           corporaConf,
+		radapter:       radapter,
+		defaultVersion: dfltVersion,
 		versions: map[string]FCSSubHandler{
 			Version12: v12.NewFCSSubHandlerV12(
-				serverInfo, corporaConf, radapter),
+				serverInfo, corporaConf, radapter, authenticator, searchAnswerTimeout),
 			Version20: v20.NewFCSSubHandlerV20(
-				serverInfo, corporaConf, radapter),
+				serverInfo, corporaConf, radapter, authenticator, searchAnswerTimeout),
 		},
 	}
 }
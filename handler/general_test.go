@@ -0,0 +1,226 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/czcorpus/mquery-sru/applog"
+	"github.com/czcorpus/mquery-sru/cnf"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/corpus/conc"
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/czcorpus/mquery-sru/rdb/rdbtest"
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+)
+
+// versionRecorder is a subhandler recording requests it handles
+type versionRecorder struct {
+	requests []general.FCSGeneralRequest
+}
+
+func (vr *versionRecorder) Handle(
+	ctx *gin.Context,
+	fcsGeneralRequest general.FCSGeneralRequest,
+	xslt map[string]string,
+) {
+	vr.requests = append(vr.requests, fcsGeneralRequest)
+}
+
+func (vr *versionRecorder) HandleError(ctx *gin.Context, code int, fcsErrors []general.FCSError) {
+}
+
+func createVersionsTestHandler(defaultVersion string) (*FCSHandler, *versionRecorder, *versionRecorder) {
+	h12 := &versionRecorder{}
+	h20 := &versionRecorder{}
+	return &FCSHandler{
+		versions:       map[string]FCSSubHandler{Version12: h12, Version20: h20},
+		defaultVersion: defaultVersion,
+	}, h12, h20
+}
+
+func handleVersion(handler *FCSHandler, args string) {
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/?"+args, nil)
+	handler.FCSHandler(ctx)
+}
+
+func TestVersionRouting(t *testing.T) {
+	handler, h12, h20 := createVersionsTestHandler(Version20)
+	handleVersion(handler, "operation=explain&version=1.2")
+	handleVersion(handler, "operation=explain&version=2.0")
+	handleVersion(handler, "operation=explain")
+	if assert.Len(t, h12.requests, 1) {
+		assert.Equal(t, Version12, h12.requests[0].Version)
+		assert.Empty(t, h12.requests[0].Errors)
+	}
+	if assert.Len(t, h20.requests, 2) {
+		assert.Equal(t, Version20, h20.requests[1].Version)
+		assert.Empty(t, h20.requests[1].Errors)
+	}
+}
+
+func TestConfiguredDefaultVersion(t *testing.T) {
+	handler, h12, h20 := createVersionsTestHandler(Version12)
+	handleVersion(handler, "operation=explain")
+	handleVersion(handler, "operation=explain&version=")
+	assert.Len(t, h12.requests, 2)
+	assert.Empty(t, h20.requests)
+}
+
+func TestUnsupportedVersionKeepsMajorVersion(t *testing.T) {
+	handler, h12, h20 := createVersionsTestHandler(Version20)
+	handleVersion(handler, "operation=explain&version=1.1")
+	handleVersion(handler, "operation=explain&version=2.1")
+	handleVersion(handler, "operation=explain&version=3.0")
+	if assert.Len(t, h12.requests, 1) {
+		assert.Equal(t, Version12, h12.requests[0].Version)
+		if assert.Len(t, h12.requests[0].Errors, 1) {
+			assert.Equal(t, general.DCUnsupportedVersion, h12.requests[0].Errors[0].Code)
+			assert.Equal(t, HighestVersion, h12.requests[0].Errors[0].Ident)
+			assert.Equal(t, "Unsupported version 1.1", h12.requests[0].Errors[0].Message)
+		}
+	}
+	if assert.Len(t, h20.requests, 2) {
+		for _, req := range h20.requests {
+			assert.Equal(t, Version20, req.Version)
+			assert.True(t, req.HasFatalError())
+		}
+	}
+}
+
+func TestGetSubHandler(t *testing.T) {
+	handler, h12, h20 := createVersionsTestHandler(Version20)
+	subHandler, version, ok := handler.getSubHandler("1.0")
+	assert.Same(t, h12, subHandler)
+	assert.Equal(t, Version12, version)
+	assert.False(t, ok)
+
+	subHandler, version, ok = handler.getSubHandler("")
+	assert.Same(t, h20, subHandler)
+	assert.Equal(t, Version20, version)
+	assert.True(t, ok)
+}
+
+func TestRequestTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler, _, _ := createVersionsTestHandler(Version20)
+	engine := gin.New()
+	var deadline time.Time
+	var hasDeadline bool
+	engine.GET("/", handler.RequestTimeout(2*time.Second), func(ctx *gin.Context) {
+		deadline, hasDeadline = ctx.Request.Context().Deadline()
+		assert.NoError(t, ctx.Request.Context().Err())
+	})
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	assert.True(t, hasDeadline)
+	assert.WithinDuration(t, time.Now().Add(2*time.Second), deadline, time.Second)
+}
+
+// logSearch runs a searchRetrieve request through the access log
+// middleware and returns the decoded access log record (i.e. the
+// last record written)
+func logSearch(t *testing.T, args string) map[string]any {
+	gin.SetMode(gin.TestMode)
+	var buff bytes.Buffer
+	origLogger := log.Logger
+	log.Logger = zerolog.New(&buff)
+	defer func() { log.Logger = origLogger }()
+
+	regDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(regDir, "syn2020"), []byte{}, 0644))
+	corporaConf := &corpus.CorporaSetup{
+		RegistryDir:    regDir,
+		MaximumRecords: 50,
+		DefaultRecords: 10,
+		Resources: corpus.SrchResources{
+			{
+				ID:  "syn2020",
+				PID: "pid:syn2020",
+				PosAttrs: []corpus.PosAttr{
+					{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true, IsBasicSearchAttr: true},
+				},
+				StructureMapping: corpus.StructureMapping{SentenceStruct: "s"},
+			},
+		},
+	}
+	radapter := rdbtest.NewAdapter(rdbtest.ConcExampleResponder(result.ConcExample{
+		Lines: []conc.ConcordanceLine{
+			{
+				Text: conc.TokenSlice{
+					{Word: "a", Attrs: map[string]string{"word": "a"}},
+					{Word: "dog", Strong: true, Attrs: map[string]string{"word": "dog"}},
+				},
+				Ref: "#1",
+			},
+		},
+		ConcSize:   1,
+		CorpusSize: 1000,
+	}))
+	handler := NewFCSHandler(&cnf.ServerInfo{Database: "test"}, corporaConf, radapter, nil, 0)
+	engine := gin.New()
+	engine.Use(applog.AccessLogMiddleware(false))
+	engine.GET("/", handler.FCSHandler)
+	engine.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/?"+args, nil))
+
+	lines := bytes.Split(bytes.TrimSpace(buff.Bytes()), []byte("\n"))
+	var record map[string]any
+	assert.NoError(t, json.Unmarshal(lines[len(lines)-1], &record))
+	return record
+}
+
+func TestSearchRetrieveLogEvents(t *testing.T) {
+	record := logSearch(t, "operation=searchRetrieve&version=2.0&query=dog&maximumRecords=5")
+	assert.Equal(t, float64(200), record["status"])
+	assert.Equal(t, Version20, record["version"])
+	assert.Equal(t, "searchRetrieve", record["operation"])
+	assert.Contains(t, record, "recordXMLEscaping")
+	assert.Equal(t, float64(1), record["numberOfRecords"])
+	assert.Equal(t, float64(1), record["returnedRecords"])
+	if args, ok := record["args"].(map[string]any); assert.True(t, ok) {
+		assert.Equal(t, "dog", args["query"])
+		assert.Equal(t, "test", args["corpus"])
+		assert.Equal(t, []any{"syn2020"}, args["sources"])
+		assert.Equal(t, float64(5), args["maximumRecords"])
+	}
+}
+
+func TestSearchRetrieveLogEventsV12(t *testing.T) {
+	record := logSearch(t, "operation=searchRetrieve&version=1.2&query=dog")
+	assert.Equal(t, float64(200), record["status"])
+	assert.Equal(t, Version12, record["version"])
+	assert.Equal(t, "searchRetrieve", record["operation"])
+	assert.Contains(t, record, "recordPacking")
+	assert.Equal(t, float64(1), record["numberOfRecords"])
+	if args, ok := record["args"].(map[string]any); assert.True(t, ok) {
+		assert.Equal(t, "dog", args["query"])
+		assert.Equal(t, []any{"syn2020"}, args["sources"])
+	}
+}
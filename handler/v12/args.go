@@ -21,8 +21,11 @@ package v12
 
 import (
 	"fmt"
+	"net/url"
+	"sort"
 	"strings"
 
+	"github.com/czcorpus/cnc-gokit/collections"
 	"github.com/gin-gonic/gin"
 )
 
@@ -31,7 +34,7 @@ const (
 	OperationScan          Operation     = "scan"
 	OperationSearchRetrive Operation     = "searchRetrieve"
 	RecordPackingXML       RecordPacking = "xml"
-	RecordPackingString    RecordPacking = "string" // TODO for now unsupported
+	RecordPackingString    RecordPacking = "string"
 
 	SearchRetrArgVersion       SearchRetrArg = "version"
 	SearchRetrStartRecord      SearchRetrArg = "startRecord"
@@ -42,6 +45,41 @@ const (
 	SearchRetrArgFCSContext    SearchRetrArg = "x-fcs-context"
 	SearchRetrArgFCSDataViews  SearchRetrArg = "x-fcs-dataviews"
 	SearchRetrArgRecordSchema  SearchRetrArg = "recordSchema"
+	SearchRetrArgStylesheet    SearchRetrArg = "stylesheet"
+	SearchRetrArgResultSetTTL  SearchRetrArg = "resultSetTTL"
+
+	// SearchRetrArgViewContextStruct is a non-standard argument
+	// allowing clients to override resource's `viewContextStruct`
+	SearchRetrArgViewContextStruct SearchRetrArg = "x-cnc-view-context-struct"
+
+	// SearchRetrArgSearchAttr is a non-standard argument allowing
+	// clients to search a specific attribute in basic queries
+	// (instead of the configured `isBasicSearchAttr` ones)
+	SearchRetrArgSearchAttr SearchRetrArg = "x-cnc-search-attr"
+
+	// SearchRetrArgResourceStats is a non-standard argument enabling
+	// per-resource statistics within `extraResponseData`
+	SearchRetrArgResourceStats SearchRetrArg = "x-cnc-resource-stats"
+
+	// SearchRetrArgIgnoreDiacritics is a non-standard argument enabling
+	// diacritics-insensitive basic search in resources with a configured
+	// `diacriticsFoldedAttr`
+	SearchRetrArgIgnoreDiacritics SearchRetrArg = "x-cnc-ignore-diacritics"
+
+	// SearchRetrArgWithin is a non-standard argument limiting basic
+	// queries to a structure specified by its FCS-QL context name
+	// (e.g. `sentence`, `p`; see resource's `structureMapping`)
+	SearchRetrArgWithin SearchRetrArg = "x-cnc-within"
+
+	// SearchRetrArgDebugQuery is a non-standard argument adding backend
+	// queries generated for individual resources to per-resource
+	// statistics (see `corpora.allowDebugQuery`)
+	SearchRetrArgDebugQuery SearchRetrArg = "x-cnc-debug-query"
+
+	// SearchRetrArgStrict is a non-standard argument making the search
+	// fail on the first resource which cannot be searched (instead
+	// of returning partial results, see `corpora.strictSearch`)
+	SearchRetrArgStrict SearchRetrArg = "x-cnc-strict"
 
 	ScanArgVersion          ScanArg = "version"
 	ScanArgOperation        ScanArg = "operation"
@@ -49,11 +87,13 @@ const (
 	ScanArgScanClause       ScanArg = "scanClause"
 	ScanArgMaximumTerms     ScanArg = "maximumTerms"
 	ScanArgResponsePosition ScanArg = "responsePosition"
+	ScanArgStylesheet       ScanArg = "stylesheet"
 
 	ExplainArgVersion                ExplainArg = "version"
 	ExplainArgRecordPacking          ExplainArg = "recordPacking"
 	ExplainArgOperation              ExplainArg = "operation"
 	ExplainArgFCSEndpointDescription ExplainArg = "x-fcs-endpoint-description"
+	ExplainArgStylesheet             ExplainArg = "stylesheet"
 )
 
 type Operation string
@@ -74,8 +114,10 @@ func (op Operation) Validate() error {
 
 type RecordPacking string
 
-func (rp RecordPacking) Validate() error {
-	if rp == RecordPackingXML {
+// Validate tests whether the record packing is among the supported ones
+// (see serverInfo.supportedRecordPackings)
+func (rp RecordPacking) Validate(supported []RecordPacking) error {
+	if collections.SliceContains(supported, rp) {
 		return nil
 	}
 	return fmt.Errorf("unsupported record packing: %s", rp)
@@ -94,7 +136,16 @@ func (sra SearchRetrArg) Validate() error {
 		sra == SearchRetrArgQuery ||
 		sra == SearchRetrArgFCSContext ||
 		sra == SearchRetrArgRecordSchema ||
-		sra == SearchRetrArgFCSDataViews {
+		sra == SearchRetrArgFCSDataViews ||
+		sra == SearchRetrArgStylesheet ||
+		sra == SearchRetrArgResultSetTTL ||
+		sra == SearchRetrArgViewContextStruct ||
+		sra == SearchRetrArgSearchAttr ||
+		sra == SearchRetrArgResourceStats ||
+		sra == SearchRetrArgIgnoreDiacritics ||
+		sra == SearchRetrArgWithin ||
+		sra == SearchRetrArgDebugQuery ||
+		sra == SearchRetrArgStrict {
 		return nil
 	}
 	return fmt.Errorf("unknown searchRetrieve argument: %s", sra)
@@ -104,6 +155,18 @@ func (sra SearchRetrArg) String() string {
 	return string(sra)
 }
 
+// resultSetArgs are arguments defining a search. They are stored
+// within result set identifiers so a search can be referred
+// to via `cql.resultSetId`.
+var resultSetArgs = []SearchRetrArg{
+	SearchRetrArgQuery,
+	SearchRetrArgFCSContext,
+	SearchRetrArgSearchAttr,
+	SearchRetrArgWithin,
+	SearchRetrArgIgnoreDiacritics,
+	SearchRetrArgViewContextStruct,
+}
+
 // -----
 
 type ScanArg string
@@ -118,7 +181,8 @@ func (sa ScanArg) Validate() error {
 		sa == ScanArgRecordPacking ||
 		sa == ScanArgScanClause ||
 		sa == ScanArgMaximumTerms ||
-		sa == ScanArgResponsePosition {
+		sa == ScanArgResponsePosition ||
+		sa == ScanArgStylesheet {
 		return nil
 	}
 	return fmt.Errorf("unknown scan argument: %s", sa)
@@ -132,7 +196,8 @@ func (arg ExplainArg) Validate() error {
 	if arg == ExplainArgVersion ||
 		arg == ExplainArgRecordPacking ||
 		arg == ExplainArgOperation ||
-		arg == ExplainArgFCSEndpointDescription {
+		arg == ExplainArgFCSEndpointDescription ||
+		arg == ExplainArgStylesheet {
 		return nil
 	}
 	return fmt.Errorf("unknown explain argument: %s", arg)
@@ -144,6 +209,27 @@ func (arg ExplainArg) String() string {
 
 // ----
 
+// detectOperation determines the requested operation. The precedence is:
+//  1. an explicit `operation` argument (even if invalid - to be able
+//     to report the error)
+//  2. searchRetrieve if the `query` argument is present
+//  3. scan if the `scanClause` argument is present
+//  4. the configured default operation (`explain` unless configured otherwise)
+func detectOperation(args url.Values, dflt Operation) Operation {
+	if args.Has(SearchRetrArgOperation.String()) {
+		return Operation(args.Get(SearchRetrArgOperation.String()))
+
+	} else if args.Has(SearchRetrArgQuery.String()) {
+		return OperationSearchRetrive
+
+	} else if args.Has(ScanArgScanClause.String()) {
+		return OperationScan
+	}
+	return dflt
+}
+
+// ----
+
 func getTypedArg[T ~string](ctx *gin.Context, name string, dflt T) T {
 	v := ctx.DefaultQuery(name, string(dflt))
 	return T(v)
@@ -151,10 +237,28 @@ func getTypedArg[T ~string](ctx *gin.Context, name string, dflt T) T {
 
 // ----
 
-func fetchContext(ctx *gin.Context) []string {
-	tmp := strings.Split(ctx.DefaultQuery(SearchRetrArgFCSContext.String(), ""), ",")
-	if len(tmp) == 0 || len(tmp) == 1 && tmp[0] == "" {
-		return []string{}
+// fetchContext returns resource PIDs specified by a value of the
+// `x-fcs-context` argument. In case the value is empty, an empty slice
+// is returned which means "search all the configured resources".
+func fetchContext(value string) []string {
+	ans := make([]string, 0, 10)
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			ans = append(ans, v)
+		}
+	}
+	return ans
+}
+
+// sortedArgNames returns names of all the URL arguments in a stable
+// order so diagnostics reported for multiple arguments are
+// deterministic.
+func sortedArgNames(args url.Values) []string {
+	ans := make([]string, 0, len(args))
+	for k := range args {
+		ans = append(ans, k)
 	}
-	return tmp
+	sort.Strings(ans)
+	return ans
 }
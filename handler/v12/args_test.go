@@ -0,0 +1,75 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package v12
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectOperation(t *testing.T) {
+	cases := []struct {
+		args     string
+		expected Operation
+	}{
+		{"", OperationExplain},
+		{"version=1.2", OperationExplain},
+		{"operation=explain", OperationExplain},
+		{"operation=explain&query=cat", OperationExplain},
+		{"operation=scan&query=cat", OperationScan},
+		{"operation=searchRetrieve&scanClause=fcs.resource", OperationSearchRetrive},
+		{"query=cat", OperationSearchRetrive},
+		{"query=cat&scanClause=fcs.resource", OperationSearchRetrive},
+		{"scanClause=fcs.resource", OperationScan},
+		{"operation=foo&query=cat", Operation("foo")},
+		{"operation=", Operation("")},
+	}
+	for _, c := range cases {
+		args, err := url.ParseQuery(c.args)
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, detectOperation(args, OperationExplain), c.args)
+	}
+	args, err := url.ParseQuery("version=1.2")
+	assert.NoError(t, err)
+	assert.Equal(t, OperationScan, detectOperation(args, OperationScan))
+}
+
+func TestFetchContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		args     string
+		expected []string
+	}{
+		{"query=cat", []string{}},
+		{"query=cat&x-fcs-context=", []string{}},
+		{"query=cat&x-fcs-context=,", []string{}},
+		{"query=cat&x-fcs-context=corp1", []string{"corp1"}},
+		{"query=cat&x-fcs-context=corp1,corp2", []string{"corp1", "corp2"}},
+		{"query=cat&x-fcs-context=corp1,,corp2,", []string{"corp1", "corp2"}},
+	}
+	for _, c := range cases {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest("GET", "/?"+c.args, nil)
+		assert.Equal(t, c.expected, fetchContext(ctx.Query(SearchRetrArgFCSContext.String())), c.args)
+	}
+}
@@ -20,11 +20,16 @@
 package v12
 
 import (
+	"crypto/sha1"
 	"encoding/xml"
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/bytedance/sonic"
+	"github.com/czcorpus/cnc-gokit/collections"
 	"github.com/czcorpus/cnc-gokit/logging"
+	"github.com/czcorpus/mquery-sru/auth"
 	"github.com/czcorpus/mquery-sru/cnf"
 	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/czcorpus/mquery-sru/general"
@@ -36,9 +41,41 @@ import (
 )
 
 type FCSSubHandlerV12 struct {
-	serverInfo  *cnf.ServerInfo
-	corporaConf *corpus.CorporaSetup
-	radapter    *rdb.Adapter
+	serverInfo    *cnf.ServerInfo
+	corporaConf   *corpus.CorporaSetup
+	radapter      rdb.QueryPublisher
+	authenticator auth.Authenticator
+
+	// searchAnswerTimeout (if non-zero) limits waiting for worker
+	// results of searchRetrieve queries
+	searchAnswerTimeout time.Duration
+
+	// confDigest identifies the current configuration
+	// (it is used to create ETags of explain responses)
+	confDigest string
+
+	// defaultOperation is used in case a request does not
+	// specify an operation (see detectOperation)
+	defaultOperation Operation
+
+	// defaultRecordPacking is used in case a request does not specify
+	// how records should be packed
+	defaultRecordPacking RecordPacking
+
+	// supportedRecordPackings lists record packings clients can request
+	supportedRecordPackings []RecordPacking
+}
+
+// isIgnoredArg tells whether an unknown request argument should
+// be ignored instead of being reported (see cnf.ServerInfo.IgnoresParam)
+func (a *FCSSubHandlerV12) isIgnoredArg(key string) bool {
+	if !a.serverInfo.IgnoresParam(key) {
+		return false
+	}
+	if a.serverInfo.LogIgnoredParams {
+		log.Info().Str("param", key).Msg("ignoring unknown request parameter")
+	}
+	return true
 }
 
 func (a *FCSSubHandlerV12) produceXMLResponse(ctx *gin.Context, code int, xslt string, data any) {
@@ -48,13 +85,26 @@ func (a *FCSSubHandlerV12) produceXMLResponse(ctx *gin.Context, code int, xslt s
 		http.Error(ctx.Writer, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	// headers and status must be set before any body is written,
+	// otherwise they are silently ignored (and 200 is sent)
+	ctx.Writer.Header().Set("Content-Type", "application/xml")
 	ctx.Writer.WriteHeader(code)
 	_, err = ctx.Writer.Write([]byte(xml.Header + general.GetXSLTHeader(xslt) + string(xmlAns)))
 	if err != nil {
 		log.Err(err).Msg("failed to write XML to response")
-		http.Error(ctx.Writer, err.Error(), http.StatusInternalServerError)
 	}
+}
+
+// produceStreamedXMLResponse writes the response directly to the client
+// without rendering it to memory first. This is intended for large
+// responses (e.g. searchRetrieve with many records). Please note that
+// once the status is written, encoding errors can be only logged.
+func (a *FCSSubHandlerV12) produceStreamedXMLResponse(ctx *gin.Context, code int, xslt string, data any) {
 	ctx.Writer.Header().Set("Content-Type", "application/xml")
+	ctx.Writer.WriteHeader(code)
+	if err := general.StreamXML(ctx.Writer, xslt, data); err != nil {
+		log.Err(err).Msg("failed to stream XML response")
+	}
 }
 
 func (a *FCSSubHandlerV12) produceExplainErrorResponse(
@@ -83,6 +133,17 @@ func (a *FCSSubHandlerV12) produceSRErrorResponse(
 	a.produceXMLResponse(ctx, code, xslt, ans)
 }
 
+// HandleError writes an error response without processing
+// the request any further. The response type (searchRetrieve
+// or explain) is derived from the requested operation.
+func (a *FCSSubHandlerV12) HandleError(ctx *gin.Context, code int, fcsErrors []general.FCSError) {
+	if detectOperation(ctx.Request.URL.Query(), a.defaultOperation) == OperationSearchRetrive {
+		a.produceSRErrorResponse(ctx, code, "", fcsErrors)
+		return
+	}
+	a.produceExplainErrorResponse(ctx, code, "", fcsErrors)
+}
+
 func (a *FCSSubHandlerV12) Handle(
 	ctx *gin.Context,
 	fcsGeneralRequest general.FCSGeneralRequest,
@@ -90,8 +151,8 @@ func (a *FCSSubHandlerV12) Handle(
 ) {
 	fcsResponse := &FCSRequest{
 		General:       &fcsGeneralRequest,
-		RecordPacking: RecordPackingXML,
-		Operation:     OperationExplain,
+		RecordPacking: a.defaultRecordPacking,
+		Operation:     a.defaultOperation,
 	}
 	if fcsResponse.General.HasFatalError() {
 		a.produceExplainErrorResponse(
@@ -99,16 +160,7 @@ func (a *FCSSubHandlerV12) Handle(
 		return
 	}
 
-	var operation Operation = OperationExplain
-	if ctx.Request.URL.Query().Has("operation") {
-		operation = getTypedArg(ctx, "operation", fcsResponse.Operation)
-
-	} else if ctx.Request.URL.Query().Has(SearchRetrArgQuery.String()) {
-		operation = OperationSearchRetrive
-
-	} else if ctx.Request.URL.Query().Has(ScanArgScanClause.String()) {
-		operation = OperationScan
-	}
+	operation := detectOperation(ctx.Request.URL.Query(), a.defaultOperation)
 	if err := operation.Validate(); err != nil {
 		fcsResponse.General.AddError(general.FCSError{
 			Code:    general.DCUnsupportedOperation,
@@ -124,7 +176,7 @@ func (a *FCSSubHandlerV12) Handle(
 	logging.AddLogEvent(ctx, "operation", operation)
 
 	recordPacking := getTypedArg(ctx, "recordPacking", fcsResponse.RecordPacking)
-	if err := recordPacking.Validate(); err != nil {
+	if err := recordPacking.Validate(a.supportedRecordPackings); err != nil {
 		fcsResponse.General.AddError(general.FCSError{
 			Code:    general.DCUnsupportedRecordPacking,
 			Ident:   "recordPacking",
@@ -143,13 +195,49 @@ func (a *FCSSubHandlerV12) Handle(
 	fcsResponse.RecordPacking = recordPacking
 	logging.AddLogEvent(ctx, "recordPacking", recordPacking)
 
+	// note: the stylesheet is applicable only to XML-packed records
+	if recordPacking == RecordPackingXML && ctx.Request.URL.Query().Has("stylesheet") {
+		stylesheet, err := general.ValidateStylesheetURL(ctx.Query("stylesheet"))
+		if err != nil {
+			fcsResponse.General.AddError(general.FCSError{
+				Code:    general.DCUnsupportedParameterValue,
+				Ident:   "stylesheet",
+				Message: err.Error(),
+			})
+			if operation == OperationSearchRetrive {
+				a.produceSRErrorResponse(
+					ctx, general.ConformantStatusBadRequest, fcsGeneralRequest.XSLT, fcsGeneralRequest.Errors)
+
+			} else {
+				a.produceExplainErrorResponse(
+					ctx, general.ConformantStatusBadRequest, fcsGeneralRequest.XSLT, fcsGeneralRequest.Errors)
+			}
+			return
+		}
+		fcsResponse.General.XSLT = stylesheet
+		logging.AddLogEvent(ctx, "stylesheet", stylesheet)
+	}
+
 	var response any
 	var code int
 	switch fcsResponse.Operation {
 	case OperationExplain:
+		// explain depends only on the configuration and request
+		// arguments so clients can avoid downloading it repeatedly
+		etag := general.ETag(a.confDigest, ctx.Request.URL.RawQuery, fcsResponse.General.XSLT)
+		ctx.Header("ETag", etag)
+		if general.ETagMatches(ctx.GetHeader("If-None-Match"), etag) {
+			ctx.Status(http.StatusNotModified)
+			return
+		}
 		response, code = a.explain(ctx, fcsResponse)
 	case OperationSearchRetrive:
-		response, code = a.searchRetrieve(ctx, fcsResponse)
+		ans, srCode := a.searchRetrieve(ctx, fcsResponse)
+		if ans.Records.IsStreamed() {
+			a.produceStreamedXMLResponse(ctx, srCode, fcsGeneralRequest.XSLT, ans)
+			return
+		}
+		response, code = ans, srCode
 	case OperationScan:
 		response, code = a.scan(ctx, fcsResponse)
 	}
@@ -159,11 +247,40 @@ func (a *FCSSubHandlerV12) Handle(
 func NewFCSSubHandlerV12(
 	generalConf *cnf.ServerInfo,
 	corporaConf *corpus.CorporaSetup,
-	radapter *rdb.Adapter,
+	radapter rdb.QueryPublisher,
+	authenticator auth.Authenticator,
+	searchAnswerTimeout time.Duration,
 ) *FCSSubHandlerV12 {
+	confData, err := sonic.Marshal([]any{generalConf, corporaConf})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to serialize configuration for ETags")
+	}
+	// the defaults are normally set by the configuration validation
+	dfltOperation, dfltPacking := OperationExplain, RecordPackingXML
+	if generalConf.DefaultOperation != "" {
+		dfltOperation = Operation(generalConf.DefaultOperation)
+	}
+	if generalConf.DefaultRecordPacking != "" {
+		dfltPacking = RecordPacking(generalConf.DefaultRecordPacking)
+	}
+	supportedPackings := []RecordPacking{RecordPackingXML, RecordPackingString}
+	if len(generalConf.SupportedRecordPackings) > 0 {
+		supportedPackings = collections.SliceMap(
+			generalConf.SupportedRecordPackings,
+			func(v string, i int) RecordPacking {
+				return RecordPacking(v)
+			},
+		)
+	}
 	return &FCSSubHandlerV12{
-		serverInfo:  generalConf,
-		corporaConf: corporaConf,
-		radapter:    radapter,
+		serverInfo:              generalConf,
+		corporaConf:             corporaConf,
+		radapter:                radapter,
+		authenticator:           authenticator,
+		searchAnswerTimeout:     searchAnswerTimeout,
+		confDigest:              fmt.Sprintf("%x", sha1.Sum(confData)),
+		defaultOperation:        dfltOperation,
+		defaultRecordPacking:    dfltPacking,
+		supportedRecordPackings: supportedPackings,
 	}
 }
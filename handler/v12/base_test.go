@@ -0,0 +1,138 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package v12
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/cnf"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorResponsesWriteStatusCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := &FCSSubHandlerV12{}
+	fcsErrors := []general.FCSError{
+		{
+			Code:    general.DCUnsupportedVersion,
+			Ident:   "3.0",
+			Message: "Unsupported version 3.0",
+		},
+	}
+	producers := map[string]func(*gin.Context, int, string, []general.FCSError){
+		"explain":        handler.produceExplainErrorResponse,
+		"searchRetrieve": handler.produceSRErrorResponse,
+	}
+	for name, produce := range producers {
+		for _, code := range []int{http.StatusOK, http.StatusBadRequest, http.StatusInternalServerError} {
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			produce(ctx, code, "", fcsErrors)
+			assert.Equal(t, code, w.Code, name)
+			assert.Equal(t, "application/xml", w.Header().Get("Content-Type"), name)
+			assert.Contains(t, w.Body.String(), "Unsupported version 3.0", name)
+		}
+	}
+}
+
+func TestSupportedRecordPackings(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handle := func(handler *FCSSubHandlerV12, args string) string {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest("GET", "/?"+args, nil)
+		handler.Handle(ctx, general.FCSGeneralRequest{Version: "1.2"}, map[string]string{})
+		return w.Body.String()
+	}
+	handler := NewFCSSubHandlerV12(
+		&cnf.ServerInfo{
+			DatabaseTitle:           map[string]string{"en": "Test"},
+			DefaultRecordPacking:    "xml",
+			SupportedRecordPackings: []string{"xml"},
+		},
+		&corpus.CorporaSetup{},
+		nil,
+		nil,
+		0,
+	)
+	body := handle(handler, "operation=explain")
+	assert.Contains(t, body, `<zr:default type="recordPacking">xml</zr:default>`)
+	assert.Contains(t, body, `<zr:supports type="recordPacking">xml</zr:supports>`)
+	assert.NotContains(t, body, `<zr:supports type="recordPacking">string</zr:supports>`)
+	body = handle(handler, "operation=explain&recordPacking=string")
+	assert.Contains(t, body, "info:srw/diagnostic/1/71")
+
+	handler = NewFCSSubHandlerV12(
+		&cnf.ServerInfo{DatabaseTitle: map[string]string{"en": "Test"}},
+		&corpus.CorporaSetup{},
+		nil,
+		nil,
+		0,
+	)
+	body = handle(handler, "operation=explain&recordPacking=string")
+	assert.Contains(t, body, `&lt;zr:supports type=&#34;recordPacking&#34;&gt;string`)
+	assert.Contains(t, body, "<sru:recordPacking>string</sru:recordPacking>")
+	assert.Contains(t, body, "&lt;zr:explain")
+	assert.NotContains(t, body, "<zr:explain")
+}
+
+func TestStylesheetProcessingInstruction(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := NewFCSSubHandlerV12(
+		&cnf.ServerInfo{DatabaseTitle: map[string]string{"en": "Test"}},
+		&corpus.CorporaSetup{},
+		nil,
+		nil,
+		0,
+	)
+	handle := func(args string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest("GET", "/?"+args, nil)
+		handler.Handle(ctx, general.FCSGeneralRequest{Version: "1.2"}, map[string]string{})
+		return w
+	}
+	pi := `<?xml-stylesheet type="text/xsl" href="https://example.org/style.xsl"?>`
+
+	w := handle("operation=explain&stylesheet=https://example.org/style.xsl")
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	if assert.Contains(t, body, pi) {
+		// the instruction must precede the root element
+		assert.Less(t, strings.Index(body, pi), strings.Index(body, "explainResponse"))
+		assert.Less(t, strings.Index(body, "<?xml "), strings.Index(body, pi))
+	}
+
+	w = handle("operation=explain&stylesheet=javascript:alert(1)")
+	assert.Equal(t, general.ConformantStatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "info:srw/diagnostic/1/6")
+	assert.NotContains(t, w.Body.String(), "<?xml-stylesheet")
+
+	// the stylesheet is ignored for string-packed records
+	w = handle("operation=explain&recordPacking=string&stylesheet=javascript:alert(1)")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "<?xml-stylesheet")
+	assert.NotContains(t, w.Body.String(), "info:srw/diagnostic/1/6")
+}
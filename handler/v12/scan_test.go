@@ -0,0 +1,105 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package v12
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanMaximumTerms(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := &FCSSubHandlerV12{corporaConf: &corpus.CorporaSetup{MaximumTerms: 100}}
+	scan := func(args string) (*FCSRequest, int, []string) {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest("GET", "/?operation=scan&scanClause=fcs.resource"+args, nil)
+		req := &FCSRequest{}
+		ans, code := handler.scan(ctx, req)
+		details := make([]string, 0, 2)
+		if ans.Diagnostics != nil {
+			for _, d := range ans.Diagnostics.Diagnostics {
+				details = append(details, d.Details)
+			}
+		}
+		return req, code, details
+	}
+
+	req, _, details := scan("")
+	assert.Equal(t, 100, req.MaximumTerms)
+	assert.NotContains(t, details, "maximumTerms")
+
+	req, _, details = scan("&maximumTerms=20")
+	assert.Equal(t, 20, req.MaximumTerms)
+	assert.NotContains(t, details, "maximumTerms")
+
+	req, _, details = scan("&maximumTerms=1000")
+	assert.Equal(t, 100, req.MaximumTerms)
+	assert.Contains(t, details, "maximumTerms")
+
+	for _, v := range []string{"0", "-5", "foo"} {
+		_, code, details := scan("&maximumTerms=" + v)
+		assert.Equal(t, general.ConformantUnprocessableEntity, code, v)
+		assert.Equal(t, []string{"maximumTerms"}, details, v)
+	}
+}
+
+func TestScanResponsePosition(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := &FCSSubHandlerV12{corporaConf: &corpus.CorporaSetup{MaximumTerms: 100}}
+	scan := func(args string) (*FCSRequest, int, []string) {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest("GET", "/?operation=scan&scanClause=fcs.resource"+args, nil)
+		req := &FCSRequest{}
+		ans, code := handler.scan(ctx, req)
+		uris := make([]string, 0, 2)
+		if ans.Diagnostics != nil {
+			for _, d := range ans.Diagnostics.Diagnostics {
+				uris = append(uris, d.URI)
+			}
+		}
+		return req, code, uris
+	}
+
+	req, _, uris := scan("")
+	assert.Equal(t, 1, req.ResponsePosition)
+	assert.NotContains(t, uris, "info:srw/diagnostic/1/120")
+
+	for _, v := range []int{0, 5, 11} {
+		req, _, uris = scan(fmt.Sprintf("&maximumTerms=10&responsePosition=%d", v))
+		assert.Equal(t, v, req.ResponsePosition)
+		assert.NotContains(t, uris, "info:srw/diagnostic/1/120")
+	}
+
+	// the position is validated against the effective maximumTerms
+	req, _, uris = scan("&maximumTerms=1000&responsePosition=101")
+	assert.Equal(t, 101, req.ResponsePosition)
+	assert.NotContains(t, uris, "info:srw/diagnostic/1/120")
+
+	for _, v := range []string{"-1", "12"} {
+		_, code, uris := scan("&maximumTerms=10&responsePosition=" + v)
+		assert.Equal(t, general.ConformantUnprocessableEntity, code, v)
+		assert.Equal(t, []string{"info:srw/diagnostic/1/120"}, uris, v)
+	}
+}
@@ -18,6 +18,15 @@
 
 package schema
 
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// RecordPackingString is a record packing with record data
+// serialized to an (escaped) string instead of an XML fragment
+const RecordPackingString = "string"
+
 type XMLMultilingual struct {
 	Language string `xml:"lang,attr,omitempty"`
 	Primary  bool   `xml:"primary,attr,omitempty"`
@@ -28,3 +37,17 @@ type XMLMultilingual2 struct {
 	Language string `xml:"xml:lang,attr,omitempty"`
 	Value    string `xml:",chardata"`
 }
+
+// packAsString serializes record data (an element `name`)
+// for the RecordPackingString record packing
+func packAsString(name string, data any) (string, error) {
+	var buff strings.Builder
+	enc := xml.NewEncoder(&buff)
+	if err := enc.EncodeElement(data, xml.StartElement{Name: xml.Name{Local: name}}); err != nil {
+		return "", err
+	}
+	if err := enc.Flush(); err != nil {
+		return "", err
+	}
+	return buff.String(), nil
+}
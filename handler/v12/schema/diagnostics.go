@@ -25,10 +25,13 @@ import (
 	"github.com/czcorpus/mquery-sru/general"
 )
 
+// XMLDiagnostic represents a single SRU diagnostic. Please note
+// that all the elements are always rendered as some validators
+// reject diagnostics with missing elements (esp. the uri).
 type XMLDiagnostic struct {
-	URI     []string `xml:"diag:uri,omitempty"`
-	Details string   `xml:"diag:details"`
-	Message string   `xml:"diag:message"`
+	URI     string `xml:"diag:uri"`
+	Details string `xml:"diag:details"`
+	Message string `xml:"diag:message"`
 }
 
 type XMLDiagnostics struct {
@@ -53,12 +56,15 @@ func (d *XMLDiagnostics) AddDiagnostic(
 	ident string,
 	message string,
 ) {
-	uri := []string{}
+	var uri string
 	if code > 0 {
-		uri = append(uri, fmt.Sprintf("info:srw/diagnostic/1/%d", code))
-	}
-	if typ > 0 {
-		uri = append(uri, fmt.Sprintf("info:srw/diagnostic/%d", typ))
+		uri = fmt.Sprintf("info:srw/diagnostic/1/%d", code)
+
+	} else if typ > 0 {
+		uri = typ.URI()
+
+	} else {
+		uri = fmt.Sprintf("info:srw/diagnostic/1/%d", general.DCGeneralSystemError)
 	}
 	d.Diagnostics = append(d.Diagnostics, XMLDiagnostic{
 		URI:     uri,
@@ -0,0 +1,56 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package schema
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/stretchr/testify/assert"
+)
+
+type parsedDiagnostics struct {
+	Diagnostics []struct {
+		URI     []string `xml:"uri"`
+		Details []string `xml:"details"`
+		Message []string `xml:"message"`
+	} `xml:"diagnostic"`
+}
+
+func TestDiagnosticElements(t *testing.T) {
+	diags := NewXMLDiagnostics()
+	diags.AddDiagnostic(general.DCUnsupportedParameter, 0, "x-foo", "Unsupported parameter x-foo")
+	diags.AddDiagnostic(0, 0, "", "something went wrong")
+	diags.AddDiagnostic(0, general.DTQueryWasRewritten, "x-fcs-context", "Query context adjusted")
+	data, err := xml.Marshal(diags)
+	assert.NoError(t, err)
+
+	var parsed parsedDiagnostics
+	assert.NoError(t, xml.Unmarshal(data, &parsed))
+	assert.Len(t, parsed.Diagnostics, 3)
+	assert.Equal(t, []string{"info:srw/diagnostic/1/8"}, parsed.Diagnostics[0].URI)
+	assert.Equal(t, []string{"x-foo"}, parsed.Diagnostics[0].Details)
+	assert.Equal(t, []string{"Unsupported parameter x-foo"}, parsed.Diagnostics[0].Message)
+	assert.Equal(t, []string{"info:srw/diagnostic/1/1"}, parsed.Diagnostics[1].URI)
+	assert.Equal(t, []string{""}, parsed.Diagnostics[1].Details)
+	assert.Equal(t, []string{"something went wrong"}, parsed.Diagnostics[1].Message)
+	assert.Equal(t, []string{"http://clarin.eu/fcs/diagnostic/12"}, parsed.Diagnostics[2].URI)
+	assert.Equal(t, []string{"x-fcs-context"}, parsed.Diagnostics[2].Details)
+}
@@ -27,8 +27,8 @@ type XMLExplainResponse struct {
 
 	ExplainRecord       *XMLExplainRecord              `xml:"sru:record,omitempty"`
 	EchoedRequest       *XMLExplainEchoedRequest       `xml:"sru:echoedExplainRequest,omitempty"`
-	EndpointDescription *XMLExplainEndpointDescription `xml:"sru:extraResponseData>ed:EndpointDescription,omitempty"`
 	Diagnostics         *XMLDiagnostics                `xml:"sru:diagnostics,omitempty"`
+	EndpointDescription *XMLExplainEndpointDescription `xml:"sru:extraResponseData>ed:EndpointDescription,omitempty"`
 }
 
 // --------------------- Explain Record ---------------------
@@ -39,6 +39,27 @@ type XMLExplainRecord struct {
 	Data          XMLExplainData `xml:"sru:recordData>zr:explain"`
 }
 
+// MarshalXML encodes the record. In case of the RecordPackingString record packing,
+// record data are serialized and sent as an escaped string.
+func (r XMLExplainRecord) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type xmlRecord XMLExplainRecord // prevents recursion
+	if r.RecordPacking != RecordPackingString {
+		return e.EncodeElement(xmlRecord(r), start)
+	}
+	data, err := packAsString("zr:explain", r.Data)
+	if err != nil {
+		return err
+	}
+	return e.EncodeElement(
+		struct {
+			Schema        string `xml:"sru:recordSchema"`
+			RecordPacking string `xml:"sru:recordPacking"`
+			Data          string `xml:"sru:recordData"`
+		}{r.Schema, r.RecordPacking, data},
+		start,
+	)
+}
+
 type XMLExplainData struct {
 	XMLNSZR string `xml:"xmlns:zr,attr"`
 
@@ -59,9 +80,16 @@ type XMLExplainServerInfo struct {
 }
 
 type XMLExplainDatabaseInfo struct {
-	Titles       []XMLMultilingual `xml:"zr:title"`
-	Descriptions []XMLMultilingual `xml:"zr:description"`
-	Authors      []XMLMultilingual `xml:"zr:author"`
+	Titles       []XMLMultilingual    `xml:"zr:title"`
+	Descriptions []XMLMultilingual    `xml:"zr:description"`
+	Authors      []XMLMultilingual    `xml:"zr:author"`
+	LangUsage    *XMLExplainLangUsage `xml:"zr:langUsage,omitempty"`
+}
+
+// XMLExplainLangUsage lists (space separated) languages
+// of all the resources.
+type XMLExplainLangUsage struct {
+	Codes string `xml:"codes,attr"`
 }
 
 type XMLExplainDefinition struct {
@@ -72,7 +100,7 @@ type XMLExplainDefinition struct {
 }
 
 type XMLExplainSchemaInfo struct {
-	Schema XMLExplainDefinition `xml:"zr:schema"`
+	Schemas []XMLExplainDefinition `xml:"zr:schema"`
 }
 
 type XMLExplainConfigInfo struct {
@@ -95,6 +123,14 @@ func (c *XMLExplainConfigInfo) AddSetting(typ string, value any) {
 	})
 }
 
+func (c *XMLExplainConfigInfo) AddSupports(typ string, value any) {
+	c.Values = append(c.Values, XMLExplainConfig{
+		XMLName: xml.Name{Local: "zr:supports"},
+		Type:    typ,
+		Value:   value,
+	})
+}
+
 type XMLExplainConfig struct {
 	XMLName xml.Name
 	Type    string `xml:"type,attr"`
@@ -142,6 +178,9 @@ type XMLExplainResource struct {
 	Languages          []string                  `xml:"ed:Languages>ed:Language"`
 	AvailableDataViews XMLExplainAvailableValues `xml:"ed:AvailableDataViews"`
 	AvailableLayers    XMLExplainAvailableValues `xml:"ed:AvailableLayers"`
+
+	// AvailabilityRestriction is empty for publicly available resources
+	AvailabilityRestriction string `xml:"ed:AvailabilityRestriction,omitempty"`
 }
 
 type XMLExplainAvailableValues struct {
@@ -22,14 +22,14 @@ import "encoding/xml"
 
 type XMLScanResponse struct {
 	XMLName           xml.Name        `xml:"sru:scanResponse"`
-	XMLNSScanResponse string          `xml:"xmlns:scan,attr"`
+	XMLNSScanResponse string          `xml:"xmlns:sru,attr"`
 	Version           string          `xml:"sru:version"`
 	Diagnostics       *XMLDiagnostics `xml:"sru:diagnostics,omitempty"`
 }
 
 func NewXMLScanResponse() XMLScanResponse {
 	return XMLScanResponse{
-		XMLNSScanResponse: "http://docs.oasis-open.org/ns/search-ws/scan",
+		XMLNSScanResponse: "http://www.loc.gov/zing/srw/",
 		Version:           "1.2",
 	}
 }
@@ -0,0 +1,134 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package schema
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type parsedSRResponse struct {
+	NumberOfRecords []string `xml:"numberOfRecords"`
+	Records         []struct {
+		Records []struct{} `xml:"record"`
+	} `xml:"records"`
+}
+
+func TestNoHitsResponse(t *testing.T) {
+	ans := NewXMLSRResponse()
+	data, err := xml.Marshal(ans)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "<sru:numberOfRecords>0</sru:numberOfRecords>")
+
+	var parsed parsedSRResponse
+	assert.NoError(t, xml.Unmarshal(data, &parsed))
+	assert.Equal(t, []string{"0"}, parsed.NumberOfRecords)
+	assert.Empty(t, parsed.Records)
+}
+
+func TestErrorResponseWithoutRecords(t *testing.T) {
+	ans := NewXMLSRResponse()
+	ans.Diagnostics = NewXMLDiagnostics()
+	ans.Diagnostics.AddDiagnostic(0, 0, "", "something went wrong")
+	data, err := xml.Marshal(ans)
+	assert.NoError(t, err)
+
+	var parsed parsedSRResponse
+	assert.NoError(t, xml.Unmarshal(data, &parsed))
+	assert.Empty(t, parsed.Records)
+}
+
+func TestStringPackedRecord(t *testing.T) {
+	rec := XMLSRRecord{
+		Schema:        "http://clarin.eu/fcs/resource",
+		RecordPacking: RecordPackingString,
+		Data: &XMLSRResource{
+			XMLNSFCS: "http://clarin.eu/fcs/resource",
+			PID:      "pid:syn2020",
+		},
+		RecordPosition: 3,
+	}
+	data, err := xml.Marshal(&XMLSRRecords{Records: []XMLSRRecord{rec}})
+	assert.NoError(t, err)
+
+	var parsed struct {
+		Records []struct {
+			Data     string `xml:"recordData"`
+			Position int    `xml:"recordPosition"`
+		} `xml:"record"`
+	}
+	assert.NoError(t, xml.Unmarshal(data, &parsed))
+	if assert.Len(t, parsed.Records, 1) {
+		assert.Equal(t, 3, parsed.Records[0].Position)
+		assert.Contains(
+			t,
+			parsed.Records[0].Data,
+			`<fcs:Resource xmlns:fcs="http://clarin.eu/fcs/resource" pid="pid:syn2020">`,
+		)
+	}
+}
+
+func TestStringPackedPlainTextRecord(t *testing.T) {
+	rec := XMLSRRecord{
+		Schema:        "http://clarin.eu/fcs/resource",
+		RecordPacking: RecordPackingString,
+		Data: &XMLSRResource{
+			XMLNSFCS: "http://clarin.eu/fcs/resource",
+			PID:      "pid:syn2020",
+		},
+		RecordPosition: 3,
+		PlainText:      "3\tpid:syn2020\tTom &\tJerry\tran",
+	}
+	data, err := xml.Marshal(&XMLSRRecords{Records: []XMLSRRecord{rec}})
+	assert.NoError(t, err)
+
+	var parsed struct {
+		Records []struct {
+			Data string `xml:"recordData"`
+		} `xml:"record"`
+	}
+	assert.NoError(t, xml.Unmarshal(data, &parsed))
+	if assert.Len(t, parsed.Records, 1) {
+		assert.Equal(t, "3\tpid:syn2020\tTom &\tJerry\tran", parsed.Records[0].Data)
+	}
+}
+
+func TestStreamedRecords(t *testing.T) {
+	records := []XMLSRRecord{
+		{Schema: "info:srw/schema/1/dc-schema", RecordPosition: 1},
+		{Schema: "info:srw/schema/1/dc-schema", RecordPosition: 2},
+	}
+	expected, err := xml.MarshalIndent(&XMLSRRecords{Records: records}, "", "  ")
+	assert.NoError(t, err)
+
+	var i int
+	streamed := NewStreamedXMLSRRecords(func() (*XMLSRRecord, error) {
+		if i == len(records) {
+			return nil, nil
+		}
+		i++
+		return &records[i-1], nil
+	})
+	assert.True(t, streamed.IsStreamed())
+	data, err := xml.MarshalIndent(streamed, "", "  ")
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), string(data))
+}
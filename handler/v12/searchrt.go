@@ -20,18 +20,21 @@
 package v12
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/bytedance/sonic"
 	"github.com/czcorpus/cnc-gokit/collections"
 	"github.com/czcorpus/cnc-gokit/logging"
-	"github.com/czcorpus/mquery-sru/backlink"
+	"github.com/czcorpus/mquery-sru/cnf"
 	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/czcorpus/mquery-sru/corpus/conc"
 	"github.com/czcorpus/mquery-sru/general"
+	"github.com/czcorpus/mquery-sru/handler/common"
 	"github.com/czcorpus/mquery-sru/handler/v12/schema"
 	"github.com/czcorpus/mquery-sru/mango"
 	"github.com/czcorpus/mquery-sru/query"
@@ -39,13 +42,25 @@ import (
 	"github.com/czcorpus/mquery-sru/query/parser/basic"
 	"github.com/czcorpus/mquery-sru/rdb"
 	"github.com/czcorpus/mquery-sru/result"
+	"github.com/czcorpus/mquery-sru/tracing"
 	"github.com/rs/zerolog/log"
 
 	"github.com/gin-gonic/gin"
 )
 
+// queryParseCache keeps a parsed query so a multi-resource search
+// parses the query just once. The AST is independent of resources
+// until it is configured (attributes, structures) and generated
+// so it is reconfigured for each resource by translateQuery.
+type queryParseCache struct {
+	basicAST *basic.Query
+}
+
 func (a *FCSSubHandlerV12) translateQuery(
-	corpusName, query string,
+	corpusName, query, searchAttr string,
+	ignoreDiacritics bool,
+	within string,
+	cache *queryParseCache,
 ) (compiler.AST, *general.FCSError) {
 	var fcsErr *general.FCSError
 	res, err := a.corporaConf.Resources.GetResource(corpusName)
@@ -57,19 +72,46 @@ func (a *FCSSubHandlerV12) translateQuery(
 		}
 		return nil, fcsErr
 	}
-	ast, err := basic.ParseQuery(
-		query,
-		res.PosAttrs,
-		res.StructureMapping,
-	)
-	if err != nil {
+	if err := a.corporaConf.QueryLimits().Check(query); err != nil {
 		fcsErr = &general.FCSError{
-			Code:    general.DCQuerySyntaxError,
+			Code:    general.DCQueryCannotProcess,
 			Ident:   query,
-			Message: "Invalid query syntax",
+			Message: fmt.Sprintf("Query cannot be processed: %s", err),
 		}
+		return nil, fcsErr
+	}
+	posAttrs := res.GetPosAttrsWithBasicSearchAttr(searchAttr)
+	foldTerms := ignoreDiacritics && res.DiacriticsFoldedAttr != ""
+	if foldTerms {
+		posAttrs = res.GetPosAttrsForFoldedSearch()
 	}
-	return ast, fcsErr
+	if cache.basicAST == nil {
+		ast, err := basic.ParseQuery(query, posAttrs, res.StructureMapping)
+		var featErr compiler.UnsupportedFeatureError
+		if errors.As(err, &featErr) {
+			fcsErr = &general.FCSError{
+				Code:    general.DCQueryFeatureUnsupported,
+				Ident:   featErr.Feature,
+				Message: fmt.Sprintf("Query feature unsupported: %s", featErr.Feature),
+			}
+			return nil, fcsErr
+
+		} else if err != nil {
+			fcsErr = &general.FCSError{
+				Code:    general.DCQuerySyntaxError,
+				Ident:   query,
+				Message: fmt.Sprintf("Invalid query syntax: %s", err),
+			}
+			return nil, fcsErr
+		}
+		cache.basicAST = ast
+	}
+	return cache.basicAST.
+		SetPosAttrs(posAttrs).
+		SetStructureMapping(res.StructureMapping).
+		SetFoldTerms(foldTerms).
+		SetWithin(within).
+		SetNormForm(res.QueryNormalization), nil
 }
 
 func (a *FCSSubHandlerV12) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequest) (schema.XMLSRResponse, int) {
@@ -78,23 +120,51 @@ func (a *FCSSubHandlerV12) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequ
 	ans := schema.NewXMLSRResponse()
 
 	// check if all parameters are supported
-	for key, _ := range ctx.Request.URL.Query() {
-		if err := SearchRetrArg(key).Validate(); err != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
-			ans.Diagnostics.AddDiagnostic(general.DCUnsupportedParameter, 0, key, err.Error())
-			return ans, general.ConformantStatusBadRequest
+	// (all the problems found here are reported at once)
+	diagnostics := schema.NewXMLDiagnostics()
+	for _, key := range sortedArgNames(ctx.Request.URL.Query()) {
+		if err := SearchRetrArg(key).Validate(); err != nil && !a.isIgnoredArg(key) {
+			diagnostics.AddDiagnostic(general.DCUnsupportedParameter, 0, key, err.Error())
 		}
 	}
 
 	// handle query parameter
 	fcsQuery := ctx.Query(SearchRetrArgQuery.String())
 	if len(fcsQuery) == 0 {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
+		diagnostics.AddDfltMsgDiagnostic(
 			general.DCMandatoryParameterNotSupplied, 0, "fcs_query")
+	}
+	if len(diagnostics.Diagnostics) > 0 {
+		ans.Diagnostics = diagnostics
 		return ans, general.ConformantStatusBadRequest
 	}
 	ans.EchoedRequest.Query = fcsQuery
+
+	// a query `cql.resultSetId="..."` refers to a result set returned
+	// by a previous search which is then defined by the arguments stored
+	// within the identifier (if the result set is not cached anymore,
+	// the search is just performed again)
+	var searchArgs map[string]string
+	if resultSetID, ok := general.ResultSetIDFromQuery(fcsQuery); ok {
+		var err error
+		searchArgs, err = general.DecodeResultSetID(resultSetID)
+		if err != nil || searchArgs[SearchRetrArgQuery.String()] == "" {
+			ans.Diagnostics = schema.NewXMLDiagnostics()
+			ans.Diagnostics.AddDfltMsgDiagnostic(
+				general.DCResultSetDoesNotExist, 0, resultSetID)
+			return ans, general.ConformantUnprocessableEntity
+		}
+		logArgs["resultSetId"] = resultSetID
+
+	} else {
+		searchArgs = make(map[string]string)
+		for _, arg := range resultSetArgs {
+			if v := ctx.Query(arg.String()); v != "" {
+				searchArgs[arg.String()] = v
+			}
+		}
+	}
+	fcsQuery = searchArgs[SearchRetrArgQuery.String()]
 	logArgs[SearchRetrArgQuery.String()] = fcsQuery
 
 	// handle start record parameter
@@ -116,50 +186,140 @@ func (a *FCSSubHandlerV12) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequ
 	logArgs[SearchRetrStartRecord.String()] = startRecord
 
 	// handle record schema parameter
-	recordSchema := ctx.DefaultQuery(SearchRetrArgRecordSchema.String(), general.RecordSchema)
-	if recordSchema != general.RecordSchema {
+	recordSchema, err := general.NormalizeRecordSchema(
+		ctx.DefaultQuery(SearchRetrArgRecordSchema.String(), general.RecordSchema))
+	if err != nil {
 		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCUnknownSchemaForRetrieval, 0, SearchMaximumRecords.String())
+		ans.Diagnostics.AddDiagnostic(
+			general.DCUnknownSchemaForRetrieval, 0, SearchRetrArgRecordSchema.String(), err.Error())
 		return ans, general.ConformantUnprocessableEntity
 	}
+	logArgs[SearchRetrArgRecordSchema.String()] = recordSchema
 
 	// handle max records parameter
-	maximumRecords := a.corporaConf.MaximumRecords
+	// (zero means the client did not specify the value unless
+	// it explicitly asked for zero records, i.e. just for the number of hits)
+	var maximumRecords int
+	var hitCountOnly bool
 	if xMaximumRecords := ctx.Query(SearchMaximumRecords.String()); len(xMaximumRecords) > 0 {
 		maximumRecords, err = strconv.Atoi(xMaximumRecords)
-		if err != nil {
+		if err != nil || maximumRecords < 0 ||
+			maximumRecords == 0 && a.corporaConf.DisableHitCountOnly {
 			ans.Diagnostics = schema.NewXMLDiagnostics()
 			ans.Diagnostics.AddDfltMsgDiagnostic(
 				general.DCUnsupportedParameterValue, 0, SearchMaximumRecords.String())
 			return ans, general.ConformantUnprocessableEntity
 		}
+		hitCountOnly = maximumRecords == 0
 	}
-	if maximumRecords < 1 {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCUnsupportedParameterValue, 0, SearchMaximumRecords.String())
-		return ans, general.ConformantUnprocessableEntity
 
+	// handle result set TTL parameter
+	// (zero means the result set is not going to be cached)
+	var resultSetTTL int
+	xResultSetTTL := ctx.Query(SearchRetrArgResultSetTTL.String())
+	if xResultSetTTL == "" {
+		// a referred result set keeps its original TTL unless specified
+		xResultSetTTL = searchArgs[SearchRetrArgResultSetTTL.String()]
 	}
-	if maximumRecords > mango.MaxRecordsInternalLimit {
-		// TODO the error type is not probably very accurate
-		// as the actual result can be very small. But we still
-		// have to limit max. number of records...
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCTooManyMatchingRecords, 0, fmt.Sprintf("%d", mango.MaxRecordsInternalLimit))
-		return ans, general.ConformantUnprocessableEntity
+	if len(xResultSetTTL) > 0 {
+		resultSetTTL, err = strconv.Atoi(xResultSetTTL)
+		if err != nil || resultSetTTL < 0 {
+			ans.Diagnostics = schema.NewXMLDiagnostics()
+			ans.Diagnostics.AddDfltMsgDiagnostic(
+				general.DCUnsupportedParameterValue, 0, SearchRetrArgResultSetTTL.String())
+			return ans, general.ConformantUnprocessableEntity
+		}
+		if resultSetTTL > a.corporaConf.MaximumResultSetTTL {
+			resultSetTTL = a.corporaConf.MaximumResultSetTTL
+		}
+		logArgs[SearchRetrArgResultSetTTL.String()] = resultSetTTL
+	}
+
+	// handle per-resource statistics
+	var resourceStats bool
+	if xResourceStats := ctx.Query(SearchRetrArgResourceStats.String()); xResourceStats != "" {
+		resourceStats, err = strconv.ParseBool(xResourceStats)
+		if err != nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics()
+			ans.Diagnostics.AddDfltMsgDiagnostic(
+				general.DCUnsupportedParameterValue, 0, SearchRetrArgResourceStats.String())
+			return ans, general.ConformantUnprocessableEntity
+		}
+		logArgs[SearchRetrArgResourceStats.String()] = resourceStats
+	}
+
+	// handle debugging output of backend queries (disabled by default)
+	var debugQuery bool
+	if xDebugQuery := ctx.Query(SearchRetrArgDebugQuery.String()); xDebugQuery != "" {
+		debugQuery, err = strconv.ParseBool(xDebugQuery)
+		if err != nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics()
+			ans.Diagnostics.AddDfltMsgDiagnostic(
+				general.DCUnsupportedParameterValue, 0, SearchRetrArgDebugQuery.String())
+			return ans, general.ConformantUnprocessableEntity
+		}
+		if debugQuery && !a.corporaConf.AllowDebugQuery {
+			ans.Diagnostics = schema.NewXMLDiagnostics()
+			ans.Diagnostics.AddDiagnostic(
+				general.DCUnsupportedParameter, 0, SearchRetrArgDebugQuery.String(),
+				"Debugging of queries is not enabled")
+			return ans, general.ConformantUnprocessableEntity
+		}
+		logArgs[SearchRetrArgDebugQuery.String()] = debugQuery
+	}
+
+	// handle all-or-nothing searches
+	strict := a.corporaConf.StrictSearch
+	if xStrict := ctx.Query(SearchRetrArgStrict.String()); xStrict != "" {
+		strict, err = strconv.ParseBool(xStrict)
+		if err != nil {
+			ans.Diagnostics = schema.NewXMLDiagnostics()
+			ans.Diagnostics.AddDfltMsgDiagnostic(
+				general.DCUnsupportedParameterValue, 0, SearchRetrArgStrict.String())
+			return ans, general.ConformantUnprocessableEntity
+		}
+		logArgs[SearchRetrArgStrict.String()] = strict
+	}
+
+	// handle view context structure override
+	viewContextStruct := searchArgs[SearchRetrArgViewContextStruct.String()]
+	if viewContextStruct != "" {
+		if !general.IsValidStructName(viewContextStruct) {
+			ans.Diagnostics = schema.NewXMLDiagnostics()
+			ans.Diagnostics.AddDfltMsgDiagnostic(
+				general.DCUnsupportedParameterValue, 0, SearchRetrArgViewContextStruct.String())
+			return ans, general.ConformantUnprocessableEntity
+		}
+		logArgs[SearchRetrArgViewContextStruct.String()] = viewContextStruct
 	}
-	logArgs[SearchMaximumRecords.String()] = maximumRecords
 
 	// handle requested sources
-	corporaPids := fetchContext(ctx)
+	corporaPids := fetchContext(searchArgs[SearchRetrArgFCSContext.String()])
 	corpora := make([]string, 0, len(corporaPids))
 	if len(corporaPids) > 0 {
 		for _, pid := range corporaPids {
+			if corpus.IsPIDPattern(pid) {
+				matching, err := a.corporaConf.Resources.FindByPIDPattern(pid)
+				if err != nil || len(matching) == 0 {
+					ans.Diagnostics = schema.NewXMLDiagnostics()
+					ans.Diagnostics.AddDiagnostic(
+						general.DCUnsupportedParameterValue, 0, pid,
+						fmt.Sprintf("No resource matches %s", pid))
+					return ans, general.ConformantUnprocessableEntity
+				}
+				corpora = append(corpora, matching...)
+				continue
+			}
+			if a.corporaConf.IsDisabledResource(pid) {
+				ans.Diagnostics = schema.NewXMLDiagnostics()
+				ans.Diagnostics.AddDiagnostic(
+					general.DCUnsupportedContextSet, 0, pid,
+					fmt.Sprintf("Unknown resource %s", pid))
+				return ans, general.ConformantUnprocessableEntity
+			}
 			res, err := a.corporaConf.Resources.GetResourceByPID(pid)
 			if err == corpus.ErrResourceNotFound {
+				log.Debug().Str("pid", pid).Msg("unknown resource requested")
 				ans.Records = nil
 				return ans, http.StatusOK
 			}
@@ -170,6 +330,44 @@ func (a *FCSSubHandlerV12) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequ
 		corpora = a.corporaConf.Resources.GetCorpora()
 	}
 
+	// each resource means a separate worker query so we must
+	// keep the number of resources searched at once reasonable
+	if a.corporaConf.ExceedsMaximumResources(len(corpora), len(corporaPids) == 0) {
+		ans.Diagnostics = schema.NewXMLDiagnostics()
+		ans.Diagnostics.AddDiagnostic(
+			general.DCUnsupportedParameterValue, 0, SearchRetrArgFCSContext.String(),
+			fmt.Sprintf(
+				"Too many resources to search (%d), please specify at most %d resources via %s",
+				len(corpora), a.corporaConf.MaximumResources, SearchRetrArgFCSContext))
+		return ans, general.ConformantUnprocessableEntity
+	}
+
+	// drop resources which cannot be searched (restricted, unavailable).
+	// This is not fatal as the remaining resources can still be searched
+	// (unless the search is strict).
+	var nonFatalDiagnostics *schema.XMLDiagnostics
+	searched, fcsErr, status := common.FilterResources(
+		ctx, a.corporaConf, a.authenticator, corpora, strict)
+	if fcsErr != nil {
+		ans.Diagnostics = schema.NewXMLDiagnostics()
+		ans.Diagnostics.AddDiagnostic(fcsErr.Code, fcsErr.Type, fcsErr.Ident, fcsErr.Message)
+		ans.Records = nil
+		return ans, status
+	}
+	for _, dropped := range searched.Dropped {
+		if nonFatalDiagnostics == nil {
+			nonFatalDiagnostics = schema.NewXMLDiagnostics()
+		}
+		nonFatalDiagnostics.AddDiagnostic(dropped.Code, dropped.Type, dropped.Ident, dropped.Message)
+	}
+	if len(searched.Corpora) == 0 && nonFatalDiagnostics != nil {
+		ans.Diagnostics = nonFatalDiagnostics
+		ans.Records = nil
+		return ans, http.StatusOK
+	}
+	corpora = searched.Corpora
+	shardIDs, registryPaths := searched.ShardIDs, searched.RegistryPaths
+
 	// get searchable corpora and attrs
 	if len(corpora) == 0 {
 		ans.Diagnostics = schema.NewXMLDiagnostics()
@@ -177,91 +375,418 @@ func (a *FCSSubHandlerV12) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequ
 			general.DCUnsupportedContextSet, 0, SearchRetrArgFCSContext.String())
 		return ans, general.ConformantStatusBadRequest
 	}
-	retrieveAttrs, err := a.corporaConf.Resources.GetCommonPosAttrNames(corpora...)
-	if err != nil {
-		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCGeneralSystemError, 0, err.Error())
-		return ans, http.StatusInternalServerError
-	}
-
-	logArgs["corpus"] = a.serverInfo.Database
-	logArgs["sources"] = corpora
-	logArgs[SearchRetrArgFCSContext.String()] = ctx.Query(SearchRetrArgFCSContext.String())
-	log.Warn().Msg("Data views are not implemented yet!")
-	logArgs[SearchRetrArgFCSDataViews.String()] = ctx.Query(SearchRetrArgFCSDataViews.String())
 
-	ranges := query.CalculatePartialRanges(corpora, startRecord-1, maximumRecords)
-
-	// make searches
-	waits := make([]<-chan *rdb.WorkerResult, len(ranges))
-	for i, rng := range ranges {
-
-		ast, fcsErr := a.translateQuery(rng.Rsc, fcsQuery)
-		if fcsErr != nil {
+	// view context structure override must be available in all the resources
+	if viewContextStruct != "" {
+		missingIn := make([]string, 0, len(corpora))
+		for _, corpusID := range corpora {
+			res, err := a.corporaConf.Resources.GetResource(corpusID)
+			if err != nil || !res.HasStruct(viewContextStruct) {
+				missingIn = append(missingIn, corpusID)
+			}
+		}
+		if len(missingIn) > 0 {
 			ans.Diagnostics = schema.NewXMLDiagnostics()
-			ans.Diagnostics.AddDiagnostic(fcsErr.Code, fcsErr.Type, fcsErr.Ident, fcsErr.Message)
+			ans.Diagnostics.AddDiagnostic(
+				general.DCUnsupportedParameterValue,
+				0,
+				SearchRetrArgViewContextStruct.String(),
+				fmt.Sprintf(
+					"structure %s not available in: %s",
+					viewContextStruct, strings.Join(missingIn, ", ")),
+			)
 			return ans, general.ConformantUnprocessableEntity
 		}
+	}
 
-		query := ast.Generate()
-		if len(ast.Errors()) > 0 {
+	// handle basic search attribute override
+	searchAttr := searchArgs[SearchRetrArgSearchAttr.String()]
+	if searchAttr != "" {
+		missingIn := make([]string, 0, len(corpora))
+		for _, corpusID := range corpora {
+			res, err := a.corporaConf.Resources.GetResource(corpusID)
+			if err != nil || !res.HasPosAttr(searchAttr) {
+				missingIn = append(missingIn, corpusID)
+			}
+		}
+		if len(missingIn) > 0 {
 			ans.Diagnostics = schema.NewXMLDiagnostics()
 			ans.Diagnostics.AddDiagnostic(
-				general.DCQueryCannotProcess, 0, SearchRetrArgQuery.String(), ast.Errors()[0].Error())
+				general.DCUnsupportedParameterValue,
+				0,
+				SearchRetrArgSearchAttr.String(),
+				fmt.Sprintf(
+					"attribute %s not available in: %s", searchAttr, strings.Join(missingIn, ", ")),
+			)
 			return ans, general.ConformantUnprocessableEntity
 		}
-		rscConf, err := a.corporaConf.Resources.GetResource(rng.Rsc)
-		if err != nil {
+		logArgs[SearchRetrArgSearchAttr.String()] = searchAttr
+	}
+
+	// handle basic search limited to a structure
+	within := searchArgs[SearchRetrArgWithin.String()]
+	if within != "" {
+		missingIn := make([]string, 0, len(corpora))
+		for _, corpusID := range corpora {
+			res, err := a.corporaConf.Resources.GetResource(corpusID)
+			if err != nil || basic.WithinStruct(res.StructureMapping, within) == "" {
+				missingIn = append(missingIn, corpusID)
+			}
+		}
+		if len(missingIn) > 0 {
 			ans.Diagnostics = schema.NewXMLDiagnostics()
-			ans.Diagnostics.AddDfltMsgDiagnostic(
-				general.DCGeneralSystemError, 0, err.Error())
-			return ans, general.ConformandGeneralServerError
-		}
-		args, err := sonic.Marshal(rdb.ConcExampleArgs{
-			CorpusPath:        a.corporaConf.GetRegistryPath(rng.Rsc),
-			Query:             query,
-			Attrs:             retrieveAttrs,
-			StartLine:         rng.From,
-			MaxItems:          maximumRecords,
-			MaxContext:        a.corporaConf.MaximumContext,
-			ViewContextStruct: rscConf.ViewContextStruct,
-		})
+			ans.Diagnostics.AddDiagnostic(
+				general.DCUnsupportedParameterValue,
+				0,
+				SearchRetrArgWithin.String(),
+				fmt.Sprintf(
+					"structure %s not available in: %s", within, strings.Join(missingIn, ", ")),
+			)
+			return ans, general.ConformantUnprocessableEntity
+		}
+		logArgs[SearchRetrArgWithin.String()] = within
+	}
+
+	// handle diacritics-insensitive search
+	var ignoreDiacritics bool
+	if xIgnoreDiacritics := searchArgs[SearchRetrArgIgnoreDiacritics.String()]; xIgnoreDiacritics != "" {
+		ignoreDiacritics, err = strconv.ParseBool(xIgnoreDiacritics)
 		if err != nil {
 			ans.Diagnostics = schema.NewXMLDiagnostics()
 			ans.Diagnostics.AddDfltMsgDiagnostic(
-				general.DCGeneralSystemError, 0, err.Error())
-			return ans, http.StatusInternalServerError
+				general.DCUnsupportedParameterValue, 0, SearchRetrArgIgnoreDiacritics.String())
+			return ans, general.ConformantUnprocessableEntity
 		}
-		wait, err := a.radapter.PublishQuery(rdb.Query{
-			Func: "concExample",
-			Args: args,
-		})
-		if err != nil {
+		if ignoreDiacritics && searchAttr != "" {
 			ans.Diagnostics = schema.NewXMLDiagnostics()
-			ans.Diagnostics.AddDfltMsgDiagnostic(
-				general.DCGeneralSystemError, 0, err.Error())
-			return ans, http.StatusInternalServerError
+			ans.Diagnostics.AddDiagnostic(
+				general.DCUnsupportedParameterValue,
+				0,
+				SearchRetrArgIgnoreDiacritics.String(),
+				fmt.Sprintf("cannot be combined with %s", SearchRetrArgSearchAttr),
+			)
+			return ans, general.ConformantUnprocessableEntity
+		}
+		logArgs[SearchRetrArgIgnoreDiacritics.String()] = ignoreDiacritics
+	}
+	if ignoreDiacritics {
+		// resources without a diacritics-folded attribute are searched as usual
+		for _, corpusID := range corpora {
+			res, err := a.corporaConf.Resources.GetResource(corpusID)
+			if err != nil || res.DiacriticsFoldedAttr != "" {
+				continue
+			}
+			if nonFatalDiagnostics == nil {
+				nonFatalDiagnostics = schema.NewXMLDiagnostics()
+			}
+			// the query is still searched so the diagnostic must not be fatal
+			nonFatalDiagnostics.AddDiagnostic(
+				0, general.DTQueryWasRewritten, res.PID,
+				fmt.Sprintf(
+					"Diacritics-insensitive search is not supported by resource %s, searching as usual",
+					res.PID))
+		}
+	}
+
+	// apply the (possibly resource-specific) default and ceiling
+	// of the number of returned records
+	maxRecordsLimit := a.corporaConf.GetMaximumRecords(corpora...)
+	if maximumRecords == 0 && !hitCountOnly {
+		maximumRecords = a.corporaConf.GetDefaultRecords(corpora...)
+
+	} else if maximumRecords > maxRecordsLimit {
+		// SRU allows returning fewer records than requested so this is
+		// not a query rewrite - the search continues with the clamped
+		// value and the client is just notified via a non-fatal diagnostic
+		if nonFatalDiagnostics == nil {
+			nonFatalDiagnostics = schema.NewXMLDiagnostics()
+		}
+		nonFatalDiagnostics.AddDiagnostic(
+			0,
+			general.DTGeneralProcessingHint,
+			SearchMaximumRecords.String(),
+			fmt.Sprintf("maximumRecords too high, using %d", maxRecordsLimit),
+		)
+		maximumRecords = maxRecordsLimit
+	}
+	logArgs[SearchMaximumRecords.String()] = maximumRecords
+
+	logArgs["corpus"] = a.serverInfo.Database
+	logArgs["sources"] = corpora
+	logArgs[SearchRetrArgFCSContext.String()] = ctx.Query(SearchRetrArgFCSContext.String())
+	log.Warn().Msg("Data views are not implemented yet!")
+	logArgs[SearchRetrArgFCSDataViews.String()] = ctx.Query(SearchRetrArgFCSDataViews.String())
+
+	ranges := query.CalculatePartialRanges(corpora, startRecord-1, maximumRecords)
+
+	// make searches
+	// without workers, we would just wait for the answer timeout
+	numWorkers, err := a.radapter.NumQueryListeners()
+	if err != nil {
+		ans.Diagnostics = schema.NewXMLDiagnostics()
+		ans.Diagnostics.AddDfltMsgDiagnostic(
+			general.DCGeneralSystemError, 0, err.Error())
+		return ans, http.StatusInternalServerError
+	}
+	if numWorkers == 0 {
+		ans.Diagnostics = schema.NewXMLDiagnostics()
+		ans.Diagnostics.AddDfltMsgDiagnostic(
+			general.DCGeneralSystemError, 0, "no search workers available")
+		return ans, http.StatusServiceUnavailable
+	}
+
+	// fetchLines searches for lines of the ranges. Note: identical queries
+	// (e.g. in case a resource is requested multiple times) are published
+	// just once and their result is then shared by all the respective ranges.
+	// the query is parsed just once (for the first range) and only
+	// configured and generated for each resource
+	parsedQuery := new(queryParseCache)
+	fetchLines := func(ranges query.LineRangeList) ([]result.ConcExample, int) {
+		waits := make([]<-chan *rdb.WorkerResult, 0, len(ranges))
+		rangeWaits := make([]int, len(ranges)) // range index => index within `waits`
+		publishedArgs := make(map[string]int)
+		// ranges searched within a (cached) result set window
+		// (i.e. the searched lines always start from the first one)
+		rangesInResultSet := make([]bool, len(ranges))
+		for i, rng := range ranges {
+
+			ast, fcsErr := a.translateQuery(
+				rng.Rsc, fcsQuery, searchAttr, ignoreDiacritics, within, parsedQuery)
+			if fcsErr != nil {
+				ans.Diagnostics = schema.NewXMLDiagnostics()
+				ans.Diagnostics.AddDiagnostic(fcsErr.Code, fcsErr.Type, fcsErr.Ident, fcsErr.Message)
+				return nil, general.ConformantUnprocessableEntity
+			}
+
+			query := ast.Generate()
+			log.Debug().
+				Str("corpus", rng.Rsc).
+				Str("fcsQuery", fcsQuery).
+				Str("cqlQuery", query).
+				Msg("translated FCS query")
+			var idxErr compiler.UnsupportedIndexError
+			var relErr compiler.UnsupportedRelationError
+			var withinErr compiler.UnsupportedWithinError
+			if len(ast.Errors()) > 0 && errors.As(ast.Errors()[0], &idxErr) {
+				ans.Diagnostics = schema.NewXMLDiagnostics()
+				ans.Diagnostics.AddDiagnostic(
+					general.DCUnsupportedIndex, 0, idxErr.Index(), idxErr.Error())
+				return nil, general.ConformantUnprocessableEntity
+
+			} else if len(ast.Errors()) > 0 && errors.As(ast.Errors()[0], &relErr) {
+				ans.Diagnostics = schema.NewXMLDiagnostics()
+				ans.Diagnostics.AddDiagnostic(
+					general.DCUnsupportedRelation, 0, relErr.Relation, relErr.Error())
+				return nil, general.ConformantUnprocessableEntity
+
+			} else if len(ast.Errors()) > 0 && errors.As(ast.Errors()[0], &withinErr) {
+				ans.Diagnostics = schema.NewXMLDiagnostics()
+				ans.Diagnostics.AddDiagnostic(
+					general.DCQueryFeatureUnsupported, 0, withinErr.Context,
+					fmt.Sprintf("%s in resource %s", withinErr.Error(), corpus.ShardResourceID(rng.Rsc)))
+				return nil, general.ConformantUnprocessableEntity
+
+			} else if len(ast.Errors()) > 0 {
+				ans.Diagnostics = schema.NewXMLDiagnostics()
+				ans.Diagnostics.AddDiagnostic(
+					general.DCQueryCannotProcess, 0, SearchRetrArgQuery.String(), ast.Errors()[0].Error())
+				return nil, general.ConformantUnprocessableEntity
+			}
+			rscConf, err := a.corporaConf.Resources.GetResource(rng.Rsc)
+			if err != nil {
+				ans.Diagnostics = schema.NewXMLDiagnostics()
+				ans.Diagnostics.AddDfltMsgDiagnostic(
+					general.DCGeneralSystemError, 0, err.Error())
+				return nil, general.ConformandGeneralServerError
+			}
+			rscViewContextStruct := rscConf.ViewContextStruct
+			if viewContextStruct != "" {
+				rscViewContextStruct = viewContextStruct
+			}
+			// the lines needed to cover the requested page
+			// (i.e. startRecord + maximumRecords) of the resource
+			startLine, maxItems := rng.From, a.corporaConf.BackendLines(rng.From, rng.To)
+			if !hitCountOnly && resultSetTTL > 0 && rng.To <= a.corporaConf.ResultSetWindow {
+				startLine, maxItems = 0, a.corporaConf.BackendLines(0, a.corporaConf.ResultSetWindow)
+				rangesInResultSet[i] = true
+			}
+			var workerFunc string
+			var args []byte
+			if hitCountOnly {
+				// no lines are needed, just the concordance size
+				workerFunc = "concSize"
+				args, err = sonic.Marshal(rdb.ConcSizeArgs{
+					CorpusPath: registryPaths[rng.Rsc],
+					Query:      query,
+				})
+
+			} else {
+				// attributes are resource-specific as the searched
+				// resources may have different (even disjoint) attributes
+				workerFunc = "concExample"
+				args, err = sonic.Marshal(rdb.ConcExampleArgs{
+					CorpusPath:        registryPaths[rng.Rsc],
+					Query:             query,
+					Attrs:             rscConf.GetSortedPosAttrNames(),
+					StartLine:         startLine,
+					MaxItems:          maxItems,
+					MaxContext:        a.corporaConf.MaximumContext,
+					ViewContextStruct: rscViewContextStruct,
+					StructAttrs:       rscConf.GetRefStructAttrs(),
+					SegmentStruct:     rscConf.SegmentStruct,
+				})
+			}
+			if err != nil {
+				ans.Diagnostics = schema.NewXMLDiagnostics()
+				ans.Diagnostics.AddDfltMsgDiagnostic(
+					general.DCGeneralSystemError, 0, err.Error())
+				return nil, http.StatusInternalServerError
+			}
+			if waitIdx, ok := publishedArgs[string(args)]; ok {
+				rangeWaits[i] = waitIdx
+				continue
+			}
+			var wait <-chan *rdb.WorkerResult
+			if rangesInResultSet[i] {
+				wait, err = a.radapter.PublishQueryCached(
+					rdb.Query{
+						Func:          workerFunc,
+						Args:          args,
+						RequestID:     tracing.GetRequestID(ctx),
+						AnswerTimeout: a.searchAnswerTimeout,
+					},
+					time.Duration(resultSetTTL)*time.Second,
+				)
+
+			} else {
+				wait, err = a.radapter.PublishQuery(rdb.Query{
+					Func:          workerFunc,
+					Args:          args,
+					RequestID:     tracing.GetRequestID(ctx),
+					AnswerTimeout: a.searchAnswerTimeout,
+				})
+			}
+			if err == rdb.ErrTooManyQueries {
+				ans.Diagnostics = schema.NewXMLDiagnostics()
+				ans.Diagnostics.AddDiagnostic(
+					general.DCSystemTemporarilyUnavailable, 0, "server load",
+					"Too many queries are being processed, please try again later")
+				return nil, http.StatusTooManyRequests
+
+			} else if err != nil {
+				ans.Diagnostics = schema.NewXMLDiagnostics()
+				ans.Diagnostics.AddDfltMsgDiagnostic(
+					general.DCGeneralSystemError, 0, err.Error())
+				return nil, http.StatusInternalServerError
+			}
+			publishedArgs[string(args)] = len(waits)
+			rangeWaits[i] = len(waits)
+			waits = append(waits, wait)
+		}
+		rawResults := make([]*rdb.WorkerResult, len(waits))
+		for i, wait := range waits {
+			select {
+			case rawResults[i] = <-wait:
+			case <-ctx.Request.Context().Done():
+				log.Warn().
+					Err(ctx.Request.Context().Err()).
+					Msg("request timeout")
+				logging.AddLogEvent(ctx, "requestTimeout", true)
+				ans.Diagnostics = schema.NewXMLDiagnostics()
+				ans.Diagnostics.AddDiagnostic(
+					general.DCSystemTemporarilyUnavailable, 0, "request timeout",
+					"The request has not been processed in time, please try again later")
+				return nil, http.StatusServiceUnavailable
+			}
+		}
+		results := make([]result.ConcExample, len(ranges))
+		for i := range ranges {
+			concEx, err := rdb.DeserializeConcExampleResult(rawResults[rangeWaits[i]])
+			if err != nil {
+				ans.Diagnostics = schema.NewXMLDiagnostics()
+				ans.Diagnostics.AddDfltMsgDiagnostic(
+					general.DCGeneralSystemError, 0, err.Error())
+				return nil, http.StatusInternalServerError
+			}
+			if rangesInResultSet[i] && concEx.Err() == nil {
+				concEx.CutLines(ranges[i].From, maximumRecords)
+			}
+			results[i] = concEx
 		}
-		waits[i] = wait
+		return results, http.StatusOK
 	}
+	// shardRanges splits ranges of resources into ranges of their shards
+	// (see query.CalculateShardRanges), exact ones in case shardSizes is set
+	shardRanges := func(ranges query.LineRangeList, shardSizes map[string]int) query.LineRangeList {
+		ans := make(query.LineRangeList, 0, len(ranges))
+		for _, rng := range ranges {
+			ans = append(ans, query.CalculateShardRanges(rng, shardIDs[rng.Rsc], shardSizes)...)
+		}
+		return ans
+	}
+	searchedRanges := shardRanges(ranges, nil)
+	shardResults, status := fetchLines(searchedRanges)
+	if status != http.StatusOK {
+		return ans, status
+	}
+	// The ranges expect all the resources (and shards of a resource) to provide
+	// enough lines. If some of them runs out of lines before the requested page,
+	// the respective positions in the combined result are taken by the other
+	// ones and the ranges must be calculated once again based on actual sizes
+	// to keep record positions stable across pages.
+	if !hitCountOnly && startRecord > 1 && len(searchedRanges) > 1 {
+		if shardSizes, ok := getConcSizes(searchedRanges, shardResults); ok {
+			rscSizes := make(map[string]int)
+			for shardID, size := range shardSizes {
+				rscSizes[corpus.ShardResourceID(shardID)] += size
+			}
+			exactRanges := query.CalculatePartialRangesBySizes(
+				corpora, rscSizes, startRecord-1, maximumRecords)
+			exactSearchedRanges := shardRanges(exactRanges, shardSizes)
+			if !exactSearchedRanges.Equals(searchedRanges) {
+				ranges, searchedRanges = exactRanges, exactSearchedRanges
+				shardResults, status = fetchLines(searchedRanges)
+				if status != http.StatusOK {
+					return ans, status
+				}
+			}
+		}
+	}
+	results := make([]result.ConcExample, len(ranges))
+	var shardIdx int
+	for i, rng := range ranges {
+		numShards := len(shardIDs[rng.Rsc])
+		results[i] = result.MergeShardResults(
+			rng.To-rng.From, shardResults[shardIdx:shardIdx+numShards]...)
+		shardIdx += numShards
+	}
+
 	// using fromResource, we will cycle through available resources' results and their lines
 	fromResource := result.NewRoundRobinLineSel(maximumRecords, ranges.PIDList()...)
 	usedQueries := make(map[string]string) // maps resource ID to Manatee CQL query
 	var totalConcSize int
-	for i, wait := range waits {
-		rawResult := <-wait
-		result, err := rdb.DeserializeConcExampleResult(rawResult)
-		if err != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
-			ans.Diagnostics.AddDfltMsgDiagnostic(
-				general.DCGeneralSystemError, 0, err.Error())
-			return ans, http.StatusInternalServerError
-		}
+	concSizes := make([]int, len(ranges))
+	corpusSizes := make([]int64, len(ranges))
+	for i := range ranges {
+		result := results[i]
 		if err := result.Err(); err != nil {
 			if err.Error() == mango.ErrRowsRangeOutOfConc.Error() {
 				fromResource.RscSetErrorAt(i, err)
 
+			} else if result.IsTimeout() {
+				log.Warn().
+					Err(err).
+					Str("corpus", ranges[i].Rsc).
+					Int("from", ranges[i].From).
+					Int("maximumRecords", maximumRecords).
+					Msg("worker result timeout")
+				logging.AddLogEvent(ctx, "workerTimeout", true)
+				ans.Diagnostics = schema.NewXMLDiagnostics()
+				ans.Diagnostics.AddDiagnostic(
+					general.DCSystemTemporarilyUnavailable, 0, "worker timeout",
+					"The search has not finished in time, please try again later")
+				return ans, http.StatusGatewayTimeout
+
 			} else {
 				ans.Diagnostics = schema.NewXMLDiagnostics()
 				ans.Diagnostics.AddDfltMsgDiagnostic(
@@ -269,17 +794,33 @@ func (a *FCSSubHandlerV12) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequ
 				return ans, http.StatusInternalServerError
 			}
 		}
-		fromResource.SetRscLines(ranges[i].Rsc, result)
+		fromResource.SetRscLinesAt(i, result)
+		concSizes[i] = result.ConcSize
+		corpusSizes[i] = result.CorpusSize
 		usedQueries[ranges[i].Rsc] = result.Query
 		totalConcSize += result.ConcSize
 	}
 
 	ans.NumberOfRecords = totalConcSize
-	if fromResource.AllHasOutOfRangeError() {
+	if resultSetTTL > 0 {
+		searchArgs[SearchRetrArgResultSetTTL.String()] = strconv.Itoa(resultSetTTL)
+		ans.ResultSetID = general.EncodeResultSetID(searchArgs)
+		ans.ResultSetIdleTime = resultSetTTL
+	}
+	// Note: resources exhausted before the requested position just do not
+	// provide any lines. It is only an error if the whole result is exhausted
+	// (which does not apply if the client asked just for the number of hits).
+	if !hitCountOnly && (fromResource.AllHasOutOfRangeError() ||
+		query.IsStartRecordOutOfRange(startRecord, totalConcSize)) {
 		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCFirstRecordPosOutOfRange, 0, fromResource.GetFirstError().Error())
-		return ans, general.ConformantUnprocessableEntity
+		ans.Diagnostics.AddDiagnostic(
+			general.DCFirstRecordPosOutOfRange, 0, strconv.Itoa(startRecord),
+			fmt.Sprintf(
+				"First record position out of range (number of records: %d)",
+				totalConcSize,
+			),
+		)
+		return ans, general.ConformantStatusBadRequest
 
 	} else if fromResource.HasFatalError() {
 		ans.Diagnostics = schema.NewXMLDiagnostics()
@@ -289,58 +830,177 @@ func (a *FCSSubHandlerV12) searchRetrieve(ctx *gin.Context, fcsResponse *FCSRequ
 	}
 
 	// transform results
-	records := make([]schema.XMLSRRecord, 0, maximumRecords)
-	for len(records) < maximumRecords && fromResource.Next() {
-		res, err := a.corporaConf.Resources.GetResource(fromResource.CurrRscName())
-		if err != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
-			ans.Diagnostics.AddDfltMsgDiagnostic(
-				general.DCGeneralSystemError, 0, err.Error())
-			return ans, http.StatusInternalServerError
-		}
-		item := fromResource.CurrLine()
-		var refURL string
-		if res.KontextBacklinkRootURL != "" {
-			var err error
-			refURL, err = backlink.GenerateForKonText(
-				res.KontextBacklinkRootURL, res.ID, usedQueries[res.ID], item.Ref)
-			if err != nil {
-				log.Error().Err(err).Msg("failed to generate ResourceFragment URL")
-			}
+	rows := result.NewKWICRowReader(
+		fromResource, maximumRecords, a.corporaConf.Resources, usedQueries,
+		a.corporaConf.MaximumRenderedContext)
+	numReturned, err := rows.CountRows() // maps resource ID to number of returned records
+	if err != nil {
+		ans.Diagnostics = schema.NewXMLDiagnostics()
+		ans.Diagnostics.AddDfltMsgDiagnostic(
+			general.DCGeneralSystemError, 0, err.Error())
+		return ans, http.StatusInternalServerError
+	}
+	var numRecords int
+	for _, num := range numReturned {
+		numRecords += num
+	}
+	nextPosition := startRecord
+	nextRecord := func() (*schema.XMLSRRecord, error) {
+		row, ok, err := rows.Next()
+		if !ok || err != nil {
+			return nil, err
+		}
+		res := row.Resource
+		position := nextPosition
+		nextPosition++
+		if recordSchema == general.RecordSchemaDC {
+			return &schema.XMLSRRecord{
+				Schema:         recordSchema,
+				RecordPacking:  string(fcsResponse.RecordPacking),
+				DCData:         newDCRecord(res, row.KWIC, row.RefURL, a.serverInfo.DefaultLanguage),
+				RecordPosition: position,
+			}, nil
 		}
-		records = append(records, schema.XMLSRRecord{
+		record := &schema.XMLSRRecord{
 			Schema:        "http://clarin.eu/fcs/resource",
 			RecordPacking: string(fcsResponse.RecordPacking),
-			Data: schema.XMLSRResource{
+			Data: &schema.XMLSRResource{
 				XMLNSFCS: "http://clarin.eu/fcs/resource",
 				PID:      res.PID,
 				ResourceFragment: schema.XMLSRResourceFragment{
-					Ref: refURL,
+					Ref: row.RefURL,
 					DataViews: schema.XMLSRDataView{
 						Type: "application/x-clarin-fcs-hits+xml",
 						Result: schema.XMLSRBasicDataViewResult{
 							XMLNSHits: "http://clarin.eu/fcs/dataview/hits",
-							Data: strings.Join(
-								collections.SliceMap(
-									item.Text,
-									func(token *conc.Token, i int) string {
-										if token.Strong {
-											return "<hits:Hit>" + token.Word + "</hits:Hit>"
-										}
-										return token.Word
-									},
-								),
-								" ",
-							),
+							Data:      row.HitsData(),
 						},
 					},
 				},
 			},
-			RecordPosition: len(records) + startRecord,
-		})
+			RecordPosition: position,
+		}
+		if fcsResponse.RecordPacking == RecordPackingString && a.serverInfo.StringRecordFormat == cnf.StringRecordFormatTSV {
+			record.PlainText = row.PlainTextRecord(position, a.serverInfo.StringRecordFieldSeparator)
+		}
+		return record, nil
+	}
+	if numRecords == 0 {
+		// no 'records' element, numberOfRecords is enough to report no hits
+		ans.Records = nil
+
+	} else if a.serverInfo.StreamingMinRecords > 0 && maximumRecords >= a.serverInfo.StreamingMinRecords {
+		// records are created while the response is written to the client
+		ans.Records = schema.NewStreamedXMLSRRecords(nextRecord)
+
+	} else {
+		records := make([]schema.XMLSRRecord, 0, numRecords)
+		for {
+			record, err := nextRecord()
+			if err != nil {
+				ans.Diagnostics = schema.NewXMLDiagnostics()
+				ans.Diagnostics.AddDfltMsgDiagnostic(
+					general.DCGeneralSystemError, 0, err.Error())
+				return ans, http.StatusInternalServerError
+			}
+			if record == nil {
+				break
+			}
+			records = append(records, *record)
+		}
+		ans.Records = &schema.XMLSRRecords{Records: records}
+	}
+	// the summary is always included so clients can tell whether
+	// a resource has more hits, statistics only on request
+	var debugQueries map[string]string
+	if debugQuery {
+		debugQueries = usedQueries
 	}
-	if len(records) > 0 {
-		ans.Records = &records
+	ans.ExtraResponseData = a.resourcesInfo(
+		ranges, concSizes, corpusSizes, numReturned, resourceStats, debugQueries)
+	logging.AddLogEvent(ctx, "numberOfRecords", ans.NumberOfRecords)
+	logging.AddLogEvent(ctx, "returnedRecords", numRecords)
+	if ans.Diagnostics == nil {
+		ans.Diagnostics = nonFatalDiagnostics
+
+	} else if nonFatalDiagnostics != nil {
+		ans.Diagnostics.Diagnostics = append(
+			ans.Diagnostics.Diagnostics, nonFatalDiagnostics.Diagnostics...)
 	}
 	return ans, http.StatusOK
 }
+
+// getConcSizes maps searched resources to sizes of their concordances.
+// The last value is false in case some of the results has failed
+// so the size of its concordance is unknown.
+func getConcSizes(ranges query.LineRangeList, results []result.ConcExample) (map[string]int, bool) {
+	ans := make(map[string]int)
+	for i, rng := range ranges {
+		if err := results[i].Err(); err != nil && err.Error() != mango.ErrRowsRangeOutOfConc.Error() {
+			return nil, false
+		}
+		ans[rng.Rsc] = results[i].ConcSize
+	}
+	return ans, true
+}
+
+// newDCRecord creates a Dublin Core summary of a concordance line.
+// The resource title is provided in the language `lang` (if available).
+func newDCRecord(
+	res *corpus.CorpusSetup,
+	kwic conc.KWICLine,
+	refURL string,
+	lang string,
+) *schema.XMLSRDCRecord {
+	ans := schema.NewXMLSRDCRecord()
+	if title, ok := general.LocalizedValue(res.FullName, lang); ok {
+		ans.Titles = append(ans.Titles, title)
+	} else {
+		ans.Titles = append(ans.Titles, res.ID)
+	}
+	ans.Description = kwic.Tokens().PackText(res.TextPacking())
+	ans.Identifier = refURL
+	ans.Source = res.PID
+	ans.Languages = res.NormalizedLanguages()
+	return ans
+}
+
+// resourcesInfo describes results of individual searched resources
+// so clients can tell whether there are more hits in a resource
+// than the ones returned so far. The sizes of resources and relative
+// frequencies of hits are included only if withStats is true.
+// In case usedQueries (resource ID => backend query) is not nil,
+// the queries are included too.
+func (a *FCSSubHandlerV12) resourcesInfo(
+	ranges query.LineRangeList,
+	concSizes []int,
+	corpusSizes []int64,
+	numReturned map[string]int,
+	withStats bool,
+	usedQueries map[string]string,
+) *schema.XMLSRExtraResponseData {
+	ans := schema.NewXMLSRExtraResponseData()
+	processed := collections.NewSet[string]()
+	for i, rng := range ranges {
+		res, err := a.corporaConf.Resources.GetResource(rng.Rsc)
+		if err != nil || processed.Contains(rng.Rsc) {
+			continue
+		}
+		processed.Add(rng.Rsc)
+		info := schema.XMLSRResourceInfo{
+			PID:             res.PID,
+			NumberOfRecords: concSizes[i],
+			ReturnedRecords: numReturned[rng.Rsc],
+			Truncated:       rng.From+numReturned[rng.Rsc] < concSizes[i],
+			Query:           usedQueries[rng.Rsc],
+		}
+		if withStats {
+			info.CorpusSize = res.CorpusSize(corpusSizes[i])
+			if ipm, ok := res.HitsPerMillion(concSizes[i], corpusSizes[i]); ok {
+				info.HitsPerMillion = &ipm
+			}
+		}
+		ans.Resources.Resources = append(ans.Resources.Resources, info)
+	}
+	return ans
+}
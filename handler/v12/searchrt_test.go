@@ -0,0 +1,795 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package v12
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/czcorpus/mquery-sru/auth"
+	"github.com/czcorpus/mquery-sru/cnf"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/corpus/conc"
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/czcorpus/mquery-sru/handler/v12/schema"
+	"github.com/czcorpus/mquery-sru/query"
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/czcorpus/mquery-sru/rdb/rdbtest"
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchRetrieveReportsAllArgErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := &FCSSubHandlerV12{}
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/?operation=searchRetrieve&x-foo=1", nil)
+	ans, code := handler.searchRetrieve(ctx, &FCSRequest{})
+	assert.Equal(t, general.ConformantStatusBadRequest, code)
+	if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 2) {
+		assert.Equal(t, "info:srw/diagnostic/1/8", ans.Diagnostics.Diagnostics[0].URI)
+		assert.Equal(t, "x-foo", ans.Diagnostics.Diagnostics[0].Details)
+		assert.Equal(t, "info:srw/diagnostic/1/7", ans.Diagnostics.Diagnostics[1].URI)
+		assert.Equal(t, "fcs_query", ans.Diagnostics.Diagnostics[1].Details)
+	}
+}
+
+func TestSearchRetrieveUnknownArgsPolicy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	search := func(serverInfo *cnf.ServerInfo) []string {
+		handler := &FCSSubHandlerV12{serverInfo: serverInfo}
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(
+			"GET", "/?operation=searchRetrieve&x-foo=1&utm_source=feed&_=123", nil)
+		ans, _ := handler.searchRetrieve(ctx, &FCSRequest{})
+		details := make([]string, 0, 4)
+		if ans.Diagnostics != nil {
+			for _, d := range ans.Diagnostics.Diagnostics {
+				details = append(details, d.Details)
+			}
+		}
+		return details
+	}
+	// note: the missing query is always reported
+	assert.Equal(
+		t,
+		[]string{"_", "utm_source", "x-foo", "fcs_query"},
+		search(&cnf.ServerInfo{UnknownParamsPolicy: cnf.UnknownParamsPolicyStrict}),
+	)
+	assert.Equal(
+		t,
+		[]string{"x-foo", "fcs_query"},
+		search(&cnf.ServerInfo{
+			UnknownParamsPolicy:  cnf.UnknownParamsPolicyStrict,
+			IgnoredParamPrefixes: []string{"utm_", "_"},
+		}),
+	)
+	assert.Equal(
+		t,
+		[]string{"fcs_query"},
+		search(&cnf.ServerInfo{UnknownParamsPolicy: cnf.UnknownParamsPolicyLenient}),
+	)
+}
+
+func TestSearchRetrieveRejectsUnknownRecordSchema(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := &FCSSubHandlerV12{}
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/?operation=searchRetrieve&query=dog&recordSchema=foo", nil)
+	ans, code := handler.searchRetrieve(ctx, &FCSRequest{})
+	assert.Equal(t, general.ConformantUnprocessableEntity, code)
+	if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+		assert.Equal(t, "info:srw/diagnostic/1/66", ans.Diagnostics.Diagnostics[0].URI)
+		assert.Equal(t, "recordSchema", ans.Diagnostics.Diagnostics[0].Details)
+	}
+}
+
+func TestSearchRetrieveValidatesMaximumRecords(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handlers := []*FCSSubHandlerV12{
+		{},
+		{corporaConf: &corpus.CorporaSetup{DisableHitCountOnly: true}},
+	}
+	for i, xMaximumRecords := range []string{"-1", "0"} {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(
+			"GET", "/?operation=searchRetrieve&query=dog&maximumRecords="+xMaximumRecords, nil)
+		ans, code := handlers[i].searchRetrieve(ctx, &FCSRequest{})
+		assert.Equal(t, general.ConformantUnprocessableEntity, code)
+		if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+			assert.Equal(t, "info:srw/diagnostic/1/6", ans.Diagnostics.Diagnostics[0].URI)
+			assert.Equal(t, "maximumRecords", ans.Diagnostics.Diagnostics[0].Details)
+		}
+	}
+}
+
+func TestResourcesInfo(t *testing.T) {
+	handler := &FCSSubHandlerV12{
+		corporaConf: &corpus.CorporaSetup{
+			Resources: corpus.SrchResources{
+				{ID: "syn2020", PID: "pid:syn2020"},
+				{ID: "intercorp", PID: "pid:intercorp"},
+				{ID: "oral", PID: "pid:oral"},
+				{ID: "spoken", PID: "pid:spoken", Size: 500000},
+			},
+		},
+	}
+	ranges := query.LineRangeList{
+		{Rsc: "syn2020", From: 0, To: 10},
+		{Rsc: "intercorp", From: 2, To: 12},
+		{Rsc: "oral", From: 0, To: 10},
+		{Rsc: "spoken", From: 0, To: 10},
+	}
+	info := handler.resourcesInfo(
+		ranges,
+		[]int{100, 7, 3, 10},
+		[]int64{1000000, 20000, 0, 0},
+		map[string]int{"syn2020": 4, "intercorp": 5, "oral": 3, "spoken": 10},
+		true,
+		nil,
+	)
+	ipm := func(v float64) *float64 { return &v }
+	assert.Equal(
+		t,
+		[]schema.XMLSRResourceInfo{
+			{PID: "pid:syn2020", NumberOfRecords: 100, ReturnedRecords: 4, Truncated: true,
+				CorpusSize: 1000000, HitsPerMillion: ipm(100)},
+			{PID: "pid:intercorp", NumberOfRecords: 7, ReturnedRecords: 5, Truncated: false,
+				CorpusSize: 20000, HitsPerMillion: ipm(350)},
+			{PID: "pid:oral", NumberOfRecords: 3, ReturnedRecords: 3, Truncated: false},
+			{PID: "pid:spoken", NumberOfRecords: 10, ReturnedRecords: 10, Truncated: false,
+				CorpusSize: 500000, HitsPerMillion: ipm(20)},
+		},
+		info.Resources.Resources,
+	)
+}
+
+func TestTranslateQueryParsesOnce(t *testing.T) {
+	handler := &FCSSubHandlerV12{
+		corporaConf: &corpus.CorporaSetup{
+			Resources: corpus.SrchResources{
+				{ID: "syn2020", PosAttrs: []corpus.PosAttr{
+					{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true, IsBasicSearchAttr: true},
+				}},
+				{ID: "oral", PosAttrs: []corpus.PosAttr{
+					{Name: "orth", Layer: corpus.LayerTypeText, IsLayerDefault: true, IsBasicSearchAttr: true},
+				}},
+			},
+		},
+	}
+	cache := new(queryParseCache)
+	ast, fcsErr := handler.translateQuery("syn2020", "dog", "", false, "", cache)
+	assert.Nil(t, fcsErr)
+	assert.Equal(t, `[word="dog"]`, ast.Generate())
+	ast2, fcsErr := handler.translateQuery("oral", "dog", "", false, "", cache)
+	assert.Nil(t, fcsErr)
+	assert.Same(t, ast, ast2)
+	assert.Equal(t, `[orth="dog"]`, ast2.Generate())
+}
+
+func TestSearchRetrieveValidatesWithin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	regDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(regDir, "syn2020"), []byte{}, 0644))
+	handler := &FCSSubHandlerV12{
+		corporaConf: &corpus.CorporaSetup{
+			RegistryDir: regDir,
+			Resources: corpus.SrchResources{
+				{
+					ID:               "syn2020",
+					PID:              "pid:syn2020",
+					StructureMapping: corpus.StructureMapping{SentenceStruct: "s"},
+				},
+			},
+		},
+	}
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(
+		"GET", "/?operation=searchRetrieve&query=dog&x-cnc-within=paragraph&x-fcs-context=pid:syn2020", nil)
+	ans, code := handler.searchRetrieve(ctx, &FCSRequest{})
+	assert.Equal(t, general.ConformantUnprocessableEntity, code)
+	if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+		assert.Equal(t, "info:srw/diagnostic/1/6", ans.Diagnostics.Diagnostics[0].URI)
+		assert.Equal(t, "x-cnc-within", ans.Diagnostics.Diagnostics[0].Details)
+		assert.Contains(t, ans.Diagnostics.Diagnostics[0].Message, "syn2020")
+	}
+}
+
+func TestTranslateQueryWithin(t *testing.T) {
+	handler := &FCSSubHandlerV12{
+		corporaConf: &corpus.CorporaSetup{
+			Resources: corpus.SrchResources{
+				{
+					ID: "syn2020",
+					PosAttrs: []corpus.PosAttr{
+						{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true, IsBasicSearchAttr: true},
+					},
+					StructureMapping: corpus.StructureMapping{SentenceStruct: "s"},
+				},
+			},
+		},
+	}
+	ast, fcsErr := handler.translateQuery(
+		"syn2020", `"lazy dog"`, "", false, "s", new(queryParseCache))
+	assert.Nil(t, fcsErr)
+	assert.Equal(t, `[word="lazy"] [word="dog"] within <s />`, ast.Generate())
+}
+
+func TestSearchRetrieveValidatesMaximumResources(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	regDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(regDir, "syn2020"), []byte{}, 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(regDir, "oral"), []byte{}, 0644))
+	handler := &FCSSubHandlerV12{
+		corporaConf: &corpus.CorporaSetup{
+			RegistryDir:      regDir,
+			MaximumResources: 1,
+			Resources: corpus.SrchResources{
+				{ID: "syn2020", PID: "pid:syn2020"},
+				{ID: "oral", PID: "pid:oral"},
+			},
+		},
+	}
+	search := func(args string) (schema.XMLSRResponse, int) {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest("GET", "/?operation=searchRetrieve&query=dog&"+args, nil)
+		return handler.searchRetrieve(ctx, &FCSRequest{})
+	}
+	for _, args := range []string{"", "x-fcs-context=pid:syn2020,pid:oral", "x-fcs-context=all"} {
+		ans, code := search(args)
+		assert.Equal(t, general.ConformantUnprocessableEntity, code)
+		if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+			assert.Equal(t, "info:srw/diagnostic/1/6", ans.Diagnostics.Diagnostics[0].URI)
+			assert.Equal(t, "x-fcs-context", ans.Diagnostics.Diagnostics[0].Details)
+			assert.Contains(t, ans.Diagnostics.Diagnostics[0].Message, "at most 1 resources")
+		}
+	}
+
+	// the limit is not exceeded so the search fails later
+	// on the (intentionally) unsupported structure
+	handler.corporaConf.MaximumResourcesExemptDefault = true
+	for _, args := range []string{"", "x-fcs-context=pid:syn2020"} {
+		ans, _ := search(args + "&x-cnc-within=paragraph")
+		if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+			assert.Equal(t, "x-cnc-within", ans.Diagnostics.Diagnostics[0].Details)
+		}
+	}
+	ans, _ := search("x-fcs-context=pid:syn2020,pid:oral")
+	if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+		assert.Equal(t, "x-fcs-context", ans.Diagnostics.Diagnostics[0].Details)
+	}
+}
+
+func TestTranslateQueryUnsupportedFeature(t *testing.T) {
+	handler := &FCSSubHandlerV12{
+		corporaConf: &corpus.CorporaSetup{
+			Resources: corpus.SrchResources{
+				{ID: "syn2020", PosAttrs: []corpus.PosAttr{
+					{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true, IsBasicSearchAttr: true},
+				}},
+			},
+		},
+	}
+	_, fcsErr := handler.translateQuery("syn2020", "cat PROX dog", "", false, "", new(queryParseCache))
+	if assert.NotNil(t, fcsErr) {
+		assert.Equal(t, general.DCQueryFeatureUnsupported, fcsErr.Code)
+		assert.Equal(t, "PROX", fcsErr.Ident)
+	}
+	_, fcsErr = handler.translateQuery("syn2020", "cat AND", "", false, "", new(queryParseCache))
+	if assert.NotNil(t, fcsErr) {
+		assert.Equal(t, general.DCQuerySyntaxError, fcsErr.Code)
+	}
+}
+
+func TestSearchRetrieveRequestTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	srv := miniredis.RunT(t)
+	port, err := strconv.Atoi(srv.Port())
+	assert.NoError(t, err)
+	regDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(regDir, "syn2020"), []byte{}, 0644))
+	radapter := rdb.NewAdapter(&rdb.Conf{
+		Host: srv.Host(), Port: port, ChannelQuery: "testQueries", QueryAnswerTimeoutSecs: 1})
+	// a fake worker which listens but never answers
+	radapter.Subscribe()
+	handler := &FCSSubHandlerV12{
+		corporaConf: &corpus.CorporaSetup{
+			RegistryDir: regDir,
+			Resources: corpus.SrchResources{
+				{
+					ID:  "syn2020",
+					PID: "pid:syn2020",
+					PosAttrs: []corpus.PosAttr{
+						{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true, IsBasicSearchAttr: true},
+					},
+					StructureMapping: corpus.StructureMapping{SentenceStruct: "s"},
+				},
+			},
+		},
+		serverInfo: &cnf.ServerInfo{Database: "test"},
+		radapter:   radapter,
+	}
+	reqCtx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(
+		"GET", "/?operation=searchRetrieve&query=dog", nil).WithContext(reqCtx)
+	ans, code := handler.searchRetrieve(ctx, &FCSRequest{})
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+		assert.Equal(t, "info:srw/diagnostic/1/2", ans.Diagnostics.Diagnostics[0].URI)
+		assert.Equal(t, "request timeout", ans.Diagnostics.Diagnostics[0].Details)
+	}
+}
+
+func TestSearchRetrieveValidatesDebugQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := &FCSSubHandlerV12{corporaConf: &corpus.CorporaSetup{}}
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(
+		"GET", "/?operation=searchRetrieve&query=dog&x-cnc-debug-query=true", nil)
+	ans, code := handler.searchRetrieve(ctx, &FCSRequest{})
+	assert.Equal(t, general.ConformantUnprocessableEntity, code)
+	if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+		assert.Equal(t, "info:srw/diagnostic/1/8", ans.Diagnostics.Diagnostics[0].URI)
+		assert.Equal(t, "x-cnc-debug-query", ans.Diagnostics.Diagnostics[0].Details)
+	}
+
+	handler.corporaConf.AllowDebugQuery = true
+	ctx, _ = gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(
+		"GET", "/?operation=searchRetrieve&query=dog&x-cnc-debug-query=maybe", nil)
+	ans, code = handler.searchRetrieve(ctx, &FCSRequest{})
+	assert.Equal(t, general.ConformantUnprocessableEntity, code)
+	if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+		assert.Equal(t, "info:srw/diagnostic/1/6", ans.Diagnostics.Diagnostics[0].URI)
+	}
+}
+
+func TestResourcesInfoWithQueries(t *testing.T) {
+	handler := &FCSSubHandlerV12{
+		corporaConf: &corpus.CorporaSetup{
+			Resources: corpus.SrchResources{
+				{ID: "syn2020", PID: "pid:syn2020"},
+				{ID: "oral", PID: "pid:oral"},
+			},
+		},
+	}
+	info := handler.resourcesInfo(
+		query.LineRangeList{{Rsc: "syn2020", From: 0, To: 10}, {Rsc: "oral", From: 0, To: 10}},
+		[]int{1, 0},
+		[]int64{0, 0},
+		map[string]int{"syn2020": 1},
+		true,
+		map[string]string{"syn2020": `[word="dog"]`, "oral": `[orth="dog"]`},
+	)
+	if assert.Len(t, info.Resources.Resources, 2) {
+		assert.Equal(t, `[word="dog"]`, info.Resources.Resources[0].Query)
+		assert.Equal(t, `[orth="dog"]`, info.Resources.Resources[1].Query)
+	}
+}
+
+func TestSearchRetrieveStrict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// note: registry of the `oral` resource is missing (i.e. it is unavailable)
+	handler := &FCSSubHandlerV12{
+		corporaConf: &corpus.CorporaSetup{
+			RegistryDir: t.TempDir(),
+			Resources: corpus.SrchResources{
+				{ID: "oral", PID: "pid:oral"},
+			},
+			StrictSearch: true,
+		},
+	}
+	search := func(args string) (schema.XMLSRResponse, int) {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(
+			"GET", "/?operation=searchRetrieve&query=dog&x-fcs-context=pid:oral"+args, nil)
+		return handler.searchRetrieve(ctx, &FCSRequest{})
+	}
+
+	ans, code := search("")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Nil(t, ans.Records)
+	if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+		assert.Equal(t, "info:srw/diagnostic/1/2", ans.Diagnostics.Diagnostics[0].URI)
+		assert.Equal(t, "pid:oral", ans.Diagnostics.Diagnostics[0].Details)
+	}
+
+	// partial results (i.e. no results here) with a surrogate diagnostic
+	ans, code = search("&x-cnc-strict=false")
+	assert.Equal(t, http.StatusOK, code)
+	if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+		assert.Equal(t, "https://github.com/czcorpus/mquery-sru/diagnostic/102", ans.Diagnostics.Diagnostics[0].URI)
+	}
+
+	ans, code = search("&x-cnc-strict=maybe")
+	assert.Equal(t, general.ConformantUnprocessableEntity, code)
+	if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+		assert.Equal(t, "x-cnc-strict", ans.Diagnostics.Diagnostics[0].Details)
+	}
+}
+
+// shardedConcordance responds to queries with three hits in each
+// searched corpus. The hits are identified by the corpus registry
+// file name and the line number.
+func shardedConcordance(q rdb.Query) *rdb.WorkerResult {
+	var args rdb.ConcExampleArgs
+	if err := json.Unmarshal(q.Args, &args); err != nil {
+		return rdbtest.ErrorResponder(err.Error())(q)
+	}
+	ans := result.ConcExample{ConcSize: 3, CorpusSize: 1000, ResultType: q.ResultType}
+	for i := args.StartLine; i < 3 && i < args.StartLine+args.MaxItems; i++ {
+		word := fmt.Sprintf("%s-%d", filepath.Base(args.CorpusPath), i)
+		ans.Lines = append(ans.Lines, conc.ConcordanceLine{
+			Text: conc.TokenSlice{{Word: word, Strong: true, Attrs: map[string]string{"word": word}}},
+			Ref:  "#1",
+		})
+	}
+	res, err := rdb.CreateWorkerResult(&ans)
+	if err != nil {
+		return rdbtest.ErrorResponder(err.Error())(q)
+	}
+	return res
+}
+
+func TestSearchRetrieveMergesShards(t *testing.T) {
+	handler := newFakeWorkersHandler(t, rdbtest.NewAdapter(shardedConcordance))
+	shardsDir := t.TempDir()
+	news := *handler.corporaConf.Resources[0]
+	news.ID = "news"
+	news.PID = "pid:news"
+	for _, name := range []string{"news2019", "news2020"} {
+		path := filepath.Join(shardsDir, name)
+		assert.NoError(t, os.WriteFile(path, []byte{}, 0644))
+		news.RegistryPaths = append(news.RegistryPaths, path)
+	}
+	handler.corporaConf.Resources = append(handler.corporaConf.Resources, &news)
+	hitPattern := regexp.MustCompile(`[a-z]+[0-9]+-[0-9]`)
+	recordHits := func(ans schema.XMLSRResponse) []string {
+		hits := make([]string, 0, len(ans.Records.Records))
+		for _, record := range ans.Records.Records {
+			data, err := xml.Marshal(record)
+			assert.NoError(t, err)
+			hits = append(hits, hitPattern.FindString(string(data)))
+		}
+		return hits
+	}
+
+	// the shards of `news` are merged so the resource takes
+	// just every other position (the same as `syn2020`)
+	ans, code := searchWithArgs(handler, "query=dog&maximumRecords=6")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 9, ans.NumberOfRecords)
+	if assert.NotNil(t, ans.Records) {
+		assert.Equal(
+			t,
+			[]string{"syn2020-0", "news2019-0", "syn2020-1", "news2020-0", "syn2020-2", "news2019-1"},
+			recordHits(ans),
+		)
+	}
+	if assert.Len(t, ans.ExtraResponseData.Resources.Resources, 2) {
+		assert.Equal(t, "pid:news", ans.ExtraResponseData.Resources.Resources[1].PID)
+		assert.Equal(t, 6, ans.ExtraResponseData.Resources.Resources[1].NumberOfRecords)
+		assert.Equal(t, 3, ans.ExtraResponseData.Resources.Resources[1].ReturnedRecords)
+		assert.True(t, ans.ExtraResponseData.Resources.Resources[1].Truncated)
+	}
+
+	ans, code = searchWithArgs(handler, "query=dog&maximumRecords=6&startRecord=7")
+	assert.Equal(t, http.StatusOK, code)
+	if assert.NotNil(t, ans.Records) {
+		assert.Equal(t, []string{"news2020-1", "news2019-2", "news2020-2"}, recordHits(ans))
+		assert.Equal(t, 7, ans.Records.Records[0].RecordPosition)
+	}
+}
+
+// newFakeWorkersHandler creates a handler with a single available
+// resource (syn2020) which passes queries to the provided publisher
+func newFakeWorkersHandler(t *testing.T, radapter rdb.QueryPublisher) *FCSSubHandlerV12 {
+	gin.SetMode(gin.TestMode)
+	regDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(regDir, "syn2020"), []byte{}, 0644))
+	return &FCSSubHandlerV12{
+		corporaConf: &corpus.CorporaSetup{
+			RegistryDir:    regDir,
+			MaximumRecords: 50,
+			DefaultRecords: 10,
+			Resources: corpus.SrchResources{
+				{
+					ID:  "syn2020",
+					PID: "pid:syn2020",
+					PosAttrs: []corpus.PosAttr{
+						{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true, IsBasicSearchAttr: true},
+					},
+					StructureMapping: corpus.StructureMapping{SentenceStruct: "s"},
+				},
+			},
+		},
+		serverInfo: &cnf.ServerInfo{Database: "test"},
+		radapter:   radapter,
+	}
+}
+
+// searchWithArgs runs searchRetrieve with the provided URL arguments
+func searchWithArgs(handler *FCSSubHandlerV12, args string) (schema.XMLSRResponse, int) {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/?operation=searchRetrieve&"+args, nil)
+	return handler.searchRetrieve(ctx, &FCSRequest{})
+}
+
+// dogConcordance is a worker result with a single hit
+var dogConcordance = result.ConcExample{
+	Lines: []conc.ConcordanceLine{
+		{
+			Text: conc.TokenSlice{
+				{Word: "a", Attrs: map[string]string{"word": "a"}},
+				{Word: "dog", Strong: true, Attrs: map[string]string{"word": "dog"}},
+				{Word: "barks", Attrs: map[string]string{"word": "barks"}},
+			},
+			Ref: "#1",
+		},
+	},
+	ConcSize:   1,
+	CorpusSize: 1000,
+}
+
+func TestSearchRetrieveWithFakeWorkers(t *testing.T) {
+	radapter := rdbtest.NewAdapter(rdbtest.ConcExampleResponder(dogConcordance))
+	handler := newFakeWorkersHandler(t, radapter)
+	ans, code := searchWithArgs(handler, "query=dog&maximumRecords=20")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, ans.Diagnostics)
+	assert.Equal(t, 1, ans.NumberOfRecords)
+	if assert.NotNil(t, ans.Records) && assert.Len(t, ans.Records.Records, 1) {
+		assert.Equal(t, 1, ans.Records.Records[0].RecordPosition)
+	}
+
+	if published := radapter.Published(); assert.Len(t, published, 1) {
+		assert.Equal(t, "concExample", published[0].Func)
+		var args rdb.ConcExampleArgs
+		assert.NoError(t, json.Unmarshal(published[0].Args, &args))
+		assert.Equal(t, `[word="dog"]`, args.Query)
+		assert.Equal(t, 20, args.MaxItems)
+	}
+}
+
+func TestSearchRetrieveWithoutWorkers(t *testing.T) {
+	radapter := rdbtest.NewAdapter(rdbtest.ConcExampleResponder(dogConcordance))
+	radapter.NumListeners = 0
+	handler := newFakeWorkersHandler(t, radapter)
+	ans, code := searchWithArgs(handler, "query=dog")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+		assert.Equal(t, "info:srw/diagnostic/1/1", ans.Diagnostics.Diagnostics[0].URI)
+		assert.Equal(t, "no search workers available", ans.Diagnostics.Diagnostics[0].Details)
+	}
+	// the search fails immediately without waiting for an answer
+	assert.Empty(t, radapter.Published())
+}
+
+func TestSearchRetrieveStreamed(t *testing.T) {
+	radapter := rdbtest.NewAdapter(rdbtest.ConcExampleResponder(dogConcordance))
+	handler := newFakeWorkersHandler(t, radapter)
+	ans, code := searchWithArgs(handler, "query=dog")
+	assert.Equal(t, http.StatusOK, code)
+	assert.False(t, ans.Records.IsStreamed())
+	expected, err := xml.MarshalIndent(ans, "", "  ")
+	assert.NoError(t, err)
+
+	handler.serverInfo.StreamingMinRecords = 10
+	ans, code = searchWithArgs(handler, "query=dog")
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, ans.Records.IsStreamed())
+	assert.Empty(t, ans.Records.Records)
+	streamed, err := xml.MarshalIndent(ans, "", "  ")
+	assert.NoError(t, err)
+	assert.Equal(t, string(expected), string(streamed))
+}
+
+func TestSearchRetrieveResourcesSummary(t *testing.T) {
+	radapter := rdbtest.NewAdapter(rdbtest.ConcExampleResponder(dogConcordance))
+	handler := newFakeWorkersHandler(t, radapter)
+	// the truncation indicator is always available
+	ans, code := searchWithArgs(handler, "query=dog")
+	assert.Equal(t, http.StatusOK, code)
+	if assert.NotNil(t, ans.ExtraResponseData) && assert.Len(t, ans.ExtraResponseData.Resources.Resources, 1) {
+		info := ans.ExtraResponseData.Resources.Resources[0]
+		assert.Equal(t, "pid:syn2020", info.PID)
+		assert.Equal(t, 1, info.ReturnedRecords)
+		assert.False(t, info.Truncated)
+		assert.Zero(t, info.CorpusSize)
+		assert.Nil(t, info.HitsPerMillion)
+	}
+	// statistics are included only on request
+	ans, code = searchWithArgs(handler, "query=dog&x-cnc-resource-stats=true")
+	assert.Equal(t, http.StatusOK, code)
+	if assert.NotNil(t, ans.ExtraResponseData) && assert.Len(t, ans.ExtraResponseData.Resources.Resources, 1) {
+		info := ans.ExtraResponseData.Resources.Resources[0]
+		assert.Equal(t, int64(1000), info.CorpusSize)
+		assert.NotNil(t, info.HitsPerMillion)
+	}
+}
+
+func TestSearchRetrieveClampsMaximumRecords(t *testing.T) {
+	radapter := rdbtest.NewAdapter(rdbtest.ConcExampleResponder(dogConcordance))
+	handler := newFakeWorkersHandler(t, radapter)
+	ans, code := searchWithArgs(handler, "query=dog&maximumRecords=500")
+	// the search is not rejected, just the number of records is limited
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, ans.NumberOfRecords)
+	if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+		assert.Equal(t, "http://clarin.eu/fcs/diagnostic/14", ans.Diagnostics.Diagnostics[0].URI)
+		assert.Equal(t, "maximumRecords", ans.Diagnostics.Diagnostics[0].Details)
+		assert.Contains(t, ans.Diagnostics.Diagnostics[0].Message, "using 50")
+	}
+	if published := radapter.Published(); assert.Len(t, published, 1) {
+		var args rdb.ConcExampleArgs
+		assert.NoError(t, json.Unmarshal(published[0].Args, &args))
+		assert.Equal(t, 50, args.MaxItems)
+	}
+}
+
+func TestSearchRetrieveSearchAttr(t *testing.T) {
+	radapter := rdbtest.NewAdapter(rdbtest.ConcExampleResponder(dogConcordance))
+	handler := newFakeWorkersHandler(t, radapter)
+	handler.corporaConf.Resources[0].PosAttrs = append(
+		handler.corporaConf.Resources[0].PosAttrs,
+		corpus.PosAttr{Name: "lemma", Layer: corpus.LayerTypeLemma},
+	)
+	ans, code := searchWithArgs(handler, "query=dog&x-cnc-search-attr=lemma")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, ans.Diagnostics)
+	if published := radapter.Published(); assert.Len(t, published, 1) {
+		var args rdb.ConcExampleArgs
+		assert.NoError(t, json.Unmarshal(published[0].Args, &args))
+		assert.Equal(t, `[lemma="dog"]`, args.Query)
+	}
+
+	ans, code = searchWithArgs(handler, "query=dog&x-cnc-search-attr=tag")
+	assert.Equal(t, general.ConformantUnprocessableEntity, code)
+	if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+		assert.Equal(t, "info:srw/diagnostic/1/6", ans.Diagnostics.Diagnostics[0].URI)
+		assert.Equal(t, "x-cnc-search-attr", ans.Diagnostics.Diagnostics[0].Details)
+		assert.Equal(t, "attribute tag not available in: syn2020", ans.Diagnostics.Diagnostics[0].Message)
+	}
+	assert.Len(t, radapter.Published(), 1)
+}
+
+func TestSearchRetrieveByResultSetID(t *testing.T) {
+	radapter := rdbtest.NewAdapter(rdbtest.ConcExampleResponder(dogConcordance))
+	handler := newFakeWorkersHandler(t, radapter)
+	handler.corporaConf.MaximumResultSetTTL = 60
+	handler.corporaConf.ResultSetWindow = 100
+	ans, code := searchWithArgs(handler, "query=dog&resultSetTTL=30&x-cnc-search-attr=word")
+	assert.Equal(t, http.StatusOK, code)
+	if !assert.NotEmpty(t, ans.ResultSetID) {
+		return
+	}
+	firstID := ans.ResultSetID
+
+	// the referred search is the same, just the page differs
+	ans, code = searchWithArgs(
+		handler, "query="+url.QueryEscape(`cql.resultSetId="`+firstID+`"`)+"&maximumRecords=5")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, ans.Diagnostics)
+	assert.Equal(t, 1, ans.NumberOfRecords)
+	assert.Equal(t, firstID, ans.ResultSetID)
+	if published := radapter.Published(); assert.Len(t, published, 2) {
+		assert.Equal(t, published[0].Func, published[1].Func)
+		assert.Equal(t, string(published[0].Args), string(published[1].Args))
+	}
+
+	ans, code = searchWithArgs(handler, "query="+url.QueryEscape(`cql.resultSetId="foo"`))
+	assert.Equal(t, general.ConformantUnprocessableEntity, code)
+	if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+		assert.Equal(t, "info:srw/diagnostic/1/51", ans.Diagnostics.Diagnostics[0].URI)
+	}
+}
+
+func TestSearchRetrieveViewContextStruct(t *testing.T) {
+	radapter := rdbtest.NewAdapter(rdbtest.ConcExampleResponder(dogConcordance))
+	handler := newFakeWorkersHandler(t, radapter)
+	ans, code := searchWithArgs(handler, "query=dog&x-cnc-view-context-struct=p")
+	assert.Equal(t, general.ConformantUnprocessableEntity, code)
+	if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+		assert.Equal(t, "x-cnc-view-context-struct", ans.Diagnostics.Diagnostics[0].Details)
+		assert.Contains(t, ans.Diagnostics.Diagnostics[0].Message, "syn2020")
+	}
+	assert.Empty(t, radapter.Published())
+
+	ans, code = searchWithArgs(handler, "query=dog&x-cnc-view-context-struct=s")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Nil(t, ans.Diagnostics)
+	if published := radapter.Published(); assert.Len(t, published, 1) {
+		var args rdb.ConcExampleArgs
+		assert.NoError(t, json.Unmarshal(published[0].Args, &args))
+		assert.Equal(t, "s", args.ViewContextStruct)
+	}
+}
+
+func TestSearchRetrieveAnswerTimeout(t *testing.T) {
+	radapter := rdbtest.NewAdapter(rdbtest.ConcExampleResponder(dogConcordance))
+	handler := newFakeWorkersHandler(t, radapter)
+	searchWithArgs(handler, "query=dog")
+	handler.searchAnswerTimeout = 90 * time.Second
+	searchWithArgs(handler, "query=cat")
+	if published := radapter.Published(); assert.Len(t, published, 2) {
+		// zero means the adapter's default timeout applies
+		assert.Zero(t, published[0].AnswerTimeout)
+		assert.Equal(t, 90*time.Second, published[1].AnswerTimeout)
+	}
+}
+
+func TestSearchRetrieveDropsRestrictedResource(t *testing.T) {
+	radapter := rdbtest.NewAdapter(rdbtest.ConcExampleResponder(dogConcordance))
+	handler := newFakeWorkersHandler(t, radapter)
+	handler.authenticator = auth.NewAuthenticator(nil)
+	assert.NoError(t, os.WriteFile(filepath.Join(handler.corporaConf.RegistryDir, "syn2015"), []byte{}, 0644))
+	handler.corporaConf.Resources = append(handler.corporaConf.Resources, &corpus.CorpusSetup{
+		ID:  "syn2015",
+		PID: "pid:syn2015",
+		PosAttrs: []corpus.PosAttr{
+			{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true, IsBasicSearchAttr: true},
+		},
+		StructureMapping:        corpus.StructureMapping{SentenceStruct: "s"},
+		AvailabilityRestriction: corpus.AvailabilityRestrictionAuthOnly,
+	})
+	ans, code := searchWithArgs(handler, "query=dog")
+	// the restricted resource is reported but the rest is still searched
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, ans.NumberOfRecords)
+	if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+		assert.Equal(t, "https://github.com/czcorpus/mquery-sru/diagnostic/101", ans.Diagnostics.Diagnostics[0].URI)
+		assert.Equal(t, "pid:syn2015", ans.Diagnostics.Diagnostics[0].Details)
+	}
+	if published := radapter.Published(); assert.Len(t, published, 1) {
+		var args rdb.ConcExampleArgs
+		assert.NoError(t, json.Unmarshal(published[0].Args, &args))
+		assert.Equal(t, filepath.Join(handler.corporaConf.RegistryDir, "syn2020"), args.CorpusPath)
+	}
+}
+
+func TestSearchRetrieveIgnoreDiacriticsWithoutFoldedAttr(t *testing.T) {
+	radapter := rdbtest.NewAdapter(rdbtest.ConcExampleResponder(dogConcordance))
+	handler := newFakeWorkersHandler(t, radapter)
+	ans, code := searchWithArgs(handler, "query=dog&x-cnc-ignore-diacritics=true")
+	// the resource is searched as usual and the rewrite is reported
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, ans.NumberOfRecords)
+	if assert.NotNil(t, ans.Records) {
+		assert.Len(t, ans.Records.Records, 1)
+	}
+	if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+		assert.Equal(t, "http://clarin.eu/fcs/diagnostic/12", ans.Diagnostics.Diagnostics[0].URI)
+		assert.Equal(t, "pid:syn2020", ans.Diagnostics.Diagnostics[0].Details)
+	}
+}
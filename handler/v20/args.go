@@ -21,8 +21,12 @@ package v20
 
 import (
 	"fmt"
+	"net/url"
+	"sort"
 	"strings"
 
+	"github.com/czcorpus/cnc-gokit/collections"
+	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/gin-gonic/gin"
 )
 
@@ -33,7 +37,13 @@ const (
 	QueryTypeCQL            QueryType         = "cql"
 	QueryTypeFCS            QueryType         = "fcs"
 	RecordXMLEscapingXML    RecordXMLEscaping = "xml"
-	RecordXMLEscapingString RecordXMLEscaping = "string" // TODO for now unsupported
+	RecordXMLEscapingString RecordXMLEscaping = "string"
+
+	// QueryTypeRawCQL is a non-standard query type for native
+	// (backend) CQL queries passed to workers without translation.
+	// Note that `cql` cannot be used here as it denotes SRU's
+	// Contextual Query Language (i.e. the FCS basic search).
+	QueryTypeRawCQL QueryType = "x-cnc-cql"
 
 	SearchRetrArgVersion            SearchRetrArg = "version"
 	SearchRetrStartRecord           SearchRetrArg = "startRecord"
@@ -46,6 +56,41 @@ const (
 	SearchRetrArgFCSContext         SearchRetrArg = "x-fcs-context"
 	SearchRetrArgFCSDataViews       SearchRetrArg = "x-fcs-dataviews"
 	SearchRetrArgFCSRewritesAllowed SearchRetrArg = "x-fcs-rewrites-allowed"
+	SearchRetrArgStylesheet         SearchRetrArg = "stylesheet"
+	SearchRetrArgResultSetTTL       SearchRetrArg = "resultSetTTL"
+
+	// SearchRetrArgViewContextStruct is a non-standard argument
+	// allowing clients to override resource's `viewContextStruct`
+	SearchRetrArgViewContextStruct SearchRetrArg = "x-cnc-view-context-struct"
+
+	// SearchRetrArgSearchAttr is a non-standard argument allowing
+	// clients to search a specific attribute in basic queries
+	// (instead of the configured `isBasicSearchAttr` ones)
+	SearchRetrArgSearchAttr SearchRetrArg = "x-cnc-search-attr"
+
+	// SearchRetrArgResourceStats is a non-standard argument enabling
+	// per-resource statistics within `extraResponseData`
+	SearchRetrArgResourceStats SearchRetrArg = "x-cnc-resource-stats"
+
+	// SearchRetrArgIgnoreDiacritics is a non-standard argument enabling
+	// diacritics-insensitive basic search in resources with a configured
+	// `diacriticsFoldedAttr`
+	SearchRetrArgIgnoreDiacritics SearchRetrArg = "x-cnc-ignore-diacritics"
+
+	// SearchRetrArgWithin is a non-standard argument limiting basic
+	// queries to a structure specified by its FCS-QL context name
+	// (e.g. `sentence`, `p`; see resource's `structureMapping`)
+	SearchRetrArgWithin SearchRetrArg = "x-cnc-within"
+
+	// SearchRetrArgDebugQuery is a non-standard argument adding backend
+	// queries generated for individual resources to per-resource
+	// statistics (see `corpora.allowDebugQuery`)
+	SearchRetrArgDebugQuery SearchRetrArg = "x-cnc-debug-query"
+
+	// SearchRetrArgStrict is a non-standard argument making the search
+	// fail on the first resource which cannot be searched (instead
+	// of returning partial results, see `corpora.strictSearch`)
+	SearchRetrArgStrict SearchRetrArg = "x-cnc-strict"
 
 	ScanArgVersion           ScanArg = "version"
 	ScanArgOperation         ScanArg = "operation"
@@ -53,15 +98,24 @@ const (
 	ScanArgScanClause        ScanArg = "scanClause"
 	ScanArgMaximumTerms      ScanArg = "maximumTerms"
 	ScanArgResponsePosition  ScanArg = "responsePosition"
+	ScanArgStylesheet        ScanArg = "stylesheet"
 
 	ExplainArgVersion                ExplainArg = "version"
 	ExplainArgRecordXMLEscaping      ExplainArg = "recordXMLEscaping"
 	ExplainArgOperation              ExplainArg = "operation"
 	ExplainArgFCSEndpointDescription ExplainArg = "x-fcs-endpoint-description"
+	ExplainArgStylesheet             ExplainArg = "stylesheet"
 
 	DefaultQueryType QueryType = QueryTypeCQL
 )
 
+const (
+	DataViewHits     = "hits"
+	DataViewAdv      = "adv"
+	DataViewOffsets  = "offsets"
+	DataViewMetadata = "metadata"
+)
+
 type Operation string
 
 func (op Operation) String() string {
@@ -81,7 +135,7 @@ func (op Operation) Validate() error {
 type QueryType string
 
 func (qt QueryType) Validate() error {
-	if qt == QueryTypeCQL || qt == QueryTypeFCS {
+	if qt == QueryTypeCQL || qt == QueryTypeFCS || qt == QueryTypeRawCQL {
 		return nil
 	}
 	return fmt.Errorf("unknown query type: %s", qt)
@@ -95,8 +149,10 @@ func (qt QueryType) String() string {
 
 type RecordXMLEscaping string
 
-func (rp RecordXMLEscaping) Validate() error {
-	if rp == RecordXMLEscapingXML {
+// Validate tests whether the record XML escaping is among the supported ones
+// (see serverInfo.supportedRecordPackings)
+func (rp RecordXMLEscaping) Validate(supported []RecordXMLEscaping) error {
+	if collections.SliceContains(supported, rp) {
 		return nil
 	}
 	return fmt.Errorf("unsupported record XML escaping: %s", rp)
@@ -117,7 +173,16 @@ func (sra SearchRetrArg) Validate() error {
 		sra == SearchRetrArgRecordSchema ||
 		sra == SearchRetrArgFCSContext ||
 		sra == SearchRetrArgFCSDataViews ||
-		sra == SearchRetrArgFCSRewritesAllowed {
+		sra == SearchRetrArgFCSRewritesAllowed ||
+		sra == SearchRetrArgStylesheet ||
+		sra == SearchRetrArgResultSetTTL ||
+		sra == SearchRetrArgViewContextStruct ||
+		sra == SearchRetrArgSearchAttr ||
+		sra == SearchRetrArgResourceStats ||
+		sra == SearchRetrArgIgnoreDiacritics ||
+		sra == SearchRetrArgWithin ||
+		sra == SearchRetrArgDebugQuery ||
+		sra == SearchRetrArgStrict {
 		return nil
 	}
 	return fmt.Errorf("unknown searchRetrieve argument: %s", sra)
@@ -127,6 +192,19 @@ func (sra SearchRetrArg) String() string {
 	return string(sra)
 }
 
+// resultSetArgs are arguments defining a search. They are stored
+// within result set identifiers so a search can be referred
+// to via `cql.resultSetId`.
+var resultSetArgs = []SearchRetrArg{
+	SearchRetrArgQuery,
+	SearchRetrArgQueryType,
+	SearchRetrArgFCSContext,
+	SearchRetrArgSearchAttr,
+	SearchRetrArgWithin,
+	SearchRetrArgIgnoreDiacritics,
+	SearchRetrArgViewContextStruct,
+}
+
 // -----
 
 type ScanArg string
@@ -141,7 +219,8 @@ func (sa ScanArg) Validate() error {
 		sa == ScanArgRecordXMLEscaping ||
 		sa == ScanArgScanClause ||
 		sa == ScanArgMaximumTerms ||
-		sa == ScanArgResponsePosition {
+		sa == ScanArgResponsePosition ||
+		sa == ScanArgStylesheet {
 		return nil
 	}
 	return fmt.Errorf("unknown scan argument: %s", sa)
@@ -155,7 +234,8 @@ func (arg ExplainArg) Validate() error {
 	if arg == ExplainArgVersion ||
 		arg == ExplainArgRecordXMLEscaping ||
 		arg == ExplainArgOperation ||
-		arg == ExplainArgFCSEndpointDescription {
+		arg == ExplainArgFCSEndpointDescription ||
+		arg == ExplainArgStylesheet {
 		return nil
 	}
 	return fmt.Errorf("unknown explain argument: %s", arg)
@@ -167,6 +247,27 @@ func (arg ExplainArg) String() string {
 
 // ----
 
+// detectOperation determines the requested operation. The precedence is:
+//  1. an explicit `operation` argument (even if invalid - to be able
+//     to report the error)
+//  2. searchRetrieve if the `query` argument is present
+//  3. scan if the `scanClause` argument is present
+//  4. the configured default operation (`explain` unless configured otherwise)
+func detectOperation(args url.Values, dflt Operation) Operation {
+	if args.Has(SearchRetrArgOperation.String()) {
+		return Operation(args.Get(SearchRetrArgOperation.String()))
+
+	} else if args.Has(SearchRetrArgQuery.String()) {
+		return OperationSearchRetrive
+
+	} else if args.Has(ScanArgScanClause.String()) {
+		return OperationScan
+	}
+	return dflt
+}
+
+// ----
+
 func getTypedArg[T ~string](ctx *gin.Context, name string, dflt T) T {
 	v := ctx.DefaultQuery(name, string(dflt))
 	return T(v)
@@ -174,10 +275,92 @@ func getTypedArg[T ~string](ctx *gin.Context, name string, dflt T) T {
 
 // ----
 
-func fetchContext(ctx *gin.Context) []string {
-	tmp := strings.Split(ctx.DefaultQuery(SearchRetrArgFCSContext.String(), ""), ",")
-	if len(tmp) == 0 || len(tmp) == 1 && tmp[0] == "" {
-		return []string{}
+// fetchContext returns resource PIDs specified by a value of the
+// `x-fcs-context` argument. In case the value is empty, an empty slice
+// is returned which means "search all the configured resources".
+func fetchContext(value string) []string {
+	ans := make([]string, 0, 10)
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v != "" {
+			ans = append(ans, v)
+		}
+	}
+	return ans
+}
+
+// DataViews represents data views requested via
+// the `x-fcs-dataviews` argument.
+type DataViews struct {
+	Adv bool
+
+	// AdvLayers contains layers requested for the advanced
+	// data view (nil means all the available layers)
+	AdvLayers []corpus.LayerType
+
+	// Offsets specifies whether the non-standard data view
+	// with character offsets of hits is requested
+	Offsets bool
+
+	// Metadata specifies whether the non-standard data view
+	// with document metadata (see corpus.CorpusSetup.MetadataAttrs)
+	// is requested
+	Metadata bool
+}
+
+// fetchDataViews parses the `x-fcs-dataviews` argument. Besides plain
+// data view identifiers (e.g. `hits,adv`), the advanced data view can be
+// refined by a list of layers - e.g. `adv:lemma,pos` or `hits,adv:lemma,pos`.
+// As the list is also comma-separated, any item following `adv:` which is not
+// a data view identifier is considered to be a layer. Unknown data views
+// are ignored.
+func fetchDataViews(ctx *gin.Context) (DataViews, error) {
+	var ans DataViews
+	var inLayers bool
+	for _, v := range strings.Split(ctx.Query(SearchRetrArgFCSDataViews.String()), ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if layer, ok := strings.CutPrefix(v, DataViewAdv+":"); ok {
+			ans.Adv = true
+			if ans.AdvLayers == nil {
+				ans.AdvLayers = make([]corpus.LayerType, 0, 5)
+			}
+			inLayers = true
+			v = layer
+			if v == "" {
+				continue
+			}
+
+		} else if v == DataViewHits || v == DataViewAdv || v == DataViewOffsets || v == DataViewMetadata {
+			ans.Adv = ans.Adv || v == DataViewAdv
+			ans.Offsets = ans.Offsets || v == DataViewOffsets
+			ans.Metadata = ans.Metadata || v == DataViewMetadata
+			inLayers = false
+			continue
+		}
+		if inLayers {
+			layer := corpus.LayerType(v)
+			if err := layer.Validate(); err != nil {
+				return ans, err
+			}
+			if !collections.SliceContains(ans.AdvLayers, layer) {
+				ans.AdvLayers = append(ans.AdvLayers, layer)
+			}
+		}
+	}
+	return ans, nil
+}
+
+// sortedArgNames returns names of all the URL arguments in a stable
+// order so diagnostics reported for multiple arguments are
+// deterministic.
+func sortedArgNames(args url.Values) []string {
+	ans := make([]string, 0, len(args))
+	for k := range args {
+		ans = append(ans, k)
 	}
-	return tmp
+	sort.Strings(ans)
+	return ans
 }
@@ -0,0 +1,161 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package v20
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectOperation(t *testing.T) {
+	cases := []struct {
+		args     string
+		expected Operation
+	}{
+		{"", OperationExplain},
+		{"version=1.2", OperationExplain},
+		{"operation=explain", OperationExplain},
+		{"operation=explain&query=cat", OperationExplain},
+		{"operation=scan&query=cat", OperationScan},
+		{"operation=searchRetrieve&scanClause=fcs.resource", OperationSearchRetrive},
+		{"query=cat", OperationSearchRetrive},
+		{"query=cat&scanClause=fcs.resource", OperationSearchRetrive},
+		{"scanClause=fcs.resource", OperationScan},
+		{"operation=foo&query=cat", Operation("foo")},
+		{"operation=", Operation("")},
+	}
+	for _, c := range cases {
+		args, err := url.ParseQuery(c.args)
+		assert.NoError(t, err)
+		assert.Equal(t, c.expected, detectOperation(args, OperationExplain), c.args)
+	}
+	args, err := url.ParseQuery("version=1.2")
+	assert.NoError(t, err)
+	assert.Equal(t, OperationScan, detectOperation(args, OperationScan))
+}
+
+func TestFetchContext(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		args     string
+		expected []string
+	}{
+		{"query=cat", []string{}},
+		{"query=cat&x-fcs-context=", []string{}},
+		{"query=cat&x-fcs-context=,", []string{}},
+		{"query=cat&x-fcs-context=corp1", []string{"corp1"}},
+		{"query=cat&x-fcs-context=corp1,corp2", []string{"corp1", "corp2"}},
+		{"query=cat&x-fcs-context=corp1,,corp2,", []string{"corp1", "corp2"}},
+	}
+	for _, c := range cases {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest("GET", "/?"+c.args, nil)
+		assert.Equal(t, c.expected, fetchContext(ctx.Query(SearchRetrArgFCSContext.String())), c.args)
+	}
+}
+
+func TestFetchDataViews(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		args     string
+		expected DataViews
+	}{
+		{"query=cat", DataViews{}},
+		{"x-fcs-dataviews=hits", DataViews{}},
+		{"x-fcs-dataviews=hits,adv", DataViews{Adv: true}},
+		{"x-fcs-dataviews=adv:", DataViews{Adv: true, AdvLayers: []corpus.LayerType{}}},
+		{
+			"x-fcs-dataviews=adv:lemma,pos",
+			DataViews{Adv: true, AdvLayers: []corpus.LayerType{corpus.LayerTypeLemma, corpus.LayerTypePOS}},
+		},
+		{
+			"x-fcs-dataviews=adv:lemma,pos,lemma,hits,foo",
+			DataViews{Adv: true, AdvLayers: []corpus.LayerType{corpus.LayerTypeLemma, corpus.LayerTypePOS}},
+		},
+		{
+			"x-fcs-dataviews=hits,adv:text",
+			DataViews{Adv: true, AdvLayers: []corpus.LayerType{corpus.LayerTypeText}},
+		},
+		{"x-fcs-dataviews=hits,offsets", DataViews{Offsets: true}},
+		{
+			"x-fcs-dataviews=adv:lemma,offsets",
+			DataViews{Adv: true, AdvLayers: []corpus.LayerType{corpus.LayerTypeLemma}, Offsets: true},
+		},
+		{"x-fcs-dataviews=hits,metadata", DataViews{Metadata: true}},
+		{
+			"x-fcs-dataviews=adv:lemma,metadata",
+			DataViews{Adv: true, AdvLayers: []corpus.LayerType{corpus.LayerTypeLemma}, Metadata: true},
+		},
+	}
+	for _, c := range cases {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest("GET", "/?"+c.args, nil)
+		dataViews, err := fetchDataViews(ctx)
+		assert.NoError(t, err, c.args)
+		assert.Equal(t, c.expected, dataViews, c.args)
+	}
+}
+
+func TestFetchDataViewsInvalidLayer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/?x-fcs-dataviews=adv:lemma,foo", nil)
+	_, err := fetchDataViews(ctx)
+	assert.Error(t, err)
+}
+
+func TestGetRetrieveAttrs(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true},
+		{Name: "lemma", Layer: corpus.LayerTypeLemma},
+		{Name: "lc", Layer: corpus.LayerTypeText},
+		{Name: "tag", Layer: corpus.LayerTypePOS},
+	}
+	assert.Equal(
+		t,
+		[]string{"word", "lemma", "lc", "tag"},
+		getRetrieveAttrs(posAttrs, DataViews{}, nil),
+	)
+	layers := []corpus.LayerType{corpus.LayerTypePOS}
+	assert.Equal(
+		t,
+		[]string{"word", "tag"},
+		getRetrieveAttrs(posAttrs, DataViews{Adv: true, AdvLayers: layers}, layers),
+	)
+}
+
+func TestGetRetrieveAttrsDisjointResources(t *testing.T) {
+	corp1 := []corpus.PosAttr{
+		{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true},
+		{Name: "tag", Layer: corpus.LayerTypePOS},
+	}
+	corp2 := []corpus.PosAttr{
+		{Name: "form", Layer: corpus.LayerTypeText, IsBasicSearchAttr: true},
+		{Name: "pos", Layer: corpus.LayerTypePOS},
+	}
+	layers := []corpus.LayerType{corpus.LayerTypePOS}
+	dataViews := DataViews{Adv: true, AdvLayers: layers}
+	assert.Equal(t, []string{"word", "tag"}, getRetrieveAttrs(corp1, dataViews, layers))
+	assert.Equal(t, []string{"form", "pos"}, getRetrieveAttrs(corp2, dataViews, layers))
+}
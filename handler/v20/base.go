@@ -20,11 +20,16 @@
 package v20
 
 import (
+	"crypto/sha1"
 	"encoding/xml"
 	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/bytedance/sonic"
+	"github.com/czcorpus/cnc-gokit/collections"
 	"github.com/czcorpus/cnc-gokit/logging"
+	"github.com/czcorpus/mquery-sru/auth"
 	"github.com/czcorpus/mquery-sru/cnf"
 	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/czcorpus/mquery-sru/general"
@@ -36,9 +41,41 @@ import (
 )
 
 type FCSSubHandlerV20 struct {
-	serverInfo  *cnf.ServerInfo
-	corporaConf *corpus.CorporaSetup
-	radapter    *rdb.Adapter
+	serverInfo    *cnf.ServerInfo
+	corporaConf   *corpus.CorporaSetup
+	radapter      rdb.QueryPublisher
+	authenticator auth.Authenticator
+
+	// searchAnswerTimeout (if non-zero) limits waiting for worker
+	// results of searchRetrieve queries
+	searchAnswerTimeout time.Duration
+
+	// confDigest identifies the current configuration
+	// (it is used to create ETags of explain responses)
+	confDigest string
+
+	// defaultOperation is used in case a request does not
+	// specify an operation (see detectOperation)
+	defaultOperation Operation
+
+	// defaultRecordXMLEscaping is used in case a request does not specify
+	// how records should be packed
+	defaultRecordXMLEscaping RecordXMLEscaping
+
+	// supportedRecordXMLEscapings lists record XML escapings clients can request
+	supportedRecordXMLEscapings []RecordXMLEscaping
+}
+
+// isIgnoredArg tells whether an unknown request argument should
+// be ignored instead of being reported (see cnf.ServerInfo.IgnoresParam)
+func (a *FCSSubHandlerV20) isIgnoredArg(key string) bool {
+	if !a.serverInfo.IgnoresParam(key) {
+		return false
+	}
+	if a.serverInfo.LogIgnoredParams {
+		log.Info().Str("param", key).Msg("ignoring unknown request parameter")
+	}
+	return true
 }
 
 func (a *FCSSubHandlerV20) produceXMLResponse(ctx *gin.Context, code int, xslt string, data any) {
@@ -48,13 +85,26 @@ func (a *FCSSubHandlerV20) produceXMLResponse(ctx *gin.Context, code int, xslt s
 		http.Error(ctx.Writer, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	// headers and status must be set before any body is written,
+	// otherwise they are silently ignored (and 200 is sent)
+	ctx.Writer.Header().Set("Content-Type", "application/xml")
 	ctx.Writer.WriteHeader(code)
 	_, err = ctx.Writer.Write([]byte(xml.Header + general.GetXSLTHeader(xslt) + string(xmlAns)))
 	if err != nil {
 		log.Err(err).Msg("failed to write XML to response")
-		http.Error(ctx.Writer, err.Error(), http.StatusInternalServerError)
 	}
+}
+
+// produceStreamedXMLResponse writes the response directly to the client
+// without rendering it to memory first. This is intended for large
+// responses (e.g. searchRetrieve with many records). Please note that
+// once the status is written, encoding errors can be only logged.
+func (a *FCSSubHandlerV20) produceStreamedXMLResponse(ctx *gin.Context, code int, xslt string, data any) {
 	ctx.Writer.Header().Set("Content-Type", "application/xml")
+	ctx.Writer.WriteHeader(code)
+	if err := general.StreamXML(ctx.Writer, xslt, data); err != nil {
+		log.Err(err).Msg("failed to stream XML response")
+	}
 }
 
 func (a *FCSSubHandlerV20) produceExplainErrorResponse(ctx *gin.Context, code int, xslt string, fcsErrors []general.FCSError) {
@@ -78,6 +128,17 @@ func (a *FCSSubHandlerV20) produceSRErrorResponse(ctx *gin.Context, code int, xs
 	a.produceXMLResponse(ctx, code, xslt, ans)
 }
 
+// HandleError writes an error response without processing
+// the request any further. The response type (searchRetrieve
+// or explain) is derived from the requested operation.
+func (a *FCSSubHandlerV20) HandleError(ctx *gin.Context, code int, fcsErrors []general.FCSError) {
+	if detectOperation(ctx.Request.URL.Query(), a.defaultOperation) == OperationSearchRetrive {
+		a.produceSRErrorResponse(ctx, code, "", fcsErrors)
+		return
+	}
+	a.produceExplainErrorResponse(ctx, code, "", fcsErrors)
+}
+
 func (a *FCSSubHandlerV20) Handle(
 	ctx *gin.Context,
 	fcsGeneralRequest general.FCSGeneralRequest,
@@ -85,8 +146,8 @@ func (a *FCSSubHandlerV20) Handle(
 ) {
 	fcsRequest := &FCSRequest{
 		General:           &fcsGeneralRequest,
-		RecordXMLEscaping: RecordXMLEscapingXML,
-		Operation:         OperationExplain,
+		RecordXMLEscaping: a.defaultRecordXMLEscaping,
+		Operation:         a.defaultOperation,
 	}
 
 	if fcsRequest.General.HasFatalError() {
@@ -94,16 +155,7 @@ func (a *FCSSubHandlerV20) Handle(
 		return
 	}
 
-	var operation Operation = OperationExplain
-	if ctx.Request.URL.Query().Has("operation") {
-		operation = getTypedArg(ctx, "operation", fcsRequest.Operation)
-
-	} else if ctx.Request.URL.Query().Has(SearchRetrArgQuery.String()) {
-		operation = OperationSearchRetrive
-
-	} else if ctx.Request.URL.Query().Has(ScanArgScanClause.String()) {
-		operation = OperationScan
-	}
+	operation := detectOperation(ctx.Request.URL.Query(), a.defaultOperation)
 
 	if err := operation.Validate(); err != nil {
 		fcsRequest.General.AddError(general.FCSError{
@@ -120,7 +172,7 @@ func (a *FCSSubHandlerV20) Handle(
 	logging.AddLogEvent(ctx, "operation", operation)
 
 	recordXMLEscaping := getTypedArg(ctx, "recordXMLEscaping", fcsRequest.RecordXMLEscaping)
-	if err := recordXMLEscaping.Validate(); err != nil {
+	if err := recordXMLEscaping.Validate(a.supportedRecordXMLEscapings); err != nil {
 		fcsRequest.General.AddError(general.FCSError{
 			Code:    general.DCUnsupportedRecordPacking,
 			Ident:   "recordXMLEscaping",
@@ -139,14 +191,50 @@ func (a *FCSSubHandlerV20) Handle(
 	fcsRequest.RecordXMLEscaping = recordXMLEscaping
 	logging.AddLogEvent(ctx, "recordXMLEscaping", recordXMLEscaping)
 
+	// note: the stylesheet is applicable only to XML-packed records
+	if recordXMLEscaping == RecordXMLEscapingXML && ctx.Request.URL.Query().Has("stylesheet") {
+		stylesheet, err := general.ValidateStylesheetURL(ctx.Query("stylesheet"))
+		if err != nil {
+			fcsRequest.General.AddError(general.FCSError{
+				Code:    general.DCUnsupportedParameterValue,
+				Ident:   "stylesheet",
+				Message: err.Error(),
+			})
+			if operation == OperationSearchRetrive {
+				a.produceSRErrorResponse(
+					ctx, general.ConformantStatusBadRequest, fcsGeneralRequest.XSLT, fcsGeneralRequest.Errors)
+
+			} else {
+				a.produceExplainErrorResponse(
+					ctx, general.ConformantStatusBadRequest, fcsGeneralRequest.XSLT, fcsGeneralRequest.Errors)
+			}
+			return
+		}
+		fcsRequest.General.XSLT = stylesheet
+		logging.AddLogEvent(ctx, "stylesheet", stylesheet)
+	}
+
 	var response any
 	var code int
 
 	switch fcsRequest.Operation {
 	case OperationExplain:
+		// explain depends only on the configuration and request
+		// arguments so clients can avoid downloading it repeatedly
+		etag := general.ETag(a.confDigest, ctx.Request.URL.RawQuery, fcsRequest.General.XSLT)
+		ctx.Header("ETag", etag)
+		if general.ETagMatches(ctx.GetHeader("If-None-Match"), etag) {
+			ctx.Status(http.StatusNotModified)
+			return
+		}
 		response, code = a.explain(ctx, fcsRequest)
 	case OperationSearchRetrive:
-		response, code = a.searchRetrieve(ctx, fcsRequest)
+		ans, srCode := a.searchRetrieve(ctx, fcsRequest)
+		if ans.Records.IsStreamed() {
+			a.produceStreamedXMLResponse(ctx, srCode, fcsGeneralRequest.XSLT, ans)
+			return
+		}
+		response, code = ans, srCode
 	case OperationScan:
 		response, code = a.scan(ctx, fcsRequest)
 	}
@@ -156,11 +244,40 @@ func (a *FCSSubHandlerV20) Handle(
 func NewFCSSubHandlerV20(
 	generalConf *cnf.ServerInfo,
 	corporaConf *corpus.CorporaSetup,
-	radapter *rdb.Adapter,
+	radapter rdb.QueryPublisher,
+	authenticator auth.Authenticator,
+	searchAnswerTimeout time.Duration,
 ) *FCSSubHandlerV20 {
+	confData, err := sonic.Marshal([]any{generalConf, corporaConf})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to serialize configuration for ETags")
+	}
+	// the defaults are normally set by the configuration validation
+	dfltOperation, dfltPacking := OperationExplain, RecordXMLEscapingXML
+	if generalConf.DefaultOperation != "" {
+		dfltOperation = Operation(generalConf.DefaultOperation)
+	}
+	if generalConf.DefaultRecordPacking != "" {
+		dfltPacking = RecordXMLEscaping(generalConf.DefaultRecordPacking)
+	}
+	supportedPackings := []RecordXMLEscaping{RecordXMLEscapingXML, RecordXMLEscapingString}
+	if len(generalConf.SupportedRecordPackings) > 0 {
+		supportedPackings = collections.SliceMap(
+			generalConf.SupportedRecordPackings,
+			func(v string, i int) RecordXMLEscaping {
+				return RecordXMLEscaping(v)
+			},
+		)
+	}
 	return &FCSSubHandlerV20{
-		serverInfo:  generalConf,
-		corporaConf: corporaConf,
-		radapter:    radapter,
+		serverInfo:                  generalConf,
+		corporaConf:                 corporaConf,
+		radapter:                    radapter,
+		authenticator:               authenticator,
+		searchAnswerTimeout:         searchAnswerTimeout,
+		confDigest:                  fmt.Sprintf("%x", sha1.Sum(confData)),
+		defaultOperation:            dfltOperation,
+		defaultRecordXMLEscaping:    dfltPacking,
+		supportedRecordXMLEscapings: supportedPackings,
 	}
 }
@@ -0,0 +1,221 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package v20
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/cnf"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorResponsesWriteStatusCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := &FCSSubHandlerV20{}
+	fcsErrors := []general.FCSError{
+		{
+			Code:    general.DCUnsupportedVersion,
+			Ident:   "3.0",
+			Message: "Unsupported version 3.0",
+		},
+	}
+	producers := map[string]func(*gin.Context, int, string, []general.FCSError){
+		"explain":        handler.produceExplainErrorResponse,
+		"searchRetrieve": handler.produceSRErrorResponse,
+	}
+	for name, produce := range producers {
+		for _, code := range []int{http.StatusOK, http.StatusBadRequest, http.StatusInternalServerError} {
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			produce(ctx, code, "", fcsErrors)
+			assert.Equal(t, code, w.Code, name)
+			assert.Equal(t, "application/xml", w.Header().Get("Content-Type"), name)
+			assert.Contains(t, w.Body.String(), "Unsupported version 3.0", name)
+		}
+	}
+}
+
+func TestExplainConditionalGet(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := NewFCSSubHandlerV20(
+		&cnf.ServerInfo{DatabaseTitle: map[string]string{"en": "Test"}},
+		&corpus.CorporaSetup{},
+		nil,
+		nil,
+		0,
+	)
+	handle := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest("GET", "/?operation=explain", nil)
+		if ifNoneMatch != "" {
+			ctx.Request.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		handler.Handle(ctx, general.FCSGeneralRequest{Version: "2.0"}, map[string]string{})
+		ctx.Writer.WriteHeaderNow()
+		return w
+	}
+	w := handle("")
+	assert.Equal(t, http.StatusOK, w.Code)
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	w = handle(etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+
+	w = handle(`"foo"`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+}
+
+func TestSupportedRecordXMLEscapings(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handle := func(handler *FCSSubHandlerV20, args string) string {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest("GET", "/?"+args, nil)
+		handler.Handle(ctx, general.FCSGeneralRequest{Version: "2.0"}, map[string]string{})
+		return w.Body.String()
+	}
+	handler := NewFCSSubHandlerV20(
+		&cnf.ServerInfo{
+			DatabaseTitle:           map[string]string{"en": "Test"},
+			DefaultRecordPacking:    "xml",
+			SupportedRecordPackings: []string{"xml"},
+		},
+		&corpus.CorporaSetup{},
+		nil,
+		nil,
+		0,
+	)
+	body := handle(handler, "operation=explain")
+	assert.Contains(t, body, `<zr:default type="recordXMLEscaping">xml</zr:default>`)
+	assert.Contains(t, body, `<zr:supports type="recordXMLEscaping">xml</zr:supports>`)
+	assert.NotContains(t, body, `<zr:supports type="recordXMLEscaping">string</zr:supports>`)
+	body = handle(handler, "operation=explain&recordXMLEscaping=string")
+	assert.Contains(t, body, "info:srw/diagnostic/1/71")
+
+	handler = NewFCSSubHandlerV20(
+		&cnf.ServerInfo{DatabaseTitle: map[string]string{"en": "Test"}},
+		&corpus.CorporaSetup{},
+		nil,
+		nil,
+		0,
+	)
+	body = handle(handler, "operation=explain&recordXMLEscaping=string")
+	assert.Contains(t, body, `&lt;zr:supports type=&#34;recordXMLEscaping&#34;&gt;string`)
+	assert.Contains(t, body, "<sruResponse:recordXMLEscaping>string</sruResponse:recordXMLEscaping>")
+	assert.Contains(t, body, "&lt;zr:explain")
+	assert.NotContains(t, body, "<zr:explain")
+}
+
+func TestDisabledResourceIsInvisible(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	regDir := t.TempDir()
+	disabled := false
+	conf := &corpus.CorporaSetup{RegistryDir: regDir}
+	for _, id := range []string{"syn2020", "oral"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(regDir, id), []byte("ATTRIBUTE word\nSTRUCTURE s\n"), 0644))
+		conf.Resources = append(conf.Resources, &corpus.CorpusSetup{
+			ID:          id,
+			PID:         "http://hdl.handle.net/11234/" + id,
+			FullName:    map[string]string{"en": id},
+			Description: map[string]string{"en": id},
+			Languages:   []string{"cs"},
+			PosAttrs: []corpus.PosAttr{
+				{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true, IsBasicSearchAttr: true},
+			},
+		})
+	}
+	conf.Resources[1].Enabled = &disabled
+	assert.NoError(t, conf.ValidateAndDefaults("corpora"))
+	handler := &FCSSubHandlerV20{
+		serverInfo:  &cnf.ServerInfo{DatabaseTitle: map[string]string{"en": "Test"}},
+		corporaConf: conf,
+	}
+
+	assert.Equal(t, []string{"syn2020"}, conf.Resources.GetCorpora())
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/?operation=explain&x-fcs-endpoint-description=true", nil)
+	explain, code := handler.explain(ctx, &FCSRequest{})
+	assert.Equal(t, http.StatusOK, code)
+	if assert.NotNil(t, explain.EndpointDescription) &&
+		assert.Len(t, explain.EndpointDescription.Resources, 1) {
+		assert.Equal(t, "http://hdl.handle.net/11234/syn2020", explain.EndpointDescription.Resources[0].PID)
+	}
+
+	ctx, _ = gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(
+		"GET", "/?operation=searchRetrieve&query=dog&x-fcs-context=http://hdl.handle.net/11234/oral", nil)
+	ans, code := handler.searchRetrieve(ctx, &FCSRequest{})
+	assert.Equal(t, general.ConformantUnprocessableEntity, code)
+	if assert.NotNil(t, ans.Diagnostics) && assert.Len(t, ans.Diagnostics.Diagnostics, 1) {
+		assert.Equal(t, "info:srw/diagnostic/1/15", ans.Diagnostics.Diagnostics[0].URI)
+		assert.Equal(t, "http://hdl.handle.net/11234/oral", ans.Diagnostics.Diagnostics[0].Details)
+	}
+}
+
+func TestStylesheetProcessingInstruction(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := NewFCSSubHandlerV20(
+		&cnf.ServerInfo{DatabaseTitle: map[string]string{"en": "Test"}},
+		&corpus.CorporaSetup{},
+		nil,
+		nil,
+		0,
+	)
+	handle := func(args string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		ctx, _ := gin.CreateTestContext(w)
+		ctx.Request = httptest.NewRequest("GET", "/?"+args, nil)
+		handler.Handle(ctx, general.FCSGeneralRequest{Version: "2.0"}, map[string]string{})
+		return w
+	}
+	pi := `<?xml-stylesheet type="text/xsl" href="https://example.org/style.xsl"?>`
+
+	w := handle("operation=explain&stylesheet=https://example.org/style.xsl")
+	assert.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	if assert.Contains(t, body, pi) {
+		// the instruction must precede the root element
+		assert.Less(t, strings.Index(body, pi), strings.Index(body, "explainResponse"))
+		assert.Less(t, strings.Index(body, "<?xml "), strings.Index(body, pi))
+	}
+
+	w = handle("operation=explain&stylesheet=javascript:alert(1)")
+	assert.Equal(t, general.ConformantStatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "info:srw/diagnostic/1/6")
+	assert.NotContains(t, w.Body.String(), "<?xml-stylesheet")
+
+	// the stylesheet is ignored for string-packed records
+	w = handle("operation=explain&recordXMLEscaping=string&stylesheet=javascript:alert(1)")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "<?xml-stylesheet")
+	assert.NotContains(t, w.Body.String(), "info:srw/diagnostic/1/6")
+}
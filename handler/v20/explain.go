@@ -22,8 +22,10 @@ package v20
 import (
 	"encoding/xml"
 	"net/http"
+	"strings"
 
 	"github.com/czcorpus/cnc-gokit/collections"
+	"github.com/czcorpus/mquery-sru/cnf"
 	"github.com/czcorpus/mquery-sru/corpus"
 	"github.com/czcorpus/mquery-sru/general"
 	"github.com/czcorpus/mquery-sru/handler/v20/schema"
@@ -49,24 +51,27 @@ func (a *FCSSubHandlerV20) explain(ctx *gin.Context, fcsResponse *FCSRequest) (s
 					Database:  a.serverInfo.Database,
 				},
 				DatabaseInfo: schema.XMLExplainDatabaseInfo{
-					Titles: general.MapItems(
-						a.serverInfo.DatabaseTitle,
+					Titles: general.MapLocalizedItems(
+						a.serverInfo.DatabaseTitle, a.serverInfo.DefaultLanguage,
 						func(k string, v string) schema.XMLMultilingual {
 							return schema.XMLMultilingual{Language: k, Primary: a.serverInfo.PrimaryLanguage == k, Value: v}
 						},
 					),
-					Descriptions: general.MapItems(
-						a.serverInfo.DatabaseDescription,
+					Descriptions: general.MapLocalizedItems(
+						a.serverInfo.DatabaseDescription, a.serverInfo.DefaultLanguage,
 						func(k string, v string) schema.XMLMultilingual {
 							return schema.XMLMultilingual{Language: k, Primary: a.serverInfo.PrimaryLanguage == k, Value: v}
 						},
 					),
-					Authors: general.MapItems(
-						a.serverInfo.DatabaseAuthor,
+					Authors: general.MapLocalizedItems(
+						a.serverInfo.DatabaseAuthor, a.serverInfo.DefaultLanguage,
 						func(k string, v string) schema.XMLMultilingual {
 							return schema.XMLMultilingual{Language: k, Primary: a.serverInfo.PrimaryLanguage == k, Value: v}
 						},
 					),
+					LangUsage: &schema.XMLExplainLangUsage{
+						Codes: strings.Join(a.corporaConf.Resources.GetLanguages(), " "),
+					},
 				},
 				IndexInfo: schema.XMLExplainIndexInfo{
 					Set: schema.XMLExplainDefinition{
@@ -88,11 +93,20 @@ func (a *FCSSubHandlerV20) explain(ctx *gin.Context, fcsResponse *FCSRequest) (s
 					},
 				},
 				SchemaInfo: schema.XMLExplainSchemaInfo{
-					Schema: schema.XMLExplainDefinition{
-						Identifier: "http://clarin.eu/fcs/resource",
-						Name:       "fcs",
-						Titles: []schema.XMLMultilingual{
-							{Language: "en", Value: "CLARIN Federated Content Search", Primary: true},
+					Schemas: []schema.XMLExplainDefinition{
+						{
+							Identifier: general.RecordSchema,
+							Name:       "fcs",
+							Titles: []schema.XMLMultilingual{
+								{Language: "en", Value: "CLARIN Federated Content Search", Primary: true},
+							},
+						},
+						{
+							Identifier: general.RecordSchemaDC,
+							Name:       "dc",
+							Titles: []schema.XMLMultilingual{
+								{Language: "en", Value: "Dublin Core", Primary: true},
+							},
 						},
 					},
 				},
@@ -100,12 +114,17 @@ func (a *FCSSubHandlerV20) explain(ctx *gin.Context, fcsResponse *FCSRequest) (s
 					schema.XMLExplainConfig{
 						XMLName: xml.Name{Local: "zr:default"},
 						Type:    "numberOfRecords",
-						Value:   corpus.ExplainOpNumberOfRecords,
+						Value:   a.corporaConf.GetDefaultRecords(a.corporaConf.Resources.GetCorpora()...),
 					},
 					schema.XMLExplainConfig{
 						XMLName: xml.Name{Local: "zr:setting"},
 						Type:    "maximumRecords",
-						Value:   a.corporaConf.MaximumRecords,
+						Value:   a.corporaConf.GetMaximumRecords(a.corporaConf.Resources.GetCorpora()...),
+					},
+					schema.XMLExplainConfig{
+						XMLName: xml.Name{Local: "zr:setting"},
+						Type:    "maximumTerms",
+						Value:   a.corporaConf.MaximumTerms,
 					},
 				}},
 			},
@@ -115,14 +134,32 @@ func (a *FCSSubHandlerV20) explain(ctx *gin.Context, fcsResponse *FCSRequest) (s
 		},
 	}
 
+	configInfo := &ans.ExplainRecord.Data.ConfigInfo
+	if a.serverInfo.DefaultVersion != "" {
+		configInfo.AddDefault("version", a.serverInfo.DefaultVersion)
+	}
+	for _, version := range cnf.SupportedVersions {
+		configInfo.AddSupports("version", version)
+	}
+	if a.defaultRecordXMLEscaping != "" {
+		configInfo.AddDefault("recordXMLEscaping", string(a.defaultRecordXMLEscaping))
+	}
+	for _, packing := range a.supportedRecordXMLEscapings {
+		configInfo.AddSupports("recordXMLEscaping", string(packing))
+	}
+
 	// check if all parameters are supported
-	for key, _ := range ctx.Request.URL.Query() {
-		if err := ExplainArg(key).Validate(); err != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
+	for _, key := range sortedArgNames(ctx.Request.URL.Query()) {
+		if err := ExplainArg(key).Validate(); err != nil && !a.isIgnoredArg(key) {
+			if ans.Diagnostics == nil {
+				ans.Diagnostics = schema.NewXMLDiagnostics()
+			}
 			ans.Diagnostics.AddDiagnostic(general.DCUnsupportedParameter, 0, key, err.Error())
-			return ans, general.ConformantStatusBadRequest
 		}
 	}
+	if ans.Diagnostics != nil {
+		return ans, general.ConformantStatusBadRequest
+	}
 
 	// extra data
 	if ctx.Query(ExplainArgFCSEndpointDescription.String()) == "true" {
@@ -137,9 +174,11 @@ func (a *FCSSubHandlerV20) explain(ctx *gin.Context, fcsResponse *FCSRequest) (s
 			SupportedDataViews: []schema.XMLExplainSupportedDataView{
 				{ID: "hits", DeliveryPolicy: "send-by-default", Value: "application/x-clarin-fcs-hits+xml"},
 				{ID: "adv", DeliveryPolicy: "send-by-default", Value: "application/x-clarin-fcs-adv+xml"},
+				{ID: "offsets", DeliveryPolicy: "need-to-request", Value: "application/x-mquery-offsets+xml"},
+				{ID: "metadata", DeliveryPolicy: "need-to-request", Value: "application/x-mquery-metadata+xml"},
 			},
 			SupportedLayers: collections.SliceMap(
-				a.corporaConf.Resources.GetCommonPosAttrs2(),
+				a.corporaConf.Resources.GetAllPosAttrs(),
 				func(posAttr corpus.PosAttr, i int) schema.XMLExplainSupportedLayer {
 					return schema.XMLExplainSupportedLayer{
 						ID:        posAttr.ID,
@@ -155,19 +194,20 @@ func (a *FCSSubHandlerV20) explain(ctx *gin.Context, fcsResponse *FCSRequest) (s
 					return schema.XMLExplainResource{
 						PID:                corpusConf.PID,
 						LandingPage:        corpusConf.URI,
-						Languages:          corpusConf.Languages,
+						Languages:          corpusConf.NormalizedLanguages(),
 						AvailableLayers:    schema.XMLExplainAvailableValues{Values: corpusConf.GetDefinedLayersAsRefString()},
-						AvailableDataViews: schema.XMLExplainAvailableValues{Values: "hits adv"},
-						Titles: general.MapItems(
-							corpusConf.FullName, func(lang, title string) schema.XMLMultilingual2 {
+						AvailableDataViews: schema.XMLExplainAvailableValues{Values: availableDataViews(corpusConf)},
+						Titles: general.MapLocalizedItems(
+							corpusConf.FullName, a.serverInfo.DefaultLanguage, func(lang, title string) schema.XMLMultilingual2 {
 								return schema.XMLMultilingual2{Language: lang, Value: title}
 							},
 						),
-						Descriptions: general.MapItems(
-							corpusConf.Description, func(lang, title string) schema.XMLMultilingual2 {
+						Descriptions: general.MapLocalizedItems(
+							corpusConf.Description, a.serverInfo.DefaultLanguage, func(lang, title string) schema.XMLMultilingual2 {
 								return schema.XMLMultilingual2{Language: lang, Value: title}
 							},
 						),
+						AvailabilityRestriction: string(corpusConf.AvailabilityRestriction),
 					}
 				},
 			),
@@ -175,3 +215,12 @@ func (a *FCSSubHandlerV20) explain(ctx *gin.Context, fcsResponse *FCSRequest) (s
 	}
 	return ans, http.StatusOK
 }
+
+// availableDataViews returns a space-separated list of data views
+// which can be provided for the resource
+func availableDataViews(corpusConf *corpus.CorpusSetup) string {
+	if len(corpusConf.MetadataAttrs) > 0 {
+		return "hits adv offsets metadata"
+	}
+	return "hits adv offsets"
+}
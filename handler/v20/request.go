@@ -26,4 +26,12 @@ type FCSRequest struct {
 	General           *general.FCSGeneralRequest
 	RecordXMLEscaping RecordXMLEscaping
 	Operation         Operation
+
+	// MaximumTerms is the effective number of requested
+	// terms (used only by scan)
+	MaximumTerms int
+
+	// ResponsePosition is the requested position of the scanClause
+	// term within the returned terms (used only by scan)
+	ResponsePosition int
 }
@@ -19,6 +19,7 @@
 package v20
 
 import (
+	"fmt"
 	"strconv"
 
 	"github.com/czcorpus/mquery-sru/general"
@@ -26,34 +27,64 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func (a *FCSSubHandlerV20) scan(ctx *gin.Context, _ *FCSRequest) (schema.XMLScanResponse, int) {
+func (a *FCSSubHandlerV20) scan(ctx *gin.Context, fcsResponse *FCSRequest) (schema.XMLScanResponse, int) {
 	ans := schema.NewXMLScanResponse()
-	for key, _ := range ctx.Request.URL.Query() {
-		if err := ScanArg(key).Validate(); err != nil {
-			ans.Diagnostics = schema.NewXMLDiagnostics()
-			ans.Diagnostics.AddDiagnostic(
-				general.DCUnsupportedParameter, 0, key, err.Error())
-			return ans, general.ConformantStatusBadRequest
+	for _, key := range sortedArgNames(ctx.Request.URL.Query()) {
+		if err := ScanArg(key).Validate(); err != nil && !a.isIgnoredArg(key) {
+			if ans.Diagnostics == nil {
+				ans.Diagnostics = schema.NewXMLDiagnostics()
+			}
+			ans.Diagnostics.AddDiagnostic(general.DCUnsupportedParameter, 0, key, err.Error())
 		}
 	}
+	if ans.Diagnostics != nil {
+		return ans, general.ConformantStatusBadRequest
+	}
 
-	xMaxTerms := ctx.DefaultQuery(ScanArgMaximumTerms.String(), "1000")
-	_, err := strconv.Atoi(xMaxTerms)
-	if err != nil {
+	maximumTerms := a.corporaConf.MaximumTerms
+	if xMaxTerms := ctx.Query(ScanArgMaximumTerms.String()); len(xMaxTerms) > 0 {
+		var err error
+		maximumTerms, err = strconv.Atoi(xMaxTerms)
+		if err != nil || maximumTerms < 1 {
+			ans.Diagnostics = schema.NewXMLDiagnostics()
+			ans.Diagnostics.AddDfltMsgDiagnostic(
+				general.DCUnsupportedParameterValue, 0, ScanArgMaximumTerms.String())
+			return ans, general.ConformantUnprocessableEntity
+		}
+	}
+	if maximumTerms > a.corporaConf.MaximumTerms {
 		ans.Diagnostics = schema.NewXMLDiagnostics()
-		ans.Diagnostics.AddDfltMsgDiagnostic(
-			general.DCUnsupportedParameterValue, 0, ScanArgMaximumTerms.String())
-		return ans, general.ConformantUnprocessableEntity
+		ans.Diagnostics.AddDiagnostic(
+			general.DCUnsupportedParameterValue,
+			0,
+			ScanArgMaximumTerms.String(),
+			fmt.Sprintf("maximumTerms too high, using %d", a.corporaConf.MaximumTerms),
+		)
+		maximumTerms = a.corporaConf.MaximumTerms
 	}
+	fcsResponse.MaximumTerms = maximumTerms
 
 	xResponsePos := ctx.DefaultQuery(ScanArgResponsePosition.String(), "1")
-	_, err = strconv.Atoi(xResponsePos)
+	responsePosition, err := strconv.Atoi(xResponsePos)
 	if err != nil {
 		ans.Diagnostics = schema.NewXMLDiagnostics()
 		ans.Diagnostics.AddDfltMsgDiagnostic(
 			general.DCUnsupportedParameterValue, 0, ScanArgResponsePosition.String())
 		return ans, general.ConformantUnprocessableEntity
 	}
+	// Position 0 means the scanClause term should be just before the first
+	// returned term, maximumTerms + 1 means just after the last one.
+	if responsePosition < 0 || responsePosition > maximumTerms+1 {
+		ans.Diagnostics = schema.NewXMLDiagnostics()
+		ans.Diagnostics.AddDiagnostic(
+			general.DCResponsePositionOutOfRange,
+			0,
+			ScanArgResponsePosition.String(),
+			fmt.Sprintf("responsePosition must be between 0 and %d (maximumTerms + 1)", maximumTerms+1),
+		)
+		return ans, general.ConformantUnprocessableEntity
+	}
+	fcsResponse.ResponsePosition = responsePosition
 
 	scanClause := ctx.Query(ScanArgScanClause.String())
 	if scanClause == "" {
@@ -63,7 +94,9 @@ func (a *FCSSubHandlerV20) scan(ctx *gin.Context, _ *FCSRequest) (schema.XMLScan
 		return ans, general.ConformantUnprocessableEntity
 	}
 
-	ans.Diagnostics = schema.NewXMLDiagnostics()
+	if ans.Diagnostics == nil {
+		ans.Diagnostics = schema.NewXMLDiagnostics()
+	}
 	ans.Diagnostics.AddDfltMsgDiagnostic(
 		general.DCUnsupportedIndex, 0, ScanArgScanClause.String())
 	return ans, general.ConformantUnprocessableEntity
@@ -27,8 +27,8 @@ type XMLExplainResponse struct {
 
 	ExplainRecord       *XMLExplainRecord              `xml:"sruResponse:record,omitempty"`
 	EchoedRequest       *XMLExplainEchoedRequest       `xml:"sruResponse:echoedExplainRequest,omitempty"`
-	EndpointDescription *XMLExplainEndpointDescription `xml:"sruResponse:extraResponseData>ed:EndpointDescription,omitempty"`
 	Diagnostics         *XMLDiagnostics                `xml:"sruResponse:diagnostics,omitempty"`
+	EndpointDescription *XMLExplainEndpointDescription `xml:"sruResponse:extraResponseData>ed:EndpointDescription,omitempty"`
 }
 
 // --------------------- Explain Record ---------------------
@@ -39,6 +39,27 @@ type XMLExplainRecord struct {
 	Data        XMLExplainData `xml:"sruResponse:recordData>zr:explain"`
 }
 
+// MarshalXML encodes the record. In case of the RecordPackingString record XML escaping,
+// record data are serialized and sent as an escaped string.
+func (r XMLExplainRecord) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type xmlRecord XMLExplainRecord // prevents recursion
+	if r.XMLEscaping != RecordPackingString {
+		return e.EncodeElement(xmlRecord(r), start)
+	}
+	data, err := packAsString("zr:explain", r.Data)
+	if err != nil {
+		return err
+	}
+	return e.EncodeElement(
+		struct {
+			Schema      string `xml:"sruResponse:recordSchema"`
+			XMLEscaping string `xml:"sruResponse:recordXMLEscaping"`
+			Data        string `xml:"sruResponse:recordData"`
+		}{r.Schema, r.XMLEscaping, data},
+		start,
+	)
+}
+
 type XMLExplainData struct {
 	XMLNSZR string `xml:"xmlns:zr,attr"`
 
@@ -60,9 +81,16 @@ type XMLExplainServerInfo struct {
 }
 
 type XMLExplainDatabaseInfo struct {
-	Titles       []XMLMultilingual `xml:"zr:title"`
-	Descriptions []XMLMultilingual `xml:"zr:description"`
-	Authors      []XMLMultilingual `xml:"zr:author"`
+	Titles       []XMLMultilingual    `xml:"zr:title"`
+	Descriptions []XMLMultilingual    `xml:"zr:description"`
+	Authors      []XMLMultilingual    `xml:"zr:author"`
+	LangUsage    *XMLExplainLangUsage `xml:"zr:langUsage,omitempty"`
+}
+
+// XMLExplainLangUsage lists (space separated) languages
+// of all the resources.
+type XMLExplainLangUsage struct {
+	Codes string `xml:"codes,attr"`
 }
 
 type XMLExplainIndexInfo struct {
@@ -97,7 +125,7 @@ type XMLExplainIndexInfoIndexMapName struct {
 }
 
 type XMLExplainSchemaInfo struct {
-	Schema XMLExplainDefinition `xml:"zr:schema"`
+	Schemas []XMLExplainDefinition `xml:"zr:schema"`
 }
 
 type XMLExplainConfigInfo struct {
@@ -120,6 +148,14 @@ func (c *XMLExplainConfigInfo) AddSetting(typ string, value any) {
 	})
 }
 
+func (c *XMLExplainConfigInfo) AddSupports(typ string, value any) {
+	c.Values = append(c.Values, XMLExplainConfig{
+		XMLName: xml.Name{Local: "zr:supports"},
+		Type:    typ,
+		Value:   value,
+	})
+}
+
 type XMLExplainConfig struct {
 	XMLName xml.Name
 	Type    string `xml:"type,attr"`
@@ -165,6 +201,9 @@ type XMLExplainResource struct {
 	Languages          []string                  `xml:"ed:Languages>ed:Language"`
 	AvailableDataViews XMLExplainAvailableValues `xml:"ed:AvailableDataViews"`
 	AvailableLayers    XMLExplainAvailableValues `xml:"ed:AvailableLayers"`
+
+	// AvailabilityRestriction is empty for publicly available resources
+	AvailabilityRestriction string `xml:"ed:AvailabilityRestriction,omitempty"`
 }
 
 type XMLExplainAvailableValues struct {
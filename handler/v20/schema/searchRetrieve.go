@@ -25,16 +25,72 @@ type XMLSRResponse struct {
 	XMLNSSRUResponse string   `xml:"xmlns:sruResponse,attr"`
 	Version          string   `xml:"sruResponse:version"`
 
-	NumberOfRecords int `xml:"sruResponse:numberOfRecords"`
+	NumberOfRecords int    `xml:"sruResponse:numberOfRecords"`
+	ResultSetID     string `xml:"sruResponse:resultSetId,omitempty"`
+	ResultSetTTL    int    `xml:"sruResponse:resultSetTTL,omitempty"`
 
 	// Records
-	// note: we need a pointer here to allow the marshaler skip the 'records' parent
-	// in case there are no 'record' children
-	Records              *[]XMLSRRecord      `xml:"sruResponse:records>sruResponse:record,omitempty"`
-	NextRecordPosition   int                 `xml:"sruResponse:nextRecordPosition,omitempty"`
-	EchoedRequest        *XMLSREchoedRequest `xml:"sruResponse:echoedSearchRetrieveRequest,omitempty"`
-	Diagnostics          *XMLDiagnostics     `xml:"sruResponse:diagnostics,omitempty"`
-	ResultCountPrecision string              `xml:"sruResponse:resultCountPrecision"`
+	// note: the schema requires at least one 'record' in 'records' so the
+	// container must be nil (i.e. omitted) in case there are no records
+	Records            *XMLSRRecords       `xml:"sruResponse:records,omitempty"`
+	NextRecordPosition int                 `xml:"sruResponse:nextRecordPosition,omitempty"`
+	EchoedRequest      *XMLSREchoedRequest `xml:"sruResponse:echoedSearchRetrieveRequest,omitempty"`
+	Diagnostics        *XMLDiagnostics     `xml:"sruResponse:diagnostics,omitempty"`
+
+	// ExtraResponseData contains non-standard information
+	// about results of individual resources
+	ExtraResponseData *XMLSRExtraResponseData `xml:"sruResponse:extraResponseData,omitempty"`
+
+	ResultCountPrecision string `xml:"sruResponse:resultCountPrecision"`
+}
+
+// XMLSRRecords is a container of returned records
+type XMLSRRecords struct {
+	Records []XMLSRRecord `xml:"sruResponse:record"`
+
+	// next (if set) provides records while the container is being
+	// encoded (see NewStreamedXMLSRRecords)
+	next func() (*XMLSRRecord, error)
+}
+
+// IsStreamed tells whether the records are created only
+// once the container is encoded
+func (r *XMLSRRecords) IsStreamed() bool {
+	return r != nil && r.next != nil
+}
+
+// MarshalXML encodes the records. In case of streamed records,
+// each record is encoded right after it is obtained.
+func (r XMLSRRecords) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type xmlRecords XMLSRRecords // prevents recursion
+	if r.next == nil {
+		return e.EncodeElement(xmlRecords(r), start)
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	recStart := xml.StartElement{Name: xml.Name{Local: "sruResponse:record"}}
+	for {
+		record, err := r.next()
+		if err != nil {
+			return err
+		}
+		if record == nil {
+			break
+		}
+		if err := e.EncodeElement(record, recStart); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// NewStreamedXMLSRRecords creates a container whose records are obtained
+// from `next` only when the container is encoded so the records do not have
+// to be kept in memory all at once. The `next` function is expected
+// to return nil once there are no more records.
+func NewStreamedXMLSRRecords(next func() (*XMLSRRecord, error)) *XMLSRRecords {
+	return &XMLSRRecords{next: next}
 }
 
 func NewXMLSRResponse() XMLSRResponse {
@@ -54,13 +110,108 @@ func NewMinimalXMLSRResponse() XMLSRResponse {
 	}
 }
 
+// XMLSRExtraResponseData contains (non-standard) information
+// about results of individual searched resources
+type XMLSRExtraResponseData struct {
+	Resources *XMLSRResourcesInfo `xml:"mq:Resources"`
+}
+
+type XMLSRResourcesInfo struct {
+	XMLNSMQ   string              `xml:"xmlns:mq,attr"`
+	Resources []XMLSRResourceInfo `xml:"mq:Resource"`
+}
+
+func NewXMLSRExtraResponseData() *XMLSRExtraResponseData {
+	return &XMLSRExtraResponseData{
+		Resources: &XMLSRResourcesInfo{
+			XMLNSMQ:   "https://github.com/czcorpus/mquery-sru",
+			Resources: make([]XMLSRResourceInfo, 0, 10),
+		},
+	}
+}
+
+// XMLSRResourceInfo describes results of a single resource.
+// Truncated means there are more hits in the resource than
+// the ones preceding and included in the response.
+// HitsPerMillion is the relative frequency of hits (i.p.m.).
+// Both CorpusSize and HitsPerMillion are omitted in case
+// the size of the resource is unknown.
+// Query is a backend query the resource was searched with
+// (included only on request, see `x-cnc-debug-query`).
+type XMLSRResourceInfo struct {
+	PID             string   `xml:"pid,attr"`
+	NumberOfRecords int      `xml:"numberOfRecords,attr"`
+	ReturnedRecords int      `xml:"returnedRecords,attr"`
+	Truncated       bool     `xml:"truncated,attr"`
+	CorpusSize      int64    `xml:"corpusSize,attr,omitempty"`
+	HitsPerMillion  *float64 `xml:"ipm,attr,omitempty"`
+	Query           string   `xml:"mq:Query,omitempty"`
+}
+
 // --------------------- Search Retrieve Record ---------------------
 
+// XMLSRRecord is a single search result record. Based on the `recordSchema`,
+// either Data (FCS resource) or DCData (Dublin Core summary) is set.
 type XMLSRRecord struct {
-	Schema         string        `xml:"sruResponse:recordSchema"`
-	XMLEscaping    string        `xml:"sruResponse:recordXMLEscaping"`
-	Data           XMLSRResource `xml:"sruResponse:recordData>fcs:Resource"`
-	RecordPosition int           `xml:"sruResponse:recordPosition"`
+	Schema         string         `xml:"sruResponse:recordSchema"`
+	XMLEscaping    string         `xml:"sruResponse:recordXMLEscaping"`
+	Data           *XMLSRResource `xml:"sruResponse:recordData>fcs:Resource,omitempty"`
+	DCData         *XMLSRDCRecord `xml:"sruResponse:recordData>srw_dc:dc,omitempty"`
+	RecordPosition int            `xml:"sruResponse:recordPosition"`
+
+	// PlainText (if set) replaces the serialized record data
+	// in case of the RecordPackingString record XML escaping
+	PlainText string `xml:"-"`
+}
+
+// MarshalXML encodes the record. In case of the RecordPackingString record XML escaping,
+// record data are serialized and sent as an escaped string.
+func (r XMLSRRecord) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type xmlRecord XMLSRRecord // prevents recursion
+	if r.XMLEscaping != RecordPackingString {
+		return e.EncodeElement(xmlRecord(r), start)
+	}
+	var data string
+	var err error
+	if r.PlainText != "" {
+		data = r.PlainText
+
+	} else if r.Data != nil {
+		data, err = packAsString("fcs:Resource", r.Data)
+
+	} else if r.DCData != nil {
+		data, err = packAsString("srw_dc:dc", r.DCData)
+	}
+	if err != nil {
+		return err
+	}
+	return e.EncodeElement(
+		struct {
+			Schema         string `xml:"sruResponse:recordSchema"`
+			XMLEscaping    string `xml:"sruResponse:recordXMLEscaping"`
+			Data           string `xml:"sruResponse:recordData"`
+			RecordPosition int    `xml:"sruResponse:recordPosition"`
+		}{r.Schema, r.XMLEscaping, data, r.RecordPosition},
+		start,
+	)
+}
+
+// XMLSRDCRecord is a Dublin Core summary of a record
+type XMLSRDCRecord struct {
+	XMLNSSRWDC  string   `xml:"xmlns:srw_dc,attr"`
+	XMLNSDC     string   `xml:"xmlns:dc,attr"`
+	Titles      []string `xml:"dc:title"`
+	Description string   `xml:"dc:description"`
+	Identifier  string   `xml:"dc:identifier,omitempty"`
+	Source      string   `xml:"dc:source"`
+	Languages   []string `xml:"dc:language"`
+}
+
+func NewXMLSRDCRecord() *XMLSRDCRecord {
+	return &XMLSRDCRecord{
+		XMLNSSRWDC: "info:srw/schema/1/dc-schema",
+		XMLNSDC:    "http://purl.org/dc/elements/1.1/",
+	}
 }
 
 type XMLSRResource struct {
@@ -110,10 +261,41 @@ type XMLSRAdvValue struct {
 	Value     string `xml:",chardata"`
 }
 
+// XMLSROffsetsDataViewResult is a non-standard data view containing
+// a plain text of a concordance line along with character offsets
+// of hits within the text
+type XMLSROffsetsDataViewResult struct {
+	XMLName xml.Name           `xml:"mq:Offsets"`
+	XMLNSMQ string             `xml:"xmlns:mq,attr"`
+	Text    string             `xml:"mq:Text"`
+	Hits    []XMLSROffsetsSpan `xml:"mq:Hit"`
+}
+
+// XMLSROffsetsSpan is a range of characters [Start, End)
+// counted from zero
+type XMLSROffsetsSpan struct {
+	Start int `xml:"start,attr"`
+	End   int `xml:"end,attr"`
+}
+
+// XMLSRMetadataDataViewResult is a non-standard data view containing
+// document metadata (values of configured structural attributes)
+// of a concordance line
+type XMLSRMetadataDataViewResult struct {
+	XMLName xml.Name            `xml:"mq:Metadata"`
+	XMLNSMQ string              `xml:"xmlns:mq,attr"`
+	Items   []XMLSRMetadataItem `xml:"mq:Item"`
+}
+
+type XMLSRMetadataItem struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:",chardata"`
+}
+
 // --------------------- Echoed Search Retrieve Request ---------------------
 
 type XMLSREchoedRequest struct {
 	Version     string `xml:"sruResponse:version"`
 	Query       string `xml:"sruResponse:query"`
-	StartRecord int    `xml:"sruResponse:startRecord"`
+	StartRecord int    `xml:"sruResponse:startRecord,omitempty"`
 }
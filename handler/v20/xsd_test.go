@@ -0,0 +1,271 @@
+//go:build xsd
+
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package v20
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/czcorpus/cnc-gokit/collections"
+	"github.com/czcorpus/mquery-sru/cnf"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/corpus/conc"
+	"github.com/czcorpus/mquery-sru/general"
+	"github.com/czcorpus/mquery-sru/handler/v20/schema"
+	"github.com/czcorpus/mquery-sru/query"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// officialSchemas lists the official schemas (see scripts/fetch-xsd.sh)
+// required to validate responses, relative to handler/testdata/xsd/official
+var officialSchemas = []string{
+	"sru-2.0/sruResponse.xsd", "sru-2.0/scan.xsd", "sru-2.0/diagnostic.xsd",
+	"fcs/Resource.xsd", "fcs/DataView-Hits.xsd", "fcs/DataView-Advanced.xsd",
+	"fcs/Endpoint-Description.xsd",
+}
+
+// validateXML renders the response the same way as produceXMLResponse
+// and validates it against the bundled schemas (see handler/testdata/xsd).
+// In case the official schemas have been downloaded, the response is also
+// validated against them (otherwise the respective subtest is skipped).
+func validateXML(t *testing.T, data any) {
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Skip("xmllint not available")
+	}
+	xmlAns, err := xml.MarshalIndent(data, "", "  ")
+	if !assert.NoError(t, err) {
+		return
+	}
+	path := filepath.Join(t.TempDir(), "response.xml")
+	if !assert.NoError(t, os.WriteFile(path, []byte(xml.Header+string(xmlAns)), 0644)) {
+		return
+	}
+	out, err := exec.Command(
+		xmllint, "--noout", "--nonet", "--schema", "../testdata/xsd/fcs-sru-2.0.xsd", path).CombinedOutput()
+	assert.NoError(t, err, string(out))
+
+	t.Run("official", func(t *testing.T) {
+		schemaDir, err := filepath.Abs("../testdata/xsd/official")
+		if !assert.NoError(t, err) {
+			return
+		}
+		for _, schemaFile := range officialSchemas {
+			if _, err := os.Stat(filepath.Join(schemaDir, schemaFile)); err != nil {
+				t.Skip("official schemas not available (see scripts/fetch-xsd.sh)")
+			}
+		}
+		cmd := exec.Command(
+			xmllint, "--noout", "--nonet", "--schema", filepath.Join(schemaDir, "fcs-sru-2.0.xsd"), path)
+		// the official schemas may import each other via absolute URLs
+		cmd.Env = append(os.Environ(), "XML_CATALOG_FILES="+filepath.Join(schemaDir, "catalog.xml"))
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+	})
+}
+
+func createXSDTestHandler() *FCSSubHandlerV20 {
+	return &FCSSubHandlerV20{
+		serverInfo: &cnf.ServerInfo{
+			ServerHost:      "fcs.example.org",
+			ServerPort:      "443",
+			Database:        "fcs",
+			DatabaseTitle:   map[string]string{"en": "Test endpoint"},
+			PrimaryLanguage: "en",
+		},
+		corporaConf: &corpus.CorporaSetup{
+			MaximumRecords: 50,
+			DefaultRecords: 20,
+			MaximumTerms:   100,
+			Resources: corpus.SrchResources{
+				{
+					ID:          "syn2020",
+					PID:         "http://hdl.handle.net/11234/1-0001",
+					FullName:    map[string]string{"en": "SYN2020"},
+					Description: map[string]string{"en": "A written corpus"},
+					Languages:   []string{"cs"},
+					URI:         "https://example.org/syn2020",
+					PosAttrs: []corpus.PosAttr{
+						{ID: "word", Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true},
+						{ID: "lemma", Name: "lemma", Layer: corpus.LayerTypeLemma, IsLayerDefault: true},
+					},
+				},
+				{
+					ID:                      "oral",
+					PID:                     "http://hdl.handle.net/11234/1-0002",
+					FullName:                map[string]string{"en": "ORAL"},
+					Description:             map[string]string{"en": "A spoken corpus"},
+					Languages:               []string{"ces"},
+					AvailabilityRestriction: corpus.AvailabilityRestrictionAuthOnly,
+					PosAttrs: []corpus.PosAttr{
+						{ID: "word", Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true},
+						{ID: "phon", Name: "phon", Layer: corpus.LayerTypePhonetic, IsLayerDefault: true},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestExplainValidates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := createXSDTestHandler()
+
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/?operation=explain&x-fcs-endpoint-description=true", nil)
+	ans, _ := handler.explain(ctx, &FCSRequest{RecordXMLEscaping: RecordXMLEscapingXML})
+	validateXML(t, ans)
+	// note: xmllint does not check IDREFS so we test layer references here
+	if assert.NotNil(t, ans.EndpointDescription) {
+		layers := collections.NewSet[string]()
+		for _, layer := range ans.EndpointDescription.SupportedLayers {
+			layers.Add(layer.ID)
+		}
+		for _, res := range ans.EndpointDescription.Resources {
+			for _, ref := range strings.Fields(res.AvailableLayers.Values) {
+				assert.True(t, layers.Contains(ref), "undefined layer %s", ref)
+			}
+		}
+	}
+
+	ctx, _ = gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/?operation=explain&x-foo=1", nil)
+	ans, _ = handler.explain(ctx, &FCSRequest{RecordXMLEscaping: RecordXMLEscapingXML})
+	validateXML(t, ans)
+}
+
+func TestScanValidates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := createXSDTestHandler()
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/?operation=scan&scanClause=fcs.resource&maximumTerms=1000", nil)
+	ans, _ := handler.scan(ctx, &FCSRequest{})
+	validateXML(t, ans)
+}
+
+func TestSearchRetrieveErrorValidates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := createXSDTestHandler()
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest("GET", "/?operation=searchRetrieve&x-foo=1", nil)
+	ans, _ := handler.searchRetrieve(ctx, &FCSRequest{})
+	validateXML(t, ans)
+}
+
+func TestSearchRetrieveNoHitsValidates(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := createXSDTestHandler()
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(
+		"GET", "/?operation=searchRetrieve&query=dog&x-fcs-context=unknown", nil)
+	ans, code := handler.searchRetrieve(ctx, &FCSRequest{})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 0, ans.NumberOfRecords)
+	assert.Nil(t, ans.Records)
+	validateXML(t, ans)
+}
+
+func TestSearchRetrieveValidates(t *testing.T) {
+	handler := createXSDTestHandler()
+	res := handler.corporaConf.Resources[0]
+	line := &conc.ConcordanceLine{
+		Text: conc.TokenSlice{
+			{Word: "prezident", Attrs: map[string]string{"lemma": "prezident"}},
+			{Word: "Havel", Strong: true, Attrs: map[string]string{"lemma": "Havel"}},
+			{Word: "řekl", Attrs: map[string]string{"lemma": "říci"}},
+		},
+	}
+	ans := schema.NewXMLSRResponse()
+	ans.NumberOfRecords = 2
+	ans.EchoedRequest.Query = "Havel"
+	ans.EchoedRequest.StartRecord = 1
+	records := []schema.XMLSRRecord{
+		{
+			Schema:      general.RecordSchema,
+			XMLEscaping: string(RecordXMLEscapingXML),
+			Data: &schema.XMLSRResource{
+				XMLNSFCS: "http://clarin.eu/fcs/resource",
+				PID:      res.PID,
+				ResourceFragment: schema.XMLSRResourceFragment{
+					Ref: "https://example.org/syn2020?q=Havel",
+					DataViews: []*schema.XMLSRDataView{
+						{
+							Type: "application/x-clarin-fcs-hits+xml",
+							Result: schema.XMLSRBasicDataViewResult{
+								XMLNSHits: "http://clarin.eu/fcs/dataview/hits",
+								Data:      "prezident <hits:Hit>Havel</hits:Hit> řekl",
+							},
+						},
+						{
+							Type: "application/x-clarin-fcs-adv+xml",
+							Result: schema.XMLSRAdvancedDataViewResult{
+								Unit:     "item",
+								XMLNSAdv: "http://clarin.eu/fcs/dataview/advanced",
+								Segments: []schema.XMLSRAdvSegment{
+									{ID: "s0", Start: 1, End: 9},
+									{ID: "s1", Start: 11, End: 15},
+									{ID: "s2", Start: 17, End: 20},
+								},
+								Layers: []schema.XMLSRAdvLayer{
+									{
+										ID: corpus.LayerTypeLemma.GetResultID(),
+										Values: []schema.XMLSRAdvValue{
+											{Ref: "s0", Value: "prezident"},
+											{Ref: "s1", Highlight: "s1", Value: "Havel"},
+											{Ref: "s2", Value: "říci"},
+										},
+									},
+								},
+							},
+						},
+						newOffsetsDataView(conc.NewKWICLine(line.Text)),
+					},
+				},
+			},
+			RecordPosition: 1,
+		},
+		{
+			Schema:         general.RecordSchemaDC,
+			XMLEscaping:    string(RecordXMLEscapingXML),
+			DCData:         newDCRecord(res, conc.NewKWICLine(line.Text), "https://example.org/syn2020?q=Havel", "en"),
+			RecordPosition: 2,
+		},
+	}
+	ans.Records = &schema.XMLSRRecords{Records: records}
+	ans.ResultSetID = general.EncodeResultSetID(map[string]string{"query": "Havel"})
+	ans.ResultSetTTL = 60
+	ans.ExtraResponseData = handler.resourcesInfo(
+		query.LineRangeList{{Rsc: "syn2020", From: 0, To: 10}},
+		[]int{2},
+		[]int64{1000000},
+		map[string]int{"syn2020": 2},
+		true,
+		map[string]string{"syn2020": `[word="Havel"]`},
+	)
+	validateXML(t, ans)
+}
@@ -25,9 +25,122 @@
 
 using namespace std;
 
+/**
+ * escapeRefs percent-encodes whitespace, ',' and '%' in a line reference
+ * item so the references (which may contain structural attribute values)
+ * form a single whitespace-delimited item of a returned line with
+ * comma-separated values.
+ */
+string escapeRefs(const string& refs) {
+    string ans;
+    ans.reserve(refs.size());
+    for (char c : refs) {
+        switch (c) {
+            case '%': ans += "%25"; break;
+            case ',': ans += "%2C"; break;
+            case ' ': ans += "%20"; break;
+            case '\t': ans += "%09"; break;
+            case '\n': ans += "%0A"; break;
+            case '\r': ans += "%0D"; break;
+            default: ans += c;
+        }
+    }
+    return ans;
+}
+
+/**
+ * structAttrValue returns a value of a structural attribute (e.g. "doc.id")
+ * at the position. In case the position is not within the structure,
+ * STRUCT_ATTR_NONE is returned (the same value Manatee uses in references).
+ */
+string structAttrValue(Corpus* corp, const string& attr, Position pos) {
+    size_t dotIdx = attr.find('.');
+    Structure* strc = corp->get_struct(attr.substr(0, dotIdx));
+    NumOfPos num = strc->rng->num_at_pos(pos);
+    if (num < 0) {
+        return STRUCT_ATTR_NONE;
+    }
+    return strc->get_attr(attr.substr(dotIdx + 1))->pos2str(num);
+}
+
+/**
+ * splitAttrs splits a comma-separated list of attributes
+ */
+vector<string> splitAttrs(const string& attrs) {
+    vector<string> ans;
+    size_t start = 0;
+    while (start < attrs.size()) {
+        size_t end = attrs.find(',', start);
+        if (end == string::npos) {
+            end = attrs.size();
+        }
+        if (end > start) {
+            ans.push_back(attrs.substr(start, end - start));
+        }
+        start = end + 1;
+    }
+    return ans;
+}
+
+/**
+ * writeItems writes KWICLines items (pairs of a string and its class)
+ * to the buffer. Structure tags (items starting with '<' with the class
+ * "strc" which is also used for positional attribute values) are removed
+ * and opening tags are replaced by SEGMENT_MARKER.
+ */
+void writeItems(ostringstream& buffer, const vector<string>& items) {
+    bool first = true;
+    for (size_t i = 0; i < items.size(); ++i) {
+        if (i % 2 == 0 && i + 1 < items.size() && items.at(i + 1) == "strc"
+                && items.at(i).rfind("<", 0) == 0) {
+            if (items.at(i).rfind("</", 0) != 0) {
+                if (!first) {
+                    buffer << " ";
+                }
+                buffer << SEGMENT_MARKER << " ";
+                first = true;
+            }
+            ++i;
+            continue;
+        }
+        if (!first) {
+            buffer << " ";
+        }
+        buffer << items.at(i);
+        first = false;
+    }
+}
+
+ConcSizeRetval conc_size(const char* corpusPath, const char* query) {
+    string cPath(corpusPath);
+    try {
+        Corpus* corp = new Corpus(cPath);
+        Concordance* conc = new Concordance(
+            corp, corp->filter_query(eval_cqpquery(query, corp)));
+        conc->sync();
+        ConcSizeRetval ans {
+            conc->size(),
+            corp->size(),
+            nullptr
+        };
+        delete conc;
+        delete corp;
+        return ans;
+
+    } catch (std::exception &e) {
+        ConcSizeRetval ans {
+            0,
+            0,
+            strdup(e.what())
+        };
+        return ans;
+    }
+}
+
 KWICRowsRetval conc_examples(
     const char* corpusPath, const char* query, const char* attrs, PosInt fromLine, PosInt limit,
-        PosInt maxContext, const char* viewContextStruct) {
+        PosInt maxContext, const char* viewContextStruct, const char* structAttrs,
+        const char* segmentStruct) {
 
     string cPath(corpusPath);
     try {
@@ -40,7 +153,9 @@ KWICRowsRetval conc_examples(
                 nullptr,
                 0,
                 0,
-                nullptr
+                nullptr,
+                0,
+                corp->size()
             };
             return ans;
         }
@@ -51,9 +166,10 @@ KWICRowsRetval conc_examples(
             KWICRowsRetval ans {
                 nullptr,
                 0,
-                0,
+                conc->size(),
                 dynamicStr,
-                1
+                1,
+                corp->size()
             };
             return ans;
         }
@@ -66,7 +182,7 @@ KWICRowsRetval conc_examples(
             ("1:"+std::string(viewContextStruct)).c_str(),
             attrs,
             attrs,
-            "",
+            segmentStruct,
             "#",
             maxContext,
             false
@@ -74,6 +190,9 @@ KWICRowsRetval conc_examples(
         if (conc->size() < limit) {
             limit = conc->size();
         }
+        // note: structural attribute values are obtained separately
+        // as Manatee references do not escape commas in values
+        vector<string> refAttrs = splitAttrs(structAttrs);
         char** lines = (char**)malloc(limit * sizeof(char*));
         int i = 0;
         while (kl->nextline()) {
@@ -82,26 +201,15 @@ KWICRowsRetval conc_examples(
             auto rgt = kl->get_right();
             std::ostringstream buffer;
 
-            buffer << kl->get_refs() << " ";
-
-            for (size_t i = 0; i < lft.size(); ++i) {
-                if (i > 0) {
-                    buffer << " ";
-                }
-                buffer << lft.at(i);
-            }
-            for (size_t i = 0; i < kwc.size(); ++i) {
-                if (i > 0) {
-                    buffer << " ";
-                }
-                buffer << kwc.at(i);
-            }
-            for (size_t i = 0; i < rgt.size(); ++i) {
-                if (i > 0) {
-                    buffer << " ";
-                }
-                buffer << rgt.at(i);
+            buffer << escapeRefs(kl->get_refs());
+            for (const string& attr : refAttrs) {
+                buffer << "," << escapeRefs(structAttrValue(corp, attr, kl->get_pos()));
             }
+            buffer << " ";
+
+            writeItems(buffer, lft);
+            writeItems(buffer, kwc);
+            writeItems(buffer, rgt);
             lines[i] = strdup(buffer.str().c_str());
             i++;
             if (i == limit) {
@@ -115,6 +223,7 @@ KWICRowsRetval conc_examples(
         for (int i2 = i; i2 < limit; i2++) {
             lines[i2] = strdup("");
         }
+        PosInt corpusSize = corp->size();
         delete conc;
         delete corp;
         KWICRowsRetval ans {
@@ -122,7 +231,8 @@ KWICRowsRetval conc_examples(
             limit,
             concSize,
             nullptr,
-            0
+            0,
+            corpusSize
         };
         return ans;
 
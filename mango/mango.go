@@ -32,6 +32,12 @@ import (
 
 const (
 	MaxRecordsInternalLimit = 1000
+
+	// SegmentMarker is a standalone item of a returned concordance
+	// line marking the start of a segment structure (see the
+	// `segmentStruct` argument of GetConcExamples). It must match
+	// SEGMENT_MARKER in mango.h.
+	SegmentMarker = "\x1f"
 )
 
 var (
@@ -46,8 +52,24 @@ type GoConcSize struct {
 }
 
 type GoConcExamples struct {
-	Lines    []string
-	ConcSize int
+	Lines      []string
+	ConcSize   int
+	CorpusSize int64
+}
+
+// GetConcSize returns the number of matching positions of the query
+// (and the corpus size) without fetching any concordance lines.
+func GetConcSize(corpusPath, query string) (GoConcSize, error) {
+	var ret GoConcSize
+	ans := C.conc_size(C.CString(corpusPath), C.CString(query))
+	if ans.err != nil {
+		err := fmt.Errorf(C.GoString(ans.err))
+		defer C.free(unsafe.Pointer(ans.err))
+		return ret, err
+	}
+	ret.Value = int64(ans.value)
+	ret.CorpusSize = int64(ans.corpusSize)
+	return ret, nil
 }
 
 func GetConcExamples(
@@ -55,14 +77,18 @@ func GetConcExamples(
 	attrs []string,
 	fromLine, maxItems, maxContext int,
 	viewContextStruct string,
+	structAttrs []string,
+	segmentStruct string,
 ) (GoConcExamples, error) {
 	ans := C.conc_examples(
 		C.CString(corpusPath), C.CString(query), C.CString(strings.Join(attrs, ",")),
 		C.longlong(fromLine), C.longlong(maxItems), C.longlong(maxContext),
-		C.CString(viewContextStruct))
+		C.CString(viewContextStruct), C.CString(strings.Join(structAttrs, ",")),
+		C.CString(segmentStruct))
 	var ret GoConcExamples
 	ret.Lines = make([]string, 0, maxItems)
 	ret.ConcSize = int(ans.concSize)
+	ret.CorpusSize = int64(ans.corpusSize)
 	if ans.err != nil {
 		err := fmt.Errorf(C.GoString(ans.err))
 		defer C.free(unsafe.Pointer(ans.err))
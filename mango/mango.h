@@ -26,20 +26,49 @@ typedef void* KWICRowsV;
 
 typedef long long int PosInt;
 
+/**
+ * SEGMENT_MARKER marks a start of a segment structure within
+ * a returned concordance line (see mango.SegmentMarker in Go)
+ */
+#define SEGMENT_MARKER "\x1f"
+
+/**
+ * STRUCT_ATTR_NONE is a value of a structural attribute at a position
+ * which is not within the structure (the same value Manatee uses)
+ */
+#define STRUCT_ATTR_NONE "===NONE==="
+
 typedef struct ConcRetval {
     ConcV value;
     const char * err;
 } ConcRetval;
 
+typedef struct ConcSizeRetval {
+    PosInt value;
+    PosInt corpusSize;
+    const char * err;
+} ConcSizeRetval;
+
 typedef struct KWICRowsRetval {
     KWICRowsV value;
     PosInt size;
     PosInt concSize;
     const char * err;
     int errorCode;
+    PosInt corpusSize;
 } KWICRowsRetval;
 
 
+/**
+ * @brief Based on provided query, return the number of matching positions
+ * (i.e. the concordance size) without fetching any concordance lines.
+ *
+ * @param corpusPath
+ * @param query
+ * @return ConcSizeRetval
+ */
+ConcSizeRetval conc_size(const char* corpusPath, const char* query);
+
 /**
  * @brief Based on provided query, return at most `limit` sentences matching the query.
  * The returned string is always in form "[kwic_token_id] [rest...]" - so to parse the
@@ -52,11 +81,19 @@ typedef struct KWICRowsRetval {
  * @param query
  * @param attrs Positional attributes (comma-separated) to be attached to returned tokens
  * @param limit
+ * @param maxContext
+ * @param viewContextStruct
+ * @param structAttrs Structural attributes (comma-separated, e.g. "doc.id,doc.title")
+ * whose values (at the KWIC position) are appended to the "[kwic_token_id]" part
+ * as comma-separated items (whitespace, ',' and '%' in values are percent-encoded)
+ * @param segmentStruct a structure (e.g. "s") whose starts are marked in the returned
+ * lines by standalone SEGMENT_MARKER items; an empty value means no marking
  * @return KWICRowsRetval
  */
 KWICRowsRetval conc_examples(
     const char* corpusPath, const char*query, const char* attrs, PosInt fromLine, PosInt limit,
-    PosInt maxContext, const char* viewContextStruct);
+    PosInt maxContext, const char* viewContextStruct, const char* structAttrs,
+    const char* segmentStruct);
 
 
 /**
@@ -24,12 +24,14 @@ import (
 
 	"github.com/czcorpus/cnc-gokit/datetime"
 	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/czcorpus/mquery-sru/rdb"
 	"github.com/gin-gonic/gin"
 )
 
 type Actions struct {
 	logger   *WorkerJobLogger
 	location *time.Location
+	radapter *rdb.Adapter
 }
 
 func (a *Actions) WorkersLoad(ctx *gin.Context) {
@@ -69,13 +71,25 @@ func (a *Actions) WorkersLoadTotal(ctx *gin.Context) {
 
 }
 
+// OutstandingQueries reports the number of published queries
+// waiting for their results and the configured limit
+// (zero means no limit)
+func (a *Actions) OutstandingQueries(ctx *gin.Context) {
+	uniresp.WriteJSONResponse(ctx.Writer, map[string]int{
+		"outstandingQueries":    a.radapter.NumOutstandingQueries(),
+		"maxOutstandingQueries": a.radapter.MaxOutstandingQueries(),
+	})
+}
+
 func NewActions(
 	logger *WorkerJobLogger,
 	location *time.Location,
+	radapter *rdb.Adapter,
 ) *Actions {
 	ans := &Actions{
 		logger:   logger,
 		location: location,
+		radapter: radapter,
 	}
 	return ans
 }
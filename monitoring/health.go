@@ -0,0 +1,112 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package monitoring
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/czcorpus/cnc-gokit/uniresp"
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/gin-gonic/gin"
+)
+
+type dependencyStatus struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+
+	// NumListening is used only for workers
+	NumListening *int `json:"numListening,omitempty"`
+}
+
+type healthResponse struct {
+	OK           bool                        `json:"ok"`
+	Dependencies map[string]dependencyStatus `json:"dependencies,omitempty"`
+}
+
+// HealthActions provides liveness and readiness endpoints
+// for service orchestrators.
+type HealthActions struct {
+	radapter    *rdb.Adapter
+	gracePeriod time.Duration
+
+	// lastListenerSeen is the last time we saw at least one
+	// worker listening on the query channel
+	lastListenerSeen time.Time
+	mutex            sync.Mutex
+}
+
+// Healthz reports that the server process is up
+func (a *HealthActions) Healthz(ctx *gin.Context) {
+	uniresp.WriteJSONResponse(ctx.Writer, healthResponse{OK: true})
+}
+
+// Readyz reports whether the server is able to process searches,
+// i.e. Redis is reachable and there is at least one worker listening
+// for queries (or the last one has been seen within the grace period).
+func (a *HealthActions) Readyz(ctx *gin.Context) {
+	ans := healthResponse{
+		OK:           true,
+		Dependencies: make(map[string]dependencyStatus),
+	}
+	if err := a.radapter.Ping(); err != nil {
+		ans.Dependencies["redis"] = dependencyStatus{Error: err.Error()}
+		ans.Dependencies["workers"] = dependencyStatus{Error: "cannot check workers without Redis"}
+		ans.OK = false
+		uniresp.WriteJSONResponseWithStatus(ctx.Writer, http.StatusServiceUnavailable, ans)
+		return
+	}
+	ans.Dependencies["redis"] = dependencyStatus{OK: true}
+
+	numListening, err := a.radapter.NumQueryListeners()
+	if err != nil {
+		ans.Dependencies["workers"] = dependencyStatus{Error: err.Error()}
+		ans.OK = false
+
+	} else {
+		a.mutex.Lock()
+		if numListening > 0 {
+			a.lastListenerSeen = time.Now()
+		}
+		workersOK := numListening > 0 || time.Since(a.lastListenerSeen) <= a.gracePeriod
+		a.mutex.Unlock()
+		workers := dependencyStatus{OK: workersOK, NumListening: &numListening}
+		if !workersOK {
+			workers.Error = "no worker listening"
+		}
+		ans.Dependencies["workers"] = workers
+		ans.OK = workersOK
+	}
+	if !ans.OK {
+		uniresp.WriteJSONResponseWithStatus(ctx.Writer, http.StatusServiceUnavailable, ans)
+		return
+	}
+	uniresp.WriteJSONResponse(ctx.Writer, ans)
+}
+
+// NewHealthActions creates health actions. The server is considered
+// ready without workers for `gracePeriod` after its start.
+func NewHealthActions(radapter *rdb.Adapter, gracePeriod time.Duration) *HealthActions {
+	return &HealthActions{
+		radapter:         radapter,
+		gracePeriod:      gracePeriod,
+		lastListenerSeen: time.Now(),
+	}
+}
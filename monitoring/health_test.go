@@ -0,0 +1,105 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package monitoring
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestHealthActions(t *testing.T, gracePeriod time.Duration) (*HealthActions, *rdb.Adapter, *miniredis.Miniredis) {
+	srv := miniredis.RunT(t)
+	port, err := strconv.Atoi(srv.Port())
+	assert.NoError(t, err)
+	radapter := rdb.NewAdapter(&rdb.Conf{Host: srv.Host(), Port: port, ChannelQuery: "testQueries"})
+	return NewHealthActions(radapter, gracePeriod), radapter, srv
+}
+
+func callHealthAction(action gin.HandlerFunc) (int, healthResponse) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(w)
+	ctx.Request = httptest.NewRequest("GET", "/", nil)
+	action(ctx)
+	var ans healthResponse
+	json.Unmarshal(w.Body.Bytes(), &ans)
+	return w.Code, ans
+}
+
+func TestHealthz(t *testing.T) {
+	actions, _, srv := newTestHealthActions(t, 0)
+	srv.Close()
+	// liveness does not depend on Redis
+	code, ans := callHealthAction(actions.Healthz)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, ans.OK)
+}
+
+func TestReadyzWithWorker(t *testing.T) {
+	actions, radapter, _ := newTestHealthActions(t, 0)
+	radapter.Subscribe()
+	assert.Eventually(t, func() bool {
+		n, err := radapter.NumQueryListeners()
+		return err == nil && n == 1
+	}, time.Second, 10*time.Millisecond)
+	code, ans := callHealthAction(actions.Readyz)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, ans.OK)
+	assert.True(t, ans.Dependencies["redis"].OK)
+	if assert.NotNil(t, ans.Dependencies["workers"].NumListening) {
+		assert.Equal(t, 1, *ans.Dependencies["workers"].NumListening)
+	}
+}
+
+func TestReadyzWithoutWorkers(t *testing.T) {
+	actions, _, _ := newTestHealthActions(t, 0)
+	time.Sleep(time.Millisecond)
+	code, ans := callHealthAction(actions.Readyz)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, ans.OK)
+	assert.True(t, ans.Dependencies["redis"].OK)
+	assert.False(t, ans.Dependencies["workers"].OK)
+	assert.Equal(t, "no worker listening", ans.Dependencies["workers"].Error)
+}
+
+func TestReadyzWithinGracePeriod(t *testing.T) {
+	actions, _, _ := newTestHealthActions(t, time.Minute)
+	code, ans := callHealthAction(actions.Readyz)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, ans.Dependencies["workers"].OK)
+}
+
+func TestReadyzWithoutRedis(t *testing.T) {
+	actions, _, srv := newTestHealthActions(t, time.Minute)
+	srv.Close()
+	code, ans := callHealthAction(actions.Readyz)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.False(t, ans.OK)
+	assert.False(t, ans.Dependencies["redis"].OK)
+	assert.NotEmpty(t, ans.Dependencies["redis"].Error)
+}
@@ -1,9 +1,60 @@
 package compiler
 
+import "fmt"
+
+// UnsupportedIndexError reports a query referring to a layer
+// (and/or qualified attribute) not available in a corpus
+type UnsupportedIndexError struct {
+	Qualifier string
+	Layer     string
+}
+
+func (err UnsupportedIndexError) Index() string {
+	if err.Qualifier != "" {
+		return err.Qualifier + ":" + err.Layer
+	}
+	return err.Layer
+}
+
+func (err UnsupportedIndexError) Error() string {
+	return fmt.Sprintf("unknown attribute and/or layer %s", err.Index())
+}
+
+// UnsupportedRelationError reports a query using a relation
+// (e.g. `<`, `contains`) between an attribute and a value
+// which cannot be translated into CQL.
+type UnsupportedRelationError struct {
+	Relation string
+}
+
+func (err UnsupportedRelationError) Error() string {
+	return fmt.Sprintf("unsupported relation %s", err.Relation)
+}
+
+// UnsupportedFeatureError reports a query using a valid construct
+// of the query language which is not supported by the endpoint
+// (e.g. the PROX operator of CQL).
+type UnsupportedFeatureError struct {
+	Feature string
+}
+
+func (err UnsupportedFeatureError) Error() string {
+	return fmt.Sprintf("unsupported query feature: %s", err.Feature)
+}
+
+type UnsupportedWithinError struct {
+	Context string
+}
+
+func (err UnsupportedWithinError) Error() string {
+	return fmt.Sprintf("structure %s not available", err.Context)
+}
+
 type AST interface {
 	Generate() string
 	AddError(err error)
 	Errors() []error
 	TranslateWithinCtx(v string) string
 	TranslatePosAttr(qualifier, name string) string
+	NormalizeTerm(v string) string
 }
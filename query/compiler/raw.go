@@ -0,0 +1,112 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// RawQuery is an AST wrapping a native (backend) CQL query
+// passed by a client. No translation is performed - the query
+// is just checked for basic sanity.
+type RawQuery struct {
+	query  string
+	errors []error
+}
+
+func (q *RawQuery) Generate() string {
+	return q.query
+}
+
+func (q *RawQuery) AddError(err error) {
+	q.errors = append(q.errors, err)
+}
+
+func (q *RawQuery) Errors() []error {
+	return q.errors
+}
+
+func (q *RawQuery) TranslateWithinCtx(v string) string {
+	return v
+}
+
+func (q *RawQuery) TranslatePosAttr(qualifier, name string) string {
+	return name
+}
+
+func (q *RawQuery) NormalizeTerm(v string) string {
+	return v
+}
+
+// sanitizeRawQuery checks that the query contains no control characters
+// and that all the quotes, brackets and parentheses are balanced
+// (with respect to quoted strings and escaping). This does not make
+// the query valid but it prevents sending obvious garbage to workers.
+func sanitizeRawQuery(q string) (string, error) {
+	q = strings.TrimSpace(q)
+	if q == "" {
+		return "", errors.New("empty query")
+	}
+	closing := map[rune]rune{')': '(', ']': '[', '}': '{'}
+	stack := make([]rune, 0, 10)
+	var inQuote, escaped bool
+	for _, c := range q {
+		if unicode.IsControl(c) {
+			return "", fmt.Errorf("invalid character %U in query", c)
+		}
+		if escaped {
+			escaped = false
+			continue
+		}
+		switch {
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			inQuote = !inQuote
+		case inQuote:
+		case c == '(' || c == '[' || c == '{':
+			stack = append(stack, c)
+		case closing[c] != 0:
+			if len(stack) == 0 || stack[len(stack)-1] != closing[c] {
+				return "", fmt.Errorf("unbalanced %c in query", c)
+			}
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if inQuote {
+		return "", errors.New("unterminated string in query")
+	}
+	if len(stack) > 0 {
+		return "", fmt.Errorf("unclosed %c in query", stack[len(stack)-1])
+	}
+	return q, nil
+}
+
+// NewRawQuery creates a new raw query AST. In case the query
+// does not pass basic sanity checks, an error is returned.
+func NewRawQuery(q string) (*RawQuery, error) {
+	sq, err := sanitizeRawQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	return &RawQuery{query: sq}, nil
+}
@@ -0,0 +1,42 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// FoldTerm normalizes a search term to match values of diacritics-folded
+// corpus attributes - i.e. the term is lowercased and all the combining
+// marks (accents, carons etc.) are removed from it.
+// Please note that letters without a canonical decomposition
+// (e.g. `ł`, `ø`) are left untouched.
+func FoldTerm(v string) string {
+	var ans strings.Builder
+	for _, c := range norm.NFD.String(v) {
+		if unicode.Is(unicode.Mn, c) {
+			continue
+		}
+		ans.WriteRune(unicode.ToLower(c))
+	}
+	return norm.NFC.String(ans.String())
+}
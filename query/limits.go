@@ -0,0 +1,112 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits specifies basic complexity constraints applied to a raw
+// query before it is passed to a parser. The checks are intentionally
+// simple (no parsing involved) so pathological queries can be rejected
+// cheaply. A zero value of any limit means "no limit".
+type Limits struct {
+	MaxLength int
+	MaxTerms  int
+	MaxDepth  int
+}
+
+func isTermSeparator(c rune) bool {
+	return unicode.IsSpace(c) || strings.ContainsRune("()[]{}&|!", c)
+}
+
+func isBoolOperator(v string) bool {
+	switch strings.ToUpper(v) {
+	case "AND", "OR", "NOT", "PROX":
+		return true
+	}
+	return false
+}
+
+// Check tests the query `q` against the limits. The number of terms
+// is estimated as the number of words (with boolean operators excluded)
+// and the depth as the maximum nesting level of parentheses and brackets.
+// Quoted strings are considered; each word inside counts as a term.
+func (l Limits) Check(q string) error {
+	if l.MaxLength > 0 && utf8.RuneCountInString(q) > l.MaxLength {
+		return fmt.Errorf("query too long (max. %d characters)", l.MaxLength)
+	}
+	var numTerms, depth, maxDepth int
+	var inQuotes, escaped bool
+	var currWord strings.Builder
+	closeWord := func() {
+		if currWord.Len() > 0 && (inQuotes || !isBoolOperator(currWord.String())) {
+			numTerms++
+		}
+		currWord.Reset()
+	}
+	for _, c := range q {
+		if escaped {
+			escaped = false
+			currWord.WriteRune(c)
+			continue
+		}
+		switch {
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			closeWord()
+			inQuotes = !inQuotes
+		case inQuotes:
+			if unicode.IsSpace(c) {
+				closeWord()
+
+			} else {
+				currWord.WriteRune(c)
+			}
+		case c == '(' || c == '[' || c == '{':
+			closeWord()
+			depth++
+			if depth > maxDepth {
+				maxDepth = depth
+			}
+		case c == ')' || c == ']' || c == '}':
+			closeWord()
+			depth--
+		case isTermSeparator(c):
+			closeWord()
+		default:
+			currWord.WriteRune(c)
+		}
+		if l.MaxTerms > 0 && numTerms > l.MaxTerms {
+			return fmt.Errorf("query contains too many terms (max. %d)", l.MaxTerms)
+		}
+		if l.MaxDepth > 0 && maxDepth > l.MaxDepth {
+			return fmt.Errorf("query is nested too deeply (max. depth %d)", l.MaxDepth)
+		}
+	}
+	closeWord()
+	if l.MaxTerms > 0 && numTerms > l.MaxTerms {
+		return fmt.Errorf("query contains too many terms (max. %d)", l.MaxTerms)
+	}
+	return nil
+}
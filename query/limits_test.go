@@ -0,0 +1,64 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitsAcceptRegularQuery(t *testing.T) {
+	l := Limits{MaxLength: 200, MaxTerms: 5, MaxDepth: 2}
+	assert.NoError(t, l.Check(`cat AND (mouse OR "lazy dog")`))
+	assert.NoError(t, l.Check(`[word="cat" & lemma="cat"]`))
+}
+
+func TestLimitsRejectLongQuery(t *testing.T) {
+	l := Limits{MaxLength: 10}
+	assert.Error(t, l.Check("a very long query"))
+}
+
+func TestLimitsRejectDeepQuery(t *testing.T) {
+	l := Limits{MaxDepth: 3}
+	assert.NoError(t, l.Check("(((cat)))"))
+	assert.Error(t, l.Check("((((cat))))"))
+	assert.NoError(t, l.Check(`"((((cat))))"`))
+}
+
+func TestLimitsCountCharacters(t *testing.T) {
+	l := Limits{MaxLength: 7}
+	assert.NoError(t, l.Check("čeština"))
+	assert.Error(t, l.Check("čeština!"))
+}
+
+func TestLimitsRejectManyTerms(t *testing.T) {
+	l := Limits{MaxLength: 1000000, MaxTerms: 100}
+	q := strings.TrimSuffix(strings.Repeat("cat OR ", 10000), " OR ")
+	assert.Error(t, l.Check(q))
+}
+
+func BenchmarkLimitsRejectManyTerms(b *testing.B) {
+	l := Limits{MaxLength: 1000000, MaxTerms: 100}
+	q := strings.TrimSuffix(strings.Repeat("cat OR ", 10000), " OR ")
+	for i := 0; i < b.N; i++ {
+		l.Check(q)
+	}
+}
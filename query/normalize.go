@@ -0,0 +1,62 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"fmt"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	NormFormNone NormForm = "none"
+	NormFormNFC  NormForm = "NFC"
+	NormFormNFD  NormForm = "NFD"
+	NormFormNFKC NormForm = "NFKC"
+	NormFormNFKD NormForm = "NFKD"
+)
+
+// NormForm is a Unicode normalization form query terms are
+// transformed to before they are searched in a corpus. It should
+// match the form the corpus data are stored in (typically NFC).
+type NormForm string
+
+func (nf NormForm) Validate() error {
+	switch nf {
+	case NormFormNone, NormFormNFC, NormFormNFD, NormFormNFKC, NormFormNFKD:
+		return nil
+	}
+	return fmt.Errorf("invalid normalization form %s", nf)
+}
+
+// Normalize transforms v into the normalization form.
+// For NormFormNone and an empty value, v is returned as it is.
+func (nf NormForm) Normalize(v string) string {
+	switch nf {
+	case NormFormNFC:
+		return norm.NFC.String(v)
+	case NormFormNFD:
+		return norm.NFD.String(v)
+	case NormFormNFKC:
+		return norm.NFKC.String(v)
+	case NormFormNFKD:
+		return norm.NFKD.String(v)
+	}
+	return v
+}
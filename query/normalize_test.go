@@ -0,0 +1,44 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package query
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	decomposed := "žluč"
+	composed := "žluč"
+	assert.Equal(t, composed, NormFormNFC.Normalize(decomposed))
+	assert.Equal(t, composed, NormFormNFC.Normalize(composed))
+	assert.Equal(t, decomposed, NormFormNFD.Normalize(composed))
+	assert.Equal(t, decomposed, NormFormNone.Normalize(decomposed))
+	assert.Equal(t, decomposed, NormForm("").Normalize(decomposed))
+	assert.Equal(t, "fi", NormFormNFKC.Normalize("ﬁ"))
+	assert.Equal(t, "ﬁ", NormFormNFC.Normalize("ﬁ"))
+}
+
+func TestNormFormValidate(t *testing.T) {
+	assert.NoError(t, NormFormNFC.Validate())
+	assert.NoError(t, NormFormNone.Validate())
+	assert.Error(t, NormForm("nfc").Validate())
+	assert.Error(t, NormForm("").Validate())
+}
@@ -25,21 +25,39 @@ import (
 	"strings"
 
 	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query"
+	"github.com/czcorpus/mquery-sru/query/compiler"
+)
+
+var (
+	ErrMissingNOTOperand = errors.New(
+		"NOT requires a preceding search term (e.g. `cat NOT dog`)")
 )
 
 type Query struct {
 	binaryOperatorQuery *binaryOperatorQuery
+	sortBy              bool
 	structureMapping    corpus.StructureMapping
 	posAttrs            []corpus.PosAttr
+	foldTerms           bool
+	normForm            query.NormForm
+	within              string
 	errors              []error
 }
 
+// WithinStruct returns a structure a `within` context (e.g. `sentence`, `p`)
+// is mapped to by the structure mapping. For unknown contexts and for
+// contexts not mapped in the resource, an empty string is returned.
+func WithinStruct(smapping corpus.StructureMapping, within string) string {
+	return smapping.Struct(within)
+}
+
 func (q *Query) getDefaultAttrsExp(word string, negated bool) string {
 	var ans strings.Builder
 	if negated {
-		for i, p := range q.posAttrs {
+		for _, p := range q.posAttrs {
 			if p.IsBasicSearchAttr {
-				if i > 0 {
+				if ans.Len() > 0 {
 					ans.WriteString(fmt.Sprintf(` & %s!="%s"`, p.Name, word))
 
 				} else {
@@ -49,9 +67,9 @@ func (q *Query) getDefaultAttrsExp(word string, negated bool) string {
 		}
 
 	} else {
-		for i, p := range q.posAttrs {
+		for _, p := range q.posAttrs {
 			if p.IsBasicSearchAttr {
-				if i > 0 {
+				if ans.Len() > 0 {
 					ans.WriteString(fmt.Sprintf(` | %s="%s"`, p.Name, word))
 
 				} else {
@@ -63,6 +81,21 @@ func (q *Query) getDefaultAttrsExp(word string, negated bool) string {
 	return "[" + ans.String() + "]"
 }
 
+// singleBasicSearchAttr returns the positional attribute searched
+// by terms in case there is exactly one such attribute
+func (q *Query) singleBasicSearchAttr() (string, bool) {
+	var ans string
+	for _, p := range q.posAttrs {
+		if p.IsBasicSearchAttr {
+			if ans != "" {
+				return "", false
+			}
+			ans = p.Name
+		}
+	}
+	return ans, ans != ""
+}
+
 func (q *Query) SetStructureMapping(m corpus.StructureMapping) *Query {
 	q.structureMapping = m
 	return q
@@ -73,22 +106,43 @@ func (q *Query) SetPosAttrs(attrs []corpus.PosAttr) *Query {
 	return q
 }
 
+// SetFoldTerms enables folding (lowercasing and removing diacritics)
+// of searched words. This is intended for searching in diacritics-folded
+// attributes (see query.FoldTerm).
+func (q *Query) SetFoldTerms(v bool) *Query {
+	q.foldTerms = v
+	return q
+}
+
+// SetWithin limits the whole query to a structure specified
+// by a context name (e.g. `sentence`, `p`; see TranslateWithinCtx).
+// An empty value means no limitation.
+func (q *Query) SetWithin(v string) *Query {
+	q.within = v
+	return q
+}
+
+// SetNormForm sets a Unicode normalization form searched
+// words are transformed to (see query.NormForm)
+func (q *Query) SetNormForm(v query.NormForm) *Query {
+	q.normForm = v
+	return q
+}
+
+// NormalizeTerm transforms a searched word into
+// the configured Unicode normalization form
+func (q *Query) NormalizeTerm(v string) string {
+	return q.normForm.Normalize(v)
+}
+
+// TranslateWithinCtx transforms a `within` context (e.g. `sentence`, `p`)
+// into a corpus structure based on the resource's structure mapping
 func (q *Query) TranslateWithinCtx(v string) string {
-	switch v {
-	case "sentence", "s":
-		return q.structureMapping.SentenceStruct
-	case "utterance", "u":
-		return q.structureMapping.UtteranceStruct
-	case "paragraph", "p":
-		return q.structureMapping.ParagraphStruct
-	case "turn", "t":
-		return q.structureMapping.TurnStruct
-	case "text":
-		return q.structureMapping.TextStruct
-	case "session":
-		return q.structureMapping.SessionStruct
+	ans := q.structureMapping.Struct(v)
+	if ans == "" {
+		q.AddError(compiler.UnsupportedWithinError{Context: v})
 	}
-	return "??"
+	return ans
 }
 
 func (q *Query) TranslatePosAttr(qualifier, name string) string {
@@ -106,7 +160,7 @@ func (q *Query) TranslatePosAttr(qualifier, name string) string {
 			}
 		}
 	}
-	q.AddError(fmt.Errorf("unknown attribute and/or layer %s:%s", qualifier, name))
+	q.AddError(compiler.UnsupportedIndexError{Qualifier: qualifier, Layer: name})
 	return ""
 }
 
@@ -119,7 +173,13 @@ func (q *Query) Errors() []error {
 }
 
 func (q *Query) Generate() string {
-	return q.binaryOperatorQuery.Generate(q, false)
+	q.errors = make([]error, 0, 20)
+	ans := q.binaryOperatorQuery.Generate(q, false)
+	if q.within != "" {
+		structName := q.TranslateWithinCtx(q.within)
+		return fmt.Sprintf("%s within <%s />", ans, structName)
+	}
+	return ans
 }
 
 // -----
@@ -138,46 +198,176 @@ func (boq *binaryOperatorQuery) AddRest(op string, nrq *nonRecursiveQuery) {
 	boq.rest = append(boq.rest, &binaryOperatorQueryRest{operation: op, nonRecursiveQuery: nrq})
 }
 
-func (boq *binaryOperatorQuery) operatorAt(idx int) string {
-	if idx < len(boq.rest) {
-		return boq.rest[idx].operation
-	}
-	return ""
+// operatorPrecedence defines how tightly the binary operators bind
+// their operands - the higher the value, the tighter the binding
+// (PROX > NOT > AND > OR). Operators of the same precedence are
+// left-associative. E.g. `a AND b OR c` is evaluated as `(a AND b) OR c`,
+// `a OR b AND c` as `a OR (b AND c)` and `a AND b NOT c` as `a AND (b NOT c)`.
+// Parentheses can be used to override the order.
+var operatorPrecedence = map[string]int{
+	"OR":   1,
+	"AND":  2,
+	"NOT":  3,
+	"PROX": 4,
 }
 
-func (boq *binaryOperatorQuery) Generate(ast *Query, isNegated bool) string {
-	var rest strings.Builder
-	for _, v := range boq.rest {
-		rest.WriteString(" " + v.nonRecursiveQuery.Generate(ast))
+// operatorTree is a binary tree created from a flat sequence
+// of operands and operators according to operatorPrecedence.
+// Leaves contain just an operand.
+type operatorTree struct {
+	operation string
+	operand   *nonRecursiveQuery
+	left      *operatorTree
+	right     *operatorTree
+}
+
+func (ot *operatorTree) Generate(ast *Query) string {
+	if ot.operand != nil {
+		return ot.operand.Generate(ast)
 	}
-	if boq.operatorAt(0) == "AND" {
+	left := ot.left.Generate(ast)
+	right := " " + ot.right.Generate(ast)
+	switch ot.operation {
+	case "AND":
 		return fmt.Sprintf(
 			"((%s within ([]{0,10} %s []{0,10} within <%s />)) | (%s within ([]{0,10} %s []{0,10} within <%s />)))",
-			boq.nonRecursiveQuery.Generate(ast),
-			rest.String(),
+			left,
+			right,
 			ast.structureMapping.SentenceStruct,
-			rest.String(),
-			boq.nonRecursiveQuery.Generate(ast),
+			right,
+			left,
 			ast.structureMapping.SentenceStruct,
 		)
-
-	} else if boq.operatorAt(0) == "OR" {
+	case "NOT":
+		// `A NOT B` means "A but not B", i.e. A which is not found
+		// near B (using the same context as in case of AND)
 		return fmt.Sprintf(
-			"(%s | %s)",
-			boq.nonRecursiveQuery.Generate(ast),
-			rest.String(),
+			"(%s !within ([]{0,10} %s []{0,10} within <%s />))",
+			left,
+			right,
+			ast.structureMapping.SentenceStruct,
 		)
+	case "OR":
+		if attr, ok := ast.singleBasicSearchAttr(); ok {
+			if values, ok := ot.simpleTermValues(ast); ok {
+				// a single token regex is much more efficient than a union
+				return fmt.Sprintf(`[%s="%s"]`, attr, strings.Join(values, "|"))
+			}
+		}
+		return fmt.Sprintf("(%s | %s)", left, right)
+	default:
+		ast.AddError(compiler.UnsupportedFeatureError{Feature: ot.operation})
+		return fmt.Sprintf("(?? %s %s)", left, right)
+	}
+}
 
-	} else if len(boq.rest) == 0 {
-		return boq.nonRecursiveQuery.Generate(ast)
+// simpleTermValues returns searched values (regexps) of terms
+// in case the tree is a simple term (i.e. a single word) or an OR
+// of simple terms (including parenthesized ones). Otherwise,
+// false is returned.
+func (ot *operatorTree) simpleTermValues(ast *Query) ([]string, bool) {
+	if ot.operand != nil {
+		return ot.operand.simpleTermValues(ast)
+	}
+	if ot.operation != "OR" {
+		return nil, false
+	}
+	left, ok := ot.left.simpleTermValues(ast)
+	if !ok {
+		return nil, false
+	}
+	right, ok := ot.right.simpleTermValues(ast)
+	if !ok {
+		return nil, false
+	}
+	return append(left, right...), true
+}
 
-	} else {
-		return fmt.Sprintf(
-			"(?? %s %s)",
-			boq.nonRecursiveQuery.Generate(ast),
-			rest.String(),
-		)
+// operatorTree creates a tree of operations respecting
+// the precedence of operators (see operatorPrecedence).
+func (boq *binaryOperatorQuery) operatorTree() *operatorTree {
+	operandAt := func(idx int) *nonRecursiveQuery {
+		if idx == 0 {
+			return boq.nonRecursiveQuery
+		}
+		return boq.rest[idx-1].nonRecursiveQuery
+	}
+	var next int
+	var climb func(minPrec int) *operatorTree
+	climb = func(minPrec int) *operatorTree {
+		ans := &operatorTree{operand: operandAt(next)}
+		for next < len(boq.rest) && operatorPrecedence[boq.rest[next].operation] >= minPrec {
+			op := boq.rest[next].operation
+			next++
+			ans = &operatorTree{
+				operation: op,
+				left:      ans,
+				right:     climb(operatorPrecedence[op] + 1),
+			}
+		}
+		return ans
 	}
+	return climb(0)
+}
+
+func (boq *binaryOperatorQuery) Generate(ast *Query, isNegated bool) string {
+	return boq.operatorTree().Generate(ast)
+}
+
+// checkNegations makes sure that NOT is always used as a binary
+// operator (i.e. there is a left operand), including nested
+// (parenthesized) queries.
+func (boq *binaryOperatorQuery) checkNegations() error {
+	if boq.nonRecursiveQuery.termNegation {
+		return ErrMissingNOTOperand
+	}
+	items := make([]*nonRecursiveQuery, 0, len(boq.rest)+1)
+	items = append(items, boq.nonRecursiveQuery)
+	for _, v := range boq.rest {
+		items = append(items, v.nonRecursiveQuery)
+	}
+	for _, item := range items {
+		if item.parenthesisExpr != nil {
+			if err := item.parenthesisExpr.binaryOperatorQuery.checkNegations(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkFeatures makes sure the query does not use CQL features
+// we are not able to translate (PROX operator, search clauses
+// with an explicit index, sorting).
+func (q *Query) checkFeatures() error {
+	if q.sortBy {
+		return compiler.UnsupportedFeatureError{Feature: "sortby"}
+	}
+	return q.binaryOperatorQuery.checkFeatures()
+}
+
+func (boq *binaryOperatorQuery) checkFeatures() error {
+	items := make([]*nonRecursiveQuery, 0, len(boq.rest)+1)
+	items = append(items, boq.nonRecursiveQuery)
+	for _, v := range boq.rest {
+		if v.operation == "PROX" {
+			return compiler.UnsupportedFeatureError{Feature: "PROX"}
+		}
+		items = append(items, v.nonRecursiveQuery)
+	}
+	for _, item := range items {
+		if item.searchClauseIndex != "" {
+			return compiler.UnsupportedFeatureError{
+				Feature: fmt.Sprintf("index in search clause (%s)", item.searchClauseIndex),
+			}
+		}
+		if item.parenthesisExpr != nil {
+			if err := item.parenthesisExpr.binaryOperatorQuery.checkFeatures(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 // ----
@@ -186,6 +376,32 @@ type nonRecursiveQuery struct {
 	parenthesisExpr *parenthesisExpr
 	term            *term
 	termNegation    bool
+
+	// searchClauseIndex is an index explicitly specified in a search
+	// clause (e.g. `title` in `title = dog`). This is not supported
+	// (see checkFeatures).
+	searchClauseIndex string
+}
+
+func (nrq *nonRecursiveQuery) simpleTermValues(ast *Query) ([]string, bool) {
+	if nrq.parenthesisExpr != nil {
+		return nrq.parenthesisExpr.binaryOperatorQuery.operatorTree().simpleTermValues(ast)
+	}
+	if nrq.term == nil || nrq.termNegation {
+		return nil, false
+	}
+	var w *word
+	if nrq.term.text != nil {
+		w = nrq.term.text.word
+
+	} else if nrq.term.quotedText != nil && len(nrq.term.quotedText.words) == 1 {
+		w = nrq.term.quotedText.words[0]
+	}
+	// note: words with trailing punctuation produce multiple tokens
+	if w == nil || len(w.splitTrailingPunct()) > 1 {
+		return nil, false
+	}
+	return []string{w.Generate(ast)}, true
 }
 
 func (nrq *nonRecursiveQuery) Generate(ast *Query) string {
@@ -237,12 +453,17 @@ type quotedText struct {
 	words []*word
 }
 
+// Generate creates a sequence of tokens (one per word). As corpora
+// typically have punctuation tokenized separately, trailing punctuation
+// of words (e.g. `York,`) produces an additional token.
 func (qt *quotedText) Generate(ast *Query, negated bool) string {
-	var ans strings.Builder
+	tokens := make([]string, 0, len(qt.words))
 	for _, v := range qt.words {
-		ans.WriteString(" " + ast.getDefaultAttrsExp(v.Generate(ast), negated))
+		for _, w := range v.splitTrailingPunct() {
+			tokens = append(tokens, ast.getDefaultAttrsExp(w.Generate(ast), negated))
+		}
 	}
-	return ans.String()
+	return strings.Join(tokens, " ")
 }
 
 func (qt *quotedText) AddWord(w *word) {
@@ -265,13 +486,75 @@ type word struct {
 	value string
 }
 
-func (w *word) Generate(ast *Query) string {
+// splitTrailingPunct splits trailing punctuation (`,;:?!` and also `.`
+// in case it is the only dot in the word - to keep e.g. abbreviations
+// like `U.S.` untouched) from the word.
+func (w *word) splitTrailingPunct() []*word {
+	v := w.value
+	var punct []*word
+	for len(v) > 1 {
+		last := v[len(v)-1]
+		if strings.IndexByte(",;:?!", last) >= 0 ||
+			last == '.' && strings.Count(v, ".") == 1 {
+			punct = append([]*word{{value: string(last)}}, punct...)
+			v = v[:len(v)-1]
+
+		} else {
+			break
+		}
+	}
+	if len(punct) == 0 {
+		return []*word{w}
+	}
+	return append([]*word{{value: v}}, punct...)
+}
+
+// anchors strips a leading `^` and a trailing `$` from the word
+// and reports which of them were present. A word consisting only
+// of an anchor character (plus possibly the other one) is taken
+// literally.
+func (w *word) anchors() (string, bool, bool) {
 	tmp := w.value
+	var atStart, atEnd bool
+	if len(tmp) > 1 && strings.HasPrefix(tmp, "^") {
+		tmp = tmp[1:]
+		atStart = true
+	}
+	if len(tmp) > 1 && strings.HasSuffix(tmp, "$") {
+		tmp = tmp[:len(tmp)-1]
+		atEnd = true
+	}
+	if tmp == "$" && atStart {
+		return w.value, false, false
+	}
+	return tmp, atStart, atEnd
+}
+
+// Generate produces an escaped regexp value for the word. A leading `^`
+// and/or a trailing `$` act as word-start/word-end anchors. As Manatee
+// matches attribute values as a whole, an anchor on one side only
+// leaves the other side open (`^pre` matches any word starting with
+// "pre"). Anchor characters appearing elsewhere are taken literally.
+func (w *word) Generate(ast *Query) string {
+	tmp, atStart, atEnd := w.anchors()
+	if ast.foldTerms {
+		tmp = query.FoldTerm(tmp)
+	}
+	tmp = ast.NormalizeTerm(tmp)
 	cqlEscapeChar := []string{"\"", "\\"}
 	for _, v := range cqlEscapeChar {
 		tmp = strings.ReplaceAll(tmp, v, "\\"+v)
 	}
-	return regexp.QuoteMeta(tmp)
+	tmp = regexp.QuoteMeta(tmp)
+	switch {
+	case atStart && atEnd:
+		return "^" + tmp + "$"
+	case atStart:
+		return "^" + tmp + ".*"
+	case atEnd:
+		return ".*" + tmp + "$"
+	}
+	return tmp
 }
 
 // -----
@@ -19,9 +19,14 @@
 package basic
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query"
+	"github.com/czcorpus/mquery-sru/query/compiler"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -45,3 +50,328 @@ func TestBasicParser(t *testing.T) {
 
 	}
 }
+
+func parseWithWordAttr(t *testing.T, q string) string {
+	ast, err := ParseQuery(
+		q,
+		[]corpus.PosAttr{
+			{Name: "word", Layer: corpus.LayerTypeText, IsBasicSearchAttr: true, IsLayerDefault: true},
+			{Name: "tag", Layer: corpus.LayerTypePOS, IsLayerDefault: true},
+		},
+		corpus.StructureMapping{SentenceStruct: "s"},
+	)
+	assert.NoError(t, err)
+	return ast.Generate()
+}
+
+func TestSingleWordTerm(t *testing.T) {
+	assert.Equal(t, `[word="cat"]`, parseWithWordAttr(t, `cat`))
+	assert.Equal(t, `[word="cat"]`, parseWithWordAttr(t, `"cat"`))
+}
+
+func TestTwoWordPhrase(t *testing.T) {
+	assert.Equal(t, `[word="New"] [word="York"]`, parseWithWordAttr(t, `"New York"`))
+}
+
+func TestThreeWordPhraseWithPunctuation(t *testing.T) {
+	assert.Equal(
+		t,
+		`[word="New"] [word="York"] [word=","] [word="NY"]`,
+		parseWithWordAttr(t, `"New York, NY"`),
+	)
+	assert.Equal(
+		t,
+		`[word="he"] [word="said"] [word="U\.S\."]`,
+		parseWithWordAttr(t, `"he said U.S."`),
+	)
+}
+
+func TestBinaryNot(t *testing.T) {
+	assert.Equal(
+		t,
+		`([word="cat"] !within ([]{0,10}  [word="dog"] []{0,10} within <s />))`,
+		parseWithWordAttr(t, `"cat" NOT "dog"`),
+	)
+	assert.Equal(
+		t,
+		`([word="cat"] !within ([]{0,10}  [word="dog|mouse"] []{0,10} within <s />))`,
+		parseWithWordAttr(t, `cat NOT (dog OR mouse)`),
+	)
+}
+
+func TestOperatorPrecedence(t *testing.T) {
+	and := func(a, b string) string {
+		return fmt.Sprintf(
+			"((%s within ([]{0,10}  %s []{0,10} within <s />)) | ( %s within ([]{0,10} %s []{0,10} within <s />)))",
+			a, b, b, a,
+		)
+	}
+	not := func(a, b string) string {
+		return fmt.Sprintf("(%s !within ([]{0,10}  %s []{0,10} within <s />))", a, b)
+	}
+	or := func(a, b string) string {
+		return fmt.Sprintf("(%s |  %s)", a, b)
+	}
+	// note: with multiple search attributes, OR is always
+	// translated as a union (see TestOrOfSimpleTerms)
+	parse := func(q string) string {
+		ast, err := ParseQuery(
+			q,
+			[]corpus.PosAttr{
+				{Name: "word", IsBasicSearchAttr: true},
+				{Name: "lemma", IsBasicSearchAttr: true},
+			},
+			corpus.StructureMapping{SentenceStruct: "s"},
+		)
+		assert.NoError(t, err)
+		return ast.Generate()
+	}
+	a, b, c := `[word="a" | lemma="a"]`, `[word="b" | lemma="b"]`, `[word="c" | lemma="c"]`
+
+	assert.Equal(t, or(and(a, b), c), parse(`a AND b OR c`))
+	assert.Equal(t, or(a, and(b, c)), parse(`a OR b AND c`))
+	assert.Equal(t, and(a, or(b, c)), parse(`a AND (b OR c)`))
+	assert.Equal(t, and(or(a, b), c), parse(`(a OR b) AND c`))
+	assert.Equal(t, and(a, not(b, c)), parse(`a AND b NOT c`))
+	assert.Equal(t, or(not(a, b), c), parse(`a NOT b OR c`))
+	assert.Equal(t, or(or(a, b), c), parse(`a OR b OR c`))
+	assert.Equal(t, and(and(a, b), c), parse(`a AND b AND c`))
+}
+
+func TestOrOfSimpleTerms(t *testing.T) {
+	assert.Equal(t, `[word="cat|dog"]`, parseWithWordAttr(t, `"cat" OR "dog"`))
+	assert.Equal(t, `[word="cat|dog|mouse"]`, parseWithWordAttr(t, `cat OR dog OR mouse`))
+	assert.Equal(t, `[word="cat|dog|mouse"]`, parseWithWordAttr(t, `cat OR (dog OR mouse)`))
+	assert.Equal(t, `[word="^pre.*|U\.S\."]`, parseWithWordAttr(t, `^pre OR U.S.`))
+	assert.Equal(t, `[word="a\|b|c"]`, parseWithWordAttr(t, `a|b OR c`))
+
+	// complex operands
+	assert.Equal(
+		t,
+		`([word="grumpy"] [word="cat"] |  [word="dog"])`,
+		parseWithWordAttr(t, `"grumpy cat" OR dog`),
+	)
+	assert.Equal(
+		t,
+		`([word="cat"] |  [word="dog"] [word=","])`,
+		parseWithWordAttr(t, `cat OR "dog,"`),
+	)
+	assert.Equal(
+		t,
+		`([word="cat"] |  (([word="dog"] within ([]{0,10}  [word="mouse"] []{0,10} within <s />)) | `+
+			`( [word="mouse"] within ([]{0,10} [word="dog"] []{0,10} within <s />))))`,
+		parseWithWordAttr(t, `cat OR (dog AND mouse)`),
+	)
+
+	// multiple search attributes
+	ast, err := ParseQuery(
+		`cat OR dog`,
+		[]corpus.PosAttr{
+			{Name: "word", IsBasicSearchAttr: true},
+			{Name: "lemma", IsBasicSearchAttr: true},
+		},
+		corpus.StructureMapping{SentenceStruct: "s"},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, `([word="cat" | lemma="cat"] |  [word="dog" | lemma="dog"])`, ast.Generate())
+}
+
+func TestLeadingNotIsRejected(t *testing.T) {
+	for _, q := range []string{`NOT dog`, `NOT "dog" AND cat`, `cat AND (NOT dog)`} {
+		_, err := ParseQuery(
+			q,
+			[]corpus.PosAttr{{Name: "word", Layer: corpus.LayerTypeText, IsBasicSearchAttr: true, IsLayerDefault: true}},
+			corpus.StructureMapping{SentenceStruct: "s"},
+		)
+		assert.ErrorIs(t, err, ErrMissingNOTOperand, q)
+	}
+}
+
+func TestFoldedTerms(t *testing.T) {
+	ast, err := ParseQuery(
+		`"Žluťoučký kůň" OR Café`,
+		[]corpus.PosAttr{{Name: "word_folded", IsBasicSearchAttr: true}},
+		corpus.StructureMapping{SentenceStruct: "s"},
+	)
+	assert.NoError(t, err)
+	ast.SetFoldTerms(true)
+	assert.Equal(
+		t,
+		`([word_folded="zlutoucky"] [word_folded="kun"] |  [word_folded="cafe"])`,
+		ast.Generate(),
+	)
+}
+
+func TestNormalizedTerms(t *testing.T) {
+	decomposed := "kůň" // NFD form of "kůň"
+	ast, err := ParseQuery(
+		decomposed,
+		[]corpus.PosAttr{{Name: "word", IsBasicSearchAttr: true}},
+		corpus.StructureMapping{SentenceStruct: "s"},
+	)
+	assert.NoError(t, err)
+	ast.SetNormForm(query.NormFormNFC)
+	assert.Equal(t, `[word="kůň"]`, ast.Generate())
+
+	ast.SetNormForm(query.NormFormNone)
+	assert.Equal(t, `[word="kůň"]`, ast.Generate())
+}
+
+func TestAnchoredTerms(t *testing.T) {
+	assert.Equal(t, `[word="^pre.*"]`, parseWithWordAttr(t, `^pre`))
+	assert.Equal(t, `[word=".*ing$"]`, parseWithWordAttr(t, `ing$`))
+	assert.Equal(t, `[word="^cat$"]`, parseWithWordAttr(t, `^cat$`))
+	assert.Equal(
+		t,
+		`[word="^New.*"] [word=".*York$"]`,
+		parseWithWordAttr(t, `"^New York$"`),
+	)
+	assert.Equal(t, `[word=".*dog$"] [word=","]`, parseWithWordAttr(t, `"dog$,"`))
+}
+
+func TestLiteralAnchorChars(t *testing.T) {
+	assert.Equal(t, `[word="a\^b\$c"]`, parseWithWordAttr(t, `a^b$c`))
+	assert.Equal(t, `[word="\^"]`, parseWithWordAttr(t, `^`))
+	assert.Equal(t, `[word="\$"]`, parseWithWordAttr(t, `$`))
+	assert.Equal(t, `[word="\^\$"]`, parseWithWordAttr(t, `^$`))
+}
+
+func TestAnchorsAreNotWildcards(t *testing.T) {
+	// truncation characters are still taken literally
+	assert.Equal(t, `[word="pre\*"]`, parseWithWordAttr(t, `pre*`))
+	assert.Equal(t, `[word="^pre\*.*"]`, parseWithWordAttr(t, `^pre*`))
+}
+
+func TestParseQueryWorkIsLimited(t *testing.T) {
+	_, err := ParseQuery(
+		strings.Repeat("cat AND ", 200000)+"dog",
+		[]corpus.PosAttr{{Name: "word", Layer: corpus.LayerTypeText, IsBasicSearchAttr: true, IsLayerDefault: true}},
+		corpus.StructureMapping{},
+	)
+	assert.Error(t, err)
+}
+
+// FuzzParseQuery makes sure the parser always terminates
+// without panicking and that a successfully parsed query
+// can be translated to CQL.
+func FuzzParseQuery(f *testing.F) {
+	for _, q := range []string{
+		`cat`,
+		`"grumpy cat" AND dog`,
+		`cat AND (mouse OR "lazy dog")`,
+		`"New York, NY"`,
+		`"he said U.S."`,
+		`""`,
+		`"`,
+		`(((`,
+		`cat NOT`,
+		`a\"b`,
+	} {
+		f.Add(q)
+	}
+	posAttrs := []corpus.PosAttr{
+		{Name: "word", Layer: corpus.LayerTypeText, IsBasicSearchAttr: true, IsLayerDefault: true},
+	}
+	f.Fuzz(func(t *testing.T, q string) {
+		ast, err := ParseQuery(q, posAttrs, corpus.StructureMapping{SentenceStruct: "s"})
+		if err == nil {
+			ast.Generate()
+		}
+	})
+}
+
+func TestReconfiguredQueryGeneratesForEachResource(t *testing.T) {
+	ast, err := ParseQuery(
+		`cat`,
+		[]corpus.PosAttr{{Name: "word", IsBasicSearchAttr: true}},
+		corpus.StructureMapping{SentenceStruct: "s"},
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, `[word="cat"]`, ast.Generate())
+	ast.SetPosAttrs([]corpus.PosAttr{{Name: "lemma", IsBasicSearchAttr: true}})
+	assert.Equal(t, `[lemma="cat"]`, ast.Generate())
+	assert.Empty(t, ast.Errors())
+}
+
+func TestWithinStructure(t *testing.T) {
+	smapping := corpus.StructureMapping{SentenceStruct: "s", ParagraphStruct: "p"}
+	ast, err := ParseQuery(
+		`"New York"`,
+		[]corpus.PosAttr{{Name: "word", IsBasicSearchAttr: true}},
+		smapping,
+	)
+	assert.NoError(t, err)
+	ast.SetWithin("sentence")
+	assert.Equal(t, `[word="New"] [word="York"] within <s />`, ast.Generate())
+	ast.SetWithin("p")
+	assert.Equal(t, `[word="New"] [word="York"] within <p />`, ast.Generate())
+	assert.Empty(t, ast.Errors())
+
+	ast, err = ParseQuery(
+		`cat OR dog`,
+		[]corpus.PosAttr{{Name: "word", IsBasicSearchAttr: true}},
+		smapping,
+	)
+	assert.NoError(t, err)
+	ast.SetWithin("paragraph")
+	assert.Equal(t, `[word="cat|dog"] within <p />`, ast.Generate())
+}
+
+func TestWithinUnavailableStructure(t *testing.T) {
+	ast, err := ParseQuery(
+		`cat`,
+		[]corpus.PosAttr{{Name: "word", IsBasicSearchAttr: true}},
+		corpus.StructureMapping{SentenceStruct: "s"},
+	)
+	assert.NoError(t, err)
+	ast.SetWithin("utterance")
+	ast.Generate()
+	if assert.Len(t, ast.Errors(), 1) {
+		var withinErr compiler.UnsupportedWithinError
+		assert.True(t, errors.As(ast.Errors()[0], &withinErr))
+		assert.Equal(t, "utterance", withinErr.Context)
+	}
+}
+
+func TestWithinStruct(t *testing.T) {
+	smapping := corpus.StructureMapping{SentenceStruct: "s", ParagraphStruct: "p"}
+	assert.Equal(t, "s", WithinStruct(smapping, "sentence"))
+	assert.Equal(t, "s", WithinStruct(smapping, "s"))
+	assert.Equal(t, "p", WithinStruct(smapping, "paragraph"))
+	assert.Equal(t, "", WithinStruct(smapping, "turn"))
+	assert.Equal(t, "", WithinStruct(smapping, "chapter"))
+}
+
+func TestUnsupportedFeatures(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{Name: "word", Layer: corpus.LayerTypeText, IsBasicSearchAttr: true, IsLayerDefault: true},
+	}
+	for q, feature := range map[string]string{
+		`cat PROX dog`:                 "PROX",
+		`cat AND (mouse PROX dog)`:     "PROX",
+		`title = dog`:                  "index in search clause (title)",
+		`cat OR dc.title any "a dog"`:  "index in search clause (dc.title)",
+		`cat AND (title <> dog)`:       "index in search clause (title)",
+		`cat sortby title`:             "sortby",
+		`"grumpy cat" sortby title id`: "sortby",
+	} {
+		_, err := ParseQuery(q, posAttrs, corpus.StructureMapping{SentenceStruct: "s"})
+		var featErr compiler.UnsupportedFeatureError
+		if assert.ErrorAs(t, err, &featErr, q) {
+			assert.Equal(t, feature, featErr.Feature, q)
+		}
+	}
+}
+
+func TestSupportedLookalikes(t *testing.T) {
+	for q, expected := range map[string]string{
+		`title=dog`:     `[word="title=dog"]`,
+		`anyway`:        `[word="anyway"]`,
+		`"cat = dog"`:   `[word="cat"] [word="="] [word="dog"]`,
+		`sortby`:        `[word="sortby"]`,
+		`PROXIMITY`:     `[word="PROXIMITY"]`,
+		`cat OR sortby`: `[word="cat|sortby"]`,
+	} {
+		assert.Equal(t, expected, parseWithWordAttr(t, q), q)
+	}
+}
@@ -24,6 +24,11 @@ import (
 	"github.com/czcorpus/mquery-sru/corpus"
 )
 
+// maxParsedExpressions limits the work the parser can do
+// with a single query so no input can make it run (almost)
+// indefinitely. Normal queries need orders of magnitude less.
+const maxParsedExpressions = 1000000
+
 // ParseQuery parses FCS-QL and returns an abstract syntax
 // tree which can be used to generate CQL.
 func ParseQuery(
@@ -31,7 +36,7 @@ func ParseQuery(
 	posAttrs []corpus.PosAttr,
 	smapping corpus.StructureMapping,
 ) (*Query, error) {
-	ans, err := Parse("query", []byte(q)) // Debug(true))
+	ans, err := Parse("query", []byte(q), MaxExpressions(maxParsedExpressions)) // Debug(true))
 	if err != nil {
 		return nil, err
 	}
@@ -39,6 +44,12 @@ func ParseQuery(
 	if !ok {
 		return nil, fmt.Errorf("invalid AST type produced by parser")
 	}
+	if err := tAns.binaryOperatorQuery.checkNegations(); err != nil {
+		return nil, err
+	}
+	if err := tAns.checkFeatures(); err != nil {
+		return nil, err
+	}
 	tAns.
 		SetStructureMapping(smapping).
 		SetPosAttrs(posAttrs)
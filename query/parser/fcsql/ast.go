@@ -23,6 +23,7 @@ import (
 	"strings"
 
 	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query"
 	"github.com/czcorpus/mquery-sru/query/compiler"
 
 	"github.com/rs/zerolog/log"
@@ -38,6 +39,26 @@ const (
 	basicExpressionTypeAttrOpRegexp
 )
 
+// relations maps supported FCS-QL relations between an attribute
+// and a value to CQL. Other relations accepted by the parser
+// are reported as compiler.UnsupportedRelationError.
+var relations = map[string]relationMapping{
+	"=":   {cqlOperator: "="},
+	"!=":  {cqlOperator: "!="},
+	"==":  {cqlOperator: "=", literal: true},
+	"!==": {cqlOperator: "!=", literal: true},
+}
+
+// relationMapping describes how an FCS-QL relation
+// is expressed in CQL
+type relationMapping struct {
+	cqlOperator string
+
+	// literal specifies whether the value is matched as a plain
+	// string (i.e. with regular expression characters escaped)
+	literal bool
+}
+
 type mainQueryOp int
 
 type beType int
@@ -49,6 +70,7 @@ type Query struct {
 	within           *withinPart
 	structureMapping corpus.StructureMapping
 	posAttrs         []corpus.PosAttr
+	normForm         query.NormForm
 	errors           []error
 }
 
@@ -62,22 +84,27 @@ func (q *Query) SetPosAttrs(attrs []corpus.PosAttr) *Query {
 	return q
 }
 
+// SetNormForm sets a Unicode normalization form searched
+// values are transformed to (see query.NormForm)
+func (q *Query) SetNormForm(v query.NormForm) *Query {
+	q.normForm = v
+	return q
+}
+
+// NormalizeTerm transforms a searched value into
+// the configured Unicode normalization form
+func (q *Query) NormalizeTerm(v string) string {
+	return q.normForm.Normalize(v)
+}
+
+// TranslateWithinCtx transforms a `within` context (e.g. `sentence`, `p`)
+// into a corpus structure based on the resource's structure mapping
 func (q *Query) TranslateWithinCtx(v string) string {
-	switch v {
-	case "sentence", "s":
-		return q.structureMapping.SentenceStruct
-	case "utterance", "u":
-		return q.structureMapping.UtteranceStruct
-	case "paragraph", "p":
-		return q.structureMapping.ParagraphStruct
-	case "turn", "t":
-		return q.structureMapping.TurnStruct
-	case "text":
-		return q.structureMapping.TextStruct
-	case "session":
-		return q.structureMapping.SessionStruct
+	ans := q.structureMapping.Struct(v)
+	if ans == "" {
+		q.AddError(compiler.UnsupportedWithinError{Context: v})
 	}
-	return "??"
+	return ans
 }
 
 // TranslatePosAttr transforms a FCS-QL attribute specifier (e.g. `text`, `p_tag:pos`)
@@ -98,7 +125,7 @@ func (q *Query) TranslatePosAttr(qualifier, name string) string {
 			}
 		}
 	}
-	q.AddError(fmt.Errorf("unknown attribute and/or layer %s:%s", qualifier, name))
+	q.AddError(compiler.UnsupportedIndexError{Qualifier: qualifier, Layer: name})
 	return ""
 }
 
@@ -176,8 +203,17 @@ func (be *basicExpression) Generate(ast compiler.AST) string {
 	case basicExpressionTypeNot:
 		return fmt.Sprintf("!%s", be.expression.Generate(ast))
 	case basicExpressionTypeAttrOpRegexp:
+		rel, ok := relations[be.operator]
+		if !ok {
+			ast.AddError(compiler.UnsupportedRelationError{Relation: be.operator})
+			return ""
+		}
+		if rel.literal {
+			return fmt.Sprintf(
+				"%s%s%s", be.attribute.Generate(ast), rel.cqlOperator, be.flaggedRegexp.GenerateLiteral(ast))
+		}
 		return fmt.Sprintf(
-			"%s%s%s", be.attribute.Generate(ast), be.operator, be.flaggedRegexp.Generate(ast))
+			"%s%s%s", be.attribute.Generate(ast), rel.cqlOperator, be.flaggedRegexp.Generate(ast))
 	default:
 		return "??"
 	}
@@ -185,31 +221,53 @@ func (be *basicExpression) Generate(ast compiler.AST) string {
 
 // ------
 
-type expressionTailItem struct {
-	operator string
-	value    *basicExpression
+// conjunction is a list of constraints
+// a single token must satisfy all at once
+type conjunction struct {
+	items []*basicExpression
+}
+
+func (c *conjunction) AddItem(value *basicExpression) {
+	c.items = append(c.items, value)
+}
+
+func (c *conjunction) Generate(ast compiler.AST) string {
+	ans := make([]string, len(c.items))
+	for i, item := range c.items {
+		ans[i] = item.Generate(ast)
+	}
+	return strings.Join(ans, " & ")
 }
 
+// expression is a disjunction of conjunctions
 type expression struct {
-	basicExpression *basicExpression
-	tailValues      []*expressionTailItem
+	conjunction *conjunction
+	tailValues  []*conjunction
 }
 
-func (e *expression) AddTailItem(operator string, value *basicExpression) {
-	e.tailValues = append(
-		e.tailValues,
-		&expressionTailItem{operator: operator, value: value},
-	)
+func (e *expression) AddTailItem(value *conjunction) {
+	e.tailValues = append(e.tailValues, value)
 }
 
 func (e *expression) Generate(ast compiler.AST) string {
 	if e == nil {
 		return ""
 	}
+	if len(e.tailValues) == 0 {
+		return e.conjunction.Generate(ast)
+	}
 	var ans strings.Builder
-	ans.WriteString(e.basicExpression.Generate(ast))
-	for _, te := range e.tailValues {
-		ans.WriteString(fmt.Sprintf(" %s %s", te.operator, te.value.Generate(ast)))
+	for i, c := range append([]*conjunction{e.conjunction}, e.tailValues...) {
+		if i > 0 {
+			ans.WriteString(" | ")
+		}
+		// make the precedence explicit in the generated CQL
+		if len(c.items) > 1 {
+			ans.WriteString(fmt.Sprintf("(%s)", c.Generate(ast)))
+
+		} else {
+			ans.WriteString(c.Generate(ast))
+		}
 	}
 	return ans.String()
 }
@@ -231,8 +289,8 @@ type regexp struct {
 	quotedString *quotedString
 }
 
-func (r *regexp) WithPrefix(p string) string {
-	return r.quotedString.WithPrefix(p)
+func (r *regexp) WithPrefix(ast compiler.AST, p string) string {
+	return r.quotedString.WithPrefix(ast, p)
 }
 
 func (r *regexp) Generate(ast compiler.AST) string {
@@ -246,7 +304,7 @@ type flaggedRegexp struct {
 	flags  []string
 }
 
-func (fr *flaggedRegexp) Generate(ast compiler.AST) string {
+func (fr *flaggedRegexp) flagPrefix() string {
 	// TODO add support for additional stuff besides case sensitivity
 	var flag string
 	for _, f := range fr.flags {
@@ -254,15 +312,26 @@ func (fr *flaggedRegexp) Generate(ast compiler.AST) string {
 			flag = "(?i)"
 
 		} else {
-			log.Warn().Str("flag", flag).Msg("requested unsupported regexp flag")
+			log.Warn().Str("flag", f).Msg("requested unsupported regexp flag")
 		}
 	}
-	if flag != "" {
-		return fr.regexp.WithPrefix(flag)
+	return flag
+}
+
+func (fr *flaggedRegexp) Generate(ast compiler.AST) string {
+	if flag := fr.flagPrefix(); flag != "" {
+		return fr.regexp.WithPrefix(ast, flag)
 	}
 	return fr.regexp.Generate(ast)
 }
 
+// GenerateLiteral generates a regular expression
+// matching exactly the (unescaped) value
+func (fr *flaggedRegexp) GenerateLiteral(ast compiler.AST) string {
+	return fmt.Sprintf(
+		`"%s%s"`, fr.flagPrefix(), escapeRegexp(ast.NormalizeTerm(fr.regexp.quotedString.RawValue())))
+}
+
 func (fr *flaggedRegexp) AttachUntypedFlag(v any) error {
 	vt, ok := v.(string)
 	if !ok {
@@ -354,19 +423,47 @@ type quotedString struct {
 
 func (qs *quotedString) Generate(ast compiler.AST) string {
 	if qs.regexp != "" {
-		return fmt.Sprintf(`"%s"`, qs.regexp)
+		return fmt.Sprintf(`"%s"`, ast.NormalizeTerm(qs.regexp))
 	}
-	return fmt.Sprintf(`"%s"`, qs.value)
+	return fmt.Sprintf(`"%s"`, ast.NormalizeTerm(qs.value))
+}
+
+func (qs *quotedString) WithPrefix(ast compiler.AST, p string) string {
+	return fmt.Sprintf(`"%s%s"`, p, ast.NormalizeTerm(qs.value))
 }
 
-func (qs *quotedString) WithPrefix(p string) string {
-	return fmt.Sprintf(`"%s%s"`, p, qs.value)
+// RawValue returns the string as written in the query
+func (qs *quotedString) RawValue() string {
+	if qs.regexp != "" {
+		return qs.regexp
+	}
+	return qs.value
 }
 
 func (qs *quotedString) Append(s string) {
 	qs.value = qs.value + s
 }
 
+// escapeRegexp escapes regular expression characters in v.
+// Characters already escaped in the query are kept as they are.
+func escapeRegexp(v string) string {
+	var ans strings.Builder
+	escaped := false
+	for _, c := range v {
+		if escaped {
+			escaped = false
+
+		} else if c == '\\' {
+			escaped = true
+
+		} else if strings.ContainsRune(`.^$*+?()[]{}|`, c) {
+			ans.WriteRune('\\')
+		}
+		ans.WriteRune(c)
+	}
+	return ans.String()
+}
+
 // -----
 
 func fromIdxOfUntypedSlice(arr any, idx int) any {
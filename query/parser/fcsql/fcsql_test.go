@@ -19,9 +19,13 @@
 package fcsql
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/query"
+	"github.com/czcorpus/mquery-sru/query/compiler"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -51,3 +55,189 @@ func TestFCSQLParser(t *testing.T) {
 
 	}
 }
+
+func TestSplitResourcePrefix(t *testing.T) {
+	pid, q := SplitResourcePrefix(`fcs.resource=corp1 AND [word="cat"]`)
+	assert.Equal(t, "corp1", pid)
+	assert.Equal(t, `[word="cat"]`, q)
+
+	pid, q = SplitResourcePrefix(` fcs.resource = "http://hdl.handle.net/11234/1-1"  AND "dog" "barks"`)
+	assert.Equal(t, "http://hdl.handle.net/11234/1-1", pid)
+	assert.Equal(t, `"dog" "barks"`, q)
+
+	pid, q = SplitResourcePrefix(`[word="fcs.resource"]`)
+	assert.Equal(t, "", pid)
+	assert.Equal(t, `[word="fcs.resource"]`, q)
+
+	pid, q = SplitResourcePrefix(`fcs.resource=corp1`)
+	assert.Equal(t, "", pid)
+	assert.Equal(t, `fcs.resource=corp1`, q)
+}
+
+func TestUnmappedLayerReportsUnsupportedIndex(t *testing.T) {
+	ast, err := ParseQuery(
+		`[lemma="walk"]`,
+		[]corpus.PosAttr{
+			{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true},
+		},
+		corpus.StructureMapping{},
+	)
+	assert.NoError(t, err)
+	ast.Generate()
+	assert.Len(t, ast.Errors(), 1)
+	var idxErr compiler.UnsupportedIndexError
+	assert.True(t, errors.As(ast.Errors()[0], &idxErr))
+	assert.Equal(t, "lemma", idxErr.Index())
+}
+
+func TestRelations(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true},
+		{Name: "lemma", Layer: corpus.LayerTypeLemma, IsLayerDefault: true},
+	}
+	cases := []struct {
+		query    string
+		expected string
+	}{
+		{`[lemma = "run.*"]`, `[lemma="run.*"]`},
+		{`[lemma != "run.*"]`, `[lemma!="run.*"]`},
+		{`[lemma == "run.*"]`, `[lemma="run\.\*"]`},
+		{`[lemma !== "run.*"]`, `[lemma!="run\.\*"]`},
+		{`[word == "Run" /c]`, `[word="(?i)Run"]`},
+		{`[word == "a\.b+"]`, `[word="a\.b\+"]`},
+		{`[word=="e-mail" & lemma="mail"]`, `[word="e-mail" & lemma="mail"]`},
+	}
+	for _, c := range cases {
+		ast, err := ParseQuery(c.query, posAttrs, corpus.StructureMapping{})
+		assert.NoError(t, err, c.query)
+		assert.Equal(t, c.expected, ast.Generate(), c.query)
+		assert.Empty(t, ast.Errors(), c.query)
+	}
+}
+
+func TestUnsupportedRelations(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true},
+	}
+	for _, rel := range []string{"<", ">", "<=", ">=", "contains"} {
+		q := fmt.Sprintf(`[word %s "run"]`, rel)
+		ast, err := ParseQuery(q, posAttrs, corpus.StructureMapping{})
+		assert.NoError(t, err, q)
+		ast.Generate()
+		assert.Len(t, ast.Errors(), 1, q)
+		var relErr compiler.UnsupportedRelationError
+		assert.True(t, errors.As(ast.Errors()[0], &relErr), q)
+		assert.Equal(t, rel, relErr.Relation, q)
+	}
+}
+
+func TestNormalizedTerms(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true},
+	}
+	decomposed := "kůň" // NFD form of "kůň"
+	for _, q := range []string{`"%s"`, `[word="%s"]`, `[word=="%s"]`, `"%s"/c`} {
+		ast, err := ParseQuery(fmt.Sprintf(q, decomposed), posAttrs, corpus.StructureMapping{})
+		assert.NoError(t, err, q)
+		ast.SetNormForm(query.NormFormNFC)
+		assert.Contains(t, ast.Generate(), "kůň", q)
+		assert.NotContains(t, ast.Generate(), decomposed, q)
+	}
+}
+
+func TestIntraTokenConjunction(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true},
+		{Name: "lemma", Layer: corpus.LayerTypeLemma, IsLayerDefault: true},
+		{Name: "tag", Layer: corpus.LayerTypePOS, IsLayerDefault: true},
+	}
+	cases := []struct {
+		query    string
+		expected string
+	}{
+		{`[word="run" & pos="V"]`, `[word="run" & tag="V"]`},
+		{`[word = "run"&pos = "V"]`, `[word="run" & tag="V"]`},
+		{`[word="run" & lemma="run" & pos="V.*"]`, `[word="run" & lemma="run" & tag="V.*"]`},
+		{`[word="run" & pos="V" | lemma="go"]`, `[(word="run" & tag="V") | lemma="go"]`},
+		{`[lemma="go" | word="run" & pos="V"]`, `[lemma="go" | (word="run" & tag="V")]`},
+		{`[word="run" & (pos="V" | pos="N")]`, `[word="run" & (tag="V" | tag="N")]`},
+		{`"ran" [word="fast" & pos="ADV"]`, `"ran" [word="fast" & tag="ADV"]`},
+	}
+	for _, c := range cases {
+		ast, err := ParseQuery(c.query, posAttrs, corpus.StructureMapping{})
+		assert.NoError(t, err, c.query)
+		assert.Equal(t, c.expected, ast.Generate(), c.query)
+		assert.Empty(t, ast.Errors(), c.query)
+	}
+}
+
+func TestIntraTokenConjunctionMismatchedLayers(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true},
+		{Name: "lemma", Layer: corpus.LayerTypeLemma, IsLayerDefault: true},
+		{Name: "tag", Layer: corpus.LayerTypePOS, IsLayerDefault: true},
+	}
+	cases := []struct {
+		query  string
+		layers []string
+	}{
+		{`[word="run" & orth="run"]`, []string{"orth"}},
+		{`[word="run" & lemma="run" & norm="run"]`, []string{"norm"}},
+		{`[x:pos="V" & tag:pos="V" & y:lemma="run"]`, []string{"x:pos", "y:lemma"}},
+	}
+	for _, c := range cases {
+		ast, err := ParseQuery(c.query, posAttrs, corpus.StructureMapping{})
+		if !assert.NoError(t, err, c.query) {
+			continue
+		}
+		ast.Generate()
+		if assert.Len(t, ast.Errors(), len(c.layers), c.query) {
+			for i, layer := range c.layers {
+				var idxErr compiler.UnsupportedIndexError
+				if assert.True(t, errors.As(ast.Errors()[i], &idxErr), c.query) {
+					assert.Equal(t, layer, idxErr.Index(), c.query)
+				}
+			}
+		}
+	}
+}
+
+func TestWithinNonDefaultStructures(t *testing.T) {
+	posAttrs := []corpus.PosAttr{
+		{Name: "word", Layer: corpus.LayerTypeText, IsLayerDefault: true},
+	}
+	smapping := corpus.StructureMapping{
+		SentenceStruct:  "sent",
+		ParagraphStruct: "para",
+		TextStruct:      "doc",
+	}
+	cases := []struct {
+		query    string
+		expected string
+	}{
+		{`"dog" within s`, `"dog" within <sent />`},
+		{`"dog" within sentence`, `"dog" within <sent />`},
+		{`"dog" within p`, `"dog" within <para />`},
+		{`"dog" within paragraph`, `"dog" within <para />`},
+		{`"dog" within text`, `"dog" within <doc />`},
+	}
+	for _, c := range cases {
+		ast, err := ParseQuery(c.query, posAttrs, smapping)
+		assert.NoError(t, err, c.query)
+		assert.Equal(t, c.expected, ast.Generate(), c.query)
+		assert.Empty(t, ast.Errors(), c.query)
+	}
+
+	// structures not mapped in the resource
+	for _, ctx := range []string{"u", "utterance", "t", "session"} {
+		q := `"dog" within ` + ctx
+		ast, err := ParseQuery(q, posAttrs, smapping)
+		assert.NoError(t, err, q)
+		ast.Generate()
+		if assert.Len(t, ast.Errors(), 1, q) {
+			var withinErr compiler.UnsupportedWithinError
+			assert.True(t, errors.As(ast.Errors()[0], &withinErr), q)
+			assert.Equal(t, ctx, withinErr.Context, q)
+		}
+	}
+}
@@ -20,10 +20,59 @@ package fcsql
 
 import (
 	"fmt"
+	"strings"
+	"unicode"
 
 	"github.com/czcorpus/mquery-sru/corpus"
 )
 
+const (
+	resourceIndex = "fcs.resource"
+)
+
+// SplitResourcePrefix detects a leading `fcs.resource=<pid> AND ...`
+// clause (used by some aggregators to scope a search) and returns
+// the resource PID along with the rest of the query. In case there is
+// no such clause, an empty PID and the original query are returned.
+func SplitResourcePrefix(q string) (string, string) {
+	tmp := strings.TrimSpace(q)
+	if !strings.HasPrefix(tmp, resourceIndex) {
+		return "", q
+	}
+	tmp = strings.TrimSpace(tmp[len(resourceIndex):])
+	if !strings.HasPrefix(tmp, "=") {
+		return "", q
+	}
+	tmp = strings.TrimLeftFunc(tmp[1:], unicode.IsSpace)
+	var pid string
+	if strings.HasPrefix(tmp, "\"") {
+		end := strings.Index(tmp[1:], "\"")
+		if end < 1 {
+			return "", q
+		}
+		pid = tmp[1 : end+1]
+		tmp = tmp[end+2:]
+
+	} else {
+		end := strings.IndexFunc(tmp, unicode.IsSpace)
+		if end < 1 {
+			return "", q
+		}
+		pid = tmp[:end]
+		tmp = tmp[end:]
+	}
+	rest := strings.TrimLeftFunc(tmp, unicode.IsSpace)
+	if len(rest) == len(tmp) || !strings.HasPrefix(rest, "AND") {
+		return "", q
+	}
+	tmp = rest[len("AND"):]
+	rest = strings.TrimLeftFunc(tmp, unicode.IsSpace)
+	if len(rest) == len(tmp) || rest == "" {
+		return "", q
+	}
+	return pid, rest
+}
+
 // ParseQuery parses FCS-QL and returns an abstract syntax
 // tree which can be used to generate CQL.
 func ParseQuery(
@@ -42,6 +42,13 @@ func (lrlist LineRangeList) PIDList() []string {
 	return ans
 }
 
+// IsStartRecordOutOfRange tells whether a (one-based) start record
+// points beyond a result with numberOfRecords items. The first
+// position is always valid as an empty result is still a valid result.
+func IsStartRecordOutOfRange(startRecord, numberOfRecords int) bool {
+	return startRecord > 1 && startRecord > numberOfRecords
+}
+
 // CalculatePartialRanges calculates ranges for individual resources (corpora)
 // in case we know that:
 //  1. we need global offset and limit
@@ -75,3 +82,96 @@ func CalculatePartialRanges(rscList []string, offset, limit int) LineRangeList {
 	}
 	return ans2
 }
+
+// Equals tests whether both lists contain the same ranges
+// in the same order
+func (lrlist LineRangeList) Equals(other LineRangeList) bool {
+	if len(lrlist) != len(other) {
+		return false
+	}
+	for i, v := range lrlist {
+		if v != other[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// CalculatePartialRangesBySizes works like CalculatePartialRanges
+// but it also takes into account actual sizes of the resources' results
+// (`sizes` maps resource names to numbers of their lines). With round
+// robin selection, resources which have run out of lines are skipped
+// so the following resources provide more lines than the others.
+// Ranges of the resources without lines for the requested offset start
+// right after their last line.
+func CalculatePartialRangesBySizes(rscList []string, sizes map[string]int, offset, limit int) LineRangeList {
+	// find the "round" of the round robin selection
+	// the offset falls into
+	var round, consumed int
+	for {
+		var numActive int
+		nextRound := -1
+		for _, rsc := range rscList {
+			if sizes[rsc] > round {
+				numActive++
+				if nextRound == -1 || sizes[rsc] < nextRound {
+					nextRound = sizes[rsc]
+				}
+			}
+		}
+		if numActive == 0 {
+			break
+		}
+		if consumed+(nextRound-round)*numActive > offset {
+			numRounds := (offset - consumed) / numActive
+			round += numRounds
+			consumed += numRounds * numActive
+			break
+		}
+		consumed += (nextRound - round) * numActive
+		round = nextRound
+	}
+	remaind := offset - consumed
+	ans := make([]LineRange, 0, len(rscList))
+	firstIdx := -1
+	for i, rsc := range rscList {
+		from := sizes[rsc]
+		if from > round {
+			from = round
+			if remaind > 0 {
+				from++
+				remaind--
+
+			} else if firstIdx == -1 {
+				firstIdx = i
+			}
+		}
+		ans = append(ans, LineRange{Rsc: rsc, From: from, To: from + limit})
+	}
+	if firstIdx == -1 {
+		firstIdx = 0
+	}
+	ans2 := make([]LineRange, 0, len(rscList))
+	for i := 0; i < len(rscList); i++ {
+		ans2 = append(ans2, ans[(i+firstIdx)%len(rscList)])
+	}
+	return ans2
+}
+
+// CalculateShardRanges splits a range of a resource consisting
+// of multiple shards (separately searched corpora) into ranges
+// of the shards. Lines of the shards are expected to be merged
+// in the round robin style (in the order of the returned ranges)
+// so the resource acts as a single resource with respect to the
+// selection of lines from multiple resources.
+// In case sizes of the shards are known, exact ranges are calculated
+// (see CalculatePartialRangesBySizes).
+func CalculateShardRanges(rng LineRange, shards []string, sizes map[string]int) LineRangeList {
+	if len(shards) == 1 {
+		return LineRangeList{{Rsc: shards[0], From: rng.From, To: rng.To}}
+	}
+	if sizes != nil {
+		return CalculatePartialRangesBySizes(shards, sizes, rng.From, rng.To-rng.From)
+	}
+	return CalculatePartialRanges(shards, rng.From, rng.To-rng.From)
+}
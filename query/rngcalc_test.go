@@ -42,3 +42,72 @@ func TestSingleResource(t *testing.T) {
 	assert.Equal(t, 38, ans[0].From)
 	assert.Equal(t, 48, ans[0].To)
 }
+
+func TestConsecutivePages(t *testing.T) {
+	// with two resources, each page of 4 records takes 2 lines
+	// from each resource (round robin)
+	page1 := CalculatePartialRanges([]string{"c1", "c2"}, 0, 4)
+	assert.Equal(t, LineRange{Rsc: "c1", From: 0, To: 4}, page1[0])
+	assert.Equal(t, LineRange{Rsc: "c2", From: 0, To: 4}, page1[1])
+
+	page2 := CalculatePartialRanges([]string{"c1", "c2"}, 4, 4)
+	assert.Equal(t, LineRange{Rsc: "c1", From: 2, To: 6}, page2[0])
+	assert.Equal(t, LineRange{Rsc: "c2", From: 2, To: 6}, page2[1])
+
+	// odd offset - c1 has already provided one more line so c2 goes first
+	page3 := CalculatePartialRanges([]string{"c1", "c2"}, 5, 4)
+	assert.Equal(t, LineRange{Rsc: "c2", From: 2, To: 6}, page3[0])
+	assert.Equal(t, LineRange{Rsc: "c1", From: 3, To: 7}, page3[1])
+}
+
+func TestRangesBySizesOfLargeResources(t *testing.T) {
+	// with enough lines in all the resources, the ranges
+	// are the same as without sizes
+	sizes := map[string]int{"c1": 100, "c2": 100, "c3": 100}
+	for _, offset := range []int{0, 4, 5, 38} {
+		assert.Equal(
+			t,
+			CalculatePartialRanges([]string{"c1", "c2", "c3"}, offset, 4),
+			CalculatePartialRangesBySizes([]string{"c1", "c2", "c3"}, sizes, offset, 4),
+		)
+	}
+}
+
+func TestRangesBySizesWithExhaustedResource(t *testing.T) {
+	// combined result: c1[0], c2[0], c1[1], c2[1], c2[2], c2[3], ...
+	sizes := map[string]int{"c1": 2, "c2": 10}
+	ans := CalculatePartialRangesBySizes([]string{"c1", "c2"}, sizes, 4, 4)
+	assert.Equal(t, LineRange{Rsc: "c2", From: 2, To: 6}, ans[0])
+	assert.Equal(t, LineRange{Rsc: "c1", From: 2, To: 6}, ans[1])
+
+	ans = CalculatePartialRangesBySizes([]string{"c1", "c2"}, sizes, 3, 4)
+	assert.Equal(t, LineRange{Rsc: "c2", From: 1, To: 5}, ans[0])
+	assert.Equal(t, LineRange{Rsc: "c1", From: 2, To: 6}, ans[1])
+
+	ans = CalculatePartialRangesBySizes([]string{"c1", "c2"}, sizes, 12, 4)
+	assert.Equal(t, LineRange{Rsc: "c1", From: 2, To: 6}, ans[0])
+	assert.Equal(t, LineRange{Rsc: "c2", From: 10, To: 14}, ans[1])
+}
+
+func TestIsStartRecordOutOfRange(t *testing.T) {
+	assert.False(t, IsStartRecordOutOfRange(1, 0))
+	assert.True(t, IsStartRecordOutOfRange(2, 0))
+	assert.False(t, IsStartRecordOutOfRange(10, 10))
+	assert.True(t, IsStartRecordOutOfRange(11, 10))
+}
+
+func TestShardRanges(t *testing.T) {
+	// a resource with a single shard keeps its range
+	ans := CalculateShardRanges(LineRange{Rsc: "c1", From: 5, To: 9}, []string{"c1"}, nil)
+	assert.Equal(t, LineRangeList{{Rsc: "c1", From: 5, To: 9}}, ans)
+
+	// the resource range is split the same way as among resources
+	ans = CalculateShardRanges(LineRange{Rsc: "c1", From: 5, To: 9}, []string{"c1#0", "c1#1"}, nil)
+	assert.Equal(t, LineRange{Rsc: "c1#1", From: 2, To: 6}, ans[0])
+	assert.Equal(t, LineRange{Rsc: "c1#0", From: 3, To: 7}, ans[1])
+
+	sizes := map[string]int{"c1#0": 2, "c1#1": 10}
+	ans = CalculateShardRanges(LineRange{Rsc: "c1", From: 4, To: 8}, []string{"c1#0", "c1#1"}, sizes)
+	assert.Equal(t, LineRange{Rsc: "c1#1", From: 2, To: 6}, ans[0])
+	assert.Equal(t, LineRange{Rsc: "c1#0", From: 2, To: 6}, ans[1])
+}
@@ -0,0 +1,85 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package ratelimit
+
+import (
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	dfltClientsIdleTimeoutSecs = 300
+)
+
+// Conf configures request rate limiting. Both the global and
+// the per-client limits are token buckets - a rate specifies how
+// many requests per second are allowed in the long run and a burst
+// specifies how many requests can be accepted at once. A zero rate
+// means the respective limit is disabled.
+type Conf struct {
+	RequestsPerSecond float64 `json:"requestsPerSecond"`
+	Burst             int     `json:"burst"`
+
+	PerClientRequestsPerSecond float64 `json:"perClientRequestsPerSecond"`
+	PerClientBurst             int     `json:"perClientBurst"`
+
+	// ClientsIdleTimeoutSecs specifies how long we keep a bucket
+	// of a client which has not sent any request.
+	ClientsIdleTimeoutSecs int `json:"clientsIdleTimeoutSecs"`
+}
+
+// IsEnabled tells whether at least one of the limits is configured
+func (conf *Conf) IsEnabled() bool {
+	return conf != nil && (conf.RequestsPerSecond > 0 || conf.PerClientRequestsPerSecond > 0)
+}
+
+func (conf *Conf) ValidateAndDefaults() error {
+	if conf == nil {
+		return nil
+	}
+	if conf.RequestsPerSecond < 0 {
+		return fmt.Errorf("rateLimit.requestsPerSecond must be a non-negative number")
+	}
+	if conf.PerClientRequestsPerSecond < 0 {
+		return fmt.Errorf("rateLimit.perClientRequestsPerSecond must be a non-negative number")
+	}
+	if conf.RequestsPerSecond > 0 && conf.Burst <= 0 {
+		conf.Burst = int(conf.RequestsPerSecond)
+		if conf.Burst < 1 {
+			conf.Burst = 1
+		}
+		log.Warn().
+			Int("value", conf.Burst).
+			Msg("rateLimit.burst not specified, using default")
+	}
+	if conf.PerClientRequestsPerSecond > 0 && conf.PerClientBurst <= 0 {
+		conf.PerClientBurst = int(conf.PerClientRequestsPerSecond)
+		if conf.PerClientBurst < 1 {
+			conf.PerClientBurst = 1
+		}
+		log.Warn().
+			Int("value", conf.PerClientBurst).
+			Msg("rateLimit.perClientBurst not specified, using default")
+	}
+	if conf.ClientsIdleTimeoutSecs == 0 {
+		conf.ClientsIdleTimeoutSecs = dfltClientsIdleTimeoutSecs
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// refill adds tokens according to the time elapsed
+// since the last request
+func (b *bucket) refill(now time.Time, rate float64, burst int) {
+	b.tokens += now.Sub(b.lastSeen).Seconds() * rate
+	if b.tokens > float64(burst) {
+		b.tokens = float64(burst)
+	}
+	b.lastSeen = now
+}
+
+func newBucket(now time.Time, burst int) *bucket {
+	return &bucket{tokens: float64(burst), lastSeen: now}
+}
+
+// Limiter is a token bucket based request limiter with an optional
+// global bucket and optional buckets for individual clients.
+type Limiter struct {
+	conf      *Conf
+	mx        sync.Mutex
+	global    *bucket
+	clients   map[string]*bucket
+	lastSweep time.Time
+}
+
+// Allow tells whether a request from the specified client
+// can be processed now.
+func (lim *Limiter) Allow(clientID string) bool {
+	return lim.allowAt(clientID, time.Now())
+}
+
+func (lim *Limiter) allowAt(clientID string, now time.Time) bool {
+	lim.mx.Lock()
+	defer lim.mx.Unlock()
+	// a token is consumed only if all the involved buckets
+	// have one so a rejected request does not use up the other
+	// bucket (e.g. a single client cannot drain the global one)
+	buckets := make([]*bucket, 0, 2)
+	if lim.conf.PerClientRequestsPerSecond > 0 {
+		lim.sweepIdleClients(now)
+		b, ok := lim.clients[clientID]
+		if !ok {
+			b = newBucket(now, lim.conf.PerClientBurst)
+			lim.clients[clientID] = b
+		}
+		b.refill(now, lim.conf.PerClientRequestsPerSecond, lim.conf.PerClientBurst)
+		buckets = append(buckets, b)
+	}
+	if lim.global != nil {
+		lim.global.refill(now, lim.conf.RequestsPerSecond, lim.conf.Burst)
+		buckets = append(buckets, lim.global)
+	}
+	for _, b := range buckets {
+		if b.tokens < 1 {
+			return false
+		}
+	}
+	for _, b := range buckets {
+		b.tokens--
+	}
+	return true
+}
+
+// sweepIdleClients removes buckets of clients which have not sent
+// any request for a configured time so the map does not grow forever.
+func (lim *Limiter) sweepIdleClients(now time.Time) {
+	timeout := time.Duration(lim.conf.ClientsIdleTimeoutSecs) * time.Second
+	if now.Sub(lim.lastSweep) < timeout {
+		return
+	}
+	for k, b := range lim.clients {
+		if now.Sub(b.lastSeen) >= timeout {
+			delete(lim.clients, k)
+		}
+	}
+	lim.lastSweep = now
+}
+
+func NewLimiter(conf *Conf) *Limiter {
+	now := time.Now()
+	lim := &Limiter{
+		conf:      conf,
+		clients:   make(map[string]*bucket),
+		lastSweep: now,
+	}
+	if conf.RequestsPerSecond > 0 {
+		lim.global = newBucket(now, conf.Burst)
+	}
+	return lim
+}
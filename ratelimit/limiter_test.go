@@ -0,0 +1,72 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPerClientLimit(t *testing.T) {
+	lim := NewLimiter(&Conf{PerClientRequestsPerSecond: 1, PerClientBurst: 2, ClientsIdleTimeoutSecs: 60})
+	now := time.Now()
+	assert.True(t, lim.allowAt("a", now))
+	assert.True(t, lim.allowAt("a", now))
+	assert.False(t, lim.allowAt("a", now))
+	assert.True(t, lim.allowAt("b", now))
+	assert.True(t, lim.allowAt("a", now.Add(time.Second)))
+	assert.False(t, lim.allowAt("a", now.Add(time.Second)))
+}
+
+func TestGlobalLimit(t *testing.T) {
+	lim := NewLimiter(&Conf{RequestsPerSecond: 2, Burst: 1})
+	now := time.Now()
+	assert.True(t, lim.allowAt("a", now))
+	assert.False(t, lim.allowAt("b", now))
+	assert.True(t, lim.allowAt("b", now.Add(500*time.Millisecond)))
+}
+
+func TestRejectedRequestKeepsTokens(t *testing.T) {
+	lim := NewLimiter(&Conf{
+		RequestsPerSecond:          1,
+		Burst:                      2,
+		PerClientRequestsPerSecond: 0.01,
+		PerClientBurst:             1,
+		ClientsIdleTimeoutSecs:     60,
+	})
+	now := time.Now()
+	assert.True(t, lim.allowAt("a", now))
+	// rejected by the per-client limit => no global token is used
+	assert.False(t, lim.allowAt("a", now))
+	assert.False(t, lim.allowAt("a", now))
+	assert.True(t, lim.allowAt("b", now))
+	// rejected by the global limit => the client keeps its token
+	assert.False(t, lim.allowAt("c", now))
+	assert.True(t, lim.allowAt("c", now.Add(time.Second)))
+}
+
+func TestIdleClientsAreRemoved(t *testing.T) {
+	lim := NewLimiter(&Conf{PerClientRequestsPerSecond: 1, PerClientBurst: 1, ClientsIdleTimeoutSecs: 10})
+	now := time.Now()
+	lim.allowAt("a", now)
+	lim.allowAt("b", now.Add(11*time.Second))
+	assert.Len(t, lim.clients, 1)
+}
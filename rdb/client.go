@@ -20,9 +20,11 @@ package rdb
 
 import (
 	"context"
+	"crypto/sha1"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/bytedance/sonic"
@@ -41,10 +43,16 @@ const (
 	DefaultQueryChannel        = "mqueryQueries"
 	DefaultResultExpiration    = 10 * time.Minute
 	DefaultQueryAnswerTimeout  = 60 * time.Second
+	DefaultResultSetKeyPrefix  = "mqueryResultSet"
+	DefaultStoredResultPrefix  = "mqueryStoredResult"
 )
 
 var (
 	ErrorEmptyQueue = errors.New("no queries in the queue")
+
+	// ErrTooManyQueries is returned by PublishQuery in case
+	// the limit of outstanding queries has been reached
+	ErrTooManyQueries = errors.New("too many outstanding queries")
 )
 
 type Query struct {
@@ -52,18 +60,59 @@ type Query struct {
 	Channel    string            `json:"channel"`
 	Func       string            `json:"func"`
 	Args       json.RawMessage   `json:"args"`
+
+	// RequestID identifies an HTTP request the query belongs to
+	// (see the `tracing` package). It is used just for logging.
+	RequestID string `json:"requestId,omitempty"`
+
+	// StoredResultKey (if set) is a deterministic key (based on the
+	// function and its arguments) under which a worker also stores
+	// a successful result for StoredResultTTLSecs so a retried
+	// identical query can be answered without recalculation
+	StoredResultKey     string `json:"storedResultKey,omitempty"`
+	StoredResultTTLSecs int    `json:"storedResultTTLSecs,omitempty"`
+
+	// AnswerTimeout (if non-zero) overrides the adapter's default
+	// time limit for waiting on the query result. The value
+	// is not passed to workers.
+	AnswerTimeout time.Duration `json:"-"`
 }
 
+// ConcExampleArgs are arguments of the `concExample` worker function
 type ConcExampleArgs struct {
-	CorpusPath        string   `json:"corpusPath"`
-	Query             string   `json:"query"`
-	Attrs             []string `json:"attrs"`
-	MaxItems          int      `json:"maxItems"`
-	StartLine         int      `json:"startLine"`
-	MaxContext        int      `json:"maxContext"`
-	ViewContextStruct string   `json:"viewContextStruct"`
+	CorpusPath string   `json:"corpusPath"`
+	Query      string   `json:"query"`
+	Attrs      []string `json:"attrs"`
+	MaxItems   int      `json:"maxItems"`
+	StartLine  int      `json:"startLine"`
+	MaxContext int      `json:"maxContext"`
+
+	// ViewContextStruct is a structure (e.g. `s`) limiting the KWIC
+	// left and right context. Workers pass it to Manatee so the context
+	// does not cross the structure boundaries. An empty value means
+	// no limitation (only `MaxContext` applies).
+	ViewContextStruct string `json:"viewContextStruct"`
+
+	// StructAttrs are structural attributes (e.g. `doc.id`) whose
+	// values (at the KWIC position) are returned with each line
+	// (see `conc.ConcordanceLine.StructAttrs`).
+	StructAttrs []string `json:"structAttrs"`
+
+	// SegmentStruct is a structure (e.g. `s`) whose starts are marked
+	// in the returned lines (see `conc.Token.SegmentStart`). An empty
+	// value means no marking.
+	SegmentStruct string `json:"segmentStruct"`
+}
+
+// ConcSizeArgs are arguments of the `concSize` worker function
+// which obtains just the number of hits (i.e. no concordance lines)
+type ConcSizeArgs struct {
+	CorpusPath string `json:"corpusPath"`
+	Query      string `json:"query"`
 }
 
+// ToJSON encodes the query to JSON which is the format
+// of queries stored in the queue (see DecodeQuery)
 func (q Query) ToJSON() (string, error) {
 	ans, err := sonic.Marshal(q)
 	if err != nil {
@@ -72,12 +121,32 @@ func (q Query) ToJSON() (string, error) {
 	return string(ans), nil
 }
 
+// DecodeQuery decodes a JSON-encoded query as stored in the queue
+// by PublishQuery (i.e. the counterpart of Query.ToJSON)
 func DecodeQuery(q string) (Query, error) {
 	var ans Query
 	err := sonic.Unmarshal([]byte(q), &ans)
 	return ans, err
 }
 
+// QueryPublisher is a subset of Adapter functions used by query
+// producers (i.e. FCS handlers) to pass queries to workers. It allows
+// testing the producers without Redis (see the `rdbtest` package).
+type QueryPublisher interface {
+
+	// NumQueryListeners returns the number of workers
+	// listening for new queries
+	NumQueryListeners() (int, error)
+
+	// PublishQuery publishes a new query and returns a channel
+	// by which a respective result will be returned.
+	PublishQuery(query Query) (<-chan *WorkerResult, error)
+
+	// PublishQueryCached works like PublishQuery but a result of the same
+	// query can be taken from a result set cache.
+	PublishQueryCached(query Query, ttl time.Duration) (<-chan *WorkerResult, error)
+}
+
 // Adapter provides functions for query producers and consumers
 // using Redis database. It leverages Redis' PUBSUB functionality
 // to notify about incoming data.
@@ -87,7 +156,17 @@ type Adapter struct {
 	conf                *Conf
 	channelQuery        string
 	channelResultPrefix string
+	queueKey            string
+	resultSetKeyPrefix  string
+	storedResultPrefix  string
+	storedResultTTL     time.Duration
 	queryAnswerTimeout  time.Duration
+
+	// querySlots is a semaphore limiting the number of outstanding
+	// queries (nil means no limit)
+	querySlots     chan struct{}
+	querySlotsWait time.Duration
+	numOutstanding atomic.Int64
 }
 
 func (a *Adapter) TestConnection(timeout time.Duration, cancel chan bool) error {
@@ -132,14 +211,100 @@ func (a *Adapter) SomeoneListens(query Query) (bool, error) {
 	return cmd.Val()[query.Channel] > 0, nil
 }
 
+// Ping tests whether the Redis server is reachable
+func (a *Adapter) Ping() error {
+	return a.redis.Ping(a.ctx).Err()
+}
+
+// NumQueryListeners returns number of clients (= workers)
+// subscribed to the query channel.
+func (a *Adapter) NumQueryListeners() (int, error) {
+	cmd := a.redis.PubSubNumSub(a.ctx, a.channelQuery)
+	if cmd.Err() != nil {
+		return 0, fmt.Errorf("failed to check query channel listeners: %w", cmd.Err())
+	}
+	return int(cmd.Val()[a.channelQuery]), nil
+}
+
+// acquireQuerySlot reserves a slot for a new outstanding query.
+// In case the limit is reached, it waits (up to the configured time)
+// for a free slot and then returns ErrTooManyQueries.
+func (a *Adapter) acquireQuerySlot() error {
+	if a.querySlots != nil {
+		select {
+		case a.querySlots <- struct{}{}:
+		default:
+			if a.querySlotsWait == 0 {
+				return ErrTooManyQueries
+			}
+			tmr := time.NewTimer(a.querySlotsWait)
+			defer tmr.Stop()
+			select {
+			case a.querySlots <- struct{}{}:
+			case <-tmr.C:
+				return ErrTooManyQueries
+			}
+		}
+	}
+	a.numOutstanding.Add(1)
+	return nil
+}
+
+func (a *Adapter) releaseQuerySlot() {
+	a.numOutstanding.Add(-1)
+	if a.querySlots != nil {
+		<-a.querySlots
+	}
+}
+
+// NumOutstandingQueries returns the number of published
+// queries still waiting for their results
+func (a *Adapter) NumOutstandingQueries() int {
+	return int(a.numOutstanding.Load())
+}
+
+// MaxOutstandingQueries returns the configured limit of outstanding
+// queries (zero means no limit)
+func (a *Adapter) MaxOutstandingQueries() int {
+	return cap(a.querySlots)
+}
+
 // PublishQuery publishes a new query and returns a channel
 // by which a respective result will be returned. In case the
 // process fails during the calculation, a respective error
 // is packed into the WorkerResult value. The error returned
 // by this method means that the publishing itself failed.
+// The time limit for the result can be set via `query.AnswerTimeout`,
+// otherwise the configured `queryAnswerTimeoutSecs` applies.
+// In case the limit of outstanding queries is reached, ErrTooManyQueries
+// is returned.
+//
+// In case stored results are enabled (see Conf.StoredResultTTLSecs),
+// a result stored by a worker for an identical query is returned
+// without publishing the query.
 func (a *Adapter) PublishQuery(query Query) (<-chan *WorkerResult, error) {
+	if a.storedResultTTL > 0 {
+		query.StoredResultKey = a.storedResultKey(query)
+		query.StoredResultTTLSecs = int(a.storedResultTTL.Seconds())
+		if ans, ok := a.getStoredResult(query.StoredResultKey); ok {
+			log.Debug().
+				Str("requestId", query.RequestID).
+				Str("key", query.StoredResultKey).
+				Str("func", query.Func).
+				Msg("using stored result")
+			return singleResultChan(ans), nil
+		}
+	}
+	if err := a.acquireQuerySlot(); err != nil {
+		return nil, err
+	}
 	query.Channel = fmt.Sprintf("%s:%s", a.channelResultPrefix, uuid.New().String())
+	answerTimeout := a.queryAnswerTimeout
+	if query.AnswerTimeout > 0 {
+		answerTimeout = query.AnswerTimeout
+	}
 	log.Debug().
+		Str("requestId", query.RequestID).
 		Str("channel", query.Channel).
 		Str("func", query.Func).
 		Any("args", query.Args).
@@ -147,29 +312,36 @@ func (a *Adapter) PublishQuery(query Query) (<-chan *WorkerResult, error) {
 
 	msg, err := query.ToJSON()
 	if err != nil {
+		a.releaseQuerySlot()
 		return nil, err
 	}
 	sub := a.redis.Subscribe(a.ctx, query.Channel)
 
-	if err := a.redis.LPush(a.ctx, DefaultQueueKey, msg).Err(); err != nil {
+	if err := a.redis.LPush(a.ctx, a.queueKey, msg).Err(); err != nil {
+		sub.Close()
+		a.releaseQuerySlot()
 		return nil, err
 	}
-	ansChan := make(chan *WorkerResult)
+	// note: the channel is buffered so the goroutine below (and thus
+	// the query slot) is not blocked by a caller which gave up waiting
+	ansChan := make(chan *WorkerResult, 1)
 
 	// now we wait for response and send result via `ans`
 	go func() {
 		defer func() {
 			sub.Close()
 			close(ansChan)
+			a.releaseQuerySlot()
 		}()
 
 		ans := new(WorkerResult)
-		tmr := time.NewTimer(a.queryAnswerTimeout)
+		tmr := time.NewTimer(answerTimeout)
 
 		for {
 			select {
 			case item, ok := <-sub.Channel():
 				log.Debug().
+					Str("requestId", query.RequestID).
 					Str("channel", query.Channel).
 					Bool("closedChannel", !ok).
 					Msg("received result")
@@ -192,8 +364,13 @@ func (a *Adapter) PublishQuery(query Query) (<-chan *WorkerResult, error) {
 				tmr.Stop()
 				return
 			case <-tmr.C:
+				log.Warn().
+					Str("requestId", query.RequestID).
+					Str("channel", query.Channel).
+					Msg("worker result timeouted")
 				ans.AttachValue(&result.ErrorResult{
-					Error: fmt.Sprintf("worker result timeouted (%v)", DefaultQueryAnswerTimeout),
+					Error:     fmt.Sprintf("worker result timeouted (%v)", answerTimeout),
+					ErrorType: result.ErrorTypeTimeout,
 				})
 				ansChan <- ans
 				return
@@ -204,11 +381,94 @@ func (a *Adapter) PublishQuery(query Query) (<-chan *WorkerResult, error) {
 	return ansChan, a.redis.Publish(a.ctx, a.channelQuery, MsgNewQuery).Err()
 }
 
+func (a *Adapter) resultSetKey(query Query) string {
+	return fmt.Sprintf(
+		"%s:%s:%x", a.resultSetKeyPrefix, query.Func, sha1.Sum(query.Args))
+}
+
+func (a *Adapter) storedResultKey(query Query) string {
+	return fmt.Sprintf(
+		"%s:%s:%x", a.storedResultPrefix, query.Func, sha1.Sum(query.Args))
+}
+
+// getStoredResult loads a result stored under the `key`. Missing
+// or invalid results are reported as not found.
+func (a *Adapter) getStoredResult(key string) (*WorkerResult, bool) {
+	cmd := a.redis.Get(a.ctx, key)
+	if cmd.Err() == redis.Nil {
+		return nil, false
+
+	} else if cmd.Err() != nil {
+		log.Error().Err(cmd.Err()).Str("key", key).Msg("failed to get stored result, ignoring")
+		return nil, false
+	}
+	var ans WorkerResult
+	if err := sonic.Unmarshal([]byte(cmd.Val()), &ans); err != nil {
+		log.Error().Err(err).Str("key", key).Msg("invalid stored result, ignoring")
+		return nil, false
+	}
+	return &ans, true
+}
+
+// isErrorResult tests whether the result contains an error
+// (such results are never cached)
+func isErrorResult(res *WorkerResult) bool {
+	var errCheck struct {
+		Error string `json:"error"`
+	}
+	return res == nil || sonic.Unmarshal(res.Value, &errCheck) != nil || errCheck.Error != ""
+}
+
+func singleResultChan(res *WorkerResult) <-chan *WorkerResult {
+	ansChan := make(chan *WorkerResult, 1)
+	ansChan <- res
+	close(ansChan)
+	return ansChan
+}
+
+// PublishQueryCached works like PublishQuery but it first looks for
+// a result of the same query (i.e. the same function and arguments)
+// stored within a result set cache. If not found, the query is published
+// and its result (unless it is an error) is stored to the cache
+// for the `ttl` time.
+func (a *Adapter) PublishQueryCached(query Query, ttl time.Duration) (<-chan *WorkerResult, error) {
+	key := a.resultSetKey(query)
+	if ans, ok := a.getStoredResult(key); ok {
+		log.Debug().
+			Str("requestId", query.RequestID).
+			Str("key", key).
+			Str("func", query.Func).
+			Msg("using cached result")
+		return singleResultChan(ans), nil
+	}
+
+	wait, err := a.PublishQuery(query)
+	if err != nil {
+		return wait, err
+	}
+	ansChan := make(chan *WorkerResult, 1)
+	go func() {
+		defer close(ansChan)
+		res := <-wait
+		if !isErrorResult(res) {
+			data, err := sonic.Marshal(res)
+			if err == nil {
+				err = a.redis.Set(a.ctx, key, string(data), ttl).Err()
+			}
+			if err != nil {
+				log.Error().Err(err).Str("key", key).Msg("failed to cache result")
+			}
+		}
+		ansChan <- res
+	}()
+	return ansChan, nil
+}
+
 // DequeueQuery looks for a query queued for processing.
 // In case nothing is found, ErrorEmptyQueue is returned
 // as an error.
 func (a *Adapter) DequeueQuery() (Query, error) {
-	cmd := a.redis.RPop(a.ctx, DefaultQueueKey)
+	cmd := a.redis.RPop(a.ctx, a.queueKey)
 
 	if cmd.Val() == "" {
 		return Query{}, ErrorEmptyQueue
@@ -223,6 +483,29 @@ func (a *Adapter) DequeueQuery() (Query, error) {
 	return q, nil
 }
 
+// DequeueQueryBlocking waits up to `timeout` for a query queued
+// for processing. Unlike DequeueQuery, it does not depend on a PUBSUB
+// notification so a query queued while a worker was busy cannot be
+// missed. In case nothing is found within the timeout, ErrorEmptyQueue
+// is returned as an error.
+func (a *Adapter) DequeueQueryBlocking(timeout time.Duration) (Query, error) {
+	// BRPop (and not BLPop) as queries are pushed via LPush
+	// and we want to keep the FIFO order of DequeueQuery
+	cmd := a.redis.BRPop(a.ctx, timeout, a.queueKey)
+	if cmd.Err() == redis.Nil {
+		return Query{}, ErrorEmptyQueue
+
+	} else if cmd.Err() != nil {
+		return Query{}, fmt.Errorf("failed to dequeue query: %w", cmd.Err())
+	}
+	// the reply is a [key, value] pair
+	q, err := DecodeQuery(cmd.Val()[1])
+	if err != nil {
+		return Query{}, fmt.Errorf("failed to deserialize query: %w", err)
+	}
+	return q, nil
+}
+
 // PublishResult sends notification via Redis PUBSUB mechanism
 // and also stores the result so a notified listener can retrieve
 // it.
@@ -239,6 +522,25 @@ func (a *Adapter) PublishResult(channelName string, value *WorkerResult) error {
 	return a.redis.Publish(a.ctx, channelName, channelName).Err()
 }
 
+// StoreResult stores a successful result under the query's
+// StoredResultKey (if set) so a retried identical query can be
+// answered by PublishQuery without recalculation. Error results
+// are not stored.
+func (a *Adapter) StoreResult(query Query, value *WorkerResult) error {
+	if query.StoredResultKey == "" || query.StoredResultTTLSecs <= 0 || isErrorResult(value) {
+		return nil
+	}
+	data, err := sonic.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to serialize result: %w", err)
+	}
+	ttl := time.Duration(query.StoredResultTTLSecs) * time.Second
+	if err := a.redis.Set(a.ctx, query.StoredResultKey, string(data), ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store result: %w", err)
+	}
+	return nil
+}
+
 // Subscribe subscribes to query queue.
 func (a *Adapter) Subscribe() <-chan *redis.Message {
 	sub := a.redis.Subscribe(a.ctx, a.channelQuery)
@@ -257,11 +559,18 @@ func NewAdapter(conf *Conf) *Adapter {
 			Msg("Redis channel for results not specified, using default")
 	}
 	if chQuery == "" {
-		chQuery := DefaultQueryChannel
+		chQuery = DefaultQueryChannel
 		log.Warn().
 			Str("channel", chQuery).
 			Msg("Redis channel for queries not specified, using default")
 	}
+	queueKey := conf.QueueKey
+	if queueKey == "" {
+		queueKey = DefaultQueueKey
+		log.Warn().
+			Str("key", queueKey).
+			Msg("Redis key for query queue not specified, using default")
+	}
 	queryAnswerTimeout := time.Duration(conf.QueryAnswerTimeoutSecs) * time.Second
 	if queryAnswerTimeout == 0 {
 		queryAnswerTimeout = DefaultQueryAnswerTimeout
@@ -269,17 +578,36 @@ func NewAdapter(conf *Conf) *Adapter {
 			Float64("value", queryAnswerTimeout.Seconds()).
 			Msg("queryAnswerTimeoutSecs not specified for Redis adapter, using default")
 	}
+	tlsConfig, err := conf.TLSConfig()
+	if err != nil {
+		log.Fatal().Err(err).Msg("failed to configure TLS for Redis")
+	}
+	var querySlots chan struct{}
+	if conf.MaxOutstandingQueries > 0 {
+		querySlots = make(chan struct{}, conf.MaxOutstandingQueries)
+	}
 	ans := &Adapter{
 		conf: conf,
 		redis: redis.NewClient(&redis.Options{
-			Addr:     fmt.Sprintf("%s:%d", conf.Host, conf.Port),
-			Password: conf.Password,
-			DB:       conf.DB,
+			Addr:         fmt.Sprintf("%s:%d", conf.Host, conf.Port),
+			Password:     conf.Password,
+			DB:           conf.DB,
+			PoolSize:     conf.PoolSize,
+			MinIdleConns: conf.MinIdleConns,
+			DialTimeout:  conf.DialTimeout(),
+			ReadTimeout:  conf.ReadTimeout(),
+			TLSConfig:    tlsConfig,
 		}),
 		ctx:                 context.Background(),
-		channelQuery:        chQuery,
-		channelResultPrefix: chRes,
+		channelQuery:        conf.Namespaced(chQuery),
+		channelResultPrefix: conf.Namespaced(chRes),
+		queueKey:            conf.Namespaced(queueKey),
+		resultSetKeyPrefix:  conf.Namespaced(DefaultResultSetKeyPrefix),
+		storedResultPrefix:  conf.Namespaced(DefaultStoredResultPrefix),
+		storedResultTTL:     conf.StoredResultTTL(),
 		queryAnswerTimeout:  queryAnswerTimeout,
+		querySlots:          querySlots,
+		querySlotsWait:      conf.OutstandingQueriesWait(),
 	}
 	return ans
 }
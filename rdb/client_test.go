@@ -0,0 +1,450 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/bytedance/sonic"
+	"github.com/czcorpus/mquery-sru/result"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestAdapter creates an adapter connected to an in-memory
+// Redis server which is stopped once the test finishes
+func newTestAdapter(t *testing.T) (*Adapter, *miniredis.Miniredis) {
+	srv := miniredis.RunT(t)
+	port, err := strconv.Atoi(srv.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	adapter := NewAdapter(&Conf{
+		Host:                   srv.Host(),
+		Port:                   port,
+		ChannelQuery:           "testQueries",
+		ChannelResultPrefix:    "testResults",
+		QueryAnswerTimeoutSecs: 5,
+	})
+	t.Cleanup(func() { adapter.redis.Close() })
+	return adapter, srv
+}
+
+// waitForListener waits until a client subscribes to the query
+// result channel (subscription and publishing use different
+// connections so we must not publish the result too early)
+func waitForListener(t *testing.T, adapter *Adapter, query Query) {
+	assert.Eventually(t, func() bool {
+		ok, err := adapter.SomeoneListens(query)
+		return err == nil && ok
+	}, 2*time.Second, 10*time.Millisecond)
+}
+
+func TestConcExampleArgsSerializeViewContextStruct(t *testing.T) {
+	args, err := sonic.Marshal(ConcExampleArgs{
+		CorpusPath:        "/var/lib/manatee/registry/syn2020",
+		Query:             `[word="cat"]`,
+		Attrs:             []string{"word", "lemma"},
+		MaxItems:          10,
+		MaxContext:        20,
+		ViewContextStruct: "s",
+		StructAttrs:       []string{"doc.id"},
+	})
+	assert.NoError(t, err)
+	q, err := DecodeQuery(
+		`{"func":"concExample","args":` + string(args) + `}`)
+	assert.NoError(t, err)
+	var decoded map[string]any
+	assert.NoError(t, json.Unmarshal(q.Args, &decoded))
+	assert.Equal(t, "s", decoded["viewContextStruct"])
+
+	var workerArgs ConcExampleArgs
+	assert.NoError(t, sonic.Unmarshal(q.Args, &workerArgs))
+	assert.Equal(t, "s", workerArgs.ViewContextStruct)
+	assert.Equal(t, []string{"doc.id"}, workerArgs.StructAttrs)
+}
+
+func TestQueryJSONRoundTrip(t *testing.T) {
+	q := Query{
+		ResultType: result.ResultTypeFx,
+		Channel:    "testResults:1",
+		Func:       "concExample",
+		Args:       json.RawMessage(`{"corpusPath":"/tmp/syn","maxItems":10}`),
+		// not serialized
+		AnswerTimeout: time.Second,
+	}
+	data, err := q.ToJSON()
+	assert.NoError(t, err)
+	decoded, err := DecodeQuery(data)
+	assert.NoError(t, err)
+	assert.Equal(t, q.ResultType, decoded.ResultType)
+	assert.Equal(t, q.Channel, decoded.Channel)
+	assert.Equal(t, q.Func, decoded.Func)
+	assert.JSONEq(t, string(q.Args), string(decoded.Args))
+	assert.Zero(t, decoded.AnswerTimeout)
+
+	data2, err := decoded.ToJSON()
+	assert.NoError(t, err)
+	assert.JSONEq(t, data, data2)
+}
+
+func TestDecodeQueryInvalid(t *testing.T) {
+	_, err := DecodeQuery(`{"func":`)
+	assert.Error(t, err)
+}
+
+func TestPublishQueryRoundTrip(t *testing.T) {
+	adapter, _ := newTestAdapter(t)
+	args := json.RawMessage(`{"query":"[word=\"cat\"]"}`)
+	wait, err := adapter.PublishQuery(Query{
+		ResultType: result.ResultTypeFx,
+		Func:       "concExample",
+		Args:       args,
+	})
+	assert.NoError(t, err)
+
+	query, err := adapter.DequeueQuery()
+	assert.NoError(t, err)
+	assert.Equal(t, "concExample", query.Func)
+	assert.Equal(t, result.ResultType(result.ResultTypeFx), query.ResultType)
+	assert.JSONEq(t, string(args), string(query.Args))
+	assert.Regexp(t, "^testResults:", query.Channel)
+
+	_, err = adapter.DequeueQuery()
+	assert.ErrorIs(t, err, ErrorEmptyQueue)
+
+	waitForListener(t, adapter, query)
+	res, err := CreateWorkerResult(&result.ConcExample{
+		ResultType: query.ResultType,
+		ConcSize:   42,
+		Query:      `[word="cat"]`,
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, adapter.PublishResult(query.Channel, res))
+
+	ans := <-wait
+	if assert.NotNil(t, ans) {
+		concEx, err := DeserializeConcExampleResult(ans)
+		assert.NoError(t, err)
+		assert.Equal(t, 42, concEx.ConcSize)
+		assert.Equal(t, `[word="cat"]`, concEx.Query)
+		assert.Empty(t, concEx.Error)
+	}
+	_, ok := <-wait
+	assert.False(t, ok)
+}
+
+func TestPublishQueryQueuesJSON(t *testing.T) {
+	adapter, srv := newTestAdapter(t)
+	wait, err := adapter.PublishQuery(Query{
+		ResultType:    result.ResultTypeFx,
+		Func:          "concExample",
+		Args:          json.RawMessage(`{"maxItems":10}`),
+		AnswerTimeout: 50 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+	defer func() { <-wait }()
+	items, err := srv.List(DefaultQueueKey)
+	assert.NoError(t, err)
+	if assert.Len(t, items, 1) {
+		// workers need not be written in Go so we check the queued
+		// data using the standard JSON decoder
+		var raw map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(items[0]), &raw))
+		assert.Equal(t, "concExample", raw["func"])
+		assert.Equal(t, "Fx", raw["resultType"])
+		assert.Equal(t, map[string]any{"maxItems": float64(10)}, raw["args"])
+		assert.Regexp(t, "^testResults:", raw["channel"])
+		assert.NotContains(t, raw, "AnswerTimeout")
+	}
+}
+
+func TestPublishQueryTransmitsWorkerError(t *testing.T) {
+	adapter, _ := newTestAdapter(t)
+	wait, err := adapter.PublishQuery(Query{Func: "concExample"})
+	assert.NoError(t, err)
+	query, err := adapter.DequeueQuery()
+	assert.NoError(t, err)
+
+	waitForListener(t, adapter, query)
+	res, err := CreateWorkerResult(&result.ErrorResult{
+		ResultType: result.ResultTypeError,
+		Error:      "corpus not found",
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, adapter.PublishResult(query.Channel, res))
+
+	ans := <-wait
+	if assert.NotNil(t, ans) {
+		assert.Equal(t, result.ResultType(result.ResultTypeError), ans.ResultType)
+		concEx, err := DeserializeConcExampleResult(ans)
+		assert.NoError(t, err)
+		assert.Equal(t, "corpus not found", concEx.Error)
+	}
+}
+
+func TestPublishQueryMissingResult(t *testing.T) {
+	adapter, srv := newTestAdapter(t)
+	wait, err := adapter.PublishQuery(Query{Func: "concExample"})
+	assert.NoError(t, err)
+	query, err := adapter.DequeueQuery()
+	assert.NoError(t, err)
+
+	// notify the listener without storing the result
+	waitForListener(t, adapter, query)
+	srv.Publish(query.Channel, query.Channel)
+
+	ans := <-wait
+	if assert.NotNil(t, ans) {
+		concEx, err := DeserializeConcExampleResult(ans)
+		assert.NoError(t, err)
+		assert.Equal(t, "redis: nil", concEx.Error)
+	}
+}
+
+func TestPublishQueryTimeout(t *testing.T) {
+	adapter, _ := newTestAdapter(t)
+	wait, err := adapter.PublishQuery(Query{
+		Func:          "concExample",
+		AnswerTimeout: 50 * time.Millisecond,
+	})
+	assert.NoError(t, err)
+
+	select {
+	case ans := <-wait:
+		if assert.NotNil(t, ans) {
+			concEx, err := DeserializeConcExampleResult(ans)
+			assert.NoError(t, err)
+			assert.Contains(t, concEx.Error, "worker result timeouted")
+			assert.True(t, concEx.IsTimeout())
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("query did not time out")
+	}
+}
+
+func TestNamespacedAdaptersDoNotShareQueue(t *testing.T) {
+	srv := miniredis.RunT(t)
+	port, err := strconv.Atoi(srv.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	newAdapter := func(namespace string) *Adapter {
+		adapter := NewAdapter(&Conf{
+			Host:                   srv.Host(),
+			Port:                   port,
+			ChannelQuery:           "testQueries",
+			ChannelResultPrefix:    "testResults",
+			QueryAnswerTimeoutSecs: 5,
+			Namespace:              namespace,
+		})
+		t.Cleanup(func() { adapter.redis.Close() })
+		return adapter
+	}
+	adapter1 := newAdapter("dep1")
+	adapter2 := newAdapter("dep2")
+
+	wait, err := adapter1.PublishQuery(
+		Query{Func: "concSize", Args: json.RawMessage(`{}`), AnswerTimeout: 50 * time.Millisecond})
+	assert.NoError(t, err)
+	defer func() { <-wait }()
+	items, err := srv.List("dep1:" + DefaultQueueKey)
+	assert.NoError(t, err)
+	assert.Len(t, items, 1)
+
+	_, err = adapter2.DequeueQuery()
+	assert.ErrorIs(t, err, ErrorEmptyQueue)
+	q, err := adapter1.DequeueQuery()
+	assert.NoError(t, err)
+	assert.Equal(t, "concSize", q.Func)
+	assert.Regexp(t, "^dep1:testResults:", q.Channel)
+}
+
+func TestPublishQueryUsesStoredResult(t *testing.T) {
+	srv := miniredis.RunT(t)
+	port, err := strconv.Atoi(srv.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	newAdapter := func() *Adapter {
+		adapter := NewAdapter(&Conf{
+			Host:                   srv.Host(),
+			Port:                   port,
+			ChannelQuery:           "testQueries",
+			ChannelResultPrefix:    "testResults",
+			QueryAnswerTimeoutSecs: 5,
+			StoredResultTTLSecs:    120,
+		})
+		t.Cleanup(func() { adapter.redis.Close() })
+		return adapter
+	}
+	adapter := newAdapter()
+	args := json.RawMessage(`{"query":"[word=\"cat\"]"}`)
+	wait, err := adapter.PublishQuery(Query{Func: "concExample", Args: args})
+	assert.NoError(t, err)
+	query, err := adapter.DequeueQuery()
+	assert.NoError(t, err)
+	assert.Regexp(t, "^"+DefaultStoredResultPrefix+":concExample:[0-9a-f]{40}$", query.StoredResultKey)
+	assert.Equal(t, 120, query.StoredResultTTLSecs)
+
+	waitForListener(t, adapter, query)
+	res, err := CreateWorkerResult(&result.ConcExample{ConcSize: 42})
+	assert.NoError(t, err)
+	assert.NoError(t, adapter.StoreResult(query, res))
+	assert.NoError(t, adapter.PublishResult(query.Channel, res))
+	<-wait
+	assert.Equal(t, 120*time.Second, srv.TTL(query.StoredResultKey))
+
+	// a retried query (even via a new adapter) is not published
+	for _, a := range []*Adapter{adapter, newAdapter()} {
+		wait, err = a.PublishQuery(Query{Func: "concExample", Args: args})
+		assert.NoError(t, err)
+		ans := <-wait
+		if assert.NotNil(t, ans) {
+			concEx, err := DeserializeConcExampleResult(ans)
+			assert.NoError(t, err)
+			assert.Equal(t, 42, concEx.ConcSize)
+		}
+		_, err = a.DequeueQuery()
+		assert.ErrorIs(t, err, ErrorEmptyQueue)
+	}
+}
+
+func TestStoreResultSkipsErrors(t *testing.T) {
+	adapter, srv := newTestAdapter(t)
+	query := Query{StoredResultKey: "stored:1", StoredResultTTLSecs: 60}
+	res, err := CreateWorkerResult(&result.ErrorResult{Error: "corpus not found"})
+	assert.NoError(t, err)
+	assert.NoError(t, adapter.StoreResult(query, res))
+	assert.False(t, srv.Exists("stored:1"))
+
+	// stored results disabled
+	res, err = CreateWorkerResult(&result.ConcExample{ConcSize: 42})
+	assert.NoError(t, err)
+	assert.NoError(t, adapter.StoreResult(Query{}, res))
+	assert.Empty(t, srv.Keys())
+}
+
+func TestDequeueQueryInvalidData(t *testing.T) {
+	adapter, srv := newTestAdapter(t)
+	_, err := srv.Lpush(DefaultQueueKey, "{invalid")
+	assert.NoError(t, err)
+	_, err = adapter.DequeueQuery()
+	assert.ErrorContains(t, err, "failed to deserialize query")
+}
+
+func TestDequeueQueryBlockingEmptyQueue(t *testing.T) {
+	adapter, _ := newTestAdapter(t)
+	_, err := adapter.DequeueQueryBlocking(time.Second)
+	assert.ErrorIs(t, err, ErrorEmptyQueue)
+}
+
+func TestDequeueQueryBlockingKeepsOrder(t *testing.T) {
+	adapter, _ := newTestAdapter(t)
+	for _, fn := range []string{"concExample", "concSize"} {
+		wait, err := adapter.PublishQuery(
+			Query{Func: fn, Args: json.RawMessage(`{}`), AnswerTimeout: 50 * time.Millisecond})
+		assert.NoError(t, err)
+		defer func() { <-wait }()
+	}
+	query, err := adapter.DequeueQueryBlocking(time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "concExample", query.Func)
+	query, err = adapter.DequeueQueryBlocking(time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, "concSize", query.Func)
+}
+
+func TestDequeueQueryBlockingWaitsForQuery(t *testing.T) {
+	adapter, _ := newTestAdapter(t)
+	dequeued := make(chan Query)
+	go func() {
+		query, err := adapter.DequeueQueryBlocking(5 * time.Second)
+		assert.NoError(t, err)
+		dequeued <- query
+	}()
+	// make sure the worker side already waits
+	time.Sleep(100 * time.Millisecond)
+	wait, err := adapter.PublishQuery(
+		Query{Func: "concSize", Args: json.RawMessage(`{}`), AnswerTimeout: 50 * time.Millisecond})
+	assert.NoError(t, err)
+	defer func() { <-wait }()
+	select {
+	case query := <-dequeued:
+		assert.Equal(t, "concSize", query.Func)
+	case <-time.After(2 * time.Second):
+		t.Fatal("query not dequeued")
+	}
+}
+
+func TestDequeueQueryBlockingInvalidData(t *testing.T) {
+	adapter, srv := newTestAdapter(t)
+	_, err := srv.Lpush(DefaultQueueKey, "{invalid")
+	assert.NoError(t, err)
+	_, err = adapter.DequeueQueryBlocking(time.Second)
+	assert.ErrorContains(t, err, "failed to deserialize query")
+}
+
+func TestPublishResultServerUnavailable(t *testing.T) {
+	adapter, srv := newTestAdapter(t)
+	srv.Close()
+	res, err := CreateWorkerResult(&result.ErrorResult{Error: "foo"})
+	assert.NoError(t, err)
+	assert.Error(t, adapter.PublishResult("testResults:1", res))
+}
+
+func TestPublishQueryLimitsOutstandingQueries(t *testing.T) {
+	adapter, _ := newTestAdapter(t)
+	adapter.querySlots = make(chan struct{}, 1)
+	assert.Equal(t, 1, adapter.MaxOutstandingQueries())
+
+	wait, err := adapter.PublishQuery(Query{Func: "concExample", AnswerTimeout: 100 * time.Millisecond})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, adapter.NumOutstandingQueries())
+	_, err = adapter.PublishQuery(Query{Func: "concExample"})
+	assert.ErrorIs(t, err, ErrTooManyQueries)
+	assert.Equal(t, 1, adapter.NumOutstandingQueries())
+
+	// the slot is released once the query is finished (here by timeout)
+	<-wait
+	assert.Eventually(t, func() bool {
+		return adapter.NumOutstandingQueries() == 0
+	}, time.Second, 10*time.Millisecond)
+	wait, err = adapter.PublishQuery(Query{Func: "concExample", AnswerTimeout: 50 * time.Millisecond})
+	assert.NoError(t, err)
+	<-wait
+}
+
+func TestPublishQueryWaitsForQuerySlot(t *testing.T) {
+	adapter, _ := newTestAdapter(t)
+	adapter.querySlots = make(chan struct{}, 1)
+	adapter.querySlotsWait = 2 * time.Second
+
+	wait1, err := adapter.PublishQuery(Query{Func: "concExample", AnswerTimeout: 100 * time.Millisecond})
+	assert.NoError(t, err)
+	// the caller does not read the first result; the slot
+	// must be released anyway
+	_ = wait1
+	wait2, err := adapter.PublishQuery(Query{Func: "concExample", AnswerTimeout: 50 * time.Millisecond})
+	assert.NoError(t, err)
+	<-wait2
+}
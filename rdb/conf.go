@@ -19,7 +19,12 @@
 package rdb
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog/log"
 )
@@ -29,6 +34,7 @@ const (
 	dfltChannelQuery           = "mquerysru"
 	dfltChannelResultPrefix    = "res"
 	dfltQueryAnswerTimeoutSecs = 30
+	dfltWorkersGracePeriodSecs = 30
 )
 
 type Conf struct {
@@ -39,6 +45,192 @@ type Conf struct {
 	ChannelQuery           string `json:"channelQuery"`
 	ChannelResultPrefix    string `json:"channelResultPrefix"`
 	QueryAnswerTimeoutSecs int    `json:"queryAnswerTimeoutSecs"`
+
+	// QueueKey is a key of the list used as a queue of queries
+	// waiting for workers
+	QueueKey string `json:"queueKey"`
+
+	// Namespace (if set) prefixes all the keys and channels used
+	// by the deployment (`[namespace]:[key]`) so multiple deployments
+	// can share a single Redis database
+	Namespace string `json:"namespace"`
+
+	// WorkersGracePeriodSecs specifies how long the server is
+	// considered ready even if there is no worker listening
+	// on the query channel.
+	WorkersGracePeriodSecs int `json:"workersGracePeriodSecs"`
+
+	// PoolSize is a maximum number of socket connections.
+	// Zero means the go-redis default (10 per CPU).
+	PoolSize int `json:"poolSize"`
+
+	// MinIdleConns is a minimum number of idle connections
+	// kept open (zero = no idle connections are kept)
+	MinIdleConns int `json:"minIdleConns"`
+
+	// DialTimeoutSecs is a timeout for establishing new connections.
+	// Zero means the go-redis default (5 seconds).
+	DialTimeoutSecs int `json:"dialTimeoutSecs"`
+
+	// ReadTimeoutSecs is a timeout for socket reads.
+	// Zero means the go-redis default (3 seconds).
+	ReadTimeoutSecs int `json:"readTimeoutSecs"`
+
+	// TLS is an optional configuration of encrypted connection
+	TLS *TLSConf `json:"tls"`
+
+	// MaxOutstandingQueries limits the number of published queries
+	// waiting for their results (shared by all the requests).
+	// Zero means no limit.
+	MaxOutstandingQueries int `json:"maxOutstandingQueries"`
+
+	// OutstandingQueriesWaitSecs specifies how long a new query
+	// waits for a free slot once MaxOutstandingQueries is reached.
+	// Zero means the query is rejected immediately.
+	OutstandingQueriesWaitSecs int `json:"outstandingQueriesWaitSecs"`
+
+	// BlockingDequeueSecs enables workers to wait for queries
+	// by blocking on the query queue (up to the specified number of
+	// seconds per attempt) instead of relying on PUBSUB notifications
+	// only. Zero means the notification based dequeuing.
+	BlockingDequeueSecs int `json:"blockingDequeueSecs"`
+
+	// StoredResultTTLSecs enables storing successful worker results
+	// under deterministic keys (based on the query function and
+	// arguments) for the specified number of seconds. A retried
+	// identical query is then answered from the stored result.
+	// Zero means no results are stored.
+	StoredResultTTLSecs int `json:"storedResultTTLSecs"`
+
+	// SearchAnswerTimeoutSecs (if non-zero) replaces QueryAnswerTimeoutSecs
+	// for queries produced by the searchRetrieve operation which may
+	// need more time than other queries
+	SearchAnswerTimeoutSecs int `json:"searchAnswerTimeoutSecs"`
+}
+
+// TLSConf configures TLS connection to a Redis server
+type TLSConf struct {
+	Enabled bool `json:"enabled"`
+
+	// CACertFile is an optional path to a PEM encoded CA certificate(s)
+	// used to verify the server. If empty, system CAs are used.
+	CACertFile string `json:"caCertFile"`
+
+	// CertFile and KeyFile are optional paths to a PEM encoded client
+	// certificate and its key (for servers requiring client auth.)
+	CertFile string `json:"certFile"`
+	KeyFile  string `json:"keyFile"`
+
+	// ServerName overrides the name used to verify the server
+	// certificate (by default, `redis.host` is used)
+	ServerName string `json:"serverName"`
+
+	InsecureSkipVerify bool `json:"insecureSkipVerify"`
+}
+
+// TLSConfig creates a TLS configuration for the Redis client.
+// In case TLS is not enabled, nil is returned.
+func (conf *Conf) TLSConfig() (*tls.Config, error) {
+	if conf.TLS == nil || !conf.TLS.Enabled {
+		return nil, nil
+	}
+	ans := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         conf.TLS.ServerName,
+		InsecureSkipVerify: conf.TLS.InsecureSkipVerify,
+	}
+	if ans.ServerName == "" {
+		ans.ServerName = conf.Host
+	}
+	if conf.TLS.CACertFile != "" {
+		pem, err := os.ReadFile(conf.TLS.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read redis.tls.caCertFile: %w", err)
+		}
+		ans.RootCAs = x509.NewCertPool()
+		if !ans.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificate found in redis.tls.caCertFile")
+		}
+	}
+	if conf.TLS.CertFile != "" || conf.TLS.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.TLS.CertFile, conf.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load redis.tls client certificate: %w", err)
+		}
+		ans.Certificates = []tls.Certificate{cert}
+	}
+	return ans, nil
+}
+
+func (conf *Conf) DialTimeout() time.Duration {
+	return time.Duration(conf.DialTimeoutSecs) * time.Second
+}
+
+func (conf *Conf) ReadTimeout() time.Duration {
+	return time.Duration(conf.ReadTimeoutSecs) * time.Second
+}
+
+func (conf *Conf) OutstandingQueriesWait() time.Duration {
+	return time.Duration(conf.OutstandingQueriesWaitSecs) * time.Second
+}
+
+// SearchAnswerTimeout returns a time limit for searchRetrieve
+// queries. Zero means the adapter's default applies.
+func (conf *Conf) SearchAnswerTimeout() time.Duration {
+	return time.Duration(conf.SearchAnswerTimeoutSecs) * time.Second
+}
+
+func (conf *Conf) BlockingDequeueTimeout() time.Duration {
+	return time.Duration(conf.BlockingDequeueSecs) * time.Second
+}
+
+// Namespaced returns the `name` prefixed by the configured
+// namespace (or the `name` itself if no namespace is set)
+func (conf *Conf) Namespaced(name string) string {
+	if conf.Namespace == "" {
+		return name
+	}
+	return conf.Namespace + ":" + name
+}
+
+// UsedKeys returns the (namespaced) Redis keys, key prefixes
+// and channels used by the deployment
+func (conf *Conf) UsedKeys() map[string]string {
+	return map[string]string{
+		"queueKey":            conf.Namespaced(conf.QueueKey),
+		"channelQuery":        conf.Namespaced(conf.ChannelQuery),
+		"channelResultPrefix": conf.Namespaced(conf.ChannelResultPrefix),
+		"resultSetKeyPrefix":  conf.Namespaced(DefaultResultSetKeyPrefix),
+		"storedResultPrefix":  conf.Namespaced(DefaultStoredResultPrefix),
+	}
+}
+
+// validateKeysUniqueness tests that the keys and channels used by
+// the deployment do not collide with each other - including keys
+// derived from the prefixes (e.g. `[channelResultPrefix]:[uuid]`)
+func (conf *Conf) validateKeysUniqueness() error {
+	keys := conf.UsedKeys()
+	prefixes := []string{"channelResultPrefix", "resultSetKeyPrefix", "storedResultPrefix"}
+	for k1, v1 := range keys {
+		for k2, v2 := range keys {
+			if k1 >= k2 {
+				continue
+			}
+			if v1 == v2 {
+				return fmt.Errorf("redis.%s and redis.%s use the same name %s", k1, k2, v1)
+			}
+		}
+		for _, p := range prefixes {
+			if k1 != p && strings.HasPrefix(v1, keys[p]+":") {
+				return fmt.Errorf("redis.%s (%s) collides with keys derived from redis.%s", k1, v1, p)
+			}
+		}
+	}
+	return nil
+}
+
+func (conf *Conf) StoredResultTTL() time.Duration {
+	return time.Duration(conf.StoredResultTTLSecs) * time.Second
 }
 
 func (conf *Conf) ServerInfo() string {
@@ -73,11 +265,62 @@ func (conf *Conf) Validate() error {
 			Str("value", conf.ChannelResultPrefix).
 			Msg("redis.channelResultPrefix not specified, using default")
 	}
+	if conf.QueueKey == "" {
+		conf.QueueKey = DefaultQueueKey
+		log.Warn().
+			Str("value", conf.QueueKey).
+			Msg("redis.queueKey not specified, using default")
+	}
+	if strings.ContainsAny(conf.Namespace, " \t\n") {
+		return fmt.Errorf("redis.namespace must not contain whitespace characters")
+	}
+	if err := conf.validateKeysUniqueness(); err != nil {
+		return err
+	}
 	if conf.QueryAnswerTimeoutSecs == 0 {
 		conf.QueryAnswerTimeoutSecs = dfltQueryAnswerTimeoutSecs
 		log.Warn().
 			Int("value", conf.QueryAnswerTimeoutSecs).
 			Msg("redis.queryAnswerTimeoutSecs not specified, using default")
 	}
+	if conf.SearchAnswerTimeoutSecs < 0 {
+		return fmt.Errorf("redis.searchAnswerTimeoutSecs must be a non-negative number")
+	}
+	if conf.WorkersGracePeriodSecs < 0 {
+		return fmt.Errorf("redis.workersGracePeriodSecs must be a non-negative number")
+
+	} else if conf.WorkersGracePeriodSecs == 0 {
+		conf.WorkersGracePeriodSecs = dfltWorkersGracePeriodSecs
+		log.Warn().
+			Int("value", conf.WorkersGracePeriodSecs).
+			Msg("redis.workersGracePeriodSecs not specified, using default")
+	}
+	if conf.PoolSize < 0 {
+		return fmt.Errorf("redis.poolSize must be a non-negative number")
+	}
+	if conf.BlockingDequeueSecs < 0 {
+		return fmt.Errorf("redis.blockingDequeueSecs must be a non-negative number")
+	}
+	if conf.MinIdleConns < 0 {
+		return fmt.Errorf("redis.minIdleConns must be a non-negative number")
+	}
+	if conf.DialTimeoutSecs < 0 {
+		return fmt.Errorf("redis.dialTimeoutSecs must be a non-negative number")
+	}
+	if conf.ReadTimeoutSecs < 0 {
+		return fmt.Errorf("redis.readTimeoutSecs must be a non-negative number")
+	}
+	if conf.MaxOutstandingQueries < 0 {
+		return fmt.Errorf("redis.maxOutstandingQueries must be a non-negative number")
+	}
+	if conf.StoredResultTTLSecs < 0 {
+		return fmt.Errorf("redis.storedResultTTLSecs must be a non-negative number")
+	}
+	if conf.OutstandingQueriesWaitSecs < 0 {
+		return fmt.Errorf("redis.outstandingQueriesWaitSecs must be a non-negative number")
+	}
+	if _, err := conf.TLSConfig(); err != nil {
+		return err
+	}
 	return nil
 }
@@ -0,0 +1,178 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package rdb
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestConf() *Conf {
+	return &Conf{
+		Host:                "localhost",
+		DB:                  1,
+		ChannelQuery:        "mquerysru",
+		ChannelResultPrefix: "res",
+	}
+}
+
+func TestValidateQueueKeyDefault(t *testing.T) {
+	conf := newTestConf()
+	assert.NoError(t, conf.Validate())
+	assert.Equal(t, DefaultQueueKey, conf.QueueKey)
+	assert.Equal(t, DefaultQueueKey, conf.UsedKeys()["queueKey"])
+}
+
+func TestUsedKeysNamespaced(t *testing.T) {
+	conf := newTestConf()
+	conf.QueueKey = "queue"
+	conf.Namespace = "corpA"
+	assert.NoError(t, conf.Validate())
+	assert.Equal(
+		t,
+		map[string]string{
+			"queueKey":            "corpA:queue",
+			"channelQuery":        "corpA:mquerysru",
+			"channelResultPrefix": "corpA:res",
+			"resultSetKeyPrefix":  "corpA:" + DefaultResultSetKeyPrefix,
+			"storedResultPrefix":  "corpA:" + DefaultStoredResultPrefix,
+		},
+		conf.UsedKeys(),
+	)
+}
+
+func TestValidateKeysUniqueness(t *testing.T) {
+	conf := newTestConf()
+	conf.QueueKey = "mquerysru"
+	assert.ErrorContains(t, conf.Validate(), "use the same name")
+
+	conf = newTestConf()
+	conf.QueueKey = "res:queue"
+	assert.ErrorContains(t, conf.Validate(), "collides with keys derived from redis.channelResultPrefix")
+
+	conf = newTestConf()
+	conf.Namespace = "corp A"
+	assert.Error(t, conf.Validate())
+}
+
+func TestValidateRejectsNegativeValues(t *testing.T) {
+	cases := []struct {
+		name   string
+		modify func(conf *Conf)
+	}{
+		{"workersGracePeriodSecs", func(conf *Conf) { conf.WorkersGracePeriodSecs = -1 }},
+		{"searchAnswerTimeoutSecs", func(conf *Conf) { conf.SearchAnswerTimeoutSecs = -1 }},
+		{"poolSize", func(conf *Conf) { conf.PoolSize = -1 }},
+		{"minIdleConns", func(conf *Conf) { conf.MinIdleConns = -1 }},
+		{"dialTimeoutSecs", func(conf *Conf) { conf.DialTimeoutSecs = -1 }},
+		{"readTimeoutSecs", func(conf *Conf) { conf.ReadTimeoutSecs = -1 }},
+		{"blockingDequeueSecs", func(conf *Conf) { conf.BlockingDequeueSecs = -1 }},
+		{"maxOutstandingQueries", func(conf *Conf) { conf.MaxOutstandingQueries = -1 }},
+		{"outstandingQueriesWaitSecs", func(conf *Conf) { conf.OutstandingQueriesWaitSecs = -1 }},
+		{"storedResultTTLSecs", func(conf *Conf) { conf.StoredResultTTLSecs = -1 }},
+	}
+	for _, c := range cases {
+		conf := newTestConf()
+		c.modify(conf)
+		assert.ErrorContains(t, conf.Validate(), "redis."+c.name, c.name)
+	}
+}
+
+// writeTestCert creates a self-signed certificate and its key
+// and returns paths of the respective PEM files
+func writeTestCert(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	assert.NoError(t, os.WriteFile(
+		certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	assert.NoError(t, os.WriteFile(
+		keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certPath, keyPath
+}
+
+func TestTLSConfig(t *testing.T) {
+	certPath, keyPath := writeTestCert(t)
+	invalidPath := filepath.Join(t.TempDir(), "invalid.pem")
+	assert.NoError(t, os.WriteFile(invalidPath, []byte("not a certificate"), 0644))
+	missingPath := filepath.Join(t.TempDir(), "missing.pem")
+
+	cases := []struct {
+		name   string
+		tls    *TLSConf
+		errMsg string
+	}{
+		{"not configured", nil, ""},
+		{"disabled", &TLSConf{CACertFile: missingPath}, ""},
+		{"system CAs", &TLSConf{Enabled: true}, ""},
+		{"custom CA", &TLSConf{Enabled: true, CACertFile: certPath}, ""},
+		{"client cert", &TLSConf{Enabled: true, CertFile: certPath, KeyFile: keyPath}, ""},
+		{"missing CA", &TLSConf{Enabled: true, CACertFile: missingPath}, "caCertFile"},
+		{"invalid CA", &TLSConf{Enabled: true, CACertFile: invalidPath}, "no valid certificate"},
+		{"missing cert", &TLSConf{Enabled: true, CertFile: missingPath, KeyFile: keyPath}, "client certificate"},
+		{"invalid cert", &TLSConf{Enabled: true, CertFile: invalidPath, KeyFile: keyPath}, "client certificate"},
+		{"missing key", &TLSConf{Enabled: true, CertFile: certPath}, "client certificate"},
+	}
+	for _, c := range cases {
+		conf := newTestConf()
+		conf.TLS = c.tls
+		tlsConf, err := conf.TLSConfig()
+		if c.errMsg != "" {
+			assert.ErrorContains(t, err, c.errMsg, c.name)
+			assert.ErrorContains(t, conf.Validate(), c.errMsg, c.name)
+			continue
+		}
+		assert.NoError(t, err, c.name)
+		assert.NoError(t, conf.Validate(), c.name)
+		if c.tls == nil || !c.tls.Enabled {
+			assert.Nil(t, tlsConf, c.name)
+			continue
+		}
+		if assert.NotNil(t, tlsConf, c.name) {
+			assert.Equal(t, "localhost", tlsConf.ServerName, c.name)
+			assert.Equal(t, c.tls.CACertFile != "", tlsConf.RootCAs != nil, c.name)
+			assert.Equal(t, c.tls.CertFile != "", len(tlsConf.Certificates) == 1, c.name)
+		}
+	}
+}
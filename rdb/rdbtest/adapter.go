@@ -0,0 +1,108 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+// Package rdbtest provides an in-memory implementation
+// of rdb.QueryPublisher for testing query producers (handlers)
+// without Redis and workers.
+package rdbtest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/czcorpus/mquery-sru/rdb"
+	"github.com/czcorpus/mquery-sru/result"
+)
+
+// Responder creates a (canned) result for a published query
+type Responder func(query rdb.Query) *rdb.WorkerResult
+
+// Adapter is an in-memory rdb.QueryPublisher answering published
+// queries by a Responder instead of passing them to workers.
+// All the published queries are recorded (see Published).
+type Adapter struct {
+
+	// NumListeners is reported as the number of listening workers
+	NumListeners int
+
+	respond   Responder
+	published []rdb.Query
+	mu        sync.Mutex
+}
+
+// NumQueryListeners returns NumListeners
+func (a *Adapter) NumQueryListeners() (int, error) {
+	return a.NumListeners, nil
+}
+
+// PublishQuery records the query and returns its result
+// created by the adapter's Responder
+func (a *Adapter) PublishQuery(query rdb.Query) (<-chan *rdb.WorkerResult, error) {
+	a.mu.Lock()
+	a.published = append(a.published, query)
+	a.mu.Unlock()
+	ans := make(chan *rdb.WorkerResult, 1)
+	ans <- a.respond(query)
+	close(ans)
+	return ans, nil
+}
+
+// PublishQueryCached works the same way as PublishQuery
+// (i.e. there is no result set cache)
+func (a *Adapter) PublishQueryCached(query rdb.Query, ttl time.Duration) (<-chan *rdb.WorkerResult, error) {
+	return a.PublishQuery(query)
+}
+
+// Published returns all the queries published so far
+func (a *Adapter) Published() []rdb.Query {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	ans := make([]rdb.Query, len(a.published))
+	copy(ans, a.published)
+	return ans
+}
+
+// NewAdapter creates a new adapter with a single
+// listening worker answering queries by respond
+func NewAdapter(respond Responder) *Adapter {
+	return &Adapter{NumListeners: 1, respond: respond}
+}
+
+// ConcExampleResponder creates a Responder answering
+// all the queries with the provided concordance
+func ConcExampleResponder(concEx result.ConcExample) Responder {
+	return func(query rdb.Query) *rdb.WorkerResult {
+		res := concEx
+		res.ResultType = query.ResultType
+		ans, err := rdb.CreateWorkerResult(&res)
+		if err != nil {
+			return ErrorResponder(err.Error())(query)
+		}
+		return ans
+	}
+}
+
+// ErrorResponder creates a Responder answering all the queries
+// with an error (as a worker does in case a search fails)
+func ErrorResponder(msg string) Responder {
+	return func(query rdb.Query) *rdb.WorkerResult {
+		ans := new(rdb.WorkerResult)
+		ans.AttachValue(&result.ErrorResult{ResultType: query.ResultType, Error: msg})
+		return ans
+	}
+}
@@ -20,13 +20,40 @@ package result
 
 import "errors"
 
+const (
+	// ErrorTypeTimeout marks errors caused by a worker
+	// not providing a result in time
+	ErrorTypeTimeout = "timeout"
+)
+
+// TimeoutError is returned in case a worker has not provided
+// a result in time (i.e. the query was probably not processed
+// due to high load).
+type TimeoutError struct {
+	Message string
+}
+
+func (err TimeoutError) Error() string {
+	return err.Message
+}
+
+// newError creates an error based on the serialized error message
+// and type (see e.g. ErrorTypeTimeout)
+func newError(msg, errorType string) error {
+	if errorType == ErrorTypeTimeout {
+		return TimeoutError{Message: msg}
+	}
+	return errors.New(msg)
+}
+
 type ErrorResult struct {
 	ResultType ResultType `json:"resultType"`
 	Error      string     `json:"error"`
+	ErrorType  string     `json:"errorType,omitempty"`
 }
 
 func (res *ErrorResult) Err() error {
-	return errors.New(res.Error)
+	return newError(res.Error, res.ErrorType)
 }
 
 func (res *ErrorResult) Type() ResultType {
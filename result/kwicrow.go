@@ -0,0 +1,202 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package result
+
+import (
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/czcorpus/mquery-sru/backlink"
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/corpus/conc"
+
+	"github.com/rs/zerolog/log"
+)
+
+// KWICRow is an SRU version independent representation
+// of a searchRetrieve record (i.e. a concordance line
+// of a searched resource)
+type KWICRow struct {
+	Resource *corpus.CorpusSetup
+	Line     *conc.ConcordanceLine
+	KWIC     conc.KWICLine
+
+	// RefURL is a reference to the line created from the resource's
+	// reference template or a link to the line in KonText
+	// (empty if neither is configured for the resource)
+	RefURL string
+
+	// SentenceRef identifies the sentence of the line (see
+	// corpus.CorpusSetup.SentenceRefAttr). It is empty in case
+	// the attribute is not configured or the line is not within
+	// a sentence.
+	SentenceRef string
+}
+
+// HitsData creates a representation of the row as required
+// by the "application/x-clarin-fcs-hits+xml" data view.
+// Each hit (see conc.KWICLine.Hits) is represented by
+// a single `Hit` element.
+func (row KWICRow) HitsData() string {
+	return row.KWIC.PackHits("<hits:Hit>", "</hits:Hit>")
+}
+
+// PlainTextRecord creates a plain text (i.e. not escaped) representation
+// of the row with the following fields separated by `sep`:
+// position, resource PID, left context, KWIC, right context.
+// Line breaks and separators within fields are replaced by spaces
+// so the record is always a single line with exactly five fields.
+func (row KWICRow) PlainTextRecord(position int, sep string) string {
+	fields := []string{
+		strconv.Itoa(position),
+		row.Resource.PID,
+		row.KWIC.Left.JoinWords(plainTextWord),
+		row.KWIC.KWIC.JoinWords(plainTextWord),
+		row.KWIC.Right.JoinWords(plainTextWord),
+	}
+	for i, field := range fields {
+		fields[i] = strings.Join(strings.FieldsFunc(field, func(r rune) bool {
+			return r == '\n' || r == '\r'
+		}), " ")
+		fields[i] = strings.ReplaceAll(fields[i], sep, " ")
+	}
+	return strings.Join(fields, sep)
+}
+
+func plainTextWord(token *conc.Token) string {
+	return html.UnescapeString(token.Word)
+}
+
+// KWICRowReader builds rows from lines fetched from a line selector
+// one by one. Unlike BuildKWICRows, it allows for processing (e.g. writing
+// to a client) each row before the next one is created so the rows
+// do not have to be kept in memory all at once.
+type KWICRowReader struct {
+	lineSel     *RoundRobinLineSel
+	maxRows     int
+	numRead     int
+	resources   corpus.SrchResources
+	usedQueries map[string]string
+	maxContext  int
+}
+
+// CountRows returns the number of rows (mapped by resource IDs) the reader
+// is going to provide. The line selector is not affected by the call.
+// An error is returned in case any of the lines belongs to an unknown
+// resource (i.e. the reader would fail to provide the line).
+func (rr *KWICRowReader) CountRows() (map[string]int, error) {
+	lineSel := rr.lineSel.clone()
+	ans := make(map[string]int)
+	for numRead := rr.numRead; numRead < rr.maxRows && lineSel.Next(); numRead++ {
+		res, err := rr.resources.GetResource(lineSel.CurrRscName())
+		if err != nil {
+			return nil, err
+		}
+		ans[res.ID]++
+	}
+	return ans, nil
+}
+
+// Next fetches the next line and transforms it into a row.
+// Once there are no more lines (or the maximum number of rows
+// has been reached), false is returned.
+func (rr *KWICRowReader) Next() (KWICRow, bool, error) {
+	if rr.numRead >= rr.maxRows || !rr.lineSel.Next() {
+		return KWICRow{}, false, nil
+	}
+	rr.numRead++
+	res, err := rr.resources.GetResource(rr.lineSel.CurrRscName())
+	if err != nil {
+		return KWICRow{}, false, err
+	}
+	line := rr.lineSel.CurrLine()
+	var sentenceRef string
+	if res.SentenceRefAttr != "" {
+		sentenceRef = line.StructAttr(res.SentenceRefAttr)
+	}
+	var refURL string
+	if res.RefTemplate != "" {
+		vars := map[string]string{
+			backlink.RefVarPosition: strings.TrimPrefix(line.Ref, "#"),
+			backlink.RefVarSentence: sentenceRef,
+		}
+		for _, attr := range res.RefStructAttrs {
+			vars[attr] = line.StructAttr(attr)
+		}
+		refURL = backlink.GenerateFromTemplate(res.RefTemplate, vars)
+
+	} else if res.KontextBacklinkRootURL != "" {
+		refURL, err = backlink.GenerateForKonText(
+			res.KontextBacklinkRootURL, res.ID, rr.usedQueries[res.ID], line.Ref)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to generate ResourceFragment URL")
+		}
+	}
+	return KWICRow{
+		Resource:    res,
+		Line:        line,
+		KWIC:        conc.NewKWICLine(line.Text).TruncateContext(rr.maxContext),
+		RefURL:      refURL,
+		SentenceRef: sentenceRef,
+	}, true, nil
+}
+
+// NewKWICRowReader creates a reader providing up to maxRows rows
+// from lineSel. The `usedQueries` argument maps resource IDs to queries
+// used to search them (this is required for backlinks). The left and right
+// context of rows is truncated to `maxContext` tokens (zero = no limit).
+func NewKWICRowReader(
+	lineSel *RoundRobinLineSel,
+	maxRows int,
+	resources corpus.SrchResources,
+	usedQueries map[string]string,
+	maxContext int,
+) *KWICRowReader {
+	return &KWICRowReader{
+		lineSel:     lineSel,
+		maxRows:     maxRows,
+		resources:   resources,
+		usedQueries: usedQueries,
+		maxContext:  maxContext,
+	}
+}
+
+// BuildKWICRows fetches up to maxRows lines from lineSel and transforms
+// them into rows (see NewKWICRowReader for the arguments).
+func BuildKWICRows(
+	lineSel *RoundRobinLineSel,
+	maxRows int,
+	resources corpus.SrchResources,
+	usedQueries map[string]string,
+	maxContext int,
+) ([]KWICRow, error) {
+	reader := NewKWICRowReader(lineSel, maxRows, resources, usedQueries, maxContext)
+	ans := make([]KWICRow, 0, maxRows)
+	for {
+		row, ok, err := reader.Next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return ans, nil
+		}
+		ans = append(ans, row)
+	}
+}
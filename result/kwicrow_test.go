@@ -0,0 +1,211 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package result
+
+import (
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/corpus"
+	"github.com/czcorpus/mquery-sru/corpus/conc"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildKWICRows(t *testing.T) {
+	resources := corpus.SrchResources{
+		{ID: "corp1", KontextBacklinkRootURL: "https://kontext.example.org"},
+		{ID: "corp2"},
+	}
+	r := NewRoundRobinLineSel(3, "corp1", "corp2")
+	r.SetRscLines("corp1", ConcExample{Lines: []conc.ConcordanceLine{
+		{Ref: "#10", Text: conc.TokenSlice{{Word: "foo1", Strong: true}, {Word: "bar"}}},
+		{Ref: "#20", Text: conc.TokenSlice{{Word: "foo2", Strong: true}}},
+	}})
+	r.SetRscLines("corp2", ConcExample{Lines: []conc.ConcordanceLine{
+		{Ref: "#30", Text: conc.TokenSlice{{Word: "baz1", Strong: true}}},
+	}})
+	rows, err := BuildKWICRows(r, 2, resources, map[string]string{"corp1": `[word="foo.*"]`}, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 2) {
+		assert.Equal(t, "corp1", rows[0].Resource.ID)
+		assert.Equal(t, "#10", rows[0].Line.Ref)
+		assert.Contains(t, rows[0].RefURL, "https://kontext.example.org")
+		assert.Len(t, rows[0].KWIC.KWIC, 1)
+		assert.Len(t, rows[0].KWIC.Right, 1)
+		assert.Equal(t, "corp2", rows[1].Resource.ID)
+		assert.Equal(t, "#30", rows[1].Line.Ref)
+		assert.Empty(t, rows[1].RefURL)
+	}
+}
+
+func TestBuildKWICRowsTruncatesContext(t *testing.T) {
+	text := make(conc.TokenSlice, 0, 2001)
+	for i := 0; i < 2001; i++ {
+		text = append(text, &conc.Token{Word: "w", Strong: i == 1000})
+	}
+	r := NewRoundRobinLineSel(1, "corp1")
+	r.SetRscLines("corp1", ConcExample{Lines: []conc.ConcordanceLine{{Ref: "#10", Text: text}}})
+	rows, err := BuildKWICRows(r, 1, corpus.SrchResources{{ID: "corp1", PID: "corp1"}}, nil, 2)
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 1) {
+		assert.Equal(t, "… w w <hits:Hit>w</hits:Hit> w w …", rows[0].HitsData())
+		assert.Equal(t, "1\tcorp1\t… w w\tw\tw w …", rows[0].PlainTextRecord(1, "\t"))
+		// the original line is kept complete
+		assert.Len(t, rows[0].Line.Text, 2001)
+	}
+}
+
+func TestBuildKWICRowsRefTemplate(t *testing.T) {
+	resources := corpus.SrchResources{
+		{
+			ID:              "corp1",
+			RefStructAttrs:  []string{"doc.id"},
+			SentenceRefAttr: "s.n",
+			RefTemplate:     "https://example.org/{doc.id}/s{sentence}?pos={pos}",
+			// the template takes precedence over KonText backlinks
+			KontextBacklinkRootURL: "https://kontext.example.org",
+		},
+	}
+	r := NewRoundRobinLineSel(2, "corp1")
+	r.SetRscLines("corp1", ConcExample{Lines: []conc.ConcordanceLine{
+		{
+			Ref:         "#10",
+			Text:        conc.TokenSlice{{Word: "foo", Strong: true}},
+			StructAttrs: map[string]string{"doc.id": "doc 1", "s.n": "12"},
+		},
+		{
+			Ref:         "#20",
+			Text:        conc.TokenSlice{{Word: "bar", Strong: true}},
+			StructAttrs: map[string]string{"doc.id": "doc2", "s.n": "===NONE==="},
+		},
+	}})
+	rows, err := BuildKWICRows(r, 2, resources, nil, 0)
+	assert.NoError(t, err)
+	if assert.Len(t, rows, 2) {
+		assert.Equal(t, "12", rows[0].SentenceRef)
+		assert.Equal(t, "https://example.org/doc%201/s12?pos=10", rows[0].RefURL)
+		// a line outside a sentence
+		assert.Equal(t, "", rows[1].SentenceRef)
+		assert.Equal(t, "https://example.org/doc2/s?pos=20", rows[1].RefURL)
+	}
+}
+
+func TestBuildKWICRowsUnknownResource(t *testing.T) {
+	r := NewRoundRobinLineSel(1, "corp1")
+	r.SetRscLines("corp1", ConcExample{Lines: []conc.ConcordanceLine{
+		{Text: conc.TokenSlice{{Word: "foo1"}}},
+	}})
+	_, err := BuildKWICRows(r, 1, corpus.SrchResources{}, nil, 0)
+	assert.Error(t, err)
+}
+
+func TestKWICRowReaderCountRows(t *testing.T) {
+	resources := corpus.SrchResources{{ID: "corp1"}, {ID: "corp2"}}
+	r := NewRoundRobinLineSel(3, "corp1", "corp2")
+	r.SetRscLines("corp1", ConcExample{Lines: []conc.ConcordanceLine{
+		{Ref: "#10", Text: conc.TokenSlice{{Word: "foo1", Strong: true}}},
+		{Ref: "#20", Text: conc.TokenSlice{{Word: "foo2", Strong: true}}},
+		{Ref: "#30", Text: conc.TokenSlice{{Word: "foo3", Strong: true}}},
+	}})
+	r.SetRscLines("corp2", ConcExample{Lines: []conc.ConcordanceLine{
+		{Ref: "#40", Text: conc.TokenSlice{{Word: "baz1", Strong: true}}},
+	}})
+	reader := NewKWICRowReader(r, 3, resources, nil, 0)
+	counts, err := reader.CountRows()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"corp1": 2, "corp2": 1}, counts)
+
+	// counting does not affect reading
+	refs := make([]string, 0, 3)
+	for {
+		row, ok, err := reader.Next()
+		assert.NoError(t, err)
+		if !ok {
+			break
+		}
+		refs = append(refs, row.Line.Ref)
+	}
+	assert.Equal(t, []string{"#10", "#40", "#20"}, refs)
+	counts, err = reader.CountRows()
+	assert.NoError(t, err)
+	assert.Empty(t, counts)
+}
+
+func TestKWICRowReaderCountRowsUnknownResource(t *testing.T) {
+	r := NewRoundRobinLineSel(1, "corp1")
+	r.SetRscLines("corp1", ConcExample{Lines: []conc.ConcordanceLine{
+		{Text: conc.TokenSlice{{Word: "foo1"}}},
+	}})
+	_, err := NewKWICRowReader(r, 1, corpus.SrchResources{}, nil, 0).CountRows()
+	assert.Error(t, err)
+}
+
+func TestKWICRowHitsData(t *testing.T) {
+	row := KWICRow{
+		KWIC: conc.NewKWICLine(conc.TokenSlice{
+			{Word: "the"},
+			{Word: "big", Strong: true},
+			{Word: "dog", Strong: true},
+			{Word: ".", NoSpaceBefore: true},
+		}),
+	}
+	assert.Equal(t, "the <hits:Hit>big dog</hits:Hit>.", row.HitsData())
+}
+
+func TestKWICRowHitsDataSeparatedHits(t *testing.T) {
+	row := KWICRow{
+		KWIC: conc.NewKWICLine(conc.TokenSlice{
+			{Word: "a"},
+			{Word: "big", Strong: true},
+			{Word: "and"},
+			{Word: "lazy"},
+			{Word: "dog", Strong: true},
+			{Word: "barks"},
+		}),
+	}
+	assert.Equal(
+		t,
+		"a <hits:Hit>big</hits:Hit> and lazy <hits:Hit>dog</hits:Hit> barks",
+		row.HitsData(),
+	)
+}
+
+func TestKWICRowPlainTextRecord(t *testing.T) {
+	row := KWICRow{
+		Resource: &corpus.CorpusSetup{PID: "corp:1"},
+		KWIC: conc.NewKWICLine(conc.TokenSlice{
+			{Word: "Tom"},
+			{Word: "&amp;"},
+			{Word: "Jerry", Strong: true},
+			{Word: "ran\tfast"},
+			{Word: "away\n"},
+			{Word: ".", NoSpaceBefore: true},
+		}),
+	}
+	assert.Equal(
+		t,
+		"3\tcorp:1\tTom &\tJerry\tran fast away .",
+		row.PlainTextRecord(3, "\t"),
+	)
+	assert.Equal(
+		t,
+		"3|corp:1|Tom &|Jerry|ran\tfast away .",
+		row.PlainTextRecord(3, "|"),
+	)
+}
@@ -19,9 +19,8 @@
 package result
 
 import (
-	"errors"
-
 	"github.com/czcorpus/mquery-sru/corpus/conc"
+	"github.com/czcorpus/mquery-sru/mango"
 )
 
 const (
@@ -53,18 +52,47 @@ type SerializableResult interface {
 type ConcExample struct {
 	Lines      []conc.ConcordanceLine `json:"lines"`
 	ConcSize   int                    `json:"concSize"`
+	CorpusSize int64                  `json:"corpusSize"`
 	ResultType ResultType             `json:"resultType"`
 	Query      string                 `json:"query"`
 	Error      string                 `json:"error"`
+	ErrorType  string                 `json:"errorType,omitempty"`
+}
+
+// CutLines limits lines to the range [from, from+maxItems). The result
+// is expected to contain lines starting from the first concordance line
+// (e.g. a cached result set window). For `from` beyond the concordance
+// size, the error is set the same way a worker would do.
+func (res *ConcExample) CutLines(from, maxItems int) {
+	if res.ConcSize < from {
+		res.Error = mango.ErrRowsRangeOutOfConc.Error()
+		res.Lines = []conc.ConcordanceLine{}
+		return
+	}
+	if from > len(res.Lines) {
+		from = len(res.Lines)
+	}
+	to := from + maxItems
+	if to > len(res.Lines) {
+		to = len(res.Lines)
+	}
+	res.Lines = res.Lines[from:to]
 }
 
 func (res *ConcExample) Err() error {
 	if res.Error != "" {
-		return errors.New(res.Error)
+		return newError(res.Error, res.ErrorType)
 	}
 	return nil
 }
 
+// IsTimeout tells whether the result is missing because
+// a worker has not provided it in time
+func (res *ConcExample) IsTimeout() bool {
+	_, ok := res.Err().(TimeoutError)
+	return ok
+}
+
 func (res *ConcExample) Type() ResultType {
 	return res.ResultType
 }
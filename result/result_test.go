@@ -0,0 +1,80 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package result
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/czcorpus/mquery-sru/corpus/conc"
+	"github.com/czcorpus/mquery-sru/mango"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createConcExampleWindow(concSize, numLines int) ConcExample {
+	ans := ConcExample{ConcSize: concSize}
+	for i := 0; i < numLines; i++ {
+		ans.Lines = append(
+			ans.Lines,
+			conc.ConcordanceLine{Text: conc.TokenSlice{&conc.Token{Word: fmt.Sprintf("foo%d", i)}}},
+		)
+	}
+	return ans
+}
+
+func TestCutLines(t *testing.T) {
+	res := createConcExampleWindow(100, 10)
+	res.CutLines(4, 3)
+	assert.NoError(t, res.Err())
+	assert.Equal(t, 3, res.NumLines())
+	assert.Equal(t, "foo4", res.Lines[0].Text[0].Word)
+}
+
+func TestCutLinesBeyondWindow(t *testing.T) {
+	res := createConcExampleWindow(8, 8)
+	res.CutLines(6, 4)
+	assert.NoError(t, res.Err())
+	assert.Equal(t, 2, res.NumLines())
+
+	res = createConcExampleWindow(8, 8)
+	res.CutLines(8, 4)
+	assert.NoError(t, res.Err())
+	assert.Equal(t, 0, res.NumLines())
+}
+
+func TestCutLinesOutOfConc(t *testing.T) {
+	res := createConcExampleWindow(8, 8)
+	res.CutLines(9, 4)
+	assert.Equal(t, mango.ErrRowsRangeOutOfConc.Error(), res.Error)
+	assert.Equal(t, 0, res.NumLines())
+}
+
+func TestTimeoutError(t *testing.T) {
+	res := ConcExample{Error: "worker result timeouted (1s)", ErrorType: ErrorTypeTimeout}
+	assert.True(t, res.IsTimeout())
+	assert.Equal(t, TimeoutError{Message: "worker result timeouted (1s)"}, res.Err())
+
+	res = ConcExample{Error: "failed to search"}
+	assert.False(t, res.IsTimeout())
+	assert.EqualError(t, res.Err(), "failed to search")
+
+	res = ConcExample{}
+	assert.False(t, res.IsTimeout())
+}
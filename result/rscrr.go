@@ -82,6 +82,15 @@ func (r *RoundRobinLineSel) iterationStarted() bool {
 	return false
 }
 
+// clone creates a copy of the selector which can be iterated
+// independently (concordance lines are shared though)
+func (r *RoundRobinLineSel) clone() *RoundRobinLineSel {
+	ans := *r
+	ans.items = make([]item, len(r.items))
+	copy(ans.items, r.items)
+	return &ans
+}
+
 // SetRscLines sets concordance data for a resource (corpus).
 // The method can be called only if the `Next()` method has not
 // been called yet. Otherwise the call panics.
@@ -99,6 +108,17 @@ func (r *RoundRobinLineSel) SetRscLines(rsc string, c ConcExample) {
 	panic("unknown resource")
 }
 
+// SetRscLinesAt sets concordance data for idx-th resource.
+// Unlike SetRscLines, this works also in case the same resource
+// name is present multiple times. The same restriction regarding
+// `Next()` applies.
+func (r *RoundRobinLineSel) SetRscLinesAt(idx int, c ConcExample) {
+	if r.iterationStarted() {
+		panic("cannot add resource lines to an already iterating RoundRobinLineSel")
+	}
+	r.items[idx].Lines = c
+}
+
 // RscSetErrorAt sets and error for idx-th resource. With that,
 // the iteration may continue, but the errored resource is skipped.
 func (r *RoundRobinLineSel) RscSetErrorAt(idx int, err error) {
@@ -168,28 +188,28 @@ func (r *RoundRobinLineSel) Next() bool {
 	}
 
 	if !r.items[r.currIdx].Started {
-		r.nextOutputLineIdx++
 		r.items[r.currIdx].Started = true
 		if len(r.items[r.currIdx].Lines.Lines) > 0 {
+			r.nextOutputLineIdx++
 			return true
 		}
 	}
 
+	// note: only returned lines are counted, resources
+	// which have run out of lines are just skipped
 	for i := 0; i < len(r.items); i++ {
-		r.nextOutputLineIdx++
-		if r.nextOutputLineIdx > r.maxLines {
-			return false
-		}
 		r.currIdx = (r.currIdx + 1) % len(r.items)
 		if !r.items[r.currIdx].Started {
 			r.items[r.currIdx].Started = true
 			if len(r.items[r.currIdx].Lines.Lines) > 0 {
+				r.nextOutputLineIdx++
 				return true
 			}
 			continue
 		}
 		r.items[r.currIdx].CurrLine++
 		if r.items[r.currIdx].CurrLine < len(r.items[r.currIdx].Lines.Lines) {
+			r.nextOutputLineIdx++
 			return true
 		}
 	}
@@ -208,3 +228,46 @@ func NewRoundRobinLineSel(maxLines int, items ...string) *RoundRobinLineSel {
 	}
 	return ans
 }
+
+// MergeShardResults merges results of shards (i.e. separately searched
+// corpora) of a single resource into a result of the resource. The lines
+// are taken from the shards in the round robin style in the order of the
+// provided results (see query.CalculateShardRanges). The sizes are summed
+// up. Any error of a shard (except for an exhausted shard) is an error
+// of the whole resource as partial results would be misleading.
+func MergeShardResults(maxLines int, shards ...ConcExample) ConcExample {
+	if len(shards) == 1 {
+		return shards[0]
+	}
+	ans := ConcExample{
+		Lines:      []conc.ConcordanceLine{},
+		ResultType: shards[0].ResultType,
+		Query:      shards[0].Query,
+	}
+	names := make([]string, len(shards))
+	sel := NewRoundRobinLineSel(maxLines, names...)
+	for i, shard := range shards {
+		ans.ConcSize += shard.ConcSize
+		ans.CorpusSize += shard.CorpusSize
+		if err := shard.Err(); err != nil {
+			if err.Error() != mango.ErrRowsRangeOutOfConc.Error() {
+				ans.Error = shard.Error
+				ans.ErrorType = shard.ErrorType
+				return ans
+			}
+			sel.RscSetErrorAt(i, err)
+			continue
+		}
+		sel.SetRscLinesAt(i, shard)
+	}
+	if sel.AllHasOutOfRangeError() {
+		ans.Error = mango.ErrRowsRangeOutOfConc.Error()
+		return ans
+	}
+	for sel.Next() {
+		if line := sel.CurrLine(); line != nil {
+			ans.Lines = append(ans.Lines, *line)
+		}
+	}
+	return ans
+}
@@ -19,9 +19,12 @@
 package result
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/czcorpus/mquery-sru/corpus/conc"
+	"github.com/czcorpus/mquery-sru/mango"
+	"github.com/czcorpus/mquery-sru/query"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -181,7 +184,7 @@ func TestWithSomeEmpty(t *testing.T) {
 	r.Next()
 	assert.Equal(t, "baz3", firstWord(r.CurrLine()))
 	assert.Equal(t, "corp3", r.CurrRscName())
-	assert.Equal(t, 9, r.nextOutputLineIdx)
+	assert.Equal(t, 6, r.nextOutputLineIdx)
 	assert.False(t, r.Next())
 	assert.Nil(t, r.CurrLine())
 }
@@ -220,6 +223,12 @@ func TestTwoResourcesOneEmpty(t *testing.T) {
 	assert.True(t, r.Next())
 	assert.Equal(t, "foo2", firstWord(r.CurrLine()))
 	assert.Equal(t, "corp1", r.CurrRscName())
+	assert.True(t, r.Next())
+	assert.Equal(t, "foo3", firstWord(r.CurrLine()))
+	assert.Equal(t, "corp1", r.CurrRscName())
+	assert.True(t, r.Next())
+	assert.Equal(t, "foo4", firstWord(r.CurrLine()))
+	assert.Equal(t, "corp1", r.CurrRscName())
 	assert.False(t, r.Next())
 	assert.Nil(t, r.CurrLine())
 }
@@ -271,3 +280,163 @@ func TestSingleResourceWithNoLines(t *testing.T) {
 	r := createSingleResourceEmptyResult()
 	assert.False(t, r.Next())
 }
+
+func TestSetRscLinesAtWithRepeatedResource(t *testing.T) {
+	r := NewRoundRobinLineSel(4, "corp1", "corp1")
+	shared := ConcExample{Lines: []conc.ConcordanceLine{
+		{Text: conc.TokenSlice{&conc.Token{Word: "foo1"}}},
+		{Text: conc.TokenSlice{&conc.Token{Word: "foo2"}}},
+	}}
+	r.SetRscLinesAt(0, shared)
+	r.SetRscLinesAt(1, shared)
+	assert.True(t, r.Next())
+	assert.Equal(t, "foo1", firstWord(r.CurrLine()))
+	assert.Equal(t, "corp1", r.CurrRscName())
+	assert.True(t, r.Next())
+	assert.Equal(t, "foo1", firstWord(r.CurrLine()))
+	assert.Equal(t, "corp1", r.CurrRscName())
+	assert.True(t, r.Next())
+	assert.Equal(t, "foo2", firstWord(r.CurrLine()))
+	assert.True(t, r.Next())
+	assert.Equal(t, "foo2", firstWord(r.CurrLine()))
+	assert.False(t, r.Next())
+}
+
+// TestLimitIgnoresExhaustedResources is a regression test - resources
+// which have run out of lines must not be counted as returned lines
+func TestLimitIgnoresExhaustedResources(t *testing.T) {
+	r := NewRoundRobinLineSel(4, "corp1", "corp2")
+	r.SetRscLines("corp1", createLines("foo", 0, 1))
+	r.SetRscLines("corp2", createLines("bar", 0, 5))
+	words := make([]string, 0, 4)
+	for r.Next() {
+		words = append(words, firstWord(r.CurrLine()))
+	}
+	assert.Equal(t, []string{"foo0", "bar0", "bar1", "bar2"}, words)
+}
+
+func createLines(prefix string, from, to int) ConcExample {
+	ans := ConcExample{Lines: make([]conc.ConcordanceLine, 0, to-from)}
+	for i := from; i < to; i++ {
+		ans.Lines = append(
+			ans.Lines,
+			conc.ConcordanceLine{Text: conc.TokenSlice{&conc.Token{Word: fmt.Sprintf("%s%d", prefix, i)}}},
+		)
+	}
+	return ans
+}
+
+func TestPositionsAcrossPages(t *testing.T) {
+	sizes := map[string]int{"c1": 3, "c2": 8}
+	prefixes := map[string]string{"c1": "foo", "c2": "bar"}
+	expected := []string{
+		"foo0", "bar0", "foo1", "bar1", "foo2", "bar2",
+		"bar3", "bar4", "bar5", "bar6", "bar7",
+	}
+	pageSize := 4
+	positions := make(map[int]string)
+	for startRecord := 1; startRecord <= len(expected); startRecord += pageSize {
+		ranges := query.CalculatePartialRangesBySizes(
+			[]string{"c1", "c2"}, sizes, startRecord-1, pageSize)
+		r := NewRoundRobinLineSel(pageSize, ranges.PIDList()...)
+		for i, rng := range ranges {
+			to := rng.To
+			if to > sizes[rng.Rsc] {
+				to = sizes[rng.Rsc]
+			}
+			r.SetRscLinesAt(i, createLines(prefixes[rng.Rsc], rng.From, to))
+		}
+		var numRecords int
+		for r.Next() {
+			positions[startRecord+numRecords] = firstWord(r.CurrLine())
+			numRecords++
+		}
+	}
+	assert.Len(t, positions, len(expected))
+	for i, word := range expected {
+		assert.Equal(t, word, positions[i+1], "position %d", i+1)
+	}
+}
+
+// fetchPage simulates workers providing lines for the ranges
+func fetchPage(sizes map[string]int, ranges query.LineRangeList, pageSize int) *RoundRobinLineSel {
+	r := NewRoundRobinLineSel(pageSize, ranges.PIDList()...)
+	for i, rng := range ranges {
+		res := createLines(rng.Rsc, 0, sizes[rng.Rsc])
+		res.ConcSize = sizes[rng.Rsc]
+		res.CutLines(rng.From, pageSize)
+		if err := res.Err(); err != nil {
+			r.RscSetErrorAt(i, err)
+		}
+		r.SetRscLinesAt(i, res)
+	}
+	return r
+}
+
+func TestStartRecordAfterLastRecord(t *testing.T) {
+	sizes := map[string]int{"c1": 2, "c2": 3}
+	ranges := query.CalculatePartialRangesBySizes([]string{"c1", "c2"}, sizes, 5, 4)
+	r := fetchPage(sizes, ranges, 4)
+	// resources are exhausted exactly at the requested position so
+	// they do not report an error - the caller must check the position
+	assert.False(t, r.AllHasOutOfRangeError())
+	assert.False(t, r.Next())
+	assert.True(t, query.IsStartRecordOutOfRange(6, 5))
+}
+
+func TestStartRecordWithSomeResourcesExhausted(t *testing.T) {
+	sizes := map[string]int{"c1": 2, "c2": 10}
+	ranges := query.CalculatePartialRanges([]string{"c1", "c2"}, 8, 4)
+	r := fetchPage(sizes, ranges, 4)
+	assert.Error(t, r.GetFirstError())
+	assert.False(t, r.AllHasOutOfRangeError())
+	assert.False(t, r.HasFatalError())
+	words := make([]string, 0, 4)
+	for r.Next() {
+		words = append(words, firstWord(r.CurrLine()))
+	}
+	assert.Equal(t, []string{"c24", "c25", "c26", "c27"}, words)
+	assert.False(t, query.IsStartRecordOutOfRange(9, 12))
+}
+
+func TestMergeShardResults(t *testing.T) {
+	shard1 := ConcExample{ConcSize: 2, CorpusSize: 100, Query: "q", Lines: []conc.ConcordanceLine{
+		{Text: conc.TokenSlice{&conc.Token{Word: "a1"}}},
+		{Text: conc.TokenSlice{&conc.Token{Word: "a2"}}},
+	}}
+	shard2 := ConcExample{ConcSize: 10, CorpusSize: 200, Query: "q", Lines: []conc.ConcordanceLine{
+		{Text: conc.TokenSlice{&conc.Token{Word: "b1"}}},
+		{Text: conc.TokenSlice{&conc.Token{Word: "b2"}}},
+		{Text: conc.TokenSlice{&conc.Token{Word: "b3"}}},
+		{Text: conc.TokenSlice{&conc.Token{Word: "b4"}}},
+	}}
+	ans := MergeShardResults(5, shard1, shard2)
+	assert.NoError(t, ans.Err())
+	assert.Equal(t, 12, ans.ConcSize)
+	assert.Equal(t, int64(300), ans.CorpusSize)
+	assert.Equal(t, "q", ans.Query)
+	words := make([]string, 0, len(ans.Lines))
+	for _, line := range ans.Lines {
+		words = append(words, line.Text[0].Word)
+	}
+	assert.Equal(t, []string{"a1", "b1", "a2", "b2", "b3"}, words)
+}
+
+func TestMergeShardResultsWithExhaustedShard(t *testing.T) {
+	shard1 := ConcExample{ConcSize: 2, Lines: []conc.ConcordanceLine{}, Error: mango.ErrRowsRangeOutOfConc.Error()}
+	shard2 := ConcExample{ConcSize: 10, Lines: []conc.ConcordanceLine{
+		{Text: conc.TokenSlice{&conc.Token{Word: "b1"}}},
+	}}
+	ans := MergeShardResults(5, shard1, shard2)
+	assert.NoError(t, ans.Err())
+	assert.Equal(t, 12, ans.ConcSize)
+	assert.Len(t, ans.Lines, 1)
+
+	ans = MergeShardResults(5, shard1, shard1)
+	assert.Equal(t, mango.ErrRowsRangeOutOfConc.Error(), ans.Error)
+	assert.Equal(t, 4, ans.ConcSize)
+
+	timeout := ConcExample{Error: "worker result timeouted (1s)", ErrorType: ErrorTypeTimeout}
+	ans = MergeShardResults(5, timeout, shard2)
+	assert.True(t, ans.IsTimeout())
+}
@@ -0,0 +1,39 @@
+#!/bin/sh
+# Downloads the official (unmodified) SRU and CLARIN FCS schemas used
+# by tests tagged `xsd` (see handler/testdata/xsd/official). Tests
+# validating against the official schemas are skipped until the schemas
+# are downloaded. Schemas referring to each other by absolute URLs are
+# resolved locally via handler/testdata/xsd/official/catalog.xml so
+# the validation works offline (xmllint --nonet).
+#
+# usage: scripts/fetch-xsd.sh
+
+set -e
+
+SRU20_URL="https://docs.oasis-open.org/search-ws/searchRetrieve/v1.0/os/schemas"
+SRU12_URL="https://www.loc.gov/standards/sru/sru-1-2-archive/xml-files"
+FCS_URL="https://www.clarin.eu/sites/default/files"
+
+DEST="$(dirname "$0")/../handler/testdata/xsd/official"
+
+fetch() {
+    mkdir -p "$DEST/$1"
+    echo "fetching $2/$3"
+    curl -fsSL -o "$DEST/$1/$3" "$2/$3"
+}
+
+# SRU 2.0 (OASIS searchRetrieve 1.0)
+fetch sru-2.0 "$SRU20_URL" sruResponse.xsd
+fetch sru-2.0 "$SRU20_URL" scan.xsd
+fetch sru-2.0 "$SRU20_URL" diagnostic.xsd
+
+# SRU 1.2 (Library of Congress)
+fetch sru-1.2 "$SRU12_URL" srw-types.xsd
+fetch sru-1.2 "$SRU12_URL" diagnostic.xsd
+fetch sru-1.2 "$SRU12_URL" xcql.xsd
+
+# CLARIN FCS 2.0
+fetch fcs "$FCS_URL" Resource.xsd
+fetch fcs "$FCS_URL" DataView-Hits.xsd
+fetch fcs "$FCS_URL" DataView-Advanced.xsd
+fetch fcs "$FCS_URL" Endpoint-Description.xsd
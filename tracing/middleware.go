@@ -0,0 +1,76 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package tracing
+
+import (
+	"github.com/czcorpus/cnc-gokit/logging"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	// HeaderRequestID is an HTTP header clients (or proxies) can use
+	// to pass their own request ID. The ID used is always echoed
+	// in the response header of the same name.
+	HeaderRequestID = "X-Request-ID"
+
+	// maxRequestIDLength limits accepted client-provided IDs
+	maxRequestIDLength = 128
+
+	ctxKeyRequestID = "requestID"
+)
+
+// isValidRequestID tests whether a client-provided ID can be safely
+// used in logs and headers (i.e. it is reasonably short and contains
+// only printable ASCII characters without spaces)
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// Middleware assigns an ID to each request. A valid ID provided by
+// the client via the `X-Request-ID` header is used, otherwise a new one
+// is generated. The ID is attached to the request log record and it is
+// sent back to the client. Handlers pass it to workers (see GetRequestID)
+// so all the log records related to a request can be found by the ID.
+func Middleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestID := ctx.GetHeader(HeaderRequestID)
+		if !isValidRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+		ctx.Set(ctxKeyRequestID, requestID)
+		ctx.Header(HeaderRequestID, requestID)
+		logging.AddLogEvent(ctx, "requestId", requestID)
+		ctx.Next()
+	}
+}
+
+// GetRequestID returns an ID of the request assigned by Middleware.
+// In case there is no such ID, an empty string is returned.
+func GetRequestID(ctx *gin.Context) string {
+	return ctx.GetString(ctxKeyRequestID)
+}
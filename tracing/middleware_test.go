@@ -0,0 +1,65 @@
+// Copyright 2024 Tomas Machalek <tomas.machalek@gmail.com>
+// Copyright 2024 Institute of the Czech National Corpus,
+//                Faculty of Arts, Charles University
+//   This file is part of MQUERY.
+//
+//  MQUERY is free software: you can redistribute it and/or modify
+//  it under the terms of the GNU General Public License as published by
+//  the Free Software Foundation, either version 3 of the License, or
+//  (at your option) any later version.
+//
+//  MQUERY is distributed in the hope that it will be useful,
+//  but WITHOUT ANY WARRANTY; without even the implied warranty of
+//  MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//  GNU General Public License for more details.
+//
+//  You should have received a copy of the GNU General Public License
+//  along with MQUERY.  If not, see <https://www.gnu.org/licenses/>.
+
+package tracing
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func handleRequest(requestID string) (*httptest.ResponseRecorder, string) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	_, engine := gin.CreateTestContext(w)
+	var seenID string
+	engine.Use(Middleware())
+	engine.GET("/", func(ctx *gin.Context) {
+		seenID = GetRequestID(ctx)
+		ctx.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	if requestID != "" {
+		req.Header.Set(HeaderRequestID, requestID)
+	}
+	engine.ServeHTTP(w, req)
+	return w, seenID
+}
+
+func TestMiddlewareAcceptsClientID(t *testing.T) {
+	w, seenID := handleRequest("abc-123")
+	assert.Equal(t, "abc-123", seenID)
+	assert.Equal(t, "abc-123", w.Header().Get(HeaderRequestID))
+}
+
+func TestMiddlewareGeneratesID(t *testing.T) {
+	for _, clientID := range []string{"", "foo bar", strings.Repeat("x", maxRequestIDLength+1)} {
+		w, seenID := handleRequest(clientID)
+		assert.NotEmpty(t, seenID)
+		assert.NotEqual(t, clientID, seenID)
+		assert.Equal(t, seenID, w.Header().Get(HeaderRequestID))
+	}
+	_, id1 := handleRequest("")
+	_, id2 := handleRequest("")
+	assert.NotEqual(t, id1, id2)
+}
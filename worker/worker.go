@@ -51,19 +51,35 @@ type Worker struct {
 	ticker     time.Ticker
 	jobLogger  jobLogger
 	currJobLog *result.JobLog
+
+	// dequeueTimeout enables blocking dequeuing of queries
+	// (zero = notification based dequeuing)
+	dequeueTimeout time.Duration
 }
 
-func (w *Worker) publishResult(res result.SerializableResult, channel string) error {
+func (w *Worker) publishResult(res result.SerializableResult, query rdb.Query) error {
 	ans, err := rdb.CreateWorkerResult(res)
 	if err != nil {
 		return err
 	}
+	log.Debug().
+		Str("requestId", query.RequestID).
+		Str("channel", query.Channel).
+		Str("func", query.Func).
+		Msg("publishing result of query")
 
 	w.currJobLog.End = time.Now()
 	w.currJobLog.Err = res.Err()
 	w.jobLogger.Log(*w.currJobLog)
 	w.currJobLog = nil
-	return w.radapter.PublishResult(channel, ans)
+	if err := w.radapter.StoreResult(query, ans); err != nil {
+		log.Error().
+			Err(err).
+			Str("requestId", query.RequestID).
+			Str("key", query.StoredResultKey).
+			Msg("failed to store result of query")
+	}
+	return w.radapter.PublishResult(query.Channel, ans)
 }
 
 func (w *Worker) tryNextQuery() error {
@@ -75,7 +91,25 @@ func (w *Worker) tryNextQuery() error {
 	} else if err != nil {
 		return err
 	}
+	return w.processQuery(query)
+}
+
+// tryNextQueryBlocking waits (up to the configured time) for a query
+// directly on the queue and processes it.
+func (w *Worker) tryNextQueryBlocking() error {
+	query, err := w.radapter.DequeueQueryBlocking(w.dequeueTimeout)
+	if err == rdb.ErrorEmptyQueue {
+		return nil
+
+	} else if err != nil {
+		return err
+	}
+	return w.processQuery(query)
+}
+
+func (w *Worker) processQuery(query rdb.Query) error {
 	log.Debug().
+		Str("requestId", query.RequestID).
 		Str("channel", query.Channel).
 		Str("func", query.Func).
 		Any("args", query.Args).
@@ -87,9 +121,9 @@ func (w *Worker) tryNextQuery() error {
 	}
 	if !isActive {
 		log.Warn().
+			Str("requestId", query.RequestID).
 			Str("func", query.Func).
 			Str("channel", query.Channel).
-			Any("args", query.Args).
 			Msg("worker found an inactive query")
 		return nil
 	}
@@ -108,19 +142,37 @@ func (w *Worker) tryNextQuery() error {
 		}
 		ans := w.concExample(args)
 		ans.ResultType = query.ResultType
-		if err := w.publishResult(ans, query.Channel); err != nil {
+		if err := w.publishResult(ans, query); err != nil {
+			return err
+		}
+	case "concSize":
+		var args rdb.ConcSizeArgs
+		if err := sonic.Unmarshal(query.Args, &args); err != nil {
+			return err
+		}
+		ans := w.concSize(args)
+		ans.ResultType = query.ResultType
+		if err := w.publishResult(ans, query); err != nil {
 			return err
 		}
 	default:
 		ans := &result.ErrorResult{Error: fmt.Sprintf("unknown query function: %s", query.Func)}
-		if err = w.publishResult(ans, query.Channel); err != nil {
+		if err = w.publishResult(ans, query); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// Listen processes incoming queries until the exit event.
+// With a non-zero dequeue timeout, the worker blocks on the
+// query queue, otherwise it dequeues queries once notified
+// (or once the ticker ticks).
 func (w *Worker) Listen() {
+	if w.dequeueTimeout > 0 {
+		w.listenBlocking()
+		return
+	}
 	for {
 		select {
 		case <-w.ticker.C:
@@ -136,6 +188,25 @@ func (w *Worker) Listen() {
 	}
 }
 
+func (w *Worker) listenBlocking() {
+	for {
+		select {
+		case <-w.exitEvent:
+			log.Info().Msg("worker exiting")
+			return
+		case <-w.messages:
+			// notifications are not needed here, we just
+			// prevent the subscription channel from filling up
+		default:
+			if err := w.tryNextQueryBlocking(); err != nil {
+				log.Error().Err(err).Msg("failed to process query")
+				// prevent busy looping e.g. in case Redis is unavailable
+				time.Sleep(DefaultTickerInterval)
+			}
+		}
+	}
+}
+
 func (w *Worker) concExample(args rdb.ConcExampleArgs) (ans *result.ConcExample) {
 	ans = new(result.ConcExample)
 	defer func() {
@@ -148,18 +219,51 @@ func (w *Worker) concExample(args rdb.ConcExampleArgs) (ans *result.ConcExample)
 	}()
 	concEx, err := mango.GetConcExamples(
 		args.CorpusPath, args.Query, args.Attrs, args.StartLine, args.MaxItems,
-		args.MaxContext, args.ViewContextStruct)
+		args.MaxContext, args.ViewContextStruct, args.StructAttrs, args.SegmentStruct)
 	if err != nil {
+		// the concordance size is also available for
+		// line ranges out of the concordance
 		ans.Error = err.Error()
+		ans.ConcSize = concEx.ConcSize
+		ans.CorpusSize = concEx.CorpusSize
 		return
 	}
 	log.Debug().
 		Str("query", args.Query).
 		Int("concSize", concEx.ConcSize).
 		Msg("obtained concordance result")
-	parser := conc.NewLineParser(args.Attrs)
+	parser := conc.NewLineParser(args.Attrs, args.StructAttrs)
 	ans.Lines = parser.Parse(concEx)
 	ans.ConcSize = concEx.ConcSize
+	ans.CorpusSize = concEx.CorpusSize
+	ans.Query = args.Query
+	return
+}
+
+// concSize obtains just the size of a concordance. The result
+// is a concordance example without any lines so it can be processed
+// the same way as results of `concExample`.
+func (w *Worker) concSize(args rdb.ConcSizeArgs) (ans *result.ConcExample) {
+	ans = &result.ConcExample{Lines: make([]conc.ConcordanceLine, 0)}
+	defer func() {
+		if r := recover(); r != nil {
+			ans = &result.ConcExample{
+				Error: fmt.Sprintf("%v", r),
+				Lines: make([]conc.ConcordanceLine, 0),
+			}
+		}
+	}()
+	concSize, err := mango.GetConcSize(args.CorpusPath, args.Query)
+	if err != nil {
+		ans.Error = err.Error()
+		return
+	}
+	log.Debug().
+		Str("query", args.Query).
+		Int64("concSize", concSize.Value).
+		Msg("obtained concordance size")
+	ans.ConcSize = int(concSize.Value)
+	ans.CorpusSize = concSize.CorpusSize
 	ans.Query = args.Query
 	return
 }
@@ -170,13 +274,15 @@ func NewWorker(
 	messages <-chan *redis.Message,
 	exitEvent chan os.Signal,
 	jobLogger jobLogger,
+	dequeueTimeout time.Duration,
 ) *Worker {
 	return &Worker{
-		ID:        workerID,
-		radapter:  radapter,
-		messages:  messages,
-		exitEvent: exitEvent,
-		ticker:    *time.NewTicker(DefaultTickerInterval),
-		jobLogger: jobLogger,
+		ID:             workerID,
+		radapter:       radapter,
+		messages:       messages,
+		exitEvent:      exitEvent,
+		ticker:         *time.NewTicker(DefaultTickerInterval),
+		jobLogger:      jobLogger,
+		dequeueTimeout: dequeueTimeout,
 	}
 }